@@ -0,0 +1,128 @@
+package taodbi
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Assign sets the variable pointed to by 'dst' to 'v', a value read from
+// the driver. Numbers are converted between the integer and float types
+// if they fit, and strings to and from []byte. A nil value sets zero, and
+// a pointer variable is allocated. A variable of sql.Scanner, like
+// sql.NullString, scans the value. It is used by the code of gogen.
+//
+func Assign(dst interface{}, v interface{}) error {
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return errors.New("assign to a nil or non-pointer")
+	}
+	target = target.Elem()
+	if scanner, ok := dst.(sql.Scanner); ok {
+		if v == nil || !reflect.TypeOf(v).AssignableTo(target.Type()) {
+			return scanner.Scan(v)
+		}
+	}
+	if v == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	value := reflect.ValueOf(v)
+	if value.Type().AssignableTo(target.Type()) {
+		target.Set(value)
+		return nil
+	}
+	if target.Kind() == reflect.Ptr {
+		p := reflect.New(target.Type().Elem())
+		if err := Assign(p.Interface(), v); err != nil {
+			return err
+		}
+		target.Set(p)
+		return nil
+	}
+
+	fail := fmt.Errorf("can not assign %T %v to %s", v, v, target.Type())
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := signed(value)
+		if !ok || target.OverflowInt(n) {
+			return fail
+		}
+		target.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := signed(value)
+		if !ok || n < 0 || target.OverflowUint(uint64(n)) {
+			if u, isUint := unsigned(value); isUint && !target.OverflowUint(u) {
+				target.SetUint(u)
+				return nil
+			}
+			return fail
+		}
+		target.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		f, ok := float(value)
+		if !ok || target.OverflowFloat(f) {
+			return fail
+		}
+		target.SetFloat(f)
+	case reflect.String:
+		if b, ok := v.([]byte); ok {
+			target.SetString(string(b))
+			return nil
+		}
+		return fail
+	case reflect.Slice:
+		if s, ok := v.(string); ok && target.Type().Elem().Kind() == reflect.Uint8 {
+			target.SetBytes([]byte(s))
+			return nil
+		}
+		return fail
+	default:
+		return fail
+	}
+	return nil
+}
+
+// signed returns an integer value, or a float of an integer, as int64
+func signed(value reflect.Value) (int64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := value.Uint(); u <= math.MaxInt64 {
+			return int64(u), true
+		}
+	case reflect.Float32, reflect.Float64:
+		if f := value.Float(); f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f), true
+		}
+	default:
+	}
+	return 0, false
+}
+
+func unsigned(value reflect.Value) (uint64, bool) {
+	switch value.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return value.Uint(), true
+	default:
+	}
+	return 0, false
+}
+
+func float(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	default:
+	}
+	if n, ok := signed(value); ok {
+		return float64(n), true
+	}
+	if u, ok := unsigned(value); ok {
+		return float64(u), true
+	}
+	return 0, false
+}
@@ -0,0 +1,68 @@
+package taodbi
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestAssign(t *testing.T) {
+	var i8 int8
+	if err := Assign(&i8, int(100)); err != nil || i8 != 100 {
+		t.Errorf("%d %v", i8, err)
+	}
+	if err := Assign(&i8, int64(300)); err == nil {
+		t.Errorf("overflow not checked")
+	}
+	var u uint16
+	if err := Assign(&u, int(-1)); err == nil {
+		t.Errorf("negative not checked")
+	}
+	var f float64
+	if err := Assign(&f, float32(1.5)); err != nil || f != 1.5 {
+		t.Errorf("%v %v", f, err)
+	}
+	var n int64
+	if err := Assign(&n, 2.0); err != nil || n != 2 {
+		t.Errorf("%d %v", n, err)
+	}
+	if err := Assign(&n, 2.5); err == nil {
+		t.Errorf("fraction not checked")
+	}
+	var s string
+	if err := Assign(&s, []byte("abc")); err != nil || s != "abc" {
+		t.Errorf("%q %v", s, err)
+	}
+	if err := Assign(&s, 1); err == nil {
+		t.Errorf("number assigned to string")
+	}
+	var ts time.Time
+	now := time.Now()
+	if err := Assign(&ts, now); err != nil || !ts.Equal(now) {
+		t.Errorf("%v %v", ts, err)
+	}
+	var p *int
+	if err := Assign(&p, int64(7)); err != nil || p == nil || *p != 7 {
+		t.Errorf("%v %v", p, err)
+	}
+	if err := Assign(&p, nil); err != nil || p != nil {
+		t.Errorf("%v %v", p, err)
+	}
+	var ns sql.NullString
+	if err := Assign(&ns, "beijing"); err != nil || !ns.Valid || ns.String != "beijing" {
+		t.Errorf("%v %v", ns, err)
+	}
+	if err := Assign(&ns, nil); err != nil || ns.Valid {
+		t.Errorf("%v %v", ns, err)
+	}
+	var pn *sql.NullInt64
+	if err := Assign(&pn, int64(3)); err != nil || pn == nil || pn.Int64 != 3 {
+		t.Errorf("%v %v", pn, err)
+	}
+	if err := Assign(&ns, []int{1}); err == nil {
+		t.Errorf("scan error not returned")
+	}
+	if err := Assign(s, "x"); err == nil {
+		t.Errorf("non-pointer not checked")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/genelet/taodbi"
+)
+
+// validate checks the connection file, in the format of taodbi.Config
+func validate(c *taodbi.Config) error {
+	if c.DbType == "" {
+		return errors.New("DbType missing")
+	}
+	if c.Create && c.Database == "" {
+		return errors.New("Database to create missing")
+	}
+	switch c.Precision {
+	case "", "ms", "us", "ns":
+	default:
+		return errors.New("invalid Precision " + c.Precision)
+	}
+	return nil
+}
+
+// openDB opens the database of connection file 'filename', overridden
+// by the environment variables. If 'server' is true, it connects
+// without database.
+func openDB(filename string, server bool) (*sql.DB, error) {
+	c, err := taodbi.NewConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(c); err != nil {
+		return nil, err
+	}
+	if server {
+		c.Database = ""
+		c.Create = false
+	}
+	dbi, err := taodbi.Open(*c)
+	if err != nil {
+		return nil, err
+	}
+	return dbi.DB, nil
+}
@@ -0,0 +1,8 @@
+//go:build taos
+// +build taos
+
+package main
+
+// The native driver needs the TDengine C client library,
+// so it is compiled in only with "go build -tags taos".
+import _ "github.com/taosdata/driver-go/taosSql"
@@ -0,0 +1,8 @@
+package main
+
+// The pure-Go drivers are always compiled in: taosRest for a server
+// over REST, and taosLite for local files without a server.
+import (
+	_ "github.com/genelet/taodbi/taoslite"
+	_ "github.com/genelet/taodbi/taosrest"
+)
@@ -0,0 +1,340 @@
+// Command taodbi runs model actions, SQL scripts and validations
+// against TDengine, using the connection file config.json, in the format
+// of taodbi.Config, and model JSON files.
+//
+//	taodbi run [-config config.json] [-format table|json|csv] [-dry-run] [-with other.json] [-extra name=value] model.json action [name=value ...]
+//	taodbi exec [-config config.json] [-server] script.sql ...
+//	taodbi describe [-config config.json] model.json
+//	taodbi validate file.json ...
+//	taodbi generate [-config config.json] [-dir directory]
+//	taodbi gogen [-package models] [-type Name] [-types column=type,...] [-imports name=path,...] [-o file.go] model.json
+//
+// The drivers taosRest and taosLite are compiled in, and the native
+// driver taosSql with "go build -tags taos".
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/genelet/taodbi"
+	"github.com/genelet/taodbi/codegen"
+)
+
+type usageError string
+
+func (self usageError) Error() string {
+	return string(self)
+}
+
+// multiFlag collects a repeated flag
+type multiFlag []string
+
+func (self *multiFlag) String() string {
+	return strings.Join(*self, ",")
+}
+
+func (self *multiFlag) Set(v string) error {
+	*self = append(*self, v)
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "taodbi:", err)
+		var u usageError
+		if errors.As(err, &u) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return usageError("command needed: run, exec, describe, validate, generate or gogen")
+	}
+	switch args[0] {
+	case "run":
+		return cmdRun(args[1:], w)
+	case "exec":
+		return cmdExec(args[1:], w)
+	case "describe":
+		return cmdDescribe(args[1:], w)
+	case "validate":
+		return cmdValidate(args[1:], w)
+	case "generate":
+		return cmdGenerate(args[1:], w)
+	case "gogen":
+		return cmdGogen(args[1:], w)
+	default:
+	}
+	return usageError("unknown command: " + args[0])
+}
+
+func cmdRun(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	config := fs.String("config", "config.json", "connection file")
+	format := fs.String("format", "table", "output format: table, json or csv")
+	dryRun := fs.Bool("dry-run", false, "print the SQL statements as JSON without running them")
+	var with, extras multiFlag
+	fs.Var(&with, "with", "other model file used in nextpages, repeatable")
+	fs.Var(&extras, "extra", "WHERE constraint as name=value, repeatable")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() < 2 {
+		return usageError("run needs a model file and an action")
+	}
+	filename, action := fs.Arg(0), fs.Arg(1)
+
+	model, table, err := loadModel(filename)
+	if err != nil {
+		return err
+	}
+	name := modelName(filename)
+	models := map[string]taodbi.Navigate{name: model}
+	for _, other := range with {
+		m, _, err := loadModel(other)
+		if err != nil {
+			return err
+		}
+		models[modelName(other)] = m
+	}
+
+	input, err := parseArgs(fs.Args()[2:], table)
+	if err != nil {
+		return err
+	}
+	var extra []map[string]interface{}
+	if len(extras) > 0 {
+		one, err := parseArgs(extras, table)
+		if err != nil {
+			return err
+		}
+		extra = append(extra, one)
+	}
+
+	schema := taodbi.NewSchema(models)
+	if *dryRun {
+		recorder := taodbi.NewRecorder(true)
+		schema.SetRecorder(recorder)
+		if _, err := schema.Run(name, action, input, extra...); err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(recorder.Log())
+	}
+
+	db, err := openDB(*config, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	schema.SetDB(db)
+	lists, err := schema.Run(name, action, input, extra...)
+	if err != nil {
+		return err
+	}
+	labels, err := taodbi.ExportLabels(name, model, action)
+	if err != nil {
+		return err
+	}
+	return write(w, *format, labels, lists)
+}
+
+func cmdExec(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("exec", flag.ContinueOnError)
+	config := fs.String("config", "config.json", "connection file")
+	server := fs.Bool("server", false, "connect without database")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() < 1 {
+		return usageError("exec needs SQL script files")
+	}
+
+	db, err := openDB(*config, *server)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dbi := &taodbi.DBI{DB: db}
+
+	for _, filename := range fs.Args() {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		for _, statement := range splitSQL(string(content)) {
+			if err := dbi.DoSQL(statement); err != nil {
+				return fmt.Errorf("%s: %s: %v", filename, statement, err)
+			}
+			fmt.Fprintf(w, "%s: %d affected\n", strings.SplitN(statement, "\n", 2)[0], dbi.Affected)
+		}
+	}
+	return nil
+}
+
+func cmdDescribe(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("describe", flag.ContinueOnError)
+	config := fs.String("config", "config.json", "connection file")
+	format := fs.String("format", "table", "output format: table, json or csv")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() != 1 {
+		return usageError("describe needs a model file")
+	}
+
+	parsed, err := readModelFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	tables := []string{parsed.CurrentTable}
+	if parsed.ProfileTable != nil {
+		tables = append(tables, parsed.ProfileTable.CurrentTable)
+	}
+	if parsed.StatusTable != nil {
+		tables = append(tables, parsed.StatusTable.CurrentTable)
+	}
+
+	db, err := openDB(*config, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dbi := &taodbi.DBI{DB: db}
+
+	for _, table := range tables {
+		lists := make([]map[string]interface{}, 0)
+		if err := dbi.SelectSQL(&lists, "DESCRIBE "+table); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, table)
+		if err := write(w, *format, nil, lists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdValidate(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return usageError("validate needs files")
+	}
+	failed := false
+	for _, filename := range args {
+		problems, err := validateFile(filename)
+		if err != nil {
+			problems = []string{err.Error()}
+		}
+		if len(problems) == 0 {
+			fmt.Fprintln(w, filename+": ok")
+			continue
+		}
+		failed = true
+		for _, problem := range problems {
+			fmt.Fprintln(w, filename+": "+problem)
+		}
+	}
+	if failed {
+		return errors.New("validation failed")
+	}
+	return nil
+}
+
+func cmdGenerate(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	config := fs.String("config", "config.json", "connection file")
+	dir := fs.String("dir", "", "write one model file per table in the directory, instead of the standard output")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+
+	db, err := openDB(*config, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dbi := &taodbi.DBI{DB: db}
+	if _, err := dbi.DetectDialect(); err != nil {
+		return err
+	}
+
+	definitions, err := dbi.Definitions()
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(definitions)
+	}
+	for name, def := range definitions {
+		content, err := json.MarshalIndent(def, "", "  ")
+		if err != nil {
+			return err
+		}
+		filename := filepath.Join(*dir, name+".json")
+		if err := ioutil.WriteFile(filename, append(content, '\n'), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, filename)
+	}
+	return nil
+}
+
+func cmdGogen(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("gogen", flag.ContinueOnError)
+	pkg := fs.String("package", "models", "package name")
+	typ := fs.String("type", "", "row type name, default to the camel-cased file name")
+	types := fs.String("types", "", "Go types of columns as column=type, comma-separated")
+	paths := fs.String("imports", "", "import paths of packages in types as name=path, comma-separated")
+	output := fs.String("o", "", "output file, instead of the standard output")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() != 1 {
+		return usageError("gogen needs a model file")
+	}
+
+	opts := &codegen.Options{Package: *pkg, Type: *typ, Types: make(map[string]string), Imports: make(map[string]string)}
+	for _, option := range []struct {
+		value string
+		hash  map[string]string
+	}{{*types, opts.Types}, {*paths, opts.Imports}} {
+		if option.value == "" {
+			continue
+		}
+		for _, pair := range strings.Split(option.value, ",") {
+			i := strings.Index(pair, "=")
+			if i <= 0 {
+				return usageError("not in name=value: " + pair)
+			}
+			option.hash[pair[:i]] = pair[i+1:]
+		}
+	}
+
+	if *output == "" {
+		return codegen.Generate(w, fs.Arg(0), opts)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := codegen.Generate(f, fs.Arg(0), opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
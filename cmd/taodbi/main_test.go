@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/genelet/taodbi"
+	_ "github.com/genelet/taodbi/taodbitest"
+)
+
+func TestRunDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	if err := run([]string{"run", "-dry-run", "-extra", "x=a", "../../m1.json", "topics"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var log []taodbi.Statement
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 || log[0].Query != "SELECT id, x, y, z\nFROM atesting\nWHERE (x=?)\nORDER BY id" ||
+		len(log[0].Args) != 1 || log[0].Args[0] != "a" {
+		t.Errorf("%s", buf.String())
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	script := filepath.Join(dir, "atesting.sql")
+	files := map[string]string{
+		config: `{"DbType":"taodbitest", "User":"root", "Password":"taosdata", "Host":"127.0.0.1", "Database":"clidb", "Create":true, "Params":{"parseTime":"false"}}`,
+		script: "DROP TABLE IF EXISTS atesting;\nCREATE TABLE atesting (id timestamp, x binary(8), y binary(8), z binary(8));\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := run([]string{"exec", "-config", config, script}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []string{"a", "b"} {
+		if err := run([]string{"run", "-config", config, "../../m1.json", "insert", "x=" + x, "z=" + x + x}, &buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.Reset()
+	if err := run([]string{"run", "-config", config, "-format", "csv", "../../m1.json", "topics"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || lines[0] != "id,x,y,z" || !strings.HasSuffix(lines[1], ",a,,aa") || !strings.HasSuffix(lines[2], ",b,,bb") {
+		t.Errorf("%q", buf.String())
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/genelet/taodbi"
+)
+
+// kind tells which model type a JSON file describes:
+// "rmodel" if it has profile_table, "smodel" if it has tags, or "model"
+func kind(content []byte) (string, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return "", err
+	}
+	if _, ok := raw["profile_table"]; ok {
+		return "rmodel", nil
+	}
+	if _, ok := raw["tags"]; ok {
+		return "smodel", nil
+	}
+	return "model", nil
+}
+
+// modelName is the file name without directory and extension,
+// which is the name used in nextpages
+func modelName(filename string) string {
+	base := filepath.Base(filename)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+type action func(...map[string]interface{}) error
+
+// loadModel reads a model file and assigns all its actions by lower-cased names.
+// It returns the model and its Table for output and validation.
+func loadModel(filename string) (taodbi.Navigate, *taodbi.Table, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	k, err := kind(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch k {
+	case "rmodel":
+		m, err := taodbi.NewRmodel(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		m.Actions = map[string]func(...map[string]interface{}) error{
+			"topics": m.Topics,
+			"edit":   m.Edit,
+			"insert": m.Insert,
+			"insupd": m.Insupd,
+			"update": m.Update,
+			"delete": m.Delete,
+		}
+		return m, &m.Table, nil
+	case "smodel":
+		m, err := taodbi.NewSmodel(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		m.Actions = map[string]func(...map[string]interface{}) error{
+			"topics":        m.Topics,
+			"edit":          m.Edit,
+			"editfk":        m.EditFK,
+			"insert":        m.Insert,
+			"insupd":        m.Insupd,
+			"lasttopics":    m.LastTopics,
+			"lastedit":      m.LastEdit,
+			"releasetopics": m.ReleaseTopics,
+			"createtable":   m.CreateTable,
+			"droptable":     m.DropTable,
+		}
+		return m, &m.Table, nil
+	default:
+	}
+
+	m, err := taodbi.NewModel(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.Actions = map[string]func(...map[string]interface{}) error{
+		"topics": m.Topics,
+		"edit":   m.Edit,
+		"editfk": m.EditFK,
+		"insert": m.Insert,
+		"insupd": m.Insupd,
+	}
+	return m, &m.Table, nil
+}
+
+// parseValue converts a command-line string into int, float64, bool or string
+func parseValue(v string) interface{} {
+	if i, err := strconv.Atoi(v); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(v); err == nil && (v == "true" || v == "false") {
+		return b
+	}
+	return v
+}
+
+// parseArgs turns name=value pairs into args for the model.
+// Fields and empties are comma-separated lists, and passid is int64,
+// as the models expect.
+func parseArgs(pairs []string, table *taodbi.Table) (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	for _, pair := range pairs {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, usageError("argument not in name=value: " + pair)
+		}
+		k, v := pair[:i], pair[i+1:]
+		switch k {
+		case table.Fields, table.Empties:
+			args[k] = strings.Split(v, ",")
+		case table.Passid:
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			args[k] = id
+		default:
+			args[k] = parseValue(v)
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/genelet/taodbi"
+)
+
+func TestLoadModel(t *testing.T) {
+	for file, want := range map[string]string{"../../rest.json": "rmodel", "../../ms.json": "smodel", "../../m1.json": "model"} {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k, _ := kind(content); k != want {
+			t.Errorf("%s: %s wanted, got %s", file, want, k)
+		}
+		m, table, err := loadModel(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.GetAction("topics") == nil || table.CurrentTable == "" {
+			t.Errorf("%s: %#v", file, table)
+		}
+	}
+	if modelName("/tmp/rest.json") != "rest" {
+		t.Errorf("rest wanted, got %s", modelName("/tmp/rest.json"))
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	table := &taodbi.Table{Fields: "fields", Empties: "empties", Passid: "passid"}
+	args, err := parseArgs([]string{"rowcount=20", "x=a1234567", "fv=1.5", "flag=true", "fields=id,x", "passid=1597730628049379"}, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args["rowcount"].(int) != 20 ||
+		args["x"].(string) != "a1234567" ||
+		args["fv"].(float64) != 1.5 ||
+		args["flag"].(bool) != true ||
+		len(args["fields"].([]string)) != 2 ||
+		args["passid"].(int64) != 1597730628049379 {
+		t.Errorf("%#v", args)
+	}
+	if _, err := parseArgs([]string{"rowcount"}, table); err == nil {
+		t.Errorf("error wanted for missing =")
+	}
+}
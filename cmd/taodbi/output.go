@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/genelet/taodbi"
+)
+
+func writeJSON(w io.Writer, lists []map[string]interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(lists)
+}
+
+// writeTable aligns the rows of the CSV export in columns
+func writeTable(w io.Writer, labels []string, lists []map[string]interface{}) error {
+	var b bytes.Buffer
+	if err := taodbi.ExportLists(&b, taodbi.FormatCSV, labels, lists); err != nil {
+		return err
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, record := range records {
+		fmt.Fprintln(tw, strings.Join(record, "\t"))
+	}
+	return tw.Flush()
+}
+
+// write outputs lists in format "table", "json" or "csv", with the
+// columns in 'labels' first, as in taodbi.ExportLists
+func write(w io.Writer, format string, labels []string, lists []map[string]interface{}) error {
+	switch format {
+	case "json":
+		return writeJSON(w, lists)
+	case "csv":
+		return taodbi.ExportLists(w, taodbi.FormatCSV, labels, lists)
+	case "table", "":
+		return writeTable(w, labels, lists)
+	default:
+	}
+	return usageError("unknown format: " + format)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/genelet/taodbi"
+)
+
+func TestWrite(t *testing.T) {
+	lists := []map[string]interface{}{
+		{"id": 1, "x": "a,b"},
+		{"id": 2, "y": "c", "testing_topics": []map[string]interface{}{{"child": "john"}}},
+	}
+
+	var buf bytes.Buffer
+	if err := write(&buf, "csv", nil, lists); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 ||
+		lines[0] != "id,testing_topics,x,y" ||
+		lines[1] != `1,,"a,b",` ||
+		lines[2] != `2,"[{""child"":""john""}]",,c` {
+		t.Errorf("%#v", lines)
+	}
+
+	buf.Reset()
+	if err := write(&buf, "csv", []string{"y", "x", "id", "none"}, lists); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "y,x,id,none,testing_topics\n") {
+		t.Errorf("%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := write(&buf, "json", nil, lists); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"child": "john"`) {
+		t.Errorf("%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := write(&buf, "table", nil, lists); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "id  testing_topics") {
+		t.Errorf("%s", buf.String())
+	}
+
+	if err := write(&buf, "xml", nil, lists); err == nil {
+		t.Errorf("error wanted for unknown format")
+	}
+}
+
+func TestOrder(t *testing.T) {
+	m, _, err := loadModel("../../rest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := taodbi.ExportLabels("rest", m, "topics"); err != nil || strings.Join(got, ",") != "ts,id,username,firstname,lastname" {
+		t.Errorf("%v %v", got, err)
+	}
+	if got, err := taodbi.ExportLabels("rest", m, "edit"); err != nil || len(got) != 11 || got[10] != "email" {
+		t.Errorf("%v %v", got, err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+)
+
+// splitSQL splits a script into statements by semicolons,
+// ignoring those in quoted strings and "--" comments.
+func splitSQL(script string) []string {
+	statements := make([]string, 0)
+	var current strings.Builder
+	var quote rune
+	comment := false
+	for _, r := range script {
+		switch {
+		case comment:
+			if r == '\n' {
+				comment = false
+				current.WriteRune(r)
+			}
+			continue
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '-' && strings.HasSuffix(current.String(), "-"):
+			s := current.String()
+			current.Reset()
+			current.WriteString(s[:len(s)-1])
+			comment = true
+			continue
+		case r == ';':
+			if s := strings.TrimSpace(current.String()); s != "" {
+				statements = append(statements, s)
+			}
+			current.Reset()
+			continue
+		default:
+		}
+		current.WriteRune(r)
+	}
+	if s := strings.TrimSpace(current.String()); s != "" {
+		statements = append(statements, s)
+	}
+	return statements
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestSplitSQL(t *testing.T) {
+	statements := splitSQL(`-- setup; comment
+drop table if exists a;
+insert into a values (now, 'x;y', "--z");
+create table b (ts timestamp)`)
+	if len(statements) != 3 {
+		t.Fatalf("%#v", statements)
+	}
+	if statements[0] != "drop table if exists a" ||
+		statements[1] != `insert into a values (now, 'x;y', "--z")` ||
+		statements[2] != "create table b (ts timestamp)" {
+		t.Errorf("%#v", statements)
+	}
+
+	content, err := ioutil.ReadFile("../../m2.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(splitSQL(string(content))); n != 6 {
+		t.Errorf("6 statements wanted in m2.sql, got %d", n)
+	}
+}
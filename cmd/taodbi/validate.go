@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/genelet/taodbi"
+)
+
+// modelFile is the union of all model JSON structures
+type modelFile struct {
+	taodbi.Table
+	Tags         []string      `json:"tags,omitempty"`
+	ProfileTable *taodbi.Table `json:"profile_table,omitempty"`
+	StatusTable  *taodbi.Table `json:"status_table,omitempty"`
+}
+
+func readModelFile(filename string) (*modelFile, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	parsed := new(modelFile)
+	if err := json.Unmarshal(content, parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// checkTable reports problems of a single table definition
+func checkTable(name string, t *taodbi.Table) []string {
+	var problems []string
+	if t.CurrentTable == "" {
+		problems = append(problems, name+": current_table missing")
+	}
+	if t.CurrentKey == "" {
+		problems = append(problems, name+": current_key missing")
+	}
+	for _, v := range append(t.TopicsPars, t.EditPars...) {
+		switch u := v.(type) {
+		case string:
+		case []interface{}:
+			if len(u) != 2 {
+				problems = append(problems, fmt.Sprintf("%s: %v should be [name, type]", name, u))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("%s: wrong column %v", name, u))
+		}
+	}
+	for action, pages := range t.Nextpages {
+		for _, page := range pages {
+			if page.Model == "" || page.Action == "" {
+				problems = append(problems, name+": nextpage of "+action+" needs model and action")
+			}
+			if page.Mode != "" && page.Mode != "embed" && page.Mode != "merge" {
+				problems = append(problems, name+": unknown mode "+page.Mode+" in nextpage of "+action)
+			}
+		}
+	}
+	return problems
+}
+
+// validateModel reports problems found in a model file
+func validateModel(filename string) ([]string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	k, err := kind(content)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := readModelFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := checkTable(k, &parsed.Table)
+	switch k {
+	case "rmodel":
+		if parsed.StatusTable == nil {
+			problems = append(problems, "rmodel: status_table missing")
+		} else {
+			problems = append(problems, checkTable("status_table", parsed.StatusTable)...)
+			if parsed.StatusTable.ForeignKey == "" {
+				problems = append(problems, "status_table: foreign_key missing")
+			}
+		}
+		if parsed.ProfileTable == nil {
+			problems = append(problems, "rmodel: profile_table missing")
+		} else {
+			problems = append(problems, checkTable("profile_table", parsed.ProfileTable)...)
+			if parsed.ProfileTable.ForeignKey == "" {
+				problems = append(problems, "profile_table: foreign_key missing")
+			}
+		}
+	case "smodel":
+		if len(parsed.Tags) == 0 {
+			problems = append(problems, "smodel: tags empty")
+		}
+		for _, tag := range parsed.Tags {
+			found := false
+			for _, v := range parsed.InsertPars {
+				if v == tag {
+					found = true
+				}
+			}
+			if !found {
+				problems = append(problems, "smodel: tag "+tag+" not in insert_pars")
+			}
+		}
+	default:
+	}
+	return problems, nil
+}
+
+// validateFile validates a connection file, if it has DbType,
+// or otherwise a model file
+func validateFile(filename string) ([]string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	if _, ok := raw["DbType"]; !ok {
+		return validateModel(filename)
+	}
+	c, err := taodbi.NewConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(c); err != nil {
+		return []string{"config: " + err.Error()}, nil
+	}
+	return nil, nil
+}
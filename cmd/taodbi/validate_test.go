@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var buf bytes.Buffer
+	files := []string{"../../config.json", "../../rest.json", "../../ms.json", "../../m2.json", "../../m22.json"}
+	if err := run(append([]string{"validate"}, files...), &buf); err != nil {
+		t.Errorf("%v: %s", err, buf.String())
+	}
+
+	dir, err := ioutil.TempDir("", "taodbi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bad := filepath.Join(dir, "bad.json")
+	content := `{"current_table":"s","tags":["pubid"],"insert_pars":["x"],
+"nextpages":{"topics":[{"model":"t","action":"topics","mode":"flat"}]}}`
+	if err := ioutil.WriteFile(bad, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := run([]string{"validate", bad}, &buf); err == nil {
+		t.Errorf("validation error wanted")
+	}
+	out := buf.String()
+	for _, problem := range []string{"current_key missing", "tag pubid not in insert_pars", "unknown mode flat"} {
+		if !strings.Contains(out, problem) {
+			t.Errorf("%s wanted in %s", problem, out)
+		}
+	}
+
+	conn := filepath.Join(dir, "conn.json")
+	if err := ioutil.WriteFile(conn, []byte(`{"DbType":"taosSql", "Database":"d", "Precision":"s"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := run([]string{"validate", conn}, &buf); err == nil || !strings.Contains(buf.String(), "invalid Precision s") {
+		t.Errorf("%v: %s", err, buf.String())
+	}
+}
@@ -0,0 +1,443 @@
+// Package codegen generates typed Go wrappers of taodbi models from their JSON files,
+// so that column names are checked at compile time.
+//
+// For a model, it writes a row struct with a field for every column in
+// insert_pars, edit_pars and topics_pars (or edit_hash and topics_hash labels),
+// and a wrapper type with Insert(row), Topics(filter) and Edit(id) on top of
+// taodbi's Model, Rmodel or Smodel. Field types come from the [name, type]
+// columns in JSON, or Types in Options; otherwise they are interface{}.
+// Types of other packages, like time.Time, are imported; values read are
+// converted to the field types by taodbi.Assign.
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/genelet/taodbi"
+)
+
+// Options controls the generated code
+type Options struct {
+	// Package: the package name, default to "models"
+	Package string
+	// Type: the row type name, default to the camel-cased file name
+	Type string
+	// Source: the model file name mentioned in the header
+	Source string
+	// Types: Go types of columns, overriding those in JSON
+	Types map[string]string
+	// Imports: import paths of the packages in Types, by their names,
+	// other than the standard ones like time and encoding/json
+	Imports map[string]string
+}
+
+// standard are the import paths of standard packages by their names
+var standard = map[string]string{
+	"big":  "math/big",
+	"json": "encoding/json",
+	"net":  "net",
+	"sql":  "database/sql",
+	"time": "time",
+	"url":  "net/url",
+}
+
+// basic are the predeclared types compared with zero literals
+var basic = map[string]string{
+	"bool": "false", "string": `""`,
+	"int": "0", "int8": "0", "int16": "0", "int32": "0", "int64": "0",
+	"uint": "0", "uint8": "0", "uint16": "0", "uint32": "0", "uint64": "0", "uintptr": "0",
+	"float32": "0", "float64": "0", "complex64": "0", "complex128": "0", "byte": "0", "rune": "0",
+}
+
+type field struct {
+	Name   string
+	Column string
+	Type   string
+	Insert bool
+	// zero: the zero literal, "nil", or empty to use reflect
+	zero string
+}
+
+type data struct {
+	Package string
+	Source  string
+	Type    string
+	Kind    string
+	Key     string
+	Imports []string
+	Fields  []*field
+}
+
+// Generate writes the wrapper of the model defined in JSON file 'filename'
+func Generate(w io.Writer, filename string, opts *Options) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	def := new(taodbi.Definition)
+	if err := json.Unmarshal(content, def); err != nil {
+		return err
+	}
+	if opts == nil {
+		opts = new(Options)
+	}
+	if opts.Source == "" {
+		opts.Source = filepath.Base(filename)
+	}
+	if opts.Type == "" {
+		base := filepath.Base(filename)
+		opts.Type = camel(strings.TrimSuffix(base, filepath.Ext(base)))
+	}
+	return GenerateDefinition(w, def, opts)
+}
+
+// GenerateDefinition writes the wrapper of a model definition
+func GenerateDefinition(w io.Writer, def *taodbi.Definition, opts *Options) error {
+	if opts == nil || opts.Type == "" {
+		return errors.New("type name needed")
+	}
+	d := &data{Package: opts.Package, Source: opts.Source, Type: opts.Type, Kind: "Model", Key: def.CurrentKey}
+	if d.Package == "" {
+		d.Package = "models"
+	}
+
+	table := &def.Table
+	if def.ProfileTable != nil {
+		d.Kind = "Rmodel"
+		table = def.ProfileTable
+	} else if len(def.Tags) > 0 {
+		d.Kind = "Smodel"
+	}
+	if d.Key == "" {
+		return errors.New("current_key missing")
+	}
+
+	fields, err := collect(d.Key, table, opts.Types)
+	if err != nil {
+		return err
+	}
+	d.Fields = fields
+	if d.Imports, err = imports(fields, opts.Imports); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, d); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// collect returns fields in order of the key, insert_pars and then other columns
+func collect(key string, table *taodbi.Table, types map[string]string) ([]*field, error) {
+	columns := []string{key}
+	found := map[string]string{key: ""}
+	add := func(column, typ string) {
+		if _, ok := found[column]; !ok {
+			columns = append(columns, column)
+			found[column] = typ
+		} else if typ != "" {
+			found[column] = typ
+		}
+	}
+	for _, column := range table.InsertPars {
+		add(column, "")
+	}
+	for _, pars := range [][]interface{}{table.EditPars, table.TopicsPars} {
+		for _, v := range pars {
+			switch u := v.(type) {
+			case string:
+				add(u, "")
+			case []interface{}:
+				name, typ, err := pair(u)
+				if err != nil {
+					return nil, err
+				}
+				add(name, typ)
+			default:
+			}
+		}
+	}
+	for _, hash := range []map[string]interface{}{table.EditHash, table.TopicsHash} {
+		keys := make([]string, 0)
+		for k := range hash {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			switch u := hash[k].(type) {
+			case string:
+				add(u, "")
+			case []interface{}:
+				label, typ, err := pair(u)
+				if err != nil {
+					return nil, err
+				}
+				add(label, typ)
+			default:
+			}
+		}
+	}
+
+	fields := make([]*field, 0)
+	names := make(map[string]bool)
+	for _, column := range columns {
+		typ := found[column]
+		if t, ok := types[column]; ok {
+			typ = t
+		}
+		if typ == "" {
+			typ = "interface{}"
+		}
+		zero, err := zeroOf(typ)
+		if err != nil {
+			return nil, fmt.Errorf("type of %s: %v", column, err)
+		}
+		name := camel(column)
+		for names[name] {
+			name += "_"
+		}
+		names[name] = true
+		insert := false
+		for _, v := range table.InsertPars {
+			if v == column {
+				insert = true
+			}
+		}
+		fields = append(fields, &field{Name: name, Column: column, Type: typ, Insert: insert, zero: zero})
+	}
+	return fields, nil
+}
+
+// pair returns the name and type of a column in [name, type]
+func pair(u []interface{}) (string, string, error) {
+	if len(u) == 2 {
+		name, ok1 := u[0].(string)
+		typ, ok2 := u[1].(string)
+		if ok1 && ok2 {
+			return name, typ, nil
+		}
+	}
+	return "", "", fmt.Errorf("column should be [name, type] of strings: %v", u)
+}
+
+// camel turns a column name like "first_name" into "FirstName"
+func camel(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	s := b.String()
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		s = "X" + s
+	}
+	return s
+}
+
+// zeroOf returns the zero of type 'typ' for comparison: a literal of
+// the basic types, nil of the nillable types, or empty for the others
+func zeroOf(typ string) (string, error) {
+	expr, err := parser.ParseExpr(typ)
+	if err != nil {
+		return "", err
+	}
+	switch u := expr.(type) {
+	case *ast.Ident:
+		if zero, ok := basic[u.Name]; ok {
+			return zero, nil
+		}
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return "nil", nil
+	case *ast.ArrayType:
+		if u.Len == nil {
+			return "nil", nil
+		}
+	default:
+	}
+	return "", nil
+}
+
+// imports returns the import specs of the generated code and the types
+// of 'fields', finding the packages in 'paths' or the standard ones
+func imports(fields []*field, paths map[string]string) ([]string, error) {
+	found := map[string]bool{`"github.com/genelet/taodbi"`: true}
+	var err error
+	for _, f := range fields {
+		if f.Type != "interface{}" {
+			found[`"fmt"`] = true
+		}
+		if f.zero == "" {
+			found[`"reflect"`] = true
+		}
+		expr, _ := parser.ParseExpr(f.Type)
+		ast.Inspect(expr, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if pkg, ok := sel.X.(*ast.Ident); ok {
+				path, ok := paths[pkg.Name]
+				if !ok {
+					path, ok = standard[pkg.Name]
+				}
+				switch {
+				case ok && path[strings.LastIndex(path, "/")+1:] == pkg.Name:
+					found[`"`+path+`"`] = true
+				case ok:
+					found[pkg.Name+` "`+path+`"`] = true
+				case err == nil:
+					err = fmt.Errorf("import path of package %s in %s unknown", pkg.Name, f.Type)
+				}
+			}
+			return false
+		})
+	}
+	list := make([]string, 0)
+	for path := range found {
+		list = append(list, path)
+	}
+	sort.Strings(list)
+	return list, err
+}
+
+// IsSet returns the condition of the field being non-zero
+func (self *field) IsSet() string {
+	if self.zero == "" {
+		return "!reflect.ValueOf(self." + self.Name + ").IsZero()"
+	}
+	return "self." + self.Name + " != " + self.zero
+}
+
+var tmpl = template.Must(template.New("wrapper").Parse(`// Code generated by taodbi gogen{{if .Source}} from {{.Source}}{{end}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+
+// {{.Type}} is a row of the model.
+type {{.Type}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}} ` + "`json:\"{{.Column}},omitempty\"`" + `
+{{- end}}
+}
+
+// toMap returns the non-zero fields, restricted to insert_pars if insert is true.
+func (self *{{.Type}}) toMap(insert bool) map[string]interface{} {
+	hash := make(map[string]interface{})
+{{- range .Fields}}
+	if {{if not .Insert}}!insert && {{end}}{{.IsSet}} {
+		hash["{{.Column}}"] = self.{{.Name}}
+	}
+{{- end}}
+	return hash
+}
+
+// new{{.Type}} converts a row read to the field types.
+func new{{.Type}}(item map[string]interface{}) (*{{.Type}}, error) {
+	self := new({{.Type}})
+{{- range .Fields}}
+{{- if eq .Type "interface{}"}}
+	self.{{.Name}} = item["{{.Column}}"]
+{{- else}}
+	if err := taodbi.Assign(&self.{{.Name}}, item["{{.Column}}"]); err != nil {
+		return nil, fmt.Errorf("column {{.Column}}: %w", err)
+	}
+{{- end}}
+{{- end}}
+	return self, nil
+}
+
+// {{.Type}}Model wraps taodbi.{{.Kind}} with typed rows.
+type {{.Type}}Model struct {
+	*taodbi.{{.Kind}}
+}
+
+// New{{.Type}}Model creates the model from its JSON file.
+func New{{.Type}}Model(filename string) (*{{.Type}}Model, error) {
+	m, err := taodbi.New{{.Kind}}(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &{{.Type}}Model{m}, nil
+}
+
+// Insert inserts row, and returns it with the new key.
+func (self *{{.Type}}Model) Insert(row *{{.Type}}) (*{{.Type}}, error) {
+	self.SetArgs(row.toMap(true))
+	if err := self.{{.Kind}}.Insert(); err != nil {
+		return nil, err
+	}
+	lists := self.GetLists()
+	if len(lists) == 0 {
+		return nil, nil
+	}
+	return new{{.Type}}(lists[0])
+}
+
+// Topics selects rows, constrained by the non-zero fields in filter.
+// Pagination and other input data are set by SetArgs beforehand.
+func (self *{{.Type}}Model) Topics(filter *{{.Type}}) ([]*{{.Type}}, error) {
+	var extra []map[string]interface{}
+	if filter != nil {
+		if hash := filter.toMap(false); len(hash) > 0 {
+			extra = append(extra, hash)
+		}
+	}
+	if err := self.{{.Kind}}.Topics(extra...); err != nil {
+		return nil, err
+	}
+	rows := make([]*{{.Type}}, 0)
+	for _, item := range self.GetLists() {
+		row, err := new{{.Type}}(item)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Edit selects the row of key {{.Key}}, or returns nil if not found.
+func (self *{{.Type}}Model) Edit(id interface{}) (*{{.Type}}, error) {
+	self.SetArgs(map[string]interface{}{"{{.Key}}": id})
+	if err := self.{{.Kind}}.Edit(); err != nil {
+		return nil, err
+	}
+	lists := self.GetLists()
+	if len(lists) == 0 {
+		return nil, nil
+	}
+	return new{{.Type}}(lists[0])
+}
+`))
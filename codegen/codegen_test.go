@@ -0,0 +1,172 @@
+package codegen
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	for file, kind := range map[string]string{"../rest.json": "Rmodel", "../ms.json": "Smodel", "../m1.json": "Model"} {
+		var buf bytes.Buffer
+		opts := &Options{Package: "models", Types: map[string]string{"gender": "bool", "x": "string"}}
+		if err := Generate(&buf, file, opts); err != nil {
+			t.Fatal(err)
+		}
+		src := buf.String()
+		if _, err := parser.ParseFile(token.NewFileSet(), "gen.go", src, 0); err != nil {
+			t.Fatalf("%s: %v\n%s", file, err, src)
+		}
+		if !strings.Contains(src, "*taodbi."+kind+"\n") {
+			t.Errorf("%s: %s wanted\n%s", file, kind, src)
+		}
+		for _, method := range []string{") Insert(row *", ") Topics(filter *", ") Edit(id interface{})"} {
+			if !strings.Contains(src, method) {
+				t.Errorf("%s: %s wanted", file, method)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Generate(&buf, "../rest.json", &Options{Type: "User", Types: map[string]string{"gender": "bool"}}); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	for _, line := range []string{
+		"package models",
+		"type UserModel struct",
+		"Firstname interface{} `json:\"firstname,omitempty\"`",
+		"Gender    bool        `json:\"gender,omitempty\"`",
+		`if err := taodbi.Assign(&self.Gender, item["gender"]); err != nil {`,
+		`if self.Gender != false {`,
+		`self.SetArgs(map[string]interface{}{"id": id})`,
+	} {
+		if !strings.Contains(src, line) {
+			t.Errorf("%s wanted\n%s", line, src)
+		}
+	}
+}
+
+func TestCamel(t *testing.T) {
+	for name, want := range map[string]string{"first_name": "FirstName", "id": "Id", "2x": "X2x", "a-b c": "ABC"} {
+		if got := camel(name); got != want {
+			t.Errorf("%s: %s wanted, got %s", name, want, got)
+		}
+	}
+}
+
+// build compiles the code generated of 'files' in a module requiring
+// this repository
+func build(t *testing.T, files map[string]string) {
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := ioutil.ReadFile(filepath.Join(root, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files["go.mod"] = "module example.com/gen\n\ngo 1.21\n\nrequire github.com/genelet/taodbi v0.0.0\n\nreplace github.com/genelet/taodbi => " + root + "\n"
+	files["go.sum"] = string(sum)
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, command := range []string{"vet", "test"} {
+		cmd := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), command, "./...")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+	}
+}
+
+// rowsTest runs the generated constructors on rows as read from the driver
+const rowsTest = `package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRows(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+	sensor, err := newSensor(map[string]interface{}{"id": ts, "x": "a", "z": "{}", "pubid": int64(333), "location": "beijing"})
+	if err != nil || !sensor.Id.Equal(ts) || sensor.X != "a" || string(sensor.Z) != "{}" || sensor.Pubid != 333 || !sensor.Location.Valid || sensor.Location.String != "beijing" {
+		t.Errorf("%v %v", sensor, err)
+	}
+	if sensor, err = newSensor(map[string]interface{}{"id": ts, "location": nil}); err != nil || sensor.Location.Valid {
+		t.Errorf("%v %v", sensor, err)
+	}
+	user, err := newUser(map[string]interface{}{"ts": ts, "id": int64(1), "gender": true, "province": int64(9), "email": "e@x"})
+	if err != nil || user.Id != 1 || !user.Gender || user.Province == nil || *user.Province != 9 || string(user.Email) != "e@x" {
+		t.Errorf("%v %v", user, err)
+	}
+	point, err := newPoint(map[string]interface{}{"id": int64(1600000000000000), "x": []byte("a")})
+	if err != nil || point.Id != 1600000000000000 || point.X != "a" {
+		t.Errorf("%v %v", point, err)
+	}
+}
+`
+
+func TestGenerateBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a module")
+	}
+	files := make(map[string]string)
+	for file, opts := range map[string]*Options{
+		"../rest.json": {Type: "User", Types: map[string]string{"ts": "time.Time", "id": "int64", "gender": "bool", "province": "*int8", "email": "[]byte"}},
+		"../ms.json":   {Type: "Sensor", Types: map[string]string{"id": "time.Time", "pubid": "int", "location": "sql.NullString", "z": "json.RawMessage"}},
+		"../m1.json":   {Type: "Point", Types: map[string]string{"id": "int64", "x": "string", "y": "[2]byte", "z": "uuid.UUID"}, Imports: map[string]string{"uuid": "example.com/gen/uuid"}},
+	} {
+		var buf bytes.Buffer
+		if err := Generate(&buf, file, opts); err != nil {
+			t.Fatal(err)
+		}
+		files["models/"+strings.ToLower(opts.Type)+".go"] = buf.String()
+	}
+	files["uuid/uuid.go"] = "package uuid\n\ntype UUID struct{ a, b uint64 }\n"
+	files["models/models_test.go"] = rowsTest
+	build(t, files)
+
+	if err := Generate(new(bytes.Buffer), "../m1.json", &Options{Types: map[string]string{"z": "uuid.UUID"}}); err == nil {
+		t.Errorf("unknown package not checked")
+	}
+	if err := Generate(new(bytes.Buffer), "../m1.json", &Options{Types: map[string]string{"z": "map[string"}}); err == nil {
+		t.Errorf("invalid type not checked")
+	}
+}
+
+func TestIsSet(t *testing.T) {
+	for typ, want := range map[string]string{
+		"int8":        "self.X != 0",
+		"string":      `self.X != ""`,
+		"*int":        "self.X != nil",
+		"[]byte":      "self.X != nil",
+		"interface{}": "self.X != nil",
+		"time.Time":   "!reflect.ValueOf(self.X).IsZero()",
+		"[2]int":      "!reflect.ValueOf(self.X).IsZero()",
+	} {
+		zero, err := zeroOf(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := &field{Name: "X", Type: typ, zero: zero}
+		if got := f.IsSet(); got != want {
+			t.Errorf("%s: %s", typ, got)
+		}
+	}
+}
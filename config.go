@@ -0,0 +1,220 @@
+package taodbi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is time.Duration in JSON as a string like "30s",
+// or a number of seconds.
+//
+type Duration time.Duration
+
+func (self *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var seconds float64
+		if err := json.Unmarshal(data, &seconds); err != nil {
+			return err
+		}
+		*self = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*self = Duration(d)
+	return nil
+}
+
+func (self Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(self).String())
+}
+
+// Config describes the connection to TDengine.
+// Dsn, if given, is used as it is instead of the components.
+//
+type Config struct {
+	// DbType: the driver name, default "taosSql"
+	DbType   string            `json:"DbType"`
+	Dsn      string            `json:"Dsn,omitempty"`
+	User     string            `json:"User,omitempty"`
+	Password string            `json:"Password,omitempty"`
+	Protocol string            `json:"Protocol,omitempty"`
+	Host     string            `json:"Host,omitempty"`
+	Port     int               `json:"Port,omitempty"`
+	Params   map[string]string `json:"Params,omitempty"`
+	// Database: optional, the database to USE
+	Database string `json:"Database,omitempty"`
+	// Create: create Database if it does not exist, in Precision
+	Create    bool   `json:"Create,omitempty"`
+	Precision string `json:"Precision,omitempty"`
+
+	MaxOpenConns    int      `json:"MaxOpenConns,omitempty"`
+	MaxIdleConns    int      `json:"MaxIdleConns,omitempty"`
+	ConnMaxLifetime Duration `json:"ConnMaxLifetime,omitempty"`
+	ConnMaxIdleTime Duration `json:"ConnMaxIdleTime,omitempty"`
+	// PingTimeout: the time to wait for ping in Open, default 5s
+	PingTimeout Duration `json:"PingTimeout,omitempty"`
+}
+
+// EnvPrefix is the prefix of environment variables overriding Config
+var EnvPrefix = "TAODBI_"
+
+// NewConfig creates a Config from json file 'filename',
+// overridden by environment variables.
+func NewConfig(filename string) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	parsed := new(Config)
+	if err := json.Unmarshal(content, parsed); err != nil {
+		return nil, err
+	}
+	return parsed, parsed.LoadEnv()
+}
+
+// LoadEnv overrides the fields by environment variables EnvPrefix plus
+// DBTYPE, DSN, USER, PASSWORD, PROTOCOL, HOST, PORT, DATABASE or PRECISION.
+func (self *Config) LoadEnv() error {
+	for name, field := range map[string]*string{
+		"DBTYPE":    &self.DbType,
+		"DSN":       &self.Dsn,
+		"USER":      &self.User,
+		"PASSWORD":  &self.Password,
+		"PROTOCOL":  &self.Protocol,
+		"HOST":      &self.Host,
+		"DATABASE":  &self.Database,
+		"PRECISION": &self.Precision,
+	} {
+		if v, ok := os.LookupEnv(EnvPrefix + name); ok {
+			*field = v
+		}
+	}
+	if v, ok := os.LookupEnv(EnvPrefix + "PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.New("invalid port " + v)
+		}
+		self.Port = port
+	}
+	return nil
+}
+
+// DSN returns the data source name with 'database', as
+// user:password@/protocol(host:port)/database?params
+func (self *Config) DSN(database string) string {
+	if self.Dsn != "" {
+		return self.Dsn
+	}
+	dsn := self.User
+	if self.Password != "" {
+		dsn += ":" + self.Password
+	}
+	if dsn != "" {
+		dsn += "@"
+	}
+	protocol := self.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	dsn += "/" + protocol + "(" + self.Host
+	if self.Port != 0 {
+		dsn += ":" + strconv.Itoa(self.Port)
+	}
+	dsn += ")/" + database
+	if len(self.Params) > 0 {
+		keys := make([]string, 0)
+		for k := range self.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		params := make([]string, len(keys))
+		for i, k := range keys {
+			params[i] = k + "=" + url.QueryEscape(self.Params[k])
+		}
+		dsn += "?" + strings.Join(params, "&")
+	}
+	return dsn
+}
+
+// Open opens a DBI by the config: it creates the database if asked,
+// pings the server, runs USE and detects the dialect.
+func Open(c Config) (*DBI, error) {
+	if c.DbType == "" {
+		c.DbType = "taosSql"
+	}
+	if c.Create && c.Database == "" {
+		return nil, errors.New("database to create is missing")
+	}
+	if c.Database != "" {
+		if err := validName(c.Database); err != nil {
+			return nil, err
+		}
+	}
+	if c.Create {
+		if err := c.create(); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open(c.DbType, c.DSN(c.Database))
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(time.Duration(c.ConnMaxLifetime))
+	db.SetConnMaxIdleTime(time.Duration(c.ConnMaxIdleTime))
+
+	timeout := time.Duration(c.PingTimeout)
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	dbi := &DBI{DB: db}
+	if c.Database != "" {
+		if err := dbi.DoSQL("USE " + c.Database); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if _, err := dbi.DetectDialect(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return dbi, nil
+}
+
+// create creates the database in a connection without database.
+// The name and the precision are checked by CreateDatabase.
+func (self *Config) create() error {
+	db, err := sql.Open(self.DbType, self.DSN(""))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dbi := &DBI{DB: db}
+	return dbi.CreateDatabase(self.Database, &DatabaseOptions{Precision: self.Precision})
+}
@@ -0,0 +1,83 @@
+package taodbi
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "conn.json")
+	content := `{"DbType":"taosSql", "User":"root", "Password":"taosdata", "Host":"127.0.0.1", "Port":6030,
+"Database":"confdb", "Params":{"parseTime":"false"}, "ConnMaxLifetime":"1m", "PingTimeout":2}`
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TAODBI_HOST", "tdengine")
+	t.Setenv("TAODBI_PORT", "6041")
+	c, err := NewConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsn := c.DSN(c.Database); dsn != "root:taosdata@/tcp(tdengine:6041)/confdb?parseTime=false" {
+		t.Errorf("%s", dsn)
+	}
+	if time.Duration(c.ConnMaxLifetime) != time.Minute || time.Duration(c.PingTimeout) != 2*time.Second {
+		t.Errorf("%v %v", c.ConnMaxLifetime, c.PingTimeout)
+	}
+	if bs, err := json.Marshal(c.ConnMaxLifetime); err != nil || string(bs) != `"1m0s"` {
+		t.Errorf("%s %v", bs, err)
+	}
+
+	t.Setenv("TAODBI_PORT", "x")
+	if err := c.LoadEnv(); err == nil {
+		t.Errorf("invalid port expected")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dbi, err := Open(Config{
+		DbType:    newconf("config.json").DbType,
+		User:      "root",
+		Password:  "taosdata",
+		Host:      "127.0.0.1",
+		Database:  "confdb",
+		Create:    true,
+		Precision: "ms",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbi.Close()
+
+	lists := make([]map[string]interface{}, 0)
+	if err := dbi.SelectSQL(&lists, "SHOW DATABASES"); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, item := range lists {
+		if item["name"] == "confdb" {
+			found = item["precision"] == "ms"
+		}
+	}
+	if !found {
+		t.Errorf("%v", lists)
+	}
+	if err := dbi.DoSQL("CREATE TABLE IF NOT EXISTS conft (ts timestamp, x int)"); err != nil {
+		t.Errorf("%v", err)
+	}
+
+	if _, err := Open(Config{DbType: "taosSql", Create: true}); err == nil {
+		t.Errorf("missing database expected")
+	}
+	driver := newconf("config.json").DbType
+	if _, err := Open(Config{DbType: driver, Database: "conf;db", Create: true}); !errors.Is(err, ErrValidation) {
+		t.Errorf("%v", err)
+	}
+	if _, err := Open(Config{DbType: driver, Database: "confdb", Create: true, Precision: "s"}); !errors.Is(err, ErrValidation) {
+		t.Errorf("%v", err)
+	}
+}
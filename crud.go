@@ -1,6 +1,7 @@
 package taodbi
 
 import (
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -37,15 +38,19 @@ func (self *Model) insertExtra(args map[string]interface{}) string {
 func (self *Model) insertHash(args map[string]interface{}) error {
     sql := "INSERT INTO " + self.CurrentTable + self.acrud.insertExtra(args)
 
+    // sorted fields keep the statement text stable for StmtCache
     fields := make([]string, 0)
-    values := make([]interface{}, 0)
     found := false
-    for k, v := range args {
+    for k := range args {
         if k == self.CurrentKey {
             found = true
         }
         fields = append(fields, k)
-        values = append(values, v)
+    }
+    sort.Strings(fields)
+    values := make([]interface{}, len(fields))
+    for i, k := range fields {
+        values[i] = args[k]
     }
     sql += " ("
     if found==false {
@@ -53,10 +58,11 @@ func (self *Model) insertHash(args map[string]interface{}) error {
     }
     sql += strings.Join(fields, ", ") + ") VALUES ("
     if found==false {
-        sql += "now,"
+        sql += self.dialect().Now() + ","
     }
     sql += strings.Join(strings.Split(strings.Repeat("?", len(fields)), ""), ",") + ")"
-    if err := self.DoSQL(sql, values...); err != nil {
+    // retry only if the key is explicit, otherwise a row may be inserted twice
+    if err := self.execSQL(found, sql, values...); err != nil {
 		return err
 	}
 /*
@@ -66,9 +72,14 @@ func (self *Model) insertHash(args map[string]interface{}) error {
     }
 */
 	str := ""
-    if err := self.DB.QueryRow("SELECT LAST(" + self.CurrentKey + ") FROM " + self.CurrentTable).Scan(&str); err != nil {
+	query := "SELECT LAST(" + self.CurrentKey + ") FROM " + self.CurrentTable
+    if err := self.scanRow(query, []interface{}{&str}); err != nil {
         return err
     }
+	if str == "" { // nothing scanned in dry run
+		self.LastID = 0
+		return nil
+	}
 	id, err := strconv.ParseInt(str, 10, 64)
 	if err != nil {
 		return err
@@ -78,6 +89,77 @@ func (self *Model) insertHash(args map[string]interface{}) error {
 	return nil
 }
 
+// InsertRows inserts rows in one statement. For Smodel, the rows are
+// inserted into their child tables by the tags, in a multi-table
+// statement creating the child tables when missing.
+// A row without the key gets the current time of the server.
+//
+func (self *Model) InsertRows(rows []map[string]interface{}) error {
+	// rows of the same child table and columns share a VALUES clause
+	type group struct {
+		table  string
+		fields []string
+		values [][]interface{}
+	}
+	groups := make([]*group, 0)
+	index := make(map[string]*group)
+	for _, row := range rows {
+		args := make(map[string]interface{})
+		for k, v := range row {
+			args[k] = v
+		}
+		extra := self.acrud.insertExtra(args)
+		if _, ok := self.acrud.(*Smodel); ok && extra == "" {
+			return newError(ErrMissingKey, self.ModelName, "missing tags")
+		}
+		fields := make([]string, 0)
+		for k := range args {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		key := extra + "(" + strings.Join(fields, ",") + ")"
+		g, ok := index[key]
+		if !ok {
+			g = &group{table: self.CurrentTable + extra, fields: fields}
+			index[key] = g
+			groups = append(groups, g)
+		}
+		values := make([]interface{}, len(fields))
+		for i, k := range fields {
+			values[i] = args[k]
+		}
+		g.values = append(g.values, values)
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	sql := "INSERT INTO"
+	values := make([]interface{}, 0)
+	for _, g := range groups {
+		found := false
+		for _, k := range g.fields {
+			if k == self.CurrentKey {
+				found = true
+			}
+		}
+		sql += " " + g.table + "("
+		if !found {
+			sql += self.CurrentKey + ", "
+		}
+		sql += strings.Join(g.fields, ", ") + ") VALUES"
+		item := "(" + strings.Join(strings.Split(strings.Repeat("?", len(g.fields)), ""), ",") + ")"
+		if !found {
+			item = "(" + self.dialect().Now() + "," + item[1:]
+		}
+		for _, v := range g.values {
+			sql += " " + item
+			values = append(values, v...)
+		}
+	}
+	return self.DoSQL(sql, values...)
+}
+
 // editHash selects one or multiple rows from the primary key.
 // lists: received the query results in slice of maps.
 // ids: primary key values array.
@@ -186,6 +268,26 @@ func (self *Model) topicsHash(lists *[]map[string]interface{}, selectPars interf
 	return self.SelectSQLTypeLabel(lists, types, labels, sql)
 }
 
+// purge deletes rows whose 'column' is 'value' by their timestamps,
+// since DELETE takes only timestamp conditions.
+//
+func (self *Model) purge(column string, value interface{}) error {
+	query := self.dialect().Delete(self.CurrentTable, self.CurrentKey)
+	if query == "" {
+		return newError(ErrValidation, self.ModelName, "delete not supported")
+	}
+	lists := make([]map[string]interface{}, 0)
+	if err := self.SelectSQLType(&lists, []string{"int64"}, "SELECT "+self.CurrentKey+" FROM "+self.CurrentTable+" WHERE "+column+"=?", value); err != nil {
+		return err
+	}
+	for _, item := range lists {
+		if err := self.DoSQL(query, item[self.CurrentKey]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // totalHash returns the total number of rows available
 // This function is used for pagination.
 // v: the total number is returned in this referenced variable
@@ -194,13 +296,13 @@ func (self *Model) topicsHash(lists *[]map[string]interface{}, selectPars interf
 func (self *Model) totalHash(v interface{}, extra ...map[string]interface{}) error {
 	str := "SELECT COUNT(*) FROM\n" + self.CurrentTable
 
+	var values []interface{}
 	if hasValue(extra) {
-		where, values := selectCondition(extra[0])
+		var where string
+		where, values = selectCondition(extra[0])
 		if where != "" {
 			str += "\nWHERE " + where
 		}
-		return self.DB.QueryRow(str, values...).Scan(v)
 	}
-
-	return self.DB.QueryRow(str).Scan(v)
+	return self.scanRow(str, []interface{}{v}, values...)
 }
@@ -4,7 +4,6 @@ import (
 	"testing"
 	"time"
 	"database/sql"
-	_ "github.com/taosdata/driver-go/taosSql"
 )
 
 func TestCrudFilterExtra(t *testing.T) {
@@ -18,7 +17,7 @@ func TestCrudFilterExtra(t *testing.T) {
 
 func TestCrudDb(t *testing.T) {
 	c := newconf("config.json")
-	db, err := sql.Open(c.DbType, c.Dsn2)
+	db, err := sql.Open(c.DbType, c.DSN(c.Database))
 	if err != nil {
 		panic(err)
 	}
@@ -132,7 +131,7 @@ func TestCrudDb(t *testing.T) {
 
 func TestCrudEditFK(t *testing.T) {
     c := newconf("config.json")
-    db, err := sql.Open(c.DbType, c.Dsn2)
+    db, err := sql.Open(c.DbType, c.DSN(c.Database))
     if err != nil {
         panic(err)
     }
@@ -0,0 +1,233 @@
+package taodbi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UpdateMode is the UPDATE option of database
+type UpdateMode int
+
+const (
+	// UpdateUnset leaves the option to the server
+	UpdateUnset UpdateMode = iota
+	// UpdateNone ignores rows of existing timestamps, UPDATE 0
+	UpdateNone
+	// UpdateRow replaces rows of existing timestamps, UPDATE 1
+	UpdateRow
+	// UpdatePartial updates the given columns only, UPDATE 2
+	UpdatePartial
+)
+
+// DatabaseOptions are options of CREATE and ALTER DATABASE.
+// Zero values are not set.
+//
+type DatabaseOptions struct {
+	// Keep: days to keep data
+	Keep int
+	// Days: days of data in a file, for CREATE only
+	Days int
+	// Replica: number of replicas
+	Replica int
+	// Blocks: number of cache blocks per vnode
+	Blocks int
+	// Precision: "ms" or "us", for CREATE only
+	Precision string
+	// Update: the mode of rows with existing timestamps
+	Update UpdateMode
+}
+
+// Database is a row of SHOW DATABASES
+//
+type Database struct {
+	Name      string `json:"name"`
+	Created   string `json:"created_time"`
+	Tables    int64  `json:"ntables"`
+	Replica   int64  `json:"replica"`
+	Days      int64  `json:"days"`
+	Keep      string `json:"keep"`
+	Blocks    int64  `json:"blocks"`
+	Precision string `json:"precision"`
+	Update    int64  `json:"update"`
+}
+
+// validName checks a database name, which can not be quoted
+func validName(name string) error {
+	if name == "" {
+		return newError(ErrValidation, "", "database name missing")
+	}
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return newError(ErrValidation, "", "invalid database name "+name)
+		}
+	}
+	return nil
+}
+
+// clauses returns the options as clauses like KEEP 365, in 'dialect'
+func (self *DatabaseOptions) clauses(dialect Dialect) ([]string, error) {
+	clauses := make([]string, 0)
+	if self == nil {
+		return clauses, nil
+	}
+	for _, item := range []struct {
+		name  string
+		value string
+		set   bool
+	}{
+		{"KEEP", strconv.Itoa(self.Keep), self.Keep > 0},
+		{"DAYS", strconv.Itoa(self.Days), self.Days > 0},
+		{"REPLICA", strconv.Itoa(self.Replica), self.Replica > 0},
+		{"BLOCKS", strconv.Itoa(self.Blocks), self.Blocks > 0},
+		{"PRECISION", `"` + self.Precision + `"`, self.Precision != ""},
+		{"UPDATE", strconv.Itoa(int(self.Update) - 1), self.Update != UpdateUnset},
+	} {
+		if !item.set {
+			continue
+		}
+		option := dialect.DatabaseOption(item.name)
+		if option == "" {
+			return nil, newError(ErrValidation, "", strings.ToLower(item.name)+" not supported in "+strconv.Itoa(dialect.Major())+".x")
+		}
+		clauses = append(clauses, option+" "+item.value)
+	}
+	return clauses, nil
+}
+
+// CreateDatabase creates database 'name' if it does not exist
+func (self *DBI) CreateDatabase(name string, opts *DatabaseOptions) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	if opts != nil && opts.Precision != "" && opts.Precision != "ms" && opts.Precision != "us" && opts.Precision != "ns" {
+		return newError(ErrValidation, "", "invalid precision "+opts.Precision)
+	}
+	clauses, err := opts.clauses(self.dialect())
+	if err != nil {
+		return err
+	}
+	query := "CREATE DATABASE IF NOT EXISTS " + name
+	if len(clauses) > 0 {
+		query += " " + strings.Join(clauses, " ")
+	}
+	return self.DoSQL(query)
+}
+
+// AlterDatabase alters options of database 'name', one statement each.
+// Days and Precision can not be altered.
+func (self *DBI) AlterDatabase(name string, opts *DatabaseOptions) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	if opts == nil {
+		return nil
+	}
+	if opts.Days > 0 || opts.Precision != "" {
+		return newError(ErrValidation, "", "days and precision can not be altered")
+	}
+	clauses, err := opts.clauses(self.dialect())
+	if err != nil {
+		return err
+	}
+	for _, clause := range clauses {
+		if err := self.DoSQL("ALTER DATABASE " + name + " " + clause); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropDatabase drops database 'name' if it exists
+func (self *DBI) DropDatabase(name string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	return self.DoSQL("DROP DATABASE IF EXISTS " + name)
+}
+
+// ListDatabases lists all databases, with the fields not in SHOW
+// DATABASES of the dialect being zero
+func (self *DBI) ListDatabases() ([]*Database, error) {
+	lists := make([]map[string]interface{}, 0)
+	if err := self.SelectSQL(&lists, "SHOW DATABASES"); err != nil {
+		return nil, err
+	}
+	dialect := self.dialect()
+	dbs := make([]*Database, 0)
+	for _, item := range lists {
+		value := func(field string) interface{} {
+			return item[dialect.DatabaseColumn(field)]
+		}
+		db := &Database{
+			Name:      fmt.Sprint(value("name")),
+			Tables:    toInt64(value("ntables")),
+			Replica:   toInt64(value("replica")),
+			Days:      toDays(value("days")),
+			Blocks:    toInt64(value("blocks")),
+			Precision: fmt.Sprint(value("precision")),
+			Update:    toInt64(value("update")),
+		}
+		switch v := value("created_time").(type) {
+		case time.Time:
+			db.Created = v.Format(time.RFC3339Nano)
+		case nil:
+		default:
+			db.Created = fmt.Sprint(v)
+		}
+		for _, k := range []string{"keep0,keep1,keep(D)", "keep0,keep1,keep2", "keep"} {
+			if v, ok := item[k]; ok {
+				db.Keep = fmt.Sprint(v)
+				break
+			}
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+// toDays returns the days of 'v', which is in minutes, hours or days
+// with a unit in 3.x, like 14400m
+func toDays(v interface{}) int64 {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return toInt64(v)
+	}
+	n := toInt64(strings.TrimRight(s, "mhd"))
+	switch s[len(s)-1] {
+	case 'm':
+		return n / (24 * 60)
+	case 'h':
+		return n / 24
+	default:
+	}
+	return n
+}
+
+func toInt64(v interface{}) int64 {
+	switch u := v.(type) {
+	case int:
+		return int64(u)
+	case int8:
+		return int64(u)
+	case int16:
+		return int64(u)
+	case int32:
+		return int64(u)
+	case int64:
+		return u
+	case float32:
+		return int64(u)
+	case float64:
+		return int64(u)
+	case string:
+		n, _ := strconv.ParseInt(u, 10, 64)
+		return n
+	case []byte:
+		n, _ := strconv.ParseInt(string(u), 10, 64)
+		return n
+	default:
+	}
+	return 0
+}
@@ -0,0 +1,170 @@
+package taodbi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/genelet/taodbi/taodbitest"
+)
+
+func TestDatabase(t *testing.T) {
+	db, err := open(serverDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	dbi := &DBI{DB: db}
+	recorder := NewRecorder(false)
+	dbi.Recorder = recorder
+
+	if err := dbi.DropDatabase("lifedb"); err != nil {
+		t.Fatal(err)
+	}
+	opts := &DatabaseOptions{Keep: 365, Days: 10, Precision: "us", Update: UpdateRow}
+	if err := dbi.CreateDatabase("lifedb", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbi.AlterDatabase("lifedb", &DatabaseOptions{Keep: 730, Update: UpdateNone}); err != nil {
+		t.Fatal(err)
+	}
+	log := recorder.Log()
+	if log[1].Query != `CREATE DATABASE IF NOT EXISTS lifedb KEEP 365 DAYS 10 PRECISION "us" UPDATE 1` ||
+		log[2].Query != `ALTER DATABASE lifedb KEEP 730` || log[3].Query != `ALTER DATABASE lifedb UPDATE 0` {
+		t.Errorf("%v", log)
+	}
+
+	dbs, err := dbi.ListDatabases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found *Database
+	for _, item := range dbs {
+		if item.Name == "lifedb" {
+			found = item
+		}
+	}
+	if found == nil || found.Precision != "us" || found.Update != 0 || found.Created == "" {
+		t.Errorf("%#v", found)
+	}
+
+	if err := dbi.AlterDatabase("lifedb", &DatabaseOptions{Days: 20}); !errors.Is(err, ErrValidation) {
+		t.Errorf("%v", err)
+	}
+	if err := dbi.CreateDatabase("life;db", nil); !errors.Is(err, ErrValidation) {
+		t.Errorf("%v", err)
+	}
+	if err := dbi.DropDatabase("lifedb"); err != nil {
+		t.Fatal(err)
+	}
+	if dbs, err = dbi.ListDatabases(); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range dbs {
+		if item.Name == "lifedb" {
+			t.Errorf("lifedb not dropped")
+		}
+	}
+}
+
+func TestDatabase3(t *testing.T) {
+	fakeOnly(t)
+	defer func(v string) { taodbitest.Version = v }(taodbitest.Version)
+	taodbitest.Version = "3.0.2.0"
+	db, err := open(serverDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	dbi := &DBI{DB: db, Dialect: Dialect3}
+	recorder := NewRecorder(false)
+	dbi.Recorder = recorder
+
+	if err := dbi.DropDatabase("lifedb"); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []*DatabaseOptions{{Blocks: 6}, {Update: UpdateRow}} {
+		if err := dbi.CreateDatabase("lifedb", opts); !errors.Is(err, ErrValidation) {
+			t.Errorf("%v", err)
+		}
+	}
+	if err := dbi.CreateDatabase("lifedb", &DatabaseOptions{Keep: 365, Days: 5, Precision: "us"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbi.AlterDatabase("lifedb", &DatabaseOptions{Keep: 730}); err != nil {
+		t.Fatal(err)
+	}
+	log := recorder.Log()
+	if log[1].Query != `CREATE DATABASE IF NOT EXISTS lifedb KEEP 365 DURATION 5 PRECISION "us"` || log[2].Query != `ALTER DATABASE lifedb KEEP 730` {
+		t.Errorf("%v", log)
+	}
+
+	dbs, err := dbi.ListDatabases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found *Database
+	for _, item := range dbs {
+		if item.Name == "lifedb" {
+			found = item
+		}
+	}
+	if found == nil || found.Precision != "us" || found.Days != 5 || found.Keep == "" || found.Created == "" || found.Blocks != 0 {
+		t.Errorf("%#v", found)
+	}
+	if err := dbi.DropDatabase("lifedb"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSchemaDatabase(t *testing.T) {
+	c := newconf("config.json")
+	db, err := open(c.DSN(c.Database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	dbi := &DBI{DB: db}
+
+	schemas := make(map[string]*Schema)
+	for _, name := range []string{"onedb", "twodb"} {
+		if err := dbi.CreateDatabase(name, nil); err != nil {
+			t.Fatal(err)
+		}
+		for _, query := range []string{
+			"DROP TABLE IF EXISTS " + name + ".atesting",
+			"CREATE TABLE " + name + ".atesting (id timestamp, x binary(8), y binary(8), z binary(8))",
+		} {
+			if err := dbi.DoSQL(query); err != nil {
+				t.Fatal(err)
+			}
+		}
+		model, err := NewModel("m22.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		model.Actions = map[string]func(...map[string]interface{}) error{"insert": model.Insert, "topics": model.Topics}
+		schema := NewSchema(map[string]Navigate{"m22": model})
+		schema.SetDB(db)
+		if err := schema.SetDatabase(name); err != nil {
+			t.Fatal(err)
+		}
+		schemas[name] = schema
+	}
+
+	if _, err := schemas["onedb"].Run("m22", "insert", map[string]interface{}{"x": "one"}); err != nil {
+		t.Fatal(err)
+	}
+	for name, n := range map[string]int{"onedb": 1, "twodb": 0} {
+		lists, err := schemas[name].Run("m22", "topics", map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lists) != n {
+			t.Errorf("%s: %v", name, lists)
+		}
+	}
+
+	if err := schemas["twodb"].SetDatabase("two db"); !errors.Is(err, ErrValidation) {
+		t.Errorf("%v", err)
+	}
+}
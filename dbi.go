@@ -2,7 +2,6 @@ package taodbi
 
 import (
 	"database/sql"
-	"errors"
 	"net/url"
 	"strings"
 )
@@ -21,7 +20,6 @@ func Quote(v interface{}) interface{} {
 	default:
 		return v
 	}
-	return v
 }
 
 // Quotes quote a slice of values for use in placeholders
@@ -46,48 +44,70 @@ type DBI struct {
 	LastID int64 `json:"-"`
 	// Affected: the number of rows affected
 	Affected int64 `json:"-"`
+	// Recorder: optional, to log statements or to run dry
+	Recorder *Recorder `json:"-"`
+	// Hooks: optional, called before and after each statement
+	Hooks []Hook `json:"-"`
+	// ModelName and ActionName: optional, passed to hooks
+	ModelName  string `json:"-"`
+	ActionName string `json:"-"`
+	// Stmts: optional, cache of prepared statements for DB
+	Stmts *StmtCache `json:"-"`
+	// Retry: optional, policy to retry reads and idempotent writes
+	Retry *Retry `json:"-"`
+	// Dialect: optional, the SQL dialect, default the detected one or Dialect2
+	Dialect Dialect `json:"-"`
 }
 
 // DoSQL is the same as SQL's Exec, except for using a prepared statement,
 // which is safe for concurrent use by multiple goroutines.
 //
 func (self *DBI) DoSQL(query string, args ...interface{}) error {
-	//glog.Infof("godbi SQL statement: %s", query)
-	//glog.Infof("godbi input data: %v", args)
+	return self.execSQL(false, query, args...)
+}
 
-	sth, err := self.DB.Prepare(query)
-	if err != nil {
-		return err
-	}
-	res, err := sth.Exec(Quotes(args)...)
-	if err != nil {
-		return err
+// execSQL runs DoSQL, and retries by Retry if 'idempotent' is true
+func (self *DBI) execSQL(idempotent bool, query string, args ...interface{}) error {
+	if self.record(query, args...) {
+		self.Affected = 0
+		return nil
 	}
 
-	/*
-	   LastID, err := res.LastInsertId()
-	   if err != nil {
-	       return err
-	   }
-	   self.LastID = LastID
-	*/
-	affected, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
-	self.Affected = affected
+	err := self.attempt(idempotent, query, args, func() (int64, error) {
+		sth, release, err := self.prepare(query)
+		if err != nil {
+			return 0, err
+		}
+		defer release()
+		res, err := sth.Exec(Quotes(args)...)
+		if err != nil {
+			return 0, err
+		}
 
-	sth.Close()
-	return nil
+		/*
+		   LastID, err := res.LastInsertId()
+		   if err != nil {
+		       return err
+		   }
+		   self.LastID = LastID
+		*/
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		self.Affected = affected
+		return affected, nil
+	})
+	if self.Stmts != nil && StatementKind(query) == "ddl" {
+		self.Stmts.Purge()
+	}
+	return err
 }
 
 // DoSQLs inserts multiple rows at once.
 // Each row is represented as array and the rows are array of array.
 //
 func (self *DBI) DoSQLs(query string, args ...[]interface{}) error {
-	//glog.Infof("godbi SQL statement: %s", query)
-	//glog.Infof("godbi input data: %v", args)
-
 	n := len(args)
 	if n == 0 {
 		return self.DoSQL(query)
@@ -136,23 +156,47 @@ func (self *DBI) SelectSQLLabel(lists *[]map[string]interface{}, selectLabels []
 // The original SQL column names will be renamed by 'selectLabels'.
 //
 func (self *DBI) SelectSQLTypeLabel(lists *[]map[string]interface{}, typeLabels []string, selectLabels []string, query string, args ...interface{}) error {
-	//glog.Infof("godbi SQL statement: %s", query)
-	//glog.Infof("godbi select columns: %v", selectLabels)
-	//glog.Infof("godbi column types: %v", typeLabels)
-	//glog.Infof("godbi input data: %v", args)
-
-	sth, err := self.DB.Prepare(query)
-	if err != nil {
-		return err
+	if self.record(query, args...) {
+		return nil
 	}
-	defer sth.Close()
-	rows, err := sth.Query(Quotes(args)...)
-	if err != nil {
-		return err
+
+	n := len(*lists)
+	return self.attempt(true, query, args, func() (int64, error) {
+		*lists = (*lists)[:n]
+		sth, release, err := self.prepare(query)
+		if err != nil {
+			return 0, err
+		}
+		defer release()
+		rows, err := sth.Query(Quotes(args)...)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+
+		err = self.pickup(rows, lists, typeLabels, selectLabels, query)
+		return int64(len(*lists) - n), err
+	})
+}
+
+// scanRow scans one row into 'dest', as QueryRow(query, args...).Scan(dest...).
+// Nothing is scanned in dry run.
+func (self *DBI) scanRow(query string, dest []interface{}, args ...interface{}) error {
+	if self.record(query, args...) {
+		return nil
 	}
-	defer rows.Close()
 
-	return self.pickup(rows, lists, typeLabels, selectLabels, query)
+	return self.attempt(true, query, args, func() (int64, error) {
+		sth, release, err := self.prepare(query)
+		if err != nil {
+			return 0, err
+		}
+		defer release()
+		if err := sth.QueryRow(args...).Scan(dest...); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	})
 }
 
 func (self *DBI) pickup(rows *sql.Rows, lists *[]map[string]interface{}, typeLabels []string, selectLabels []string, query string) error {
@@ -163,6 +207,7 @@ func (self *DBI) pickup(rows *sql.Rows, lists *[]map[string]interface{}, typeLab
 		}
 	}
 
+	dialect := self.dialect()
 	isType := false
 	if typeLabels != nil {
 		isType = true
@@ -257,12 +302,9 @@ func (self *DBI) pickup(rows *sql.Rows, lists *[]map[string]interface{}, typeLab
 					}
 				case "string":
 					x := x[j].(*sql.NullString)
-					n := len(x.String)
 					if x.Valid {
-						if n >= 2 {
-							res[v] = strings.TrimRight(x.String[:n-2], "\x00")
-						} else {
-							return errors.New("wrong string output: " + x.String)
+						if res[v], err = dialect.Trim(x.String); err != nil {
+							return err
 						}
 					}
 				default:
@@ -272,20 +314,12 @@ func (self *DBI) pickup(rows *sql.Rows, lists *[]map[string]interface{}, typeLab
 				if name != nil {
 					switch name.(type) {
 					case []uint8:
-						x := string(name.([]uint8))
-						n := len(x)
-						if n >= 2 {
-							res[v] = strings.TrimRight(x[:n-2], "\x00")
-						} else {
-							return errors.New("wrong string output: " + x)
+						if res[v], err = dialect.Trim(string(name.([]uint8))); err != nil {
+							return err
 						}
 					case string:
-						x := name.(string)
-						n := len(x)
-						if n >= 2 {
-							res[v] = strings.TrimRight(x[:n-2], "\x00")
-						} else {
-							return errors.New("wrong string output: " + x)
+						if res[v], err = dialect.Trim(name.(string)); err != nil {
+							return err
 						}
 					default:
 						res[v] = name
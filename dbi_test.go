@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"time"
 	"database/sql"
-	_ "github.com/taosdata/driver-go/taosSql"
 )
 
 func TestQuote(t *testing.T) {
@@ -40,10 +39,9 @@ func TestQuote(t *testing.T) {
 }
 
 func TestLong(t *testing.T) {
-	c := newconf("config.json")
 
 	dbname := "demodb"
-	db, err := open(c.Dsn1)
+	db, err := open(serverDSN())
 	if err != nil {
 		panic(err)
 	}
@@ -127,8 +125,7 @@ func TestLong(t *testing.T) {
 
 func TestShort(t *testing.T) {
 	dbname := "demodb"
-	c := newconf("config.json")
-	db, err := open(c.Dsn1)
+	db, err := open(serverDSN())
 	if err != nil {
 		panic(err)
 	}
@@ -279,7 +276,7 @@ func TestShort(t *testing.T) {
 func TestInt(t *testing.T) {
 	dbname := "demodb"
 	c := newconf("config.json")
-	db, err := sql.Open(c.DbType, c.Dsn2)
+	db, err := sql.Open(c.DbType, c.DSN(c.Database))
 	if err != nil {
 		panic(err)
 	}
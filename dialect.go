@@ -0,0 +1,240 @@
+package taodbi
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Dialect writes the SQL, and reads the values, differing between
+// major versions of TDengine.
+//
+type Dialect interface {
+	// Major: the major version, 2 or 3
+	Major() int
+	// Text: the type of variable-length string of 'n' bytes
+	Text(n int) string
+	// Now: the current time in INSERT
+	Now() string
+	// Trim: the string value read from the driver
+	Trim(string) (string, error)
+	// SelectGroup: SELECT 'columns' FROM 'table', returning also the
+	// values of 'groups' in GROUP BY
+	SelectGroup(columns, table string, groups []string) string
+	// Delete: the statement to delete rows of 'table' by timestamp
+	// 'key', or empty if DELETE is not supported
+	Delete(table, key string) string
+	// TagIndex: the statement to index 'tag' of super table 'stable',
+	// or empty if not supported
+	TagIndex(stable, tag string) string
+	// Interval: SELECT 'columns' FROM 'table' WHERE 'where' in windows
+	// of 'interval', returning the window start, the columns and the
+	// values of 'groups' by which the windows are partitioned
+	Interval(columns, table, where, interval string, groups []string) string
+	// StableName: the column of the names in SHOW STABLES
+	StableName() string
+	// DatabaseOption: the option of CREATE and ALTER DATABASE for 'name'
+	// of DatabaseOptions, KEEP, DAYS, REPLICA, BLOCKS, PRECISION or UPDATE,
+	// or empty if not supported
+	DatabaseOption(name string) string
+	// DatabaseColumn: the column in SHOW DATABASES of 'field', a json key
+	// of Database, or empty if there is none
+	DatabaseColumn(field string) string
+}
+
+var (
+	// Dialect2 is the dialect of TDengine 2.x and the driver of 2020, which
+	// pads strings with two bytes and appends group columns to aggregates.
+	Dialect2 Dialect = dialect2{}
+	// Dialect3 is the dialect of TDengine 3.x
+	Dialect3 Dialect = dialect3{}
+)
+
+type dialect2 struct{}
+
+func (self dialect2) Major() int {
+	return 2
+}
+
+func (self dialect2) Text(n int) string {
+	return "BINARY(" + strconv.Itoa(n) + ")"
+}
+
+func (self dialect2) Now() string {
+	return "now"
+}
+
+func (self dialect2) Trim(s string) (string, error) {
+	n := len(s)
+	if n < 2 {
+		return "", errors.New("wrong string output: " + s)
+	}
+	return strings.TrimRight(s[:n-2], "\x00"), nil
+}
+
+func (self dialect2) SelectGroup(columns, table string, groups []string) string {
+	return "SELECT " + columns + " FROM " + table
+}
+
+func (self dialect2) Delete(table, key string) string {
+	return ""
+}
+
+func (self dialect2) TagIndex(stable, tag string) string {
+	return ""
+}
+
+func (self dialect2) Interval(columns, table, where, interval string, groups []string) string {
+	sql := "SELECT " + columns + " FROM " + table
+	if where != "" {
+		sql += " WHERE " + where
+	}
+	sql += " INTERVAL(" + interval + ")"
+	if len(groups) > 0 {
+		sql += " GROUP BY " + strings.Join(groups, ", ")
+	}
+	return sql
+}
+
+func (self dialect2) StableName() string {
+	return "name"
+}
+
+func (self dialect2) DatabaseOption(name string) string {
+	return name
+}
+
+func (self dialect2) DatabaseColumn(field string) string {
+	return field
+}
+
+type dialect3 struct{}
+
+func (self dialect3) Major() int {
+	return 3
+}
+
+func (self dialect3) Text(n int) string {
+	return "VARCHAR(" + strconv.Itoa(n) + ")"
+}
+
+func (self dialect3) Now() string {
+	return "NOW"
+}
+
+func (self dialect3) Trim(s string) (string, error) {
+	return strings.TrimRight(s, "\x00"), nil
+}
+
+func (self dialect3) SelectGroup(columns, table string, groups []string) string {
+	if len(groups) == 0 {
+		return "SELECT " + columns + " FROM " + table
+	}
+	return "SELECT " + columns + ", " + strings.Join(groups, ", ") + " FROM " + table
+}
+
+func (self dialect3) Delete(table, key string) string {
+	return "DELETE FROM " + table + " WHERE " + key + "=?"
+}
+
+func (self dialect3) TagIndex(stable, tag string) string {
+	return "CREATE INDEX " + strings.Replace(stable, ".", "_", -1) + "_" + tag + " ON " + stable + " (" + tag + ")"
+}
+
+func (self dialect3) Interval(columns, table, where, interval string, groups []string) string {
+	sql := self.SelectGroup("_wstart, "+columns, table, groups)
+	if where != "" {
+		sql += " WHERE " + where
+	}
+	if len(groups) > 0 {
+		sql += " PARTITION BY " + strings.Join(groups, ", ")
+	}
+	return sql + " INTERVAL(" + interval + ")"
+}
+
+func (self dialect3) StableName() string {
+	return "stable_name"
+}
+
+// DatabaseOption has DURATION for DAYS. BLOCKS and UPDATE are gone, rows
+// of existing timestamps being always updated.
+func (self dialect3) DatabaseOption(name string) string {
+	switch name {
+	case "DAYS":
+		return "DURATION"
+	case "BLOCKS", "UPDATE":
+		return ""
+	default:
+	}
+	return name
+}
+
+func (self dialect3) DatabaseColumn(field string) string {
+	switch field {
+	case "created_time":
+		return "create_time"
+	case "days":
+		return "duration"
+	case "blocks", "update":
+		return ""
+	default:
+	}
+	return field
+}
+
+// DialectOf returns the dialect of server 'version', like 3.0.2.0
+func DialectOf(version string) Dialect {
+	if strings.HasPrefix(strings.TrimSpace(version), "3") {
+		return Dialect3
+	}
+	return Dialect2
+}
+
+// dialects caches the detected dialects by database handle,
+// until ForgetDialect
+var dialects sync.Map
+
+// ForgetDialect removes the dialect detected for database handle 'db'.
+// Call it when closing a handle opened by DetectDialect or Open, so that
+// the cache does not keep it alive.
+//
+func ForgetDialect(db *sql.DB) {
+	dialects.Delete(db)
+}
+
+// Close forgets the dialect of DB and closes it
+func (self *DBI) Close() error {
+	ForgetDialect(self.DB)
+	return self.DB.Close()
+}
+
+// DetectDialect selects SERVER_VERSION() and returns its dialect, which
+// is then used by all DBIs of the same database handle without Dialect.
+func (self *DBI) DetectDialect() (Dialect, error) {
+	version := ""
+	if err := self.scanRow("SELECT SERVER_VERSION()", []interface{}{&version}); err != nil {
+		return nil, err
+	}
+	if version == "" { // dry run
+		return self.dialect(), nil
+	}
+	dialect := DialectOf(version)
+	dialects.Store(self.DB, dialect)
+	return dialect, nil
+}
+
+// dialect returns Dialect, or the detected one of DB, or Dialect2
+func (self *DBI) dialect() Dialect {
+	if self.Dialect != nil {
+		return self.Dialect
+	}
+	if self.DB != nil {
+		if dialect, ok := dialects.Load(self.DB); ok {
+			return dialect.(Dialect)
+		}
+	}
+	return Dialect2
+}
+
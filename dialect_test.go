@@ -0,0 +1,132 @@
+package taodbi
+
+import (
+	"testing"
+
+	"github.com/genelet/taodbi/taodbitest"
+)
+
+func TestDialect(t *testing.T) {
+	if DialectOf("3.0.2.0").Major() != 3 || DialectOf("2.0.20.0\x00\x00").Major() != 2 {
+		t.Errorf("wrong dialect of version")
+	}
+	if s, err := Dialect2.Trim("ab\x00\x00\x00"); err != nil || s != "ab" {
+		t.Errorf("%q %v", s, err)
+	}
+	if _, err := Dialect2.Trim("a"); err == nil {
+		t.Errorf("short string expected")
+	}
+	if s, err := Dialect3.Trim("ab"); err != nil || s != "ab" {
+		t.Errorf("%q %v", s, err)
+	}
+	if Dialect2.Text(8) != "BINARY(8)" || Dialect3.Text(8) != "VARCHAR(8)" {
+		t.Errorf("wrong text types")
+	}
+	if q := Dialect3.SelectGroup("LAST(*)", "st", []string{"a", "b"}); q != "SELECT LAST(*), a, b FROM st" {
+		t.Errorf("%s", q)
+	}
+	if Dialect2.Delete("t", "ts") != "" || Dialect3.Delete("t", "ts") != "DELETE FROM t WHERE ts=?" {
+		t.Errorf("wrong delete")
+	}
+	if q := Dialect2.Interval("AVG(x)", "st", "ts>=?", "1m", []string{"loc"}); q != "SELECT AVG(x) FROM st WHERE ts>=? INTERVAL(1m) GROUP BY loc" {
+		t.Errorf("%s", q)
+	}
+	if q := Dialect3.Interval("AVG(x)", "st", "ts>=?", "1m", []string{"loc"}); q != "SELECT _wstart, AVG(x), loc FROM st WHERE ts>=? PARTITION BY loc INTERVAL(1m)" {
+		t.Errorf("%s", q)
+	}
+}
+
+func TestDialect3(t *testing.T) {
+	fakeOnly(t)
+	defer func(v string) { taodbitest.Version = v }(taodbitest.Version)
+	taodbitest.Version = "3.0.2.0"
+
+	c := newconf("config.json")
+	db, err := open(c.DSN(c.Database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smodel, err := NewSmodel("ms.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smodel.SetDB(db)
+	if d, err := smodel.DetectDialect(); err != nil || d.Major() != 3 {
+		t.Fatalf("%v %v", d, err)
+	}
+	if _, ok := dialects.Load(db); !ok {
+		t.Fatalf("dialect not cached")
+	}
+	defer func() {
+		ForgetDialect(db)
+		if _, ok := dialects.Load(db); ok {
+			t.Errorf("dialect not forgotten")
+		}
+	}()
+	recorder := NewRecorder(false)
+	smodel.SetRecorder(recorder)
+	for _, query := range []string{
+		`DROP TABLE IF EXISTS stesting`,
+		`CREATE STABLE stesting (id timestamp, x varchar(8), y varchar(8), z varchar(8)) TAGS (pubid int, location varchar(8))`,
+	} {
+		if err := smodel.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := smodel.CreateTagIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	if log := recorder.Log(); log[len(log)-1].Query != "CREATE INDEX stesting_location ON stesting (location)" {
+		t.Errorf("%v", log)
+	}
+	for _, args := range []map[string]interface{}{
+		{"x": "aa1", "y": "bb1", "z": "cc1", "pubid": 333, "location": "yyz"},
+		{"x": "aa2", "y": "bb2", "z": "cc2", "pubid": 444, "location": "yyz"},
+	} {
+		smodel.SetArgs(args)
+		if err := smodel.Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	smodel.SetArgs(map[string]interface{}{"x": "aa2"})
+	if err := smodel.LastTopics(); err != nil {
+		t.Fatal(err)
+	}
+	lists := smodel.GetLists()
+	if len(lists) != 1 || lists[0]["y"] != "bb2" || lists[0]["location"] != "yyz" {
+		t.Errorf("%v", lists)
+	}
+	smodel.SetArgs(map[string]interface{}{})
+	if err := smodel.ReleaseTopics(); err != nil {
+		t.Fatal(err)
+	}
+	if lists = smodel.GetLists(); len(lists) != 1 || lists[0]["x"] != "aa2" {
+		t.Errorf("%v", lists)
+	}
+
+	rest, err := NewRmodel("rest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest.SetDB(db)
+	initRest(db)
+	ids := make([]interface{}, 0)
+	for _, name := range []string{"u1", "u2"} {
+		args := map[string]interface{}{"username": name, "passwd": "p", "firstname": "f", "lastname": "l", "gender": true, "street": "s", "city": "c", "province": 1, "phone": "p", "email": "e"}
+		if err := rest.insertRest(args); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, rest.LastID)
+	}
+	if err := rest.deleteRest(ids[:1]); err != nil {
+		t.Fatal(err)
+	}
+	for table, n := range map[string]int64{"tmain": 1, "tprofile": 1, "tstatus": 1} {
+		var count int64
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil || count != n {
+			t.Errorf("%s: %d %v", table, count, err)
+		}
+	}
+}
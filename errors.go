@@ -0,0 +1,160 @@
+package taodbi
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sentinel errors to be tested by errors.Is
+var (
+	ErrNotFound       = errors.New("not found")
+	ErrDuplicate      = errors.New("duplicate")
+	ErrMissingKey     = errors.New("missing key")
+	ErrValidation     = errors.New("validation failed")
+	ErrModelNotFound  = errors.New("model not found in schema models")
+	ErrActionNotFound = errors.New("action not found in schema model")
+	ErrWriterClosed   = errors.New("writer closed")
+)
+
+// Error is an error of model. Kind is one of the sentinel errors.
+//
+type Error struct {
+	Kind  error
+	Model string
+	Msg   string
+}
+
+func newError(kind error, model, msg string) *Error {
+	return &Error{Kind: kind, Model: model, Msg: msg}
+}
+
+func (self *Error) Error() string {
+	return self.Msg
+}
+
+func (self *Error) Unwrap() error {
+	return self.Kind
+}
+
+// TDengine error codes in driver messages
+const (
+	CodeNetworkUnavailable = 0x000B
+	CodeInvalidSQL         = 0x0200
+	CodeTableExists        = 0x0360
+	CodeTableNotExist      = 0x0362
+	CodeInvalidTableType   = 0x0363
+	CodeDBNotSelected      = 0x0380
+	CodeInvalidDB          = 0x0381
+	CodeDBExists           = 0x0383
+
+	// codes of the storage and the parser in 3.x
+	CodeStorageTableExists   = 0x0603
+	CodeStorageTableNotExist = 0x0604
+	CodeParserNoTable        = 0x2603
+	CodeParserNoTable3       = 0x2662
+)
+
+var codeMessages = []struct {
+	code int
+	msg  string
+}{
+	{CodeTableNotExist, "table does not exist"},
+	{CodeTableExists, "table already exists"},
+	{CodeInvalidTableType, "invalid table type"},
+	{CodeDBNotSelected, "database not specified or available"},
+	{CodeInvalidDB, "invalid database name"},
+	{CodeDBExists, "database already exists"},
+	{CodeInvalidSQL, "invalid sql"},
+	{CodeNetworkUnavailable, "unable to establish connection"},
+}
+
+// DriverError wraps an error of database driver, with the TDengine code,
+// the statement and the model name.
+//
+type DriverError struct {
+	Code  int
+	SQL   string
+	Model string
+	Err   error
+}
+
+func (self *DriverError) Error() string {
+	msg := self.Err.Error()
+	if self.Code != 0 && !strings.HasPrefix(msg, "[0x") {
+		msg = fmt.Sprintf("[0x%04X] %s", self.Code, msg)
+	}
+	if self.Model != "" {
+		msg += ", model " + self.Model
+	}
+	return msg + ", sql: " + self.SQL
+}
+
+func (self *DriverError) Unwrap() error {
+	return self.Err
+}
+
+// Is reports ErrNotFound and ErrDuplicate by the code, of 2.x or 3.x
+func (self *DriverError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		if self.Err == sql.ErrNoRows {
+			return true
+		}
+		switch self.Code {
+		case CodeTableNotExist, CodeInvalidDB, CodeStorageTableNotExist, CodeParserNoTable, CodeParserNoTable3:
+			return true
+		default:
+		}
+	case ErrDuplicate:
+		switch self.Code {
+		case CodeTableExists, CodeDBExists, CodeStorageTableExists:
+			return true
+		default:
+		}
+	default:
+	}
+	return false
+}
+
+// ErrorCode returns the TDengine code in the driver message, as in
+// "[0x0362] Table does not exist", or the code of a known message.
+// It returns 0 if not found, or for nil.
+func ErrorCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var derr *DriverError
+	if errors.As(err, &derr) {
+		return derr.Code
+	}
+	msg := err.Error()
+	if strings.HasPrefix(msg, "[0x") {
+		if i := strings.IndexByte(msg, ']'); i > 0 {
+			if code, err := strconv.ParseInt(msg[3:i], 16, 32); err == nil {
+				return int(code)
+			}
+		}
+	}
+	msg = strings.ToLower(msg)
+	for _, item := range codeMessages {
+		if strings.HasPrefix(msg, item.msg) {
+			return item.code
+		}
+	}
+	return 0
+}
+
+// wrap returns a DriverError of 'err' in running 'query'
+func (self *DBI) wrap(query string, err error) error {
+	if err == nil {
+		return err
+	}
+	var derr *DriverError
+	if errors.As(err, &derr) {
+		return err
+	}
+	return &DriverError{Code: ErrorCode(err), SQL: query, Model: self.ModelName, Err: err}
+}
@@ -0,0 +1,81 @@
+package taodbi
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	c := newconf("config.json")
+	db, err := open(c.DSN(c.Database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	model, err := NewModel("m22.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.SetDB(db)
+	model.ModelName = "m22"
+
+	err = model.DoSQL(`select x from nosuchtable`)
+	var derr *DriverError
+	if !errors.As(err, &derr) || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("%#v", err)
+	}
+	if derr.Code != CodeTableNotExist || derr.SQL != `select x from nosuchtable` || derr.Model != "m22" {
+		t.Errorf("%#v", derr)
+	}
+
+	if err = model.DoSQL(`drop table if exists etesting`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err = model.DoSQL(`create table etesting (ts timestamp, x int)`)
+	}
+	if !errors.Is(err, ErrDuplicate) || ErrorCode(err) != CodeTableExists {
+		t.Errorf("%v", err)
+	}
+
+	err = model.DoSQL(`selects x from etesting`)
+	if ErrorCode(err) != CodeInvalidSQL || ErrorClass(err) != "syntax" {
+		t.Errorf("%v", err)
+	}
+	if ErrorCode(nil) != 0 {
+		t.Errorf("code of nil")
+	}
+	if ErrorCode(errors.New("[0x2662] Table does not exist")) != 0x2662 {
+		t.Errorf("code not parsed")
+	}
+	for code, kind := range map[int]error{CodeParserNoTable3: ErrNotFound, CodeParserNoTable: ErrNotFound, CodeStorageTableNotExist: ErrNotFound, CodeStorageTableExists: ErrDuplicate} {
+		if err := (&DriverError{Code: code, Err: errors.New("3.x")}); !errors.Is(err, kind) {
+			t.Errorf("0x%04X: %v wanted", code, kind)
+		}
+	}
+
+	model.SetArgs(map[string]interface{}{})
+	err = model.EditFK()
+	var merr *Error
+	if !errors.Is(err, ErrMissingKey) || !errors.As(err, &merr) || merr.Model != "m22" {
+		t.Errorf("%#v", err)
+	}
+	if err.Error() != "Foreign key has no value" {
+		t.Errorf("%s", err.Error())
+	}
+	if err = model.Insert(); !errors.Is(err, ErrValidation) {
+		t.Errorf("%v", err)
+	}
+	if err = model.Insupd(); !errors.Is(err, ErrMissingKey) || errors.Is(err, ErrNotFound) {
+		t.Errorf("%v", err)
+	}
+
+	schema := NewSchema(map[string]Navigate{"m22": model})
+	if _, err = schema.Run("none", "topics", nil); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("%v", err)
+	}
+	if _, err = schema.Run("m22", "none", nil); !errors.Is(err, ErrActionNotFound) {
+		t.Errorf("%v", err)
+	}
+}
@@ -0,0 +1,569 @@
+package taodbi
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Export formats built in. Others, like Arrow in package export/arrow,
+// are added by RegisterExportFormat.
+//
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// exportFormat is a registered export format
+type exportFormat struct {
+	name        string
+	contentType string
+	newWriter   func(w io.Writer, labels []string, types []string) (ExportWriter, error)
+}
+
+var (
+	exportMu      sync.RWMutex
+	exportFormats = []*exportFormat{
+		{FormatCSV, "text/csv; charset=utf-8", newCSVExport},
+		{FormatNDJSON, "application/x-ndjson", newNDJSONExport},
+	}
+)
+
+// RegisterExportFormat adds export format 'name' of 'contentType', written
+// by 'newWriter'. It panics if the format is registered twice, as in the
+// init of the package providing it.
+//
+func RegisterExportFormat(name, contentType string, newWriter func(w io.Writer, labels []string, types []string) (ExportWriter, error)) {
+	exportMu.Lock()
+	defer exportMu.Unlock()
+	if name == "" || newWriter == nil {
+		panic("taodbi: invalid export format")
+	}
+	for _, format := range exportFormats {
+		if format.name == name {
+			panic("taodbi: export format registered twice " + name)
+		}
+	}
+	exportFormats = append(exportFormats, &exportFormat{name, contentType, newWriter})
+}
+
+// exportFormatOf returns the registered format 'name', or nil
+func exportFormatOf(name string) *exportFormat {
+	exportMu.RLock()
+	defer exportMu.RUnlock()
+	for _, format := range exportFormats {
+		if format.name == name {
+			return format
+		}
+	}
+	return nil
+}
+
+// ExportWriter writes rows of values in the order of the columns
+type ExportWriter interface {
+	// Write writes a row
+	Write(values []interface{}) error
+	// Close flushes the rows written
+	Close() error
+}
+
+// NewExportWriter returns the writer of 'format' to 'w', for columns
+// named 'labels'. The 'types', needed by typed formats like Arrow only,
+// are those in SelectSQLType: int64, float64, bool or string, for each
+// column, or timestamp for time.Time.
+//
+func NewExportWriter(w io.Writer, format string, labels []string, types []string) (ExportWriter, error) {
+	if item := exportFormatOf(format); item != nil {
+		return item.newWriter(w, labels, types)
+	}
+	return nil, newError(ErrValidation, "", "invalid export format "+format)
+}
+
+// NegotiateFormat returns the export format of the Accept header, of
+// the highest quality, or empty if none is acceptable. Media types are
+// compared exactly, or by the wildcards */*, text/* and application/*.
+// Among equal qualities, the first in the header wins, and CSV for a
+// wildcard.
+//
+func NegotiateFormat(accept string) string {
+	best, quality := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		if q <= quality {
+			continue
+		}
+		if format := formatOf(mediaType); format != "" {
+			best, quality = format, q
+		}
+	}
+	return best
+}
+
+// formatOf returns the export format of media type 'mediaType', which
+// may be a wildcard
+func formatOf(mediaType string) string {
+	switch mediaType {
+	case "*/*", "text/*":
+		return FormatCSV
+	case "application/*":
+		return FormatNDJSON
+	default:
+	}
+	exportMu.RLock()
+	defer exportMu.RUnlock()
+	for _, format := range exportFormats {
+		if typ, _, _ := mime.ParseMediaType(format.contentType); typ == mediaType {
+			return format.name
+		}
+	}
+	return ""
+}
+
+// text formats a value in CSV; rows from nextpages are written as JSON
+func text(v interface{}) string {
+	switch u := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return u
+	case []byte:
+		return string(u)
+	case time.Time:
+		return u.Format("2006-01-02 15:04:05.999999")
+	case []map[string]interface{}, map[string]interface{}, []interface{}:
+		bs, err := json.Marshal(u)
+		if err != nil {
+			return fmt.Sprintf("%v", u)
+		}
+		return string(bs)
+	default:
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+type csvExport struct {
+	*csv.Writer
+}
+
+func newCSVExport(w io.Writer, labels []string, types []string) (ExportWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(labels); err != nil {
+		return nil, err
+	}
+	return &csvExport{cw}, nil
+}
+
+func (self *csvExport) Write(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = text(v)
+	}
+	return self.Writer.Write(record)
+}
+
+func (self *csvExport) Close() error {
+	self.Flush()
+	return self.Error()
+}
+
+type ndjsonExport struct {
+	w      io.Writer
+	labels []string
+}
+
+func newNDJSONExport(w io.Writer, labels []string, types []string) (ExportWriter, error) {
+	return &ndjsonExport{w: w, labels: labels}, nil
+}
+
+// Write writes an object with keys in the order of the columns
+func (self *ndjsonExport) Write(values []interface{}) error {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, label := range self.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(label)
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteString("}\n")
+	_, err := self.w.Write(b.Bytes())
+	return err
+}
+
+func (self *ndjsonExport) Close() error {
+	return nil
+}
+
+func asInt64(v interface{}) (int64, bool) {
+	switch u := v.(type) {
+	case int:
+		return int64(u), true
+	case int8:
+		return int64(u), true
+	case int16:
+		return int64(u), true
+	case int32:
+		return int64(u), true
+	case int64:
+		return u, true
+	case uint8:
+		return int64(u), true
+	case uint16:
+		return int64(u), true
+	case uint32:
+		return int64(u), true
+	default:
+	}
+	return 0, false
+}
+
+// typeOf returns the type name in SelectSQLType of value 'v'
+func typeOf(v interface{}) string {
+	if _, ok := asInt64(v); ok {
+		return "int64"
+	}
+	switch v.(type) {
+	case float32, float64:
+		return "float64"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "timestamp"
+	default:
+	}
+	return "string"
+}
+
+// ExportLists writes 'lists' in 'format', with the columns in the order
+// of 'labels', followed by the other keys in the rows in sorted order.
+//
+func ExportLists(w io.Writer, format string, labels []string, lists []map[string]interface{}) error {
+	labels = append([]string{}, labels...)
+	others := make([]string, 0)
+	for _, item := range lists {
+		for k := range item {
+			if !grep(labels, k) && !grep(others, k) {
+				others = append(others, k)
+			}
+		}
+	}
+	sort.Strings(others)
+	labels = append(labels, others...)
+
+	types := make([]string, len(labels))
+	for i, label := range labels {
+		types[i] = "string"
+		for _, item := range lists {
+			if v := item[label]; v != nil {
+				types[i] = typeOf(v)
+				break
+			}
+		}
+	}
+	writer, err := NewExportWriter(w, format, labels, types)
+	if err != nil {
+		return err
+	}
+	for _, item := range lists {
+		values := make([]interface{}, len(labels))
+		for i, label := range labels {
+			values[i] = item[label]
+		}
+		if err := writer.Write(values); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// ExportSQL streams the rows of 'query' in 'format', without reading
+// them into memory. The types of columns are those reported by the driver.
+//
+func (self *DBI) ExportSQL(w io.Writer, format string, query string, args ...interface{}) error {
+	if self.record(query, args...) {
+		return nil
+	}
+	return self.attempt(false, query, args, func() (int64, error) {
+		sth, release, err := self.prepare(query)
+		if err != nil {
+			return 0, err
+		}
+		defer release()
+		rows, err := sth.Query(Quotes(args)...)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		return self.exportRows(w, format, rows)
+	})
+}
+
+func (self *DBI) exportRows(w io.Writer, format string, rows *sql.Rows) (int64, error) {
+	labels, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	types := make([]string, len(labels))
+	for i, c := range columnTypes {
+		switch name := strings.ToUpper(c.DatabaseTypeName()); {
+		case name == "TIMESTAMP":
+			// by the value in the first row: time.Time, an integer or a string
+			types[i] = "timestamp"
+		case strings.HasSuffix(name, "INT"):
+			types[i] = "int64"
+		case name == "FLOAT" || name == "DOUBLE":
+			types[i] = "float64"
+		case name == "BOOL":
+			types[i] = "bool"
+		default:
+			types[i] = "string"
+		}
+	}
+	var writer ExportWriter
+
+	dialect := self.dialect()
+	n := int64(0)
+	values := make([]interface{}, len(labels))
+	pointers := make([]interface{}, len(labels))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return n, err
+		}
+		for i, v := range values {
+			switch u := v.(type) {
+			case []byte:
+				if values[i], err = dialect.Trim(string(u)); err != nil {
+					return n, err
+				}
+			case string:
+				if types[i] == "string" {
+					if values[i], err = dialect.Trim(u); err != nil {
+						return n, err
+					}
+				}
+			default:
+			}
+		}
+		if writer == nil {
+			if writer, err = NewExportWriter(w, format, labels, timestampTypes(types, values)); err != nil {
+				return n, err
+			}
+		}
+		if err := writer.Write(values); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if writer == nil {
+		if writer, err = NewExportWriter(w, format, labels, timestampTypes(types, nil)); err != nil {
+			return n, err
+		}
+	}
+	return n, writer.Close()
+}
+
+// timestampTypes returns 'types' with the timestamp columns typed by
+// the values of the first row: timestamp for time.Time (parseTime=true),
+// string for text, and int64 for the integers in the database precision
+// or no rows.
+func timestampTypes(types []string, first []interface{}) []string {
+	typed := make([]string, len(types))
+	for i, typ := range types {
+		typed[i] = typ
+		if typ != "timestamp" {
+			continue
+		}
+		var v interface{}
+		if i < len(first) {
+			v = first[i]
+		}
+		switch v.(type) {
+		case time.Time:
+		case string:
+			typed[i] = "string"
+		default:
+			typed[i] = "int64"
+		}
+	}
+	return typed
+}
+
+// ExportLabels returns the output labels of 'action' of 'model' in the order
+// of topics_pars or topics_hash, edit_pars or edit_hash for the edit
+// actions. Those of topics_hash are in the order of the columns.
+func ExportLabels(model string, nav Navigate, action string) ([]string, error) {
+	_, table, _ := openapiTables(nav)
+	if table == nil {
+		return nil, nil
+	}
+	hash, pars := table.TopicsHash, table.TopicsPars
+	switch action {
+	case "edit", "editfk", "lastedit":
+		hash, pars = table.EditHash, table.EditPars
+	default:
+	}
+	values := make([]interface{}, 0)
+	if hasValue(hash) {
+		keys := make([]string, 0)
+		for k := range hash {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			values = append(values, hash[k])
+		}
+	} else {
+		values = pars
+	}
+	labels := make([]string, 0)
+	for _, vs := range values {
+		if v, ok := vs.([]interface{}); ok && len(v) > 0 {
+			vs = v[0]
+		}
+		label, ok := vs.(string)
+		if !ok {
+			return nil, newError(ErrValidation, model, fmt.Sprintf("invalid column %v in %s", vs, action))
+		}
+		labels = append(labels, label)
+	}
+	return labels, nil
+}
+
+// Export runs 'action' of 'model' as Run, and writes the rows in 'format'
+// with the columns in the order of the model definition, only those
+// in the fields argument if any.
+//
+func (self *Schema) Export(w io.Writer, format, model, action string, args map[string]interface{}, extra ...map[string]interface{}) error {
+	nav, ok := self.Models[model]
+	if !ok {
+		return ErrModelNotFound
+	}
+	lists, err := self.Run(model, action, args, extra...)
+	if err != nil {
+		return err
+	}
+	labels, err := ExportLabels(model, nav, action)
+	if err != nil {
+		return err
+	}
+	if main, _, _ := openapiTables(nav); main != nil {
+		if fields, ok := args[main.Fields].([]string); ok && len(fields) > 0 {
+			selected := make([]string, 0)
+			for _, label := range labels {
+				if grep(fields, label) {
+					selected = append(selected, label)
+				}
+			}
+			labels = selected
+		}
+	}
+	return ExportLists(w, format, labels, lists)
+}
+
+// ExportHandler serves GET /model[/action] by Export, the action being
+// topics by default. The query parameters are the args, with multiple
+// values for fields. The format is the parameter format, or negotiated
+// by the Accept header.
+//
+type ExportHandler struct {
+	Schema *Schema
+	sync.Mutex
+}
+
+// NewExportHandler creates an ExportHandler of 'schema'
+func NewExportHandler(schema *Schema) *ExportHandler {
+	return &ExportHandler{Schema: schema}
+}
+
+func (self *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	model, action := parts[len(parts)-1], "topics"
+	if len(parts) > 1 {
+		model, action = parts[len(parts)-2], parts[len(parts)-1]
+	}
+	if _, ok := self.Schema.Models[model]; !ok {
+		model = parts[len(parts)-1]
+		action = "topics"
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = NegotiateFormat(r.Header.Get("Accept"))
+	}
+	item := exportFormatOf(format)
+	if item == nil {
+		http.Error(w, "not acceptable", http.StatusNotAcceptable)
+		return
+	}
+	args := make(map[string]interface{})
+	for k, vs := range query {
+		if k == "format" {
+			continue
+		}
+		if k == self.fields(model) {
+			args[k] = vs
+		} else {
+			args[k] = vs[0]
+		}
+	}
+
+	// rows are written to the buffer first, to answer errors by status
+	var b bytes.Buffer
+	self.Lock()
+	err := self.Schema.Export(&b, format, model, action, args)
+	self.Unlock()
+	switch {
+	case err == nil:
+		w.Header().Set("Content-Type", item.contentType)
+		w.Write(b.Bytes())
+	case err == ErrModelNotFound || err == ErrActionNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// fields returns the name of the fields parameter of 'model'
+func (self *ExportHandler) fields(model string) string {
+	if main, _, _ := openapiTables(self.Schema.Models[model]); main != nil {
+		return main.Fields
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+// Package arrow adds the export format of Apache Arrow IPC stream to
+// taodbi, kept apart for its dependency on the Arrow library. Import it
+// for the side effect:
+//
+//	import _ "github.com/genelet/taodbi/export/arrow"
+//
+package arrow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apache/arrow/go/v15/arrow"
+	"github.com/apache/arrow/go/v15/arrow/array"
+	"github.com/apache/arrow/go/v15/arrow/ipc"
+	"github.com/apache/arrow/go/v15/arrow/memory"
+	"github.com/genelet/taodbi"
+)
+
+// Format is the name of the export format, of ContentType
+const (
+	Format      = "arrow"
+	ContentType = "application/vnd.apache.arrow.stream"
+)
+
+func init() {
+	taodbi.RegisterExportFormat(Format, ContentType, NewWriter)
+}
+
+// batchSize is the number of rows in a record batch
+const batchSize = 1024
+
+type arrowExport struct {
+	w       *ipc.Writer
+	builder *array.RecordBuilder
+	rows    int
+}
+
+// NewWriter returns the writer of Arrow IPC stream to 'w', for columns
+// named 'labels' in 'types' of taodbi.NewExportWriter. A timestamp is
+// written in microseconds.
+//
+func NewWriter(w io.Writer, labels []string, types []string) (taodbi.ExportWriter, error) {
+	fields := make([]arrow.Field, len(labels))
+	for i, label := range labels {
+		typ := "string"
+		if i < len(types) {
+			typ = types[i]
+		}
+		var dataType arrow.DataType
+		switch typ {
+		case "int64":
+			dataType = arrow.PrimitiveTypes.Int64
+		case "float64":
+			dataType = arrow.PrimitiveTypes.Float64
+		case "bool":
+			dataType = arrow.FixedWidthTypes.Boolean
+		case "timestamp":
+			dataType = arrow.FixedWidthTypes.Timestamp_us
+		default:
+			dataType = arrow.BinaryTypes.String
+		}
+		fields[i] = arrow.Field{Name: label, Type: dataType, Nullable: true}
+	}
+	schema := arrow.NewSchema(fields, nil)
+	return &arrowExport{
+		w:       ipc.NewWriter(w, ipc.WithSchema(schema)),
+		builder: array.NewRecordBuilder(memory.DefaultAllocator, schema),
+	}, nil
+}
+
+// Write appends a row, and writes a record batch if it is full.
+// A value not of the column type is NULL.
+func (self *arrowExport) Write(values []interface{}) error {
+	for i, field := range self.builder.Fields() {
+		var v interface{}
+		if i < len(values) {
+			v = values[i]
+		}
+		switch b := field.(type) {
+		case *array.Int64Builder:
+			if n, ok := asInt64(v); ok {
+				b.Append(n)
+			} else {
+				b.AppendNull()
+			}
+		case *array.Float64Builder:
+			if f, ok := asFloat64(v); ok {
+				b.Append(f)
+			} else {
+				b.AppendNull()
+			}
+		case *array.BooleanBuilder:
+			if x, ok := v.(bool); ok {
+				b.Append(x)
+			} else {
+				b.AppendNull()
+			}
+		case *array.TimestampBuilder:
+			if t, ok := v.(time.Time); ok {
+				b.Append(arrow.Timestamp(t.UnixMicro()))
+			} else {
+				b.AppendNull()
+			}
+		case *array.StringBuilder:
+			if v == nil {
+				b.AppendNull()
+			} else {
+				b.Append(text(v))
+			}
+		}
+	}
+	if self.rows++; self.rows >= batchSize {
+		return self.flush()
+	}
+	return nil
+}
+
+func (self *arrowExport) flush() error {
+	record := self.builder.NewRecord()
+	defer record.Release()
+	self.rows = 0
+	return self.w.Write(record)
+}
+
+// Close writes the last record batch, and the end of stream
+func (self *arrowExport) Close() error {
+	defer self.builder.Release()
+	if self.rows > 0 {
+		if err := self.flush(); err != nil {
+			return err
+		}
+	}
+	return self.w.Close()
+}
+
+func asInt64(v interface{}) (int64, bool) {
+	switch u := v.(type) {
+	case int:
+		return int64(u), true
+	case int8:
+		return int64(u), true
+	case int16:
+		return int64(u), true
+	case int32:
+		return int64(u), true
+	case int64:
+		return u, true
+	case uint8:
+		return int64(u), true
+	case uint16:
+		return int64(u), true
+	case uint32:
+		return int64(u), true
+	default:
+	}
+	return 0, false
+}
+
+func asFloat64(v interface{}) (float64, bool) {
+	switch u := v.(type) {
+	case float32:
+		return float64(u), true
+	case float64:
+		return u, true
+	default:
+	}
+	if n, ok := asInt64(v); ok {
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// text formats a value of a string column, as in the CSV of taodbi
+func text(v interface{}) string {
+	switch u := v.(type) {
+	case string:
+		return u
+	case []byte:
+		return string(u)
+	case time.Time:
+		return u.Format("2006-01-02 15:04:05.999999")
+	case []map[string]interface{}, map[string]interface{}, []interface{}:
+		bs, err := json.Marshal(u)
+		if err != nil {
+			return fmt.Sprintf("%v", u)
+		}
+		return string(bs)
+	default:
+	}
+	return fmt.Sprintf("%v", v)
+}
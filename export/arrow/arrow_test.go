@@ -0,0 +1,129 @@
+package arrow
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v15/arrow"
+	"github.com/apache/arrow/go/v15/arrow/array"
+	"github.com/apache/arrow/go/v15/arrow/ipc"
+	"github.com/genelet/taodbi"
+	_ "github.com/genelet/taodbi/taodbitest"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	for accept, format := range map[string]string{
+		"application/vnd.apache.arrow.stream":                  Format,
+		"*/*; q=0.1, application/vnd.apache.arrow.stream":      Format,
+		"application/vnd.apache.arrow.stream; q=0.5, text/csv": taodbi.FormatCSV,
+	} {
+		if got := taodbi.NegotiateFormat(accept); got != format {
+			t.Errorf("%s: %s", accept, got)
+		}
+	}
+}
+
+func TestExportLists(t *testing.T) {
+	lists := []map[string]interface{}{
+		{"z": "1", "id": int64(10), "x": "a, b", "extra": 1.5},
+		{"id": int64(11), "x": "c", "nested": []map[string]interface{}{{"k": 1}}},
+	}
+	var b bytes.Buffer
+	if err := taodbi.ExportLists(&b, Format, []string{"id", "x", "z"}, lists); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := ipc.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Release()
+	fields := reader.Schema().Fields()
+	if len(fields) != 5 || fields[0].Name != "id" || fields[0].Type.String() != "int64" || fields[3].Type.String() != "float64" {
+		t.Errorf("%v", reader.Schema())
+	}
+	if !reader.Next() {
+		t.Fatal(reader.Err())
+	}
+	record := reader.Record()
+	ids := record.Column(0).(*array.Int64)
+	zs := record.Column(2).(*array.String)
+	nested := record.Column(4).(*array.String)
+	if record.NumRows() != 2 || ids.Value(1) != 11 || zs.Value(0) != "1" || !zs.IsNull(1) || nested.Value(1) != `[{"k":1}]` {
+		t.Errorf("%v", record)
+	}
+}
+
+func TestExportTimestamp(t *testing.T) {
+	c, err := taodbi.NewConfig("../../config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Params = map[string]string{"parseTime": "true"}
+	db, err := sql.Open("taodbitest", c.DSN(c.Database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	dbi := &taodbi.DBI{DB: db}
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS ttesting",
+		"CREATE TABLE ttesting (id timestamp, x int)",
+		"INSERT INTO ttesting VALUES ('2020-09-13 12:26:40.000', 1)",
+	} {
+		if err := dbi.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the fake driver returns timestamps as text in parseTime=true
+	var b bytes.Buffer
+	if err := dbi.ExportSQL(&b, Format, "SELECT id, x FROM ttesting"); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := ipc.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Release()
+	if !reader.Next() {
+		t.Fatal(reader.Err())
+	}
+	if ids := reader.Record().Column(0); ids.IsNull(0) {
+		t.Errorf("%v", ids)
+	}
+
+	b.Reset()
+	if err := dbi.ExportSQL(&b, Format, "SELECT id, x FROM ttesting WHERE x>1"); err != nil {
+		t.Fatal(err)
+	}
+	if reader, err = ipc.NewReader(&b); err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Release()
+	if typ := reader.Schema().Field(0).Type; typ.ID() != arrow.INT64 {
+		t.Errorf("%v", typ)
+	}
+
+	// and the native driver as time.Time
+	ts := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+	b.Reset()
+	if err := taodbi.ExportLists(&b, Format, []string{"id", "x"}, []map[string]interface{}{{"id": ts, "x": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if reader, err = ipc.NewReader(&b); err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Release()
+	if typ := reader.Schema().Field(0).Type; typ.ID() != arrow.TIMESTAMP {
+		t.Fatalf("%v", typ)
+	}
+	if !reader.Next() {
+		t.Fatal(reader.Err())
+	}
+	ids := reader.Record().Column(0).(*array.Timestamp)
+	if ids.IsNull(0) || !ids.Value(0).ToTime(arrow.Microsecond).Equal(ts) {
+		t.Errorf("%v", ids)
+	}
+}
@@ -0,0 +1,185 @@
+package taodbi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	for accept, format := range map[string]string{
+		"text/csv":                              FormatCSV,
+		"application/x-ndjson; q=0.9, text/csv": FormatCSV,
+		"application/x-ndjson, text/csv; q=0.5": FormatNDJSON,
+		"application/vnd.apache.arrow.stream":   "",
+		"*/*":                                   FormatCSV,
+		"*/*; q=0.1, application/vnd.apache.arrow.stream": FormatCSV,
+		"application/*":            FormatNDJSON,
+		"text/csv; q=0":            "",
+		"text/c, application/x-nd": "",
+		"application/xml":          "",
+		"application/xml, application/x-ndjson;q=0.5": FormatNDJSON,
+	} {
+		if got := NegotiateFormat(accept); got != format {
+			t.Errorf("%s: %s", accept, got)
+		}
+	}
+}
+
+func TestExportLists(t *testing.T) {
+	lists := []map[string]interface{}{
+		{"z": "1", "id": int64(10), "x": "a, b", "extra": 1.5},
+		{"id": int64(11), "x": "c", "nested": []map[string]interface{}{{"k": 1}}},
+	}
+	labels := []string{"id", "x", "z"}
+
+	var b bytes.Buffer
+	if err := ExportLists(&b, FormatCSV, labels, lists); err != nil {
+		t.Fatal(err)
+	}
+	expected := "id,x,z,extra,nested\n10,\"a, b\",1,1.5,\n11,c,,,\"[{\"\"k\"\":1}]\"\n"
+	if b.String() != expected {
+		t.Errorf("%q", b.String())
+	}
+
+	b.Reset()
+	if err := ExportLists(&b, FormatNDJSON, labels, lists[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != `{"id":10,"x":"a, b","z":"1","extra":1.5}`+"\n" {
+		t.Errorf("%q", b.String())
+	}
+
+	if err := ExportLists(&b, "xml", labels, lists); err == nil {
+		t.Errorf("format not checked")
+	}
+}
+
+func TestExportHandler(t *testing.T) {
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	model, err := NewModel("m1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.SetDB(db)
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS atesting",
+		"CREATE TABLE atesting (id timestamp, x binary(8), y binary(8), z binary(8))",
+		"INSERT INTO atesting VALUES (1600000000000000, 'a', 'b', 'c')",
+		"INSERT INTO atesting VALUES (1600000001000000, 'd', 'e', 'f')",
+	} {
+		if err := model.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	model.SetDB(nil)
+	model.Actions = map[string]func(...map[string]interface{}) error{
+		"topics": func(args ...map[string]interface{}) error { return model.Topics(args...) },
+		"edit":   func(args ...map[string]interface{}) error { return model.Edit(args...) },
+	}
+
+	var b bytes.Buffer
+	dbi := &DBI{DB: db}
+	if err := dbi.ExportSQL(&b, FormatCSV, "SELECT z, x FROM atesting WHERE id>=? ORDER BY id", 1600000001000000); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "z,x\nf,d\n" {
+		t.Errorf("%q", b.String())
+	}
+
+	schema := NewSchema(map[string]Navigate{"m1": model})
+	schema.SetDB(db)
+	server := httptest.NewServer(NewExportHandler(schema))
+	defer server.Close()
+
+	get := func(path, accept string) (int, string, string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.StatusCode, res.Header.Get("Content-Type"), string(body)
+	}
+
+	code, typ, body := get("/m1/topics", "text/csv")
+	if code != 200 || !strings.HasPrefix(typ, "text/csv") || !strings.HasPrefix(body, "id,x,y,z\n") || strings.Count(body, "\n") != 3 {
+		t.Errorf("%d %s %q", code, typ, body)
+	}
+	code, typ, body = get("/m1?format=ndjson&fields=x&fields=id", "")
+	if code != 200 || typ != "application/x-ndjson" || strings.Count(body, "\n") != 2 || !strings.Contains(body, `"x":"a"`) || strings.Contains(body, `"y"`) {
+		t.Errorf("%d %s %q", code, typ, body)
+	}
+	code, _, body = get("/m1/edit?id=1600000001000000", "application/x-ndjson")
+	if code != 200 || !strings.HasPrefix(body, `{"id":1600000001000000,"x":"d","y":"e","z":"f"}`) {
+		t.Errorf("%d %q", code, body)
+	}
+	if code, _, _ = get("/m1/topics", "application/xml"); code != http.StatusNotAcceptable {
+		t.Errorf("%d", code)
+	}
+	if code, _, _ = get("/none", "text/csv"); code != http.StatusNotFound {
+		t.Errorf("%d", code)
+	}
+}
+
+func TestLabelsOf(t *testing.T) {
+	model := &Model{}
+	model.TopicsPars = []interface{}{"id", []interface{}{"x", "string"}}
+	model.EditHash = map[string]interface{}{"b": "y", "a": []interface{}{"z", "int"}}
+	if labels, err := ExportLabels("m", model, "topics"); err != nil || strings.Join(labels, ",") != "id,x" {
+		t.Errorf("%v %v", labels, err)
+	}
+	if labels, err := ExportLabels("m", model, "editfk"); err != nil || strings.Join(labels, ",") != "z,y" {
+		t.Errorf("%v %v", labels, err)
+	}
+	for _, pars := range [][]interface{}{{"id", 1}, {[]interface{}{2, "int"}}, {[]interface{}{}}} {
+		model.TopicsPars = pars
+		if _, err := ExportLabels("m", model, "topics"); !errors.Is(err, ErrValidation) {
+			t.Errorf("%v: %v", pars, err)
+		}
+	}
+}
+
+func TestExportTimestamp(t *testing.T) {
+	ts := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+	types := timestampTypes([]string{"timestamp", "timestamp", "timestamp", "int64"}, []interface{}{ts, "2020-09-13 12:26:40.000", int64(1600000000000), 1})
+	if strings.Join(types, ",") != "timestamp,string,int64,int64" {
+		t.Errorf("%v", types)
+	}
+	if typeOf(ts) != "timestamp" {
+		t.Errorf("%s", typeOf(ts))
+	}
+}
+
+func TestRegisterExportFormat(t *testing.T) {
+	defer func(formats []*exportFormat) { exportFormats = formats }(exportFormats)
+	RegisterExportFormat("tsv", "text/tab-separated-values", newCSVExport)
+	if format := NegotiateFormat("text/tab-separated-values, text/csv; q=0.5"); format != "tsv" {
+		t.Errorf("%s", format)
+	}
+	if _, err := NewExportWriter(io.Discard, "tsv", nil, nil); err != nil {
+		t.Errorf("%v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("no panic of registering twice")
+		}
+	}()
+	RegisterExportFormat(FormatCSV, "text/csv", newCSVExport)
+}
@@ -0,0 +1,416 @@
+package taodbi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Grafana serves the JSON datasource API of Grafana on the models of
+// Schema. A target is "model.column" for a timeseries, aggregated by
+// Aggregate in windows of the query interval, one series for each value
+// of the tags of Smodel; or "model" for a table of topics_pars.
+//
+type Grafana struct {
+	Schema *Schema
+	// Aggregate is the function in the windows, default AVG
+	Aggregate string
+	// Precision is the precision of the database, "ms" (default), "us" or "ns"
+	Precision string
+	sync.Mutex
+}
+
+// NewGrafana creates a Grafana datasource of 'schema'
+func NewGrafana(schema *Schema) *Grafana {
+	return &Grafana{Schema: schema}
+}
+
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type grafanaTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"`
+}
+
+type grafanaQuery struct {
+	Range         grafanaRange    `json:"range"`
+	IntervalMs    int64           `json:"intervalMs"`
+	MaxDataPoints int             `json:"maxDataPoints"`
+	Targets       []grafanaTarget `json:"targets"`
+}
+
+type grafanaAnnotation struct {
+	Range      grafanaRange           `json:"range"`
+	Annotation map[string]interface{} `json:"annotation"`
+}
+
+// modelOf returns the model in Navigate, and the tags if it is Smodel
+func modelOf(navigate Navigate) (*Model, []string) {
+	switch v := navigate.(type) {
+	case *Model:
+		return v, nil
+	case *Smodel:
+		return &v.Model, v.Tags
+	case *Rmodel:
+		return &v.Model, nil
+	default:
+	}
+	return nil, nil
+}
+
+// columns returns the columns of topics_pars, or topics_hash, in order
+func (self *Model) columns() ([]string, error) {
+	columns := make([]string, 0)
+	if !hasValue(self.TopicsHash) {
+		for _, vs := range self.TopicsPars {
+			if v, ok := vs.([]interface{}); ok && len(v) > 0 {
+				vs = v[0]
+			}
+			column, ok := vs.(string)
+			if !ok {
+				return nil, newError(ErrValidation, self.ModelName, fmt.Sprintf("invalid column %v in topics_pars", vs))
+			}
+			columns = append(columns, column)
+		}
+		return columns, nil
+	}
+	for k := range self.TopicsHash {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+	return columns, nil
+}
+
+// Search returns the targets containing 'target': the model names, and
+// model.column for the columns other than the key and the tags
+func (self *Grafana) Search(target string) ([]string, error) {
+	names := make([]string, 0)
+	for name, navigate := range self.Schema.Models {
+		model, tags := modelOf(navigate)
+		if model == nil {
+			continue
+		}
+		columns, err := model.columns()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		for _, column := range columns {
+			if column != model.CurrentKey && !grep(tags, column) {
+				names = append(names, name+"."+column)
+			}
+		}
+	}
+	found := make([]string, 0)
+	for _, name := range names {
+		if strings.Contains(name, target) {
+			found = append(found, name)
+		}
+	}
+	sort.Strings(found)
+	return found, nil
+}
+
+// model returns the model of 'target', with the tags and the column,
+// the model being bound to the database of Schema until 'release'
+func (self *Grafana) model(target string) (*Model, []string, string, func(), error) {
+	name, column := target, ""
+	if i := strings.IndexByte(target, '.'); i > 0 {
+		name, column = target[:i], target[i+1:]
+	}
+	navigate := self.Schema.GetNavigate(name, map[string]interface{}{})
+	if navigate == nil {
+		return nil, nil, "", nil, newError(ErrModelNotFound, name, "model not found: "+name)
+	}
+	release := func() {
+		navigate.SetDB(nil)
+		navigate.SetRecorder(nil)
+		navigate.SetHooks()
+	}
+	model, tags := modelOf(navigate)
+	if model == nil {
+		release()
+		return nil, nil, "", nil, newError(ErrValidation, name, "invalid target: "+target)
+	}
+	columns, err := model.columns()
+	if err != nil {
+		release()
+		return nil, nil, "", nil, err
+	}
+	if column != "" && !grep(columns, column) {
+		release()
+		return nil, nil, "", nil, newError(ErrValidation, name, "invalid target: "+target)
+	}
+	return model, tags, column, release, nil
+}
+
+func (self *Grafana) unit() int64 {
+	switch self.Precision {
+	case "us":
+		return int64(time.Microsecond)
+	case "ns":
+		return int64(time.Nanosecond)
+	default:
+	}
+	return int64(time.Millisecond)
+}
+
+// millis converts a timestamp read from the database to milliseconds
+func (self *Grafana) millis(v interface{}) interface{} {
+	switch u := v.(type) {
+	case int64:
+		return u * self.unit() / int64(time.Millisecond)
+	case int:
+		return int64(u) * self.unit() / int64(time.Millisecond)
+	default:
+	}
+	return v
+}
+
+// interval returns the window of the query in TDengine duration
+func interval(query *grafanaQuery) string {
+	ms := query.IntervalMs
+	if ms <= 0 && query.MaxDataPoints > 0 {
+		ms = query.Range.To.Sub(query.Range.From).Milliseconds() / int64(query.MaxDataPoints)
+	}
+	if ms <= 0 {
+		ms = 60000
+	}
+	if ms < 10 {
+		ms = 10
+	}
+	if ms%1000 == 0 {
+		return fmt.Sprintf("%ds", ms/1000)
+	}
+	return fmt.Sprintf("%da", ms)
+}
+
+// timeseries returns the series of 'target' aggregated in windows
+func (self *Grafana) timeseries(query *grafanaQuery, target string) ([]map[string]interface{}, error) {
+	model, tags, column, release, err := self.model(target)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if column == "" {
+		return nil, newError(ErrValidation, model.ModelName, "no column in target: "+target)
+	}
+	aggregate := self.Aggregate
+	if aggregate == "" {
+		aggregate = "AVG"
+	}
+
+	labels := append([]string{model.CurrentKey, column}, tags...)
+	types := []string{"int64", "float64"}
+	for range tags {
+		types = append(types, "string")
+	}
+	sql := model.dialect().Interval(aggregate+"("+column+")", model.CurrentTable, model.CurrentKey+">=? AND "+model.CurrentKey+"<=?", interval(query), tags)
+	lists := make([]map[string]interface{}, 0)
+	if err := model.SelectSQLTypeLabel(&lists, types, labels, sql, query.Range.From.Local(), query.Range.To.Local()); err != nil {
+		return nil, err
+	}
+
+	all := make([]map[string]interface{}, 0)
+	index := make(map[string]map[string]interface{})
+	for _, item := range lists {
+		name := target
+		if len(tags) > 0 {
+			pairs := make([]string, len(tags))
+			for i, tag := range tags {
+				pairs[i] = fmt.Sprintf("%s=%q", tag, item[tag])
+			}
+			name += "{" + strings.Join(pairs, ", ") + "}"
+		}
+		series, ok := index[name]
+		if !ok {
+			series = map[string]interface{}{"target": name, "datapoints": [][]interface{}{}}
+			index[name] = series
+			all = append(all, series)
+		}
+		series["datapoints"] = append(series["datapoints"].([][]interface{}), []interface{}{item[column], self.millis(item[model.CurrentKey])})
+	}
+	return all, nil
+}
+
+// table returns the rows of 'target' in the time range
+func (self *Grafana) table(query *grafanaQuery, target string) (map[string]interface{}, error) {
+	model, tags, column, release, err := self.model(target)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	labels, err := model.columns()
+	if err != nil {
+		return nil, err
+	}
+	if column != "" {
+		labels = append([]string{model.CurrentKey, column}, tags...)
+	}
+	sql := "SELECT " + strings.Join(labels, ", ") + " FROM " + model.CurrentTable + " WHERE " + model.CurrentKey + ">=? AND " + model.CurrentKey + "<=?"
+	if query.MaxDataPoints > 0 {
+		sql += fmt.Sprintf(" LIMIT %d", query.MaxDataPoints)
+	}
+	lists := make([]map[string]interface{}, 0)
+	if err := model.SelectSQLLabel(&lists, labels, sql, query.Range.From.Local(), query.Range.To.Local()); err != nil {
+		return nil, err
+	}
+
+	columns := make([]map[string]string, len(labels))
+	for i, label := range labels {
+		typ := "string"
+		var value interface{}
+		for _, item := range lists {
+			if value = item[label]; value != nil {
+				break
+			}
+		}
+		switch value.(type) {
+		case nil, string:
+		case bool:
+			typ = "boolean"
+		default:
+			typ = "number"
+		}
+		if label == model.CurrentKey {
+			typ = "time"
+		}
+		columns[i] = map[string]string{"text": label, "type": typ}
+	}
+	rows := make([][]interface{}, 0)
+	for _, item := range lists {
+		row := make([]interface{}, len(labels))
+		for i, label := range labels {
+			row[i] = item[label]
+			if label == model.CurrentKey {
+				row[i] = self.millis(row[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return map[string]interface{}{"type": "table", "columns": columns, "rows": rows}, nil
+}
+
+// Query answers the targets of 'query', as timeseries or tables
+func (self *Grafana) Query(query *grafanaQuery) ([]interface{}, error) {
+	self.Lock()
+	defer self.Unlock()
+	results := make([]interface{}, 0)
+	for _, target := range query.Targets {
+		if target.Type == "table" {
+			table, err := self.table(query, target.Target)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, table)
+			continue
+		}
+		all, err := self.timeseries(query, target.Target)
+		if err != nil {
+			return nil, err
+		}
+		for _, series := range all {
+			results = append(results, series)
+		}
+	}
+	return results, nil
+}
+
+// Annotations returns an event for each row of the annotation query
+// "model.column" in the time range, titled by the column, and tagged
+// by the tags of Smodel.
+//
+func (self *Grafana) Annotations(annotation *grafanaAnnotation) ([]map[string]interface{}, error) {
+	target, _ := annotation.Annotation["query"].(string)
+	query := &grafanaQuery{Range: annotation.Range}
+	if !strings.Contains(target, ".") {
+		return nil, newError(ErrValidation, target, "no column in annotation query: "+target)
+	}
+	self.Lock()
+	defer self.Unlock()
+	table, err := self.table(query, target)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]map[string]interface{}, 0)
+	for _, row := range table["rows"].([][]interface{}) {
+		title := fmt.Sprintf("%v", row[1])
+		tags := make([]string, 0)
+		for _, v := range row[2:] {
+			tags = append(tags, fmt.Sprintf("%v", v))
+		}
+		events = append(events, map[string]interface{}{
+			"annotation": annotation.Annotation,
+			"time":       row[0],
+			"title":      title,
+			"text":       title,
+			"tags":       tags,
+		})
+	}
+	return events, nil
+}
+
+// ServeHTTP serves / for the connection test, /search, /query and
+// /annotations of the JSON datasource API.
+//
+func (self *Grafana) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimRight(r.URL.Path, "/")
+	var result interface{}
+	var err error
+	switch {
+	case strings.HasSuffix(path, "/search"):
+		var body struct {
+			Target string `json:"target"`
+		}
+		if !decodeJSON(w, r, &body) {
+			return
+		}
+		result, err = self.Search(body.Target)
+	case strings.HasSuffix(path, "/query"):
+		query := new(grafanaQuery)
+		if !decodeJSON(w, r, query) {
+			return
+		}
+		result, err = self.Query(query)
+	case strings.HasSuffix(path, "/annotations"):
+		annotation := new(grafanaAnnotation)
+		if !decodeJSON(w, r, annotation) {
+			return
+		}
+		result, err = self.Annotations(annotation)
+	default:
+		w.Write([]byte("OK"))
+		return
+	}
+
+	var modelErr *Error
+	switch {
+	case err == nil:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	case errors.As(err, &modelErr):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// decodeJSON decodes the body of 'r', which may be empty, into 'v',
+// answering 400 if it fails
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
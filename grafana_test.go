@@ -0,0 +1,136 @@
+package taodbi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGrafana(t *testing.T) {
+	if testDriver == "taosLite" {
+		t.Skip("INTERVAL is not supported")
+	}
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	smodel, err := NewSmodel("prom/testdata/prom.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smodel.SetDB(db)
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS samples",
+		"CREATE TABLE samples (ts timestamp, value double) TAGS (__name__ binary(64), job binary(32), instance binary(32))",
+	} {
+		if err := smodel.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Unix(1600000000, 0)
+	rows := make([]map[string]interface{}, 0)
+	for i, v := range []float64{1, 3, 5, 7} {
+		instance := "a"
+		if i == 3 {
+			instance = "b"
+		}
+		rows = append(rows, map[string]interface{}{"ts": start.Add(time.Duration(i%3) * 500 * time.Millisecond), "value": v, "__name__": "up", "job": "node", "instance": instance})
+	}
+	if err := smodel.InsertRows(rows); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := NewSchema(map[string]Navigate{"samples": smodel})
+	schema.SetDB(db)
+	grafana := NewGrafana(schema)
+	grafana.Precision = "us"
+	server := httptest.NewServer(grafana)
+	defer server.Close()
+
+	post := func(path, body string, v interface{}) int {
+		res, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusOK && v != nil {
+			if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res.StatusCode
+	}
+
+	if code := post("/", "", nil); code != http.StatusOK {
+		t.Errorf("%d", code)
+	}
+	var names []string
+	post("/search", `{"target":""}`, &names)
+	if !reflect.DeepEqual(names, []string{"samples", "samples.value"}) {
+		t.Errorf("%v", names)
+	}
+
+	var results []map[string]interface{}
+	if code := post("/query", `{"range":{"from":"2020-09-13T12:26:40Z","to":"2020-09-13T12:26:42Z"},"intervalMs":1000,
+"targets":[{"target":"samples.value","refId":"A","type":"timeserie"},{"target":"samples","refId":"B","type":"table"}]}`, &results); code != http.StatusOK {
+		t.Fatalf("%d", code)
+	}
+	if len(results) != 3 {
+		t.Fatalf("%#v", results)
+	}
+	a, _ := json.Marshal(results[0])
+	if string(a) != `{"datapoints":[[2,1600000000000],[5,1600000001000]],"target":"samples.value{__name__=\"up\", job=\"node\", instance=\"a\"}"}` {
+		t.Errorf("%s", a)
+	}
+	b, _ := json.Marshal(results[1])
+	if string(b) != `{"datapoints":[[7,1600000000000]],"target":"samples.value{__name__=\"up\", job=\"node\", instance=\"b\"}"}` {
+		t.Errorf("%s", b)
+	}
+	table := results[2]
+	columns, _ := json.Marshal(table["columns"])
+	if table["type"] != "table" || string(columns) != `[{"text":"ts","type":"time"},{"text":"value","type":"number"},{"text":"__name__","type":"string"},{"text":"job","type":"string"},{"text":"instance","type":"string"}]` {
+		t.Errorf("%#v", table)
+	}
+	if n := len(table["rows"].([]interface{})); n != 4 {
+		t.Errorf("%d", n)
+	}
+
+	var events []map[string]interface{}
+	if code := post("/annotations", `{"range":{"from":"2020-09-13T12:26:40.4Z","to":"2020-09-13T12:26:40.6Z"},"annotation":{"name":"a","query":"samples.value"}}`, &events); code != http.StatusOK {
+		t.Fatalf("%d", code)
+	}
+	if len(events) != 1 || events[0]["title"] != "3" || events[0]["time"] != 1600000000500.0 {
+		t.Errorf("%#v", events)
+	}
+
+	for _, body := range []string{
+		`{"targets":[{"target":"nosuch.value"}]}`,
+		`{"targets":[{"target":"samples.nosuch"}]}`,
+		`{"targets":[{"target":"samples","type":"timeserie"}]}`,
+		`{"targets":`,
+	} {
+		if code := post("/query", body, nil); code != http.StatusBadRequest {
+			t.Errorf("%s: %d", body, code)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	model := &Model{}
+	model.TopicsPars = []interface{}{"ts", []interface{}{"value", "float64"}}
+	if columns, err := model.columns(); err != nil || strings.Join(columns, ",") != "ts,value" {
+		t.Errorf("%v %v", columns, err)
+	}
+	for _, pars := range [][]interface{}{{"ts", 1}, {[]interface{}{2, "int"}}, {[]interface{}{}}} {
+		model.TopicsPars = pars
+		if _, err := model.columns(); !errors.Is(err, ErrValidation) {
+			t.Errorf("%v: %v", pars, err)
+		}
+	}
+}
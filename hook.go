@@ -0,0 +1,121 @@
+package taodbi
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Event describes a statement run through DBI.
+// Rows, Duration and Err are set after the statement is done.
+type Event struct {
+	Query  string
+	Args   []interface{}
+	Model  string
+	Action string
+
+	Start    time.Time
+	Duration time.Duration
+	// Rows: the number of rows affected or returned
+	Rows int64
+	Err  error
+}
+
+// Hook observes statements run through DBI.
+//
+type Hook interface {
+	// Before is called before the statement is sent to the database
+	Before(*Event)
+	// After is called after the statement is done
+	After(*Event)
+}
+
+// observe runs the hooks around 'run', which returns the number of rows,
+// and wraps its error in DriverError
+func (self *DBI) observe(query string, args []interface{}, run func() (int64, error)) error {
+	if len(self.Hooks) == 0 {
+		_, err := run()
+		return self.wrap(query, err)
+	}
+
+	event := &Event{Query: query, Args: args, Model: self.ModelName, Action: self.ActionName, Start: time.Now()}
+	for _, hook := range self.Hooks {
+		hook.Before(event)
+	}
+	event.Rows, event.Err = run()
+	event.Err = self.wrap(query, event.Err)
+	event.Duration = time.Since(event.Start)
+	for i := len(self.Hooks) - 1; i >= 0; i-- {
+		self.Hooks[i].After(event)
+	}
+	return event.Err
+}
+
+func (self *Event) attrs() []slog.Attr {
+	attrs := []slog.Attr{slog.String("sql", self.Query)}
+	if len(self.Args) > 0 {
+		attrs = append(attrs, slog.Any("args", self.Args))
+	}
+	if self.Model != "" {
+		attrs = append(attrs, slog.String("model", self.Model))
+	}
+	if self.Action != "" {
+		attrs = append(attrs, slog.String("action", self.Action))
+	}
+	attrs = append(attrs, slog.Duration("duration", self.Duration), slog.Int64("rows", self.Rows))
+	if self.Err != nil {
+		attrs = append(attrs, slog.String("error", self.Err.Error()))
+	}
+	return attrs
+}
+
+// SlogHook logs every statement at Level, and failed ones at Error.
+//
+type SlogHook struct {
+	Logger *slog.Logger
+	Level  slog.Level
+}
+
+// NewSlogHook logs statements into 'logger' at level Debug;
+// slog.Default() is used if 'logger' is nil.
+func NewSlogHook(logger *slog.Logger) *SlogHook {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogHook{Logger: logger, Level: slog.LevelDebug}
+}
+
+func (self *SlogHook) Before(event *Event) {}
+
+func (self *SlogHook) After(event *Event) {
+	level := self.Level
+	if event.Err != nil {
+		level = slog.LevelError
+	}
+	self.Logger.LogAttrs(context.Background(), level, "taodbi statement", event.attrs()...)
+}
+
+// SlowHook logs at Warn the statements taking Threshold or longer.
+//
+type SlowHook struct {
+	Logger    *slog.Logger
+	Threshold time.Duration
+}
+
+// NewSlowHook logs slow statements into 'logger';
+// slog.Default() is used if 'logger' is nil.
+func NewSlowHook(logger *slog.Logger, threshold time.Duration) *SlowHook {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlowHook{Logger: logger, Threshold: threshold}
+}
+
+func (self *SlowHook) Before(event *Event) {}
+
+func (self *SlowHook) After(event *Event) {
+	if event.Duration < self.Threshold {
+		return
+	}
+	self.Logger.LogAttrs(context.Background(), slog.LevelWarn, "taodbi slow statement", event.attrs()...)
+}
@@ -0,0 +1,82 @@
+package taodbi
+
+import (
+	"bytes"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+type eventsHook struct {
+	before int
+	events []Event
+}
+
+func (self *eventsHook) Before(event *Event) {
+	self.before++
+}
+
+func (self *eventsHook) After(event *Event) {
+	self.events = append(self.events, *event)
+}
+
+func TestHook(t *testing.T) {
+	c := newconf("config.json")
+	db, err := sql.Open(c.DbType, c.DSN(c.Database))
+	if err != nil { t.Fatal(err) }
+	defer db.Close()
+
+	model, err := NewModel("m1.json")
+	if err != nil { t.Fatal(err) }
+	model.SetDB(db)
+	if err = model.DoSQL(`drop table if exists atesting`); err != nil { t.Fatal(err) }
+	if err = model.DoSQL(`CREATE TABLE atesting (id timestamp, x binary(8), y binary(8), z binary(8))`); err != nil { t.Fatal(err) }
+	model.Actions = map[string]func(...map[string]interface{}) error{
+		"topics": func(args ...map[string]interface{}) error { return model.Topics(args...) },
+		"insert": func(args ...map[string]interface{}) error { return model.Insert(args...) },
+	}
+
+	hook := &eventsHook{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	schema := NewSchema(map[string]Navigate{"m1": model})
+	schema.SetDB(db)
+	schema.SetHooks(hook, NewSlogHook(logger), NewSlowHook(logger, time.Hour))
+
+	if _, err = schema.Run("m1", "insert", map[string]interface{}{"x":"a1234567"}); err != nil { t.Fatal(err) }
+	lists, err := schema.Run("m1", "topics", map[string]interface{}{})
+	if err != nil { t.Fatal(err) }
+
+	events := hook.events
+	if hook.before != 3 || len(events) != 3 || len(lists) != 1 {
+		t.Fatalf("%d %#v", hook.before, events)
+	}
+	if events[0].Model != "m1" || events[0].Action != "insert" || events[0].Rows != 1 ||
+		!strings.HasPrefix(events[0].Query, "INSERT INTO atesting") || events[0].Args[0] != "a1234567" {
+		t.Errorf("%#v", events[0])
+	}
+	if events[2].Model != "m1" || events[2].Action != "topics" || events[2].Rows != 1 || events[2].Duration <= 0 {
+		t.Errorf("%#v", events[2])
+	}
+	if model.ModelName != "" || model.ActionName != "" || model.Hooks != nil {
+		t.Errorf("names and hooks should be unset after Run")
+	}
+
+	out := buf.String()
+	if strings.Count(out, "level=DEBUG msg=\"taodbi statement\"") != 3 ||
+		!strings.Contains(out, "model=m1 action=topics") || strings.Contains(out, "slow") {
+		t.Errorf("%s", out)
+	}
+
+	buf.Reset()
+	dbi := &DBI{DB: db, Hooks: []Hook{NewSlogHook(logger), NewSlowHook(logger, 0)}}
+	if err = dbi.DoSQL(`INSERT INTO nosuchtable VALUES (now, 'a')`); err == nil {
+		t.Errorf("error expected")
+	}
+	out = buf.String()
+	if !strings.Contains(out, "level=ERROR") || !strings.Contains(out, "level=WARN msg=\"taodbi slow statement\"") {
+		t.Errorf("%s", out)
+	}
+}
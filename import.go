@@ -0,0 +1,287 @@
+package taodbi
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportOptions configures ImportCSV and ImportNDJSON
+type ImportOptions struct {
+	// Columns maps the names in the CSV header, or the keys in NDJSON,
+	// to columns; by default, the names are the columns. Only the key
+	// and insert_pars are imported.
+	Columns map[string]string
+	// TimeFormats are the layouts of times, tried in order. Integers are
+	// taken in the precision of the database. The default layouts are
+	// RFC3339, "2006-01-02 15:04:05.999999" and "2006-01-02".
+	TimeFormats []string
+	// Location is of the times without zone, default local
+	Location *time.Location
+	// BatchSize is the maximal number of rows in a statement, default 1000
+	BatchSize int
+	// Comma is the separator of CSV, default ','
+	Comma rune
+}
+
+var defaultTimeFormats = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999", "2006-01-02"}
+
+// LineError is the error of a line not imported
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (self *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", self.Line, self.Err.Error())
+}
+
+func (self *LineError) Unwrap() error {
+	return self.Err
+}
+
+// ImportErrors are the errors of the lines not imported, while
+// the other lines are
+type ImportErrors []*LineError
+
+func (self ImportErrors) Error() string {
+	if len(self) == 1 {
+		return self[0].Error()
+	}
+	return fmt.Sprintf("%d lines not imported, %s ...", len(self), self[0].Error())
+}
+
+// importer converts and writes the rows of an import
+type importer struct {
+	model   *Model
+	opts    *ImportOptions
+	types   map[string]string
+	rows    []map[string]interface{}
+	lines   []int
+	count   int
+	errs    ImportErrors
+	formats []string
+}
+
+func (self *Model) newImporter(opts *ImportOptions) (*importer, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	columns, err := self.Describe(self.CurrentTable)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string)
+	for _, column := range columns {
+		if column.Field == self.CurrentKey || grep(self.InsertPars, column.Field) {
+			types[column.Field] = column.Type
+		}
+	}
+	formats := opts.TimeFormats
+	if len(formats) == 0 {
+		formats = defaultTimeFormats
+	}
+	return &importer{model: self, opts: opts, types: types, formats: formats}, nil
+}
+
+// column returns the column of 'name' and if it is imported
+func (self *importer) column(name string) (string, bool) {
+	if column, ok := self.opts.Columns[name]; ok {
+		name = column
+	}
+	_, ok := self.types[name]
+	return name, ok
+}
+
+// convert converts 'v', a string or a value of JSON, to the type of 'column'
+func (self *importer) convert(column string, v interface{}) (interface{}, error) {
+	s, isString := v.(string)
+	if !isString {
+		s = fmt.Sprintf("%v", v)
+	}
+	typ := self.types[column]
+	switch {
+	case typ == "TIMESTAMP":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		location := self.opts.Location
+		if location == nil {
+			location = time.Local
+		}
+		for _, format := range self.formats {
+			if t, err := time.ParseInLocation(format, s, location); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid time %q of %s", s, column)
+	case typ == "BOOL":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool %q of %s", s, column)
+		}
+		return b, nil
+	case typ == "FLOAT" || typ == "DOUBLE":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q of %s", s, column)
+		}
+		return f, nil
+	case strings.HasSuffix(typ, "INT"):
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q of %s", s, column)
+		}
+		return n, nil
+	default:
+	}
+	return s, nil
+}
+
+// add adds a row of 'line', writing the rows if a batch is full
+func (self *importer) add(line int, row map[string]interface{}, err error) {
+	if err == nil {
+		if _, ok := row[self.model.CurrentKey]; !ok {
+			err = errors.New("missing " + self.model.CurrentKey)
+		}
+	}
+	if err != nil {
+		self.errs = append(self.errs, &LineError{Line: line, Err: err})
+		return
+	}
+	self.rows = append(self.rows, row)
+	self.lines = append(self.lines, line)
+	size := self.opts.BatchSize
+	if size <= 0 {
+		size = 1000
+	}
+	if len(self.rows) >= size {
+		self.flush()
+	}
+}
+
+// flush writes the rows, and one by one if the batch fails,
+// to find the lines in error
+func (self *importer) flush() {
+	if len(self.rows) == 0 {
+		return
+	}
+	if err := self.model.InsertRows(self.rows); err == nil {
+		self.count += len(self.rows)
+	} else {
+		for i, row := range self.rows {
+			if err := self.model.InsertRows([]map[string]interface{}{row}); err != nil {
+				self.errs = append(self.errs, &LineError{Line: self.lines[i], Err: err})
+			} else {
+				self.count++
+			}
+		}
+	}
+	self.rows = self.rows[:0]
+	self.lines = self.lines[:0]
+}
+
+// done returns the number of rows imported, and ImportErrors in
+// order of lines if any
+func (self *importer) done() (int, error) {
+	self.flush()
+	if len(self.errs) > 0 {
+		sort.SliceStable(self.errs, func(i, j int) bool { return self.errs[i].Line < self.errs[j].Line })
+		return self.count, self.errs
+	}
+	return self.count, nil
+}
+
+// ImportCSV imports CSV of a header line naming the columns, writing
+// in batches. Smodel rows are routed to child tables by the tags.
+// Empty fields are NULL. Lines in error are skipped and returned in
+// ImportErrors, with the number of rows imported. It stops on other errors.
+//
+func (self *Model) ImportCSV(r io.Reader, opts *ImportOptions) (int, error) {
+	im, err := self.newImporter(opts)
+	if err != nil {
+		return 0, err
+	}
+	reader := csv.NewReader(r)
+	if im.opts.Comma != 0 {
+		reader.Comma = im.opts.Comma
+	}
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			im.add(parseErr.StartLine, nil, parseErr.Err)
+			continue
+		} else if err != nil {
+			return im.count, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			im.add(line, nil, fmt.Errorf("%d fields, %d expected", len(record), len(header)))
+			continue
+		}
+		row := make(map[string]interface{})
+		for i, field := range record {
+			column, ok := im.column(header[i])
+			if !ok || field == "" {
+				continue
+			}
+			if row[column], err = im.convert(column, field); err != nil {
+				break
+			}
+		}
+		im.add(line, row, err)
+	}
+	return im.done()
+}
+
+// ImportNDJSON imports lines of JSON objects keyed by the columns, as
+// ImportCSV does. Nulls are NULL, and empty lines are skipped.
+//
+func (self *Model) ImportNDJSON(r io.Reader, opts *ImportOptions) (int, error) {
+	im, err := self.newImporter(opts)
+	if err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return im.count, err
+		}
+		if text := strings.TrimSpace(string(data)); text != "" {
+			item := make(map[string]interface{})
+			decoder := json.NewDecoder(strings.NewReader(text))
+			decoder.UseNumber()
+			rowErr := decoder.Decode(&item)
+			row := make(map[string]interface{})
+			for k, v := range item {
+				column, ok := im.column(k)
+				if !ok || v == nil || rowErr != nil {
+					continue
+				}
+				row[column], rowErr = im.convert(column, v)
+			}
+			im.add(line, row, rowErr)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return im.done()
+}
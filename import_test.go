@@ -0,0 +1,110 @@
+package taodbi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportCSV(t *testing.T) {
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	model, err := NewModel("m1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.SetDB(db)
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS atesting",
+		"CREATE TABLE atesting (id timestamp, x binary(8), y binary(8), z binary(8))",
+	} {
+		if err := model.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	csv := `time,x,y,ignored
+2020-09-13 12:26:40,a,b,1
+2020-09-13T12:26:41Z,c,,2
+bad,d,e,3
+2020-09-13 12:26:43,"f, g",h,4
+2020-09-13 12:26:44,toolong123,i,5
+2020-09-13 12:26:45,j
+,k,l,6
+`
+	n, err := model.ImportCSV(strings.NewReader(csv), &ImportOptions{Columns: map[string]string{"time": "id"}, BatchSize: 2})
+	var lineErrs ImportErrors
+	if !errors.As(err, &lineErrs) {
+		t.Fatalf("%v", err)
+	}
+	lines := make([]int, 0)
+	for _, e := range lineErrs {
+		lines = append(lines, e.Line)
+	}
+	if n != 3 || len(lines) != 4 || lines[0] != 4 || lines[1] != 6 || lines[2] != 7 || lines[3] != 8 {
+		t.Errorf("%d %v", n, err)
+	}
+
+	model.SetArgs(map[string]interface{}{})
+	if err := model.Topics(); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0)
+	for _, item := range model.GetLists() {
+		y, _ := item["y"].(string)
+		got = append(got, item["x"].(string)+":"+y)
+	}
+	if strings.Join(got, ",") != "a:b,c:,f, g:h" {
+		t.Errorf("%v", got)
+	}
+}
+
+func TestImportNDJSON(t *testing.T) {
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	smodel, err := NewSmodel("ms.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smodel.SetDB(db)
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS stesting",
+		"CREATE TABLE stesting (id timestamp, x binary(8), y binary(8), z binary(8)) TAGS (pubid int, location binary(8))",
+	} {
+		if err := smodel.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ndjson := `{"id": "13/09/2020 12:26:40", "x": "a", "pubid": 333, "location": "yyz"}
+{"id": "13/09/2020 12:26:40", "x": "b", "pubid": 333, "location": "ord"}
+
+{"id": "13/09/2020 12:26:41", "x": "c", "pubid": "x", "location": "ord"}
+{"id": "13/09/2020 12:26:42", "x": "d", "pubid": 333}
+{"id": 
+{"id": "13/09/2020 12:26:43", "x": "e", "y": null, "pubid": 444, "location": "yyz"}`
+	n, err := smodel.ImportNDJSON(strings.NewReader(ndjson), &ImportOptions{TimeFormats: []string{"02/01/2006 15:04:05"}, Location: time.UTC})
+	var lineErrs ImportErrors
+	if !errors.As(err, &lineErrs) || len(lineErrs) != 3 || lineErrs[0].Line != 4 || lineErrs[1].Line != 5 || lineErrs[2].Line != 6 {
+		t.Fatalf("%v", err)
+	}
+	if !errors.Is(lineErrs[1], ErrMissingKey) {
+		t.Errorf("%v", lineErrs[1])
+	}
+	if n != 3 {
+		t.Errorf("%d", n)
+	}
+	for table, expected := range map[string]int64{"stesting_333_yyz": 1, "stesting_333_ord": 1, "stesting_444_yyz": 1} {
+		var count int64
+		if err := smodel.scanRow("SELECT COUNT(*) FROM "+table, []interface{}{&count}); err != nil || count != expected {
+			t.Errorf("%s: %d %v", table, count, err)
+		}
+	}
+}
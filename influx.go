@@ -0,0 +1,318 @@
+package taodbi
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Point is a point in the InfluxDB line protocol:
+// measurement[,tag=value...] field=value[,field=value...] [timestamp]
+//
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	// Time is zero if the line has no timestamp
+	Time time.Time
+}
+
+// ParsePoints parses lines of the line protocol. The timestamps are in
+// 'precision', one of n (or ns, the default), u (or us), ms, s, m and h.
+// Empty lines and comments starting with # are skipped.
+//
+func ParsePoints(data []byte, precision string) ([]*Point, error) {
+	unit, err := precisionUnit(precision)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]*Point, 0)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		point, err := parsePoint(line, unit)
+		if err != nil {
+			return nil, newError(ErrValidation, "", "unable to parse line "+strconv.Itoa(i+1)+" '"+line+"': "+err.Error())
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+func precisionUnit(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	return 0, newError(ErrValidation, "", "invalid precision "+precision)
+}
+
+// scanToken reads from 'i' until an unescaped byte in 'stops',
+// removing the backslashes before the escaped bytes.
+func scanToken(line string, i int, stops string) (string, int) {
+	var b strings.Builder
+	for ; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) && strings.IndexByte(stops+`\`, line[i+1]) >= 0 {
+			i++
+			b.WriteByte(line[i])
+			continue
+		}
+		if strings.IndexByte(stops, c) >= 0 {
+			break
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), i
+}
+
+func parsePoint(line string, unit time.Duration) (*Point, error) {
+	point := &Point{Tags: make(map[string]string), Fields: make(map[string]interface{})}
+	var i int
+	point.Measurement, i = scanToken(line, 0, ", ")
+	if point.Measurement == "" {
+		return nil, errors.New("missing measurement")
+	}
+	for i < len(line) && line[i] == ',' {
+		var k, v string
+		k, i = scanToken(line, i+1, ",= ")
+		if i >= len(line) || line[i] != '=' || k == "" {
+			return nil, errors.New("missing tag value")
+		}
+		v, i = scanToken(line, i+1, ", ")
+		if v == "" {
+			return nil, errors.New("missing tag value")
+		}
+		point.Tags[k] = v
+	}
+	if i >= len(line) || line[i] != ' ' {
+		return nil, errors.New("missing fields")
+	}
+
+	for {
+		var k string
+		k, i = scanToken(line, i+1, ",= ")
+		if i >= len(line) || line[i] != '=' || k == "" {
+			return nil, errors.New("missing field value")
+		}
+		i++
+		var raw string
+		if i < len(line) && line[i] == '"' {
+			var b strings.Builder
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+					i++
+				}
+				b.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, errors.New("unterminated string")
+			}
+			i++
+			point.Fields[k] = b.String()
+		} else {
+			raw, i = scanToken(line, i, ", ")
+			v, err := fieldValue(raw)
+			if err != nil {
+				return nil, err
+			}
+			point.Fields[k] = v
+		}
+		if i >= len(line) || line[i] != ',' {
+			break
+		}
+	}
+
+	rest := strings.TrimSpace(line[i:])
+	if rest == "" {
+		return point, nil
+	}
+	ts, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil {
+		return nil, errors.New("bad timestamp")
+	}
+	point.Time = time.Unix(0, ts*int64(unit))
+	return point, nil
+}
+
+// fieldValue converts an unquoted field value: integers end in i,
+// unsigned integers in u, and the others are booleans or floats.
+func fieldValue(raw string) (interface{}, error) {
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	case "":
+		return nil, errors.New("missing field value")
+	}
+	switch raw[len(raw)-1] {
+	case 'i':
+		if v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64); err == nil {
+			return v, nil
+		}
+	case 'u':
+		if v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64); err == nil {
+			return v, nil
+		}
+	default:
+		if v, err := strconv.ParseFloat(raw, 64); err == nil {
+			return v, nil
+		}
+	}
+	return nil, errors.New("invalid field value " + raw)
+}
+
+// Influx writes points of the line protocol into super tables. The
+// measurement is the super table of a model, the tags are its Tags
+// and the fields are written if they are in insert_pars. It is also an
+// http.Handler compatible with the InfluxDB /write endpoint.
+//
+type Influx struct {
+	// Models are keyed by the measurement, i.e. the super table
+	Models map[string]*Smodel
+	// BatchSize is the maximal number of rows in a statement, default 1000
+	BatchSize int
+	// Database, if not empty, is the only one accepted in the db parameter
+	Database string
+	sync.Mutex
+}
+
+// NewInflux creates an Influx for the super table models
+func NewInflux(models ...*Smodel) *Influx {
+	self := &Influx{Models: make(map[string]*Smodel)}
+	for _, model := range models {
+		self.Models[model.CurrentTable] = model
+	}
+	return self
+}
+
+// Write inserts the points, creating the child tables when missing.
+// A point without timestamp gets the current time.
+//
+func (self *Influx) Write(points []*Point) error {
+	size := self.BatchSize
+	if size <= 0 {
+		size = 1000
+	}
+	now := time.Now()
+	order := make([]string, 0)
+	rows := make(map[string][]map[string]interface{})
+	for _, point := range points {
+		model, ok := self.Models[point.Measurement]
+		if !ok {
+			return newError(ErrModelNotFound, point.Measurement, "measurement not found: "+point.Measurement)
+		}
+		row := make(map[string]interface{})
+		for _, field := range model.InsertPars {
+			if v, ok := point.Fields[field]; ok {
+				row[field] = v
+			}
+		}
+		if len(row) == 0 {
+			return newError(ErrValidation, point.Measurement, "no field in insert_pars")
+		}
+		for _, tag := range model.Tags {
+			v, ok := point.Tags[tag]
+			if !ok {
+				return newError(ErrMissingKey, point.Measurement, "missing tag "+tag)
+			}
+			row[tag] = v
+		}
+		if point.Time.IsZero() {
+			row[model.CurrentKey] = now
+		} else {
+			row[model.CurrentKey] = point.Time
+		}
+		if _, ok := rows[point.Measurement]; !ok {
+			order = append(order, point.Measurement)
+		}
+		rows[point.Measurement] = append(rows[point.Measurement], row)
+	}
+
+	self.Lock()
+	defer self.Unlock()
+	for _, measurement := range order {
+		model := self.Models[measurement]
+		all := rows[measurement]
+		for len(all) > 0 {
+			n := size
+			if n > len(all) {
+				n = len(all)
+			}
+			if err := model.InsertRows(all[:n]); err != nil {
+				return err
+			}
+			all = all[n:]
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the InfluxDB /write endpoint, with the query parameters
+// db and precision. The body may be compressed by gzip.
+//
+func (self *Influx) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		influxError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if db := r.URL.Query().Get("db"); self.Database != "" && db != self.Database {
+		influxError(w, http.StatusNotFound, "database not found: \""+db+"\"")
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			influxError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		influxError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	points, err := ParsePoints(data, r.URL.Query().Get("precision"))
+	if err == nil {
+		err = self.Write(points)
+	}
+	var modelErr *Error
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.As(err, &modelErr):
+		influxError(w, http.StatusBadRequest, err.Error())
+	default:
+		influxError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func influxError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Influxdb-Error", msg)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
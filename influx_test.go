@@ -0,0 +1,142 @@
+package taodbi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePoints(t *testing.T) {
+	points, err := ParsePoints([]byte(`# comment
+cpu\,1,host=server\ 01,region=us-west load=0.64,count=3i,big=7u,up=t,note="say \"hi\", ok" 1600000000000
+
+mem free=1e3`), "ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("%d", len(points))
+	}
+	p := points[0]
+	if p.Measurement != "cpu,1" || p.Tags["host"] != "server 01" || p.Tags["region"] != "us-west" {
+		t.Errorf("%#v", p)
+	}
+	if p.Fields["load"] != 0.64 || p.Fields["count"] != int64(3) || p.Fields["big"] != uint64(7) ||
+		p.Fields["up"] != true || p.Fields["note"] != `say "hi", ok` {
+		t.Errorf("%#v", p.Fields)
+	}
+	if !p.Time.Equal(time.Unix(1600000000, 0)) {
+		t.Errorf("%v", p.Time)
+	}
+	if p = points[1]; p.Measurement != "mem" || len(p.Tags) != 0 || p.Fields["free"] != 1000.0 || !p.Time.IsZero() {
+		t.Errorf("%#v", p)
+	}
+
+	for _, line := range []string{
+		"cpu",
+		"cpu,host load=1",
+		"cpu load=",
+		"cpu load=1x",
+		`cpu note="open`,
+		"cpu load=1 abc",
+	} {
+		if _, err := ParsePoints([]byte(line), ""); err == nil {
+			t.Errorf("%s: error expected", line)
+		}
+	}
+	if _, err := ParsePoints([]byte("cpu load=1"), "d"); err == nil {
+		t.Errorf("precision error expected")
+	}
+}
+
+func TestInflux(t *testing.T) {
+	smodel, err := NewSmodel("ms.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	smodel.SetDB(db)
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS stesting",
+		"CREATE TABLE stesting (id timestamp, x binary(8), y binary(8), z binary(8)) TAGS (pubid int, location binary(8))",
+	} {
+		if err := smodel.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	influx := NewInflux(smodel)
+	influx.BatchSize = 2
+	influx.Database = "demodb"
+	server := httptest.NewServer(influx)
+	defer server.Close()
+
+	body := `stesting,pubid=333,location=yyz x="a",y="b",w="ignored" 1600000000000000
+stesting,pubid=333,location=yyz x="c" 1600000001000000
+stesting,pubid=333,location=ord x="d",z="e" 1600000000000000
+`
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(body))
+	gz.Close()
+	req, _ := http.NewRequest("POST", server.URL+"/write?db=demodb&precision=us", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("%d %s", res.StatusCode, res.Header.Get("X-Influxdb-Error"))
+	}
+
+	smodel.SetArgs(map[string]interface{}{})
+	if err := smodel.Topics(); err != nil {
+		t.Fatal(err)
+	}
+	lists := smodel.GetLists()
+	if len(lists) != 3 {
+		t.Fatalf("%#v", lists)
+	}
+	got := make([]string, 0)
+	for _, item := range lists {
+		got = append(got, strings.TrimRight(item["x"].(string), "\x00")+":"+strings.TrimRight(item["location"].(string), "\x00"))
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "a:yyz,c:yyz,d:ord" {
+		t.Errorf("%v", got)
+	}
+	n := 0
+	if err := smodel.scanRow("SELECT COUNT(*) FROM stesting_333_ord", []interface{}{&n}); err != nil || n != 1 {
+		t.Errorf("%d %v", n, err)
+	}
+
+	for _, c := range []struct {
+		query string
+		body  string
+		code  int
+	}{
+		{"db=demodb", "stesting,pubid=1 x=\"a\"", http.StatusBadRequest},
+		{"db=demodb", "unknown,pubid=1 x=\"a\"", http.StatusBadRequest},
+		{"db=demodb", "stesting x", http.StatusBadRequest},
+		{"db=other", "stesting,pubid=1,location=a x=\"a\"", http.StatusNotFound},
+	} {
+		res, err := http.Post(server.URL+"/write?"+c.query, "text/plain", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.code || res.Header.Get("X-Influxdb-Error") == "" {
+			t.Errorf("%s: %d", c.body, res.StatusCode)
+		}
+	}
+}
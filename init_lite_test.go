@@ -0,0 +1,12 @@
+//go:build lite
+// +build lite
+
+package taodbi
+
+import (
+	_ "github.com/genelet/taodbi/taoslite"
+)
+
+func init() {
+	testDriver = "taosLite"
+}
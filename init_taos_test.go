@@ -0,0 +1,12 @@
+//go:build taos
+// +build taos
+
+package taodbi
+
+import (
+	_ "github.com/taosdata/driver-go/taosSql"
+)
+
+func init() {
+	testDriver = ""
+}
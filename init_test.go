@@ -2,31 +2,48 @@ package taodbi
 
 import (
 	"database/sql"
-	"encoding/json"
 	"io/ioutil"
+	"testing"
 
-	_ "github.com/taosdata/driver-go/taosSql"
+	_ "github.com/genelet/taodbi/taodbitest"
 )
 
-type conf struct {
-	DbType string `json:"DbType"`
-	Dsn1   string `json:"Dsn1"`
-	Dsn2   string `json:"Dsn2"`
-}
+// testDriver replaces DbType in config.json unless tests are built
+// with tag taos to run against a TDengine server.
+var testDriver = "taodbitest"
 
-func newconf(filename string) *conf {
-	parsed := new(conf)
-	content, err := ioutil.ReadFile(filename)
+func newconf(filename string) *Config {
+	parsed, err := NewConfig(filename)
 	if err != nil {
 		panic(err)
 	}
-	err = json.Unmarshal(content, parsed)
-	if err != nil {
-		panic(err)
+	if testDriver != "" {
+		parsed.DbType = testDriver
 	}
 	return parsed
 }
 
+// serverDSN returns the data source name without database, in
+// the default parameters of the driver
+func serverDSN() string {
+	c := newconf("config.json")
+	c.Params = nil
+	return c.DSN("")
+}
+
+// testDSN returns the data source name of the test database
+func testDSN() string {
+	c := newconf("config.json")
+	return c.DSN(c.Database)
+}
+
+// fakeOnly skips tests relying on the taodbitest driver, like faults
+func fakeOnly(t *testing.T) {
+	if testDriver != "taodbitest" {
+		t.Skip("needs the taodbitest driver")
+	}
+}
+
 func getString(filename string) []byte {
 	content, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -36,5 +53,5 @@ func getString(filename string) []byte {
 }
 
 func open(ds string) (*sql.DB, error) {
-	return sql.Open("taosSql", ds)
+	return sql.Open(newconf("config.json").DbType, ds)
 }
@@ -0,0 +1,119 @@
+// Package lexer splits the statements of TDengine into tokens, for the
+// fake drivers taodbitest and taoslite.
+package lexer
+
+import (
+	"errors"
+	"strings"
+)
+
+// Kinds of token
+const (
+	EOF = iota
+	Ident
+	Number
+	String
+	Punct
+)
+
+// Token is a word, a literal or a punctuation of statement
+type Token struct {
+	Kind int
+	Text string
+}
+
+// Is reports if the token is the keyword or punctuation s, case-insensitive
+func (self Token) Is(s string) bool {
+	return (self.Kind == Ident || self.Kind == Punct) && strings.EqualFold(self.Text, s)
+}
+
+// Tokenize splits a statement into tokens, ending with EOF. Strings in
+// single or double quotes are unescaped by backslash, as TDengine does.
+func Tokenize(query string) ([]Token, error) {
+	tokens := make([]Token, 0)
+	i, n := 0, len(query)
+	for i < n {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ';':
+			i++
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			closed := false
+			for j < n {
+				d := query[j]
+				if d == '\\' && j+1 < n {
+					switch query[j+1] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					case 'r':
+						b.WriteByte('\r')
+					case '0':
+						b.WriteByte(0)
+					default:
+						b.WriteByte(query[j+1])
+					}
+					j += 2
+					continue
+				}
+				if d == c {
+					closed = true
+					j++
+					break
+				}
+				b.WriteByte(d)
+				j++
+			}
+			if !closed {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, Token{String, b.String()})
+			i = j
+		case c >= '0' && c <= '9' || c == '.' && i+1 < n && query[i+1] >= '0' && query[i+1] <= '9':
+			j := i
+			for j < n && (query[j] >= '0' && query[j] <= '9' || query[j] == '.' ||
+				(query[j] == 'e' || query[j] == 'E') && j+1 < n && (query[j+1] >= '0' && query[j+1] <= '9' || query[j+1] == '-' || query[j+1] == '+') ||
+				(query[j] == '-' || query[j] == '+') && (query[j-1] == 'e' || query[j-1] == 'E')) {
+				j++
+			}
+			// durations like 10s, 1m in INTERVAL
+			for j < n && (query[j] >= 'a' && query[j] <= 'z' || query[j] >= 'A' && query[j] <= 'Z') {
+				j++
+			}
+			tokens = append(tokens, Token{Number, query[i:j]})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < n && (query[j] == '_' || query[j] >= 'a' && query[j] <= 'z' || query[j] >= 'A' && query[j] <= 'Z' || query[j] >= '0' && query[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, Token{Ident, query[i:j]})
+			i = j
+		case c == '`':
+			j := strings.IndexByte(query[i+1:], '`')
+			if j < 0 {
+				return nil, errors.New("unterminated identifier")
+			}
+			tokens = append(tokens, Token{Ident, query[i+1 : i+1+j]})
+			i += j + 2
+		default:
+			if i+1 < n {
+				two := query[i : i+2]
+				if two == "<=" || two == ">=" || two == "!=" || two == "<>" {
+					tokens = append(tokens, Token{Punct, two})
+					i += 2
+					continue
+				}
+			}
+			if strings.IndexByte("(),*=<>+-/.%?", c) < 0 {
+				return nil, errors.New("unexpected character " + string(c))
+			}
+			tokens = append(tokens, Token{Punct, string(c)})
+			i++
+		}
+	}
+	return append(tokens, Token{Kind: EOF}), nil
+}
@@ -0,0 +1,31 @@
+package lexer
+
+import (
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize("SELECT `x`, 'a\\'b' FROM t WHERE ts>=1.5e3 INTERVAL(10s);")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Token{{Ident, "SELECT"}, {Ident, "x"}, {Punct, ","}, {String, "a'b"}, {Ident, "FROM"}, {Ident, "t"},
+		{Ident, "WHERE"}, {Ident, "ts"}, {Punct, ">="}, {Number, "1.5e3"}, {Ident, "INTERVAL"}, {Punct, "("},
+		{Number, "10s"}, {Punct, ")"}, {EOF, ""}}
+	if len(tokens) != len(want) {
+		t.Fatalf("%v", tokens)
+	}
+	for i, token := range tokens {
+		if token != want[i] {
+			t.Errorf("%d: %v wanted, got %v", i, want[i], token)
+		}
+	}
+	if !tokens[0].Is("select") || tokens[3].Is("a'b") {
+		t.Errorf("Is")
+	}
+	for _, query := range []string{"'abc", "`abc", "a # b"} {
+		if _, err := Tokenize(query); err == nil {
+			t.Errorf("%s: error wanted", query)
+		}
+	}
+}
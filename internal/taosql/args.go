@@ -0,0 +1,106 @@
+// Package taosql is the TDengine SQL shared by the drivers taodbitest,
+// taoslite and taosrest: the arguments interpolated into statements, the
+// timestamps formatted as the native driver, and the statements of tables
+// parsed from the tokens of lexer.
+package taosql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Named returns the values of named arguments
+func Named(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+// Interpolate replaces ? by arguments as taosSql does: strings are
+// put as they are except escaping by backslash.
+func Interpolate(query string, args []driver.Value) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	if strings.Count(query, "?") != len(args) {
+		return "", errors.New("invalid number of arguments")
+	}
+	var b strings.Builder
+	k := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			b.WriteByte(query[i])
+			continue
+		}
+		switch v := args[k].(type) {
+		case nil:
+			b.WriteString("NULL")
+		case int64:
+			b.WriteString(strconv.FormatInt(v, 10))
+		case float64:
+			b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		case bool:
+			if v {
+				b.WriteString("1")
+			} else {
+				b.WriteString("0")
+			}
+		case time.Time:
+			b.WriteString("'" + v.Format("2006-01-02 15:04:05.999999") + "'")
+		case []byte:
+			b.WriteString(escape(string(v)))
+		case string:
+			b.WriteString(escape(v))
+		default:
+			return "", errors.New("unsupported argument type")
+		}
+		k++
+	}
+	return b.String(), nil
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case 0:
+			b.WriteString(`\0`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\x1a':
+			b.WriteString(`\Z`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// FormatTime formats a timestamp of 'precision' as the native driver
+// of 2020 does in parseTime mode
+func FormatTime(ts int64, precision string) string {
+	var decimal, sec, nsec int64
+	switch precision {
+	case "ms":
+		decimal, sec = ts%1000, ts/1000
+		nsec = decimal * 1000000
+	case "us":
+		decimal, sec = ts%1000000, ts/1000000
+		nsec = decimal * 1000
+	default:
+		decimal, sec = ts%1000000000, ts/1000000000
+		nsec = decimal
+	}
+	return time.Unix(sec, nsec).Format("2006-01-02 15:04:05") + "." + strconv.Itoa(int(decimal))
+}
@@ -0,0 +1,99 @@
+package taosql
+
+import (
+	"strconv"
+)
+
+// Database is a database in SHOW DATABASES, created in milliseconds,
+// with Days and Keep in days
+type Database struct {
+	Name      string
+	Created   int64
+	Tables    int64
+	Replica   int64
+	Days      int64
+	Keep      int64
+	Blocks    int64
+	Precision string
+	Update    int64
+}
+
+// Table is a table in SHOW TABLES, a child of Stable if not empty, or a
+// super table in SHOW STABLES of Tags and Children
+type Table struct {
+	Name     string
+	Created  int64
+	Columns  int64
+	Tags     int64
+	Children int64
+	Stable   string
+}
+
+// ShowDatabases returns the columns and rows of SHOW DATABASES, in the
+// columns of 3.x if 'v3', the durations being in minutes
+func ShowDatabases(dbs []*Database, v3 bool) ([]*Column, [][]interface{}) {
+	rows := make([][]interface{}, 0)
+	if v3 {
+		for _, db := range dbs {
+			keep := strconv.FormatInt(db.Keep*1440, 10) + "m"
+			rows = append(rows, []interface{}{db.Name, db.Created, int64(2), db.Tables, db.Replica,
+				strconv.FormatInt(db.Days*1440, 10) + "m", keep + "," + keep + "," + keep, int64(96), db.Precision})
+		}
+		return []*Column{
+			{Name: "name", Type: "VARCHAR", Length: 64},
+			{Name: "create_time", Type: "TIMESTAMP", Length: 8},
+			{Name: "vgroups", Type: "SMALLINT", Length: 2},
+			{Name: "ntables", Type: "BIGINT", Length: 8},
+			{Name: "replica", Type: "TINYINT", Length: 1},
+			{Name: "duration", Type: "VARCHAR", Length: 10},
+			{Name: "keep", Type: "VARCHAR", Length: 32},
+			{Name: "buffer", Type: "INT", Length: 4},
+			{Name: "precision", Type: "VARCHAR", Length: 2},
+		}, rows
+	}
+
+	for _, db := range dbs {
+		keep := strconv.FormatInt(db.Keep, 10)
+		rows = append(rows, []interface{}{db.Name, db.Created, db.Tables, db.Replica, db.Days,
+			keep + "," + keep + "," + keep, db.Blocks, db.Precision, db.Update})
+	}
+	return []*Column{
+		{Name: "name", Type: "BINARY", Length: 32},
+		{Name: "created_time", Type: "TIMESTAMP", Length: 8},
+		{Name: "ntables", Type: "INT", Length: 4},
+		{Name: "replica", Type: "SMALLINT", Length: 2},
+		{Name: "days", Type: "SMALLINT", Length: 2},
+		{Name: "keep0,keep1,keep(D)", Type: "BINARY", Length: 24},
+		{Name: "blocks", Type: "INT", Length: 4},
+		{Name: "precision", Type: "BINARY", Length: 3},
+		{Name: "update", Type: "TINYINT", Length: 1},
+	}, rows
+}
+
+// ShowTables returns the columns and rows of SHOW TABLES, or of SHOW
+// STABLES if 'super', with the names in column 'name'
+func ShowTables(tables []*Table, super bool, name string) ([]*Column, [][]interface{}) {
+	rows := make([][]interface{}, 0)
+	if super {
+		for _, t := range tables {
+			rows = append(rows, []interface{}{t.Name, t.Created, t.Columns, t.Tags, t.Children})
+		}
+		return []*Column{
+			{Name: name, Type: "BINARY", Length: 192},
+			{Name: "created_time", Type: "TIMESTAMP", Length: 8},
+			{Name: "columns", Type: "SMALLINT", Length: 2},
+			{Name: "tags", Type: "SMALLINT", Length: 2},
+			{Name: "tables", Type: "INT", Length: 4},
+		}, rows
+	}
+
+	for _, t := range tables {
+		rows = append(rows, []interface{}{t.Name, t.Created, t.Columns, t.Stable})
+	}
+	return []*Column{
+		{Name: "table_name", Type: "BINARY", Length: 192},
+		{Name: "created_time", Type: "TIMESTAMP", Length: 8},
+		{Name: "columns", Type: "SMALLINT", Length: 2},
+		{Name: "stable_name", Type: "BINARY", Length: 192},
+	}, rows
+}
@@ -0,0 +1,357 @@
+package taosql
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genelet/taodbi/internal/lexer"
+)
+
+// ErrSyntax returns the error of invalid SQL, as TDengine does
+func ErrSyntax(msg string) error {
+	return errors.New("invalid SQL: " + msg)
+}
+
+// Name is [database.]table in lower case, Database being empty for the
+// database in use
+type Name struct {
+	Database string
+	Table    string
+}
+
+// Column is a column of a table or of a result set. In CREATE TABLE,
+// Type is in upper case with UNSIGNED, and Length is in parentheses, or 0.
+type Column struct {
+	Name   string
+	Type   string
+	Length int
+}
+
+// Using is child table Table of super table Stable, of tag Values in the
+// order of Tags, or of the tags of Stable if Tags are empty
+type Using struct {
+	Table  Name
+	Stable Name
+	Tags   []string
+	Values [][]lexer.Token
+}
+
+// CreateTable is CREATE TABLE or STABLE: a table of Columns and Tags, a
+// super table if there are tags, or the child tables of Children
+type CreateTable struct {
+	Super       bool
+	IfNotExists bool
+	Table       Name
+	Columns     []*Column
+	Tags        []*Column
+	Children    []*Using
+}
+
+// Insert is INSERT INTO a table, or into a child table created by Using
+// if it does not exist: Rows of values of Columns, or of all columns if
+// Columns are empty
+type Insert struct {
+	Table   Name
+	Using   *Using
+	Columns []string
+	Rows    [][][]lexer.Token
+}
+
+// reader reads a statement from tokens ending with EOF
+type reader struct {
+	tokens []lexer.Token
+	pos    int
+}
+
+func (self *reader) peek() lexer.Token {
+	return self.tokens[self.pos]
+}
+
+func (self *reader) next() lexer.Token {
+	t := self.tokens[self.pos]
+	if t.Kind != lexer.EOF {
+		self.pos++
+	}
+	return t
+}
+
+// accept consumes the keywords or punctuations in sequence if all matched
+func (self *reader) accept(words ...string) bool {
+	for i, w := range words {
+		if self.pos+i >= len(self.tokens) || !self.tokens[self.pos+i].Is(w) {
+			return false
+		}
+	}
+	self.pos += len(words)
+	return true
+}
+
+func (self *reader) expect(words ...string) error {
+	if !self.accept(words...) {
+		return ErrSyntax("expecting " + strings.Join(words, " ") + " near " + self.peek().Text)
+	}
+	return nil
+}
+
+func (self *reader) done() error {
+	if t := self.peek(); t.Kind != lexer.EOF {
+		return ErrSyntax("unexpected " + t.Text)
+	}
+	return nil
+}
+
+func (self *reader) ident() (string, error) {
+	t := self.next()
+	if t.Kind != lexer.Ident {
+		return "", ErrSyntax("expecting name near " + t.Text)
+	}
+	return strings.ToLower(t.Text), nil
+}
+
+func (self *reader) name() (Name, error) {
+	table, err := self.ident()
+	if err != nil {
+		return Name{}, err
+	}
+	if !self.accept(".") {
+		return Name{Table: table}, nil
+	}
+	name := Name{Database: table}
+	name.Table, err = self.ident()
+	return name, err
+}
+
+// names reads (name, ...)
+func (self *reader) names() ([]string, error) {
+	if err := self.expect("("); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for {
+		name, err := self.ident()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if self.accept(")") {
+			return names, nil
+		}
+		if err := self.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// values reads (expression, ...) as lists of tokens
+func (self *reader) values() ([][]lexer.Token, error) {
+	if err := self.expect("("); err != nil {
+		return nil, err
+	}
+	values := make([][]lexer.Token, 0)
+	value := make([]lexer.Token, 0)
+	depth := 0
+	for {
+		t := self.next()
+		switch {
+		case t.Kind == lexer.EOF:
+			return nil, ErrSyntax("unterminated values")
+		case t.Is("("):
+			depth++
+		case t.Is(")") && depth == 0, t.Is(",") && depth == 0:
+			if len(value) == 0 {
+				return nil, ErrSyntax("value missing")
+			}
+			values = append(values, value)
+			if t.Is(")") {
+				return values, nil
+			}
+			value = make([]lexer.Token, 0)
+			continue
+		case t.Is(")"):
+			depth--
+		default:
+		}
+		value = append(value, t)
+	}
+}
+
+// definitions reads (name type, ...)
+func (self *reader) definitions() ([]*Column, error) {
+	if err := self.expect("("); err != nil {
+		return nil, err
+	}
+	columns := make([]*Column, 0)
+	seen := make(map[string]bool)
+	for {
+		name, err := self.ident()
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			return nil, ErrSyntax("duplicated column names")
+		}
+		seen[name] = true
+		typ, err := self.ident()
+		if err != nil {
+			return nil, err
+		}
+		c := &Column{Name: name, Type: strings.ToUpper(typ)}
+		if self.accept("UNSIGNED") {
+			c.Type += " UNSIGNED"
+		}
+		if self.accept("(") {
+			t := self.next()
+			if c.Length, err = strconv.Atoi(t.Text); err != nil || t.Kind != lexer.Number || c.Length <= 0 {
+				return nil, ErrSyntax("invalid length of " + name)
+			}
+			if err := self.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+		columns = append(columns, c)
+		if self.accept(")") {
+			return columns, nil
+		}
+		if err := self.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// using reads the rest of 'table' USING stable [(tags)] TAGS (values)
+func (self *reader) using(table Name) (*Using, error) {
+	stable, err := self.name()
+	if err != nil {
+		return nil, err
+	}
+	u := &Using{Table: table, Stable: stable}
+	if self.peek().Is("(") {
+		if u.Tags, err = self.names(); err != nil {
+			return nil, err
+		}
+	}
+	if err := self.expect("TAGS"); err != nil {
+		return nil, err
+	}
+	if u.Values, err = self.values(); err != nil {
+		return nil, err
+	}
+	if len(u.Tags) > 0 && len(u.Tags) != len(u.Values) {
+		return nil, ErrSyntax("tags number not matched")
+	}
+	return u, nil
+}
+
+// ParseCreateTable reads CREATE TABLE, or STABLE if 'super', from the
+// tokens after TABLE or STABLE:
+//
+//	[IF NOT EXISTS] t (column type, ...) [TAGS (tag type, ...)]
+//	[IF NOT EXISTS] t1 USING st [(tags)] TAGS (values) [t2 USING ...]
+func ParseCreateTable(tokens []lexer.Token, super bool) (*CreateTable, error) {
+	r := &reader{tokens: tokens}
+	create := &CreateTable{Super: super, IfNotExists: r.accept("IF", "NOT", "EXISTS")}
+	table, err := r.name()
+	if err != nil {
+		return nil, err
+	}
+	create.Table = table
+	if !super && r.accept("USING") {
+		for {
+			u, err := r.using(table)
+			if err != nil {
+				return nil, err
+			}
+			create.Children = append(create.Children, u)
+			if r.peek().Kind == lexer.EOF {
+				return create, nil
+			}
+			if table, err = r.name(); err != nil {
+				return nil, err
+			}
+			if err := r.expect("USING"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if create.Columns, err = r.definitions(); err != nil {
+		return nil, err
+	}
+	if r.accept("TAGS") {
+		if create.Tags, err = r.definitions(); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	if super && len(create.Tags) == 0 {
+		return nil, ErrSyntax("super table needs tags")
+	}
+	if create.Columns[0].Type != "TIMESTAMP" {
+		return nil, ErrSyntax("first column must be timestamp")
+	}
+	return create, nil
+}
+
+// ParseInsert reads INSERT from the tokens after INSERT:
+//
+//	INTO t1 [USING st [(tags)] TAGS (values)] [(columns)] VALUES (values) ... [t2 ...]
+func ParseInsert(tokens []lexer.Token) ([]*Insert, error) {
+	r := &reader{tokens: tokens}
+	if err := r.expect("INTO"); err != nil {
+		return nil, err
+	}
+	inserts := make([]*Insert, 0)
+	for {
+		table, err := r.name()
+		if err != nil {
+			return nil, err
+		}
+		insert := &Insert{Table: table}
+		if r.accept("USING") {
+			if insert.Using, err = r.using(table); err != nil {
+				return nil, err
+			}
+		}
+		if r.peek().Is("(") {
+			if insert.Columns, err = r.names(); err != nil {
+				return nil, err
+			}
+		}
+		if err := r.expect("VALUES"); err != nil {
+			return nil, err
+		}
+		for r.peek().Is("(") {
+			values, err := r.values()
+			if err != nil {
+				return nil, err
+			}
+			if len(insert.Columns) > 0 && len(values) != len(insert.Columns) {
+				return nil, ErrSyntax("illegal number of columns")
+			}
+			insert.Rows = append(insert.Rows, values)
+		}
+		if len(insert.Rows) == 0 {
+			return nil, ErrSyntax("values missing")
+		}
+		inserts = append(inserts, insert)
+		if r.peek().Kind == lexer.EOF {
+			return inserts, nil
+		}
+	}
+}
+
+// ParseShow reads SHOW from the tokens after SHOW, returning DATABASES,
+// TABLES or STABLES
+func ParseShow(tokens []lexer.Token) (string, error) {
+	r := &reader{tokens: tokens}
+	t := r.next()
+	for _, what := range []string{"DATABASES", "TABLES", "STABLES"} {
+		if t.Is(what) {
+			return what, r.done()
+		}
+	}
+	return "", ErrSyntax("unsupported SHOW " + t.Text)
+}
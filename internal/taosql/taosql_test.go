@@ -0,0 +1,90 @@
+package taosql
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/genelet/taodbi/internal/lexer"
+)
+
+func tokenize(t *testing.T, query string) []lexer.Token {
+	tokens, err := lexer.Tokenize(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestInterpolate(t *testing.T) {
+	ts := time.Date(2020, 7, 19, 9, 7, 48, 341270000, time.Local)
+	query, err := Interpolate("INSERT INTO t VALUES (?, ?, ?, ?, ?)", []driver.Value{ts, int64(1), 1.5, true, "a'\"\n"})
+	if err != nil || query != `INSERT INTO t VALUES ('2020-07-19 09:07:48.34127', 1, 1.5, 1, a'\"\n)` {
+		t.Errorf("%s %v", query, err)
+	}
+	if _, err := Interpolate("?", Named([]driver.NamedValue{{Value: nil}, {Value: nil}})); err == nil {
+		t.Errorf("number of arguments not checked")
+	}
+	if got := FormatTime(ts.UnixNano()/1000, "us"); got != "2020-07-19 09:07:48.341270" {
+		t.Errorf("%s", got)
+	}
+}
+
+func TestParseCreateTable(t *testing.T) {
+	create, err := ParseCreateTable(tokenize(t, "IF NOT EXISTS db.St (ts timestamp, v int unsigned, s binary(8)) TAGS (loc nchar(4))"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !create.IfNotExists || create.Table != (Name{"db", "st"}) || len(create.Columns) != 3 || len(create.Tags) != 1 ||
+		*create.Columns[1] != (Column{"v", "INT UNSIGNED", 0}) || *create.Columns[2] != (Column{"s", "BINARY", 8}) {
+		t.Errorf("%#v", create)
+	}
+
+	create, err = ParseCreateTable(tokenize(t, "t1 USING st TAGS (1, 'a') t2 USING st (loc) TAGS (NULL)"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(create.Children) != 2 || create.Children[1].Table.Table != "t2" || create.Children[1].Tags[0] != "loc" ||
+		len(create.Children[0].Values) != 2 || create.Children[0].Values[1][0].Text != "a" {
+		t.Errorf("%#v", create.Children)
+	}
+
+	for _, query := range []string{"st (ts timestamp)", "t (v int)", "t (ts timestamp, ts int)", "t (ts timestamp, s binary(0))"} {
+		if _, err := ParseCreateTable(tokenize(t, query), true); err == nil {
+			t.Errorf("%s: error wanted", query)
+		}
+	}
+}
+
+func TestParseInsert(t *testing.T) {
+	inserts, err := ParseInsert(tokenize(t, "INTO t1 USING st TAGS (1) (ts, v) VALUES (now, abs(-1)) (now+1s, 2) t2 VALUES (now, 3)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inserts) != 2 || inserts[0].Using == nil || len(inserts[0].Rows) != 2 || len(inserts[0].Rows[0][1]) != 5 ||
+		inserts[1].Table.Table != "t2" || len(inserts[1].Columns) != 0 {
+		t.Errorf("%#v", inserts)
+	}
+	for _, query := range []string{"INTO t VALUES", "INTO t (ts, v) VALUES (now)", "INTO t VALUES (now,)", "t VALUES (now)"} {
+		if _, err := ParseInsert(tokenize(t, query)); err == nil {
+			t.Errorf("%s: error wanted", query)
+		}
+	}
+}
+
+func TestShow(t *testing.T) {
+	if what, err := ParseShow(tokenize(t, "stables")); err != nil || what != "STABLES" {
+		t.Errorf("%s %v", what, err)
+	}
+	if _, err := ParseShow(tokenize(t, "users")); err == nil {
+		t.Errorf("error wanted")
+	}
+	columns, rows := ShowDatabases([]*Database{{Name: "db", Days: 10, Keep: 365}}, true)
+	if columns[5].Name != "duration" || rows[0][5] != "14400m" || rows[0][6] != "525600m,525600m,525600m" {
+		t.Errorf("%v %v", columns, rows)
+	}
+	columns, rows = ShowTables([]*Table{{Name: "st", Tags: 2}}, true, "name")
+	if columns[0].Name != "name" || rows[0][3] != int64(2) {
+		t.Errorf("%v %v", columns, rows)
+	}
+}
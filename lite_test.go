@@ -0,0 +1,107 @@
+package taodbi
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	_ "github.com/genelet/taodbi/taoslite"
+)
+
+// TestLite runs the same super table model on the SQLite backend and the
+// native one, expecting the same values from pickup.
+func TestLite(t *testing.T) {
+	c := newconf("config.json")
+	results := make([][][]map[string]interface{}, 0)
+	for _, driver := range []string{c.DbType, "taosLite"} {
+		db, err := sql.Open(driver, c.DSN(c.Database))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		smodel, err := NewSmodel("ms.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		smodel.SetDB(db)
+		for _, query := range []string{
+			"DROP TABLE IF EXISTS stesting",
+			"CREATE TABLE stesting (id timestamp, x binary(8), y binary(8), z binary(8)) TAGS (pubid int, location binary(8))",
+		} {
+			if err := smodel.DoSQL(query); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i, location := range []string{"yyz", "yyz", "ord", "yyz"} {
+			smodel.SetArgs(map[string]interface{}{"x": "x" + string(rune('a'+i)), "y": "y", "pubid": 333, "location": location})
+			if err := smodel.Insert(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		outputs := make([][]map[string]interface{}, 0)
+		for _, action := range []func(...map[string]interface{}) error{smodel.Topics, smodel.LastTopics} {
+			smodel.SetArgs(map[string]interface{}{})
+			if err := action(); err != nil {
+				t.Fatal(err)
+			}
+			lists := smodel.GetLists()
+			// ids are the insert time
+			for _, item := range lists {
+				delete(item, "id")
+			}
+			outputs = append(outputs, lists)
+		}
+		if n := len(outputs[0]); n != 4 {
+			t.Errorf("%s: %d rows", driver, n)
+		}
+		results = append(results, outputs)
+	}
+	if !reflect.DeepEqual(results[0], results[1]) {
+		t.Errorf("%#v\n%#v", results[0], results[1])
+	}
+}
+
+// TestLiteDialect checks the dialect detected on the SQLite backend
+func TestLiteDialect(t *testing.T) {
+	db, err := sql.Open("taosLite", testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	dbi := &DBI{DB: db}
+	defer dialects.Delete(db)
+	dialect, err := dbi.DetectDialect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialect != Dialect3 {
+		t.Errorf("%#v", dialect)
+	}
+
+	rmodel, err := NewRmodel("rest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rmodel.SetDB(db)
+	initRest(db)
+	ids := make([]interface{}, 0)
+	for _, name := range []string{"u1", "u2"} {
+		rmodel.SetArgs(map[string]interface{}{"username": name, "passwd": "p", "firstname": "f", "lastname": "l"})
+		if err := rmodel.Insert(); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, rmodel.getArgs()[rmodel.CurrentKey])
+	}
+	rmodel.SetArgs(map[string]interface{}{"id": ids[0]})
+	if err := rmodel.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	// with the 3.x dialect, the rows are deleted for real
+	for _, table := range []string{"tmain", "tprofile", "tstatus"} {
+		n := int64(0)
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil || n != 1 {
+			t.Errorf("%s: %d %v", table, n, err)
+		}
+	}
+}
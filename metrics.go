@@ -0,0 +1,268 @@
+package taodbi
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds in seconds of latency histograms
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+type histogram struct {
+	// counts per bucket, the last one for +Inf
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+func (self *histogram) observe(buckets []float64, seconds float64) {
+	i := sort.SearchFloat64s(buckets, seconds)
+	self.counts[i]++
+	self.sum += seconds
+	self.count++
+}
+
+type labels struct {
+	kind   string
+	model  string
+	action string
+}
+
+// Metrics collects counts and latencies of statements by kind (insert,
+// select, ddl or other), model and action, of Schema.Run by model and action,
+// and counts errors by class. It is a Hook to be set in DBI, models or Schema.
+//
+type Metrics struct {
+	Buckets []float64
+
+	sync.Mutex
+	statements map[labels]*histogram
+	runs       map[labels]*histogram
+	errors     map[[2]string]int64
+}
+
+// NewMetrics creates metrics with DefaultBuckets
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Buckets:    DefaultBuckets,
+		statements: make(map[labels]*histogram),
+		runs:       make(map[labels]*histogram),
+		errors:     make(map[[2]string]int64),
+	}
+}
+
+// StatementKind returns insert, select, ddl or other by the first word
+func StatementKind(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch strings.ToLower(fields[0]) {
+	case "insert", "import":
+		return "insert"
+	case "select", "show", "describe", "desc":
+		return "select"
+	case "create", "drop", "alter", "use":
+		return "ddl"
+	default:
+	}
+	return "other"
+}
+
+// ErrorClass returns the class of an error: not_found, duplicate, syntax,
+// connection or other.
+func ErrorClass(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound) || errors.Is(err, sql.ErrNoRows):
+		return "not_found"
+	case errors.Is(err, ErrDuplicate):
+		return "duplicate"
+	default:
+	}
+	switch ErrorCode(err) {
+	case CodeInvalidSQL:
+		return "syntax"
+	case CodeNetworkUnavailable:
+		return "connection"
+	default:
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return "connection"
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "not found") || strings.Contains(msg, "does not exist") || strings.Contains(msg, "not exist"):
+		return "not_found"
+	case strings.Contains(msg, "already exist") || strings.Contains(msg, "duplicate"):
+		return "duplicate"
+	case strings.Contains(msg, "invalid sql") || strings.Contains(msg, "syntax"):
+		return "syntax"
+	case strings.Contains(msg, "connect") || strings.Contains(msg, "timeout"):
+		return "connection"
+	default:
+	}
+	return "other"
+}
+
+func (self *Metrics) histogram(m map[labels]*histogram, key labels) *histogram {
+	h, ok := m[key]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(self.Buckets)+1)}
+		m[key] = h
+	}
+	return h
+}
+
+func (self *Metrics) Before(event *Event) {}
+
+// After counts the statement in the event
+func (self *Metrics) After(event *Event) {
+	kind := StatementKind(event.Query)
+	self.Lock()
+	defer self.Unlock()
+	self.histogram(self.statements, labels{kind, event.Model, event.Action}).observe(self.Buckets, event.Duration.Seconds())
+	if event.Err != nil {
+		self.errors[[2]string{"statement", ErrorClass(event.Err)}]++
+	}
+}
+
+// observeRun counts a Schema.Run
+func (self *Metrics) observeRun(model, action string, duration time.Duration, err error) {
+	self.Lock()
+	defer self.Unlock()
+	self.histogram(self.runs, labels{"", model, action}).observe(self.Buckets, duration.Seconds())
+	if err != nil {
+		self.errors[[2]string{"run", ErrorClass(err)}]++
+	}
+}
+
+func sortedLabels(m map[labels]*histogram) []labels {
+	keys := make([]labels, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		if a.model != b.model {
+			return a.model < b.model
+		}
+		return a.action < b.action
+	})
+	return keys
+}
+
+func (self *Metrics) snapshot(m map[labels]*histogram, withKind bool) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, h := range m {
+		name := k.model + "/" + k.action
+		if withKind {
+			name = k.kind + "/" + name
+		}
+		buckets := make(map[string]int64)
+		cumulative := int64(0)
+		for i, n := range h.counts {
+			cumulative += n
+			le := "+Inf"
+			if i < len(self.Buckets) {
+				le = strconv.FormatFloat(self.Buckets[i], 'g', -1, 64)
+			}
+			buckets[le] = cumulative
+		}
+		out[name] = map[string]interface{}{"count": h.count, "sum": h.sum, "buckets": buckets}
+	}
+	return out
+}
+
+// Snapshot returns the metrics as a map, used by expvar
+func (self *Metrics) Snapshot() interface{} {
+	self.Lock()
+	defer self.Unlock()
+	errs := make(map[string]int64)
+	for k, n := range self.errors {
+		errs[k[0]+"/"+k[1]] = n
+	}
+	return map[string]interface{}{
+		"statements": self.snapshot(self.statements, true),
+		"runs":       self.snapshot(self.runs, false),
+		"errors":     errs,
+	}
+}
+
+// Publish exports the metrics in expvar under 'name'.
+// As expvar.Publish, it panics if the name is already used.
+func (self *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(self.Snapshot))
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func (self *Metrics) writeHistogram(w io.Writer, name, help string, m map[labels]*histogram, withKind bool) {
+	if len(m) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, k := range sortedLabels(m) {
+		h := m[k]
+		tags := `model="` + escapeLabel(k.model) + `",action="` + escapeLabel(k.action) + `"`
+		if withKind {
+			tags = `kind="` + k.kind + `",` + tags
+		}
+		cumulative := int64(0)
+		for i, n := range h.counts {
+			cumulative += n
+			le := "+Inf"
+			if i < len(self.Buckets) {
+				le = strconv.FormatFloat(self.Buckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, tags, le, cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, tags, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, tags, h.count)
+	}
+}
+
+// WritePrometheus writes the metrics in the Prometheus text format
+func (self *Metrics) WritePrometheus(w io.Writer) {
+	self.Lock()
+	defer self.Unlock()
+	self.writeHistogram(w, "taodbi_statement_duration_seconds", "Latency of SQL statements by kind, model and action.", self.statements, true)
+	self.writeHistogram(w, "taodbi_run_duration_seconds", "Latency of Schema.Run by model and action.", self.runs, false)
+	if len(self.errors) == 0 {
+		return
+	}
+	keys := make([][2]string, 0, len(self.errors))
+	for k := range self.errors {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	fmt.Fprintf(w, "# HELP taodbi_errors_total Errors by source and class.\n# TYPE taodbi_errors_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(w, "taodbi_errors_total{source=\"%s\",class=\"%s\"} %d\n", k[0], k[1], self.errors[k])
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format
+func (self *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	self.WritePrometheus(w)
+}
@@ -0,0 +1,104 @@
+package taodbi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsKind(t *testing.T) {
+	for query, kind := range map[string]string{"INSERT INTO a VALUES (now)": "insert", "\nselect * from a": "select",
+		"CREATE TABLE a (ts timestamp)": "ddl", "use demodb": "ddl", "": "other"} {
+		if StatementKind(query) != kind {
+			t.Errorf("%s: %s wanted", query, kind)
+		}
+	}
+	for msg, class := range map[string]string{"Table does not exist": "not_found", "Table already exists": "duplicate",
+		"invalid SQL: unexpected": "syntax", "Unable to establish connection": "connection", "whatever": "other"} {
+		if ErrorClass(errors.New(msg)) != class {
+			t.Errorf("%s: %s wanted", msg, class)
+		}
+	}
+	if ErrorClass(sql.ErrNoRows) != "not_found" {
+		t.Errorf("not_found wanted")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	c := newconf("config.json")
+	db, err := sql.Open(c.DbType, c.DSN(c.Database))
+	if err != nil { t.Fatal(err) }
+	defer db.Close()
+
+	model, err := NewModel("m1.json")
+	if err != nil { t.Fatal(err) }
+	model.SetDB(db)
+	if err = model.DoSQL(`drop table if exists atesting`); err != nil { t.Fatal(err) }
+	if err = model.DoSQL(`CREATE TABLE atesting (id timestamp, x binary(8), y binary(8), z binary(8))`); err != nil { t.Fatal(err) }
+	model.Actions = map[string]func(...map[string]interface{}) error{
+		"topics": func(args ...map[string]interface{}) error { return model.Topics(args...) },
+		"insert": func(args ...map[string]interface{}) error { return model.Insert(args...) },
+	}
+
+	metrics := NewMetrics()
+	schema := NewSchema(map[string]Navigate{"m1": model})
+	schema.SetDB(db)
+	schema.SetMetrics(metrics)
+	for i := 0; i < 2; i++ {
+		if _, err = schema.Run("m1", "insert", map[string]interface{}{"x":"a1234567"}); err != nil { t.Fatal(err) }
+	}
+	if _, err = schema.Run("m1", "topics", map[string]interface{}{}); err != nil { t.Fatal(err) }
+	if _, err = schema.Run("m2", "topics", map[string]interface{}{}); err == nil {
+		t.Errorf("model not found expected")
+	}
+	dbi := &DBI{DB: db, Hooks: []Hook{metrics}}
+	dbi.DoSQL(`INSERT INTO nosuchtable VALUES (now, 'a')`)
+
+	server := httptest.NewServer(metrics)
+	defer server.Close()
+	res, err := http.Get(server.URL)
+	if err != nil { t.Fatal(err) }
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	text := string(body)
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("%s", res.Header.Get("Content-Type"))
+	}
+	for _, line := range []string{
+		"# TYPE taodbi_statement_duration_seconds histogram",
+		`taodbi_statement_duration_seconds_count{kind="insert",model="m1",action="insert"} 2`,
+		`taodbi_statement_duration_seconds_count{kind="select",model="m1",action="insert"} 2`,
+		`taodbi_statement_duration_seconds_count{kind="select",model="m1",action="topics"} 1`,
+		`taodbi_statement_duration_seconds_bucket{kind="insert",model="",action="",le="+Inf"} 1`,
+		`taodbi_run_duration_seconds_count{model="m1",action="insert"} 2`,
+		`taodbi_run_duration_seconds_count{model="m2",action="topics"} 1`,
+		`taodbi_errors_total{source="run",class="not_found"} 1`,
+		`taodbi_errors_total{source="statement",class="not_found"} 1`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("%s not found in\n%s", line, text)
+		}
+	}
+
+	metrics.Publish("taodbi_test")
+	rec := httptest.NewRecorder()
+	expvar.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil { t.Fatal(err) }
+	var snapshot struct {
+		Statements map[string]struct{ Count int64 } `json:"statements"`
+		Runs       map[string]struct{ Count int64 } `json:"runs"`
+		Errors     map[string]int64                 `json:"errors"`
+	}
+	if err := json.Unmarshal(vars["taodbi_test"], &snapshot); err != nil { t.Fatal(err) }
+	if snapshot.Statements["insert/m1/insert"].Count != 2 || snapshot.Runs["m1/topics"].Count != 1 ||
+		snapshot.Errors["run/not_found"] != 1 {
+		t.Errorf("%s", vars["taodbi_test"])
+	}
+}
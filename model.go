@@ -3,7 +3,6 @@ package taodbi
 import (
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -30,6 +29,18 @@ type Navigate interface {
 
 	// SetDB: set SQL handle
 	SetDB(*sql.DB)
+
+	// SetRecorder: set statement recorder, nil to turn off
+	SetRecorder(*Recorder)
+
+	// SetHooks: set statement hooks
+	SetHooks(...Hook)
+
+	// setNames: set model and action names passed to hooks
+	setNames(string, string)
+
+	// setDatabase: qualify tables with database, empty for the default
+	setDatabase(string)
 }
 
 // Model works on table's CRUD in web applications.
@@ -71,13 +82,18 @@ func (self *Model) GetLists() []map[string]interface{} {
 	return self.aLISTS
 }
 
-// GetAction returns action's function
+// GetAction returns action's function. The action name is passed
+// to hooks while the function runs.
 func (self *Model) GetAction(action string) func(...map[string]interface{}) error {
-	if act, ok := self.Actions[action]; ok {
-		return act
+	act, ok := self.Actions[action]
+	if !ok {
+		return nil
+	}
+	return func(extra ...map[string]interface{}) error {
+		defer self.setNames(self.ModelName, self.ActionName)
+		self.setNames(self.ModelName, action)
+		return act(extra...)
 	}
-
-	return nil
 }
 
 // getArgs returns the input data which may have extra keys added
@@ -117,6 +133,25 @@ func (self *Model) SetDB(db *sql.DB) {
 	self.aLISTS = make([]map[string]interface{}, 0)
 }
 
+// SetRecorder sets the statement recorder
+func (self *Model) SetRecorder(r *Recorder) {
+	self.Recorder = r
+}
+
+// SetHooks sets the statement hooks
+func (self *Model) SetHooks(hooks ...Hook) {
+	self.Hooks = hooks
+}
+
+func (self *Model) setNames(model, action string) {
+	self.ModelName = model
+	self.ActionName = action
+}
+
+func (self *Model) setDatabase(database string) {
+	self.Table.qualify(database)
+}
+
 func (self *Model) filteredFields(pars []string) []string {
 	ARGS := self.aARGS
 	fields, ok := ARGS[self.Fields]
@@ -269,7 +304,7 @@ func (self *Model) orderString() string {
 func (self *Model) Edit(extra ...map[string]interface{}) error {
 	val := self.editIdVal(extra...)
 	if !hasValue(val) {
-		return errors.New("pk value not provided")
+		return newError(ErrMissingKey, self.ModelName, "pk value not provided")
 	}
 
 	hashPars := self.editHashPars
@@ -290,7 +325,7 @@ func (self *Model) EditFK(extra ...map[string]interface{}) error {
         val = self.properValue(id, extra[0])
     }
     if val == nil {
-        return errors.New("Foreign key has no value")
+        return newError(ErrMissingKey, self.ModelName, "Foreign key has no value")
     }
 
 	hashPars := self.editHashPars
@@ -314,7 +349,7 @@ func (self *Model) Insert(extra ...map[string]interface{}) error {
 		}
 	}
 	if !hasValue(fieldValues) {
-		return errors.New("no data to insert")
+		return newError(ErrValidation, self.ModelName, "no data to insert")
 	}
 
 	if err := self.insertHash(fieldValues); err != nil {
@@ -341,7 +376,7 @@ func (self *Model) Insupd(extra ...map[string]interface{}) error {
 		}
 	}
 	if !hasValue(fieldValues) {
-		return errors.New("unique value not found")
+		return newError(ErrMissingKey, self.ModelName, "unique value not found")
 	}
 
 	lists := make([]map[string]interface{}, 0)
@@ -350,7 +385,7 @@ func (self *Model) Insupd(extra ...map[string]interface{}) error {
     }
 
 	if len(lists) > 1 {
-        return errors.New("multiple returns for unique key")
+        return newError(ErrDuplicate, self.ModelName, "multiple returns for unique key")
     }
 
 	args := self.properValuesHash(self.InsertPars, nil)
@@ -6,12 +6,11 @@ import (
 	"strconv"
 	"math/rand"
     "database/sql"
-    _ "github.com/taosdata/driver-go/taosSql"
 )
 
 func TestModel(t *testing.T) {
     c := newconf("config.json")
-    db, err := sql.Open(c.DbType, c.Dsn2)
+    db, err := sql.Open(c.DbType, c.DSN(c.Database))
     if err != nil { panic(err) }
 	model, err := NewModel("m1.json")
     if err != nil { panic(err) }
@@ -116,7 +115,7 @@ if diff > 10.0 {
 
 func TestPagination(t *testing.T) {
     c := newconf("config.json")
-    db, err := sql.Open(c.DbType, c.Dsn2)
+    db, err := sql.Open(c.DbType, c.DSN(c.Database))
     if err != nil { panic(err) }
 	model, err := NewModel("m1.json")
     if err != nil { panic(err) }
@@ -181,7 +180,7 @@ func TestPagination(t *testing.T) {
 
 func TestUInsupd(t *testing.T) {
     c := newconf("config.json")
-    db, err := sql.Open(c.DbType, c.Dsn2)
+    db, err := sql.Open(c.DbType, c.DSN(c.Database))
     if err != nil { panic(err) }
     model, err := NewModel("m1.json")
     if err != nil { panic(err) }
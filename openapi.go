@@ -0,0 +1,293 @@
+package taodbi
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// OpenAPI returns the OpenAPI 3 document, in JSON, of all models and actions in the schema.
+// The paths follow the RESTful verbs:
+//	GET /model		topics
+//	GET /model/{key}	edit
+//	POST /model		insert
+//	PUT /model/{key}	update
+//	PATCH /model		insupd
+//	DELETE /model/{key}	delete
+//	GET /model/action	other actions
+// Each action's row is a component named model_action, with nextpages
+// embedded as properties, or merged in the merge mode.
+//
+func (self *Schema) OpenAPI() ([]byte, error) {
+	paths := make(map[string]interface{})
+	components := make(map[string]interface{})
+
+	names := make([]string, 0)
+	for name := range self.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		main, columns, actions := openapiTables(self.Models[name])
+		if main == nil {
+			continue
+		}
+		for _, action := range actions {
+			ref, err := self.openapiRow(components, name, action)
+			if err != nil {
+				return nil, err
+			}
+			if ref == nil {
+				continue
+			}
+			path, method, op := openapiOperation(name, action, main, columns, ref)
+			item, ok := paths[path].(map[string]interface{})
+			if !ok {
+				item = make(map[string]interface{})
+				paths[path] = item
+			}
+			item[method] = op
+		}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"openapi":    "3.0.3",
+		"info":       map[string]interface{}{"title": "taodbi schema", "version": "1.0.0"},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": components},
+	})
+}
+
+// openapiTables returns the main table, the table of columns and the sorted action names.
+// For Rmodel, the columns are in the profile table.
+func openapiTables(nav Navigate) (*Table, *Table, []string) {
+	var main, columns *Table
+	var actions map[string]func(...map[string]interface{}) error
+	switch m := nav.(type) {
+	case *Model:
+		main, columns, actions = &m.Table, &m.Table, m.Actions
+	case *Smodel:
+		main, columns, actions = &m.Table, &m.Table, m.Actions
+	case *Rmodel:
+		main, columns, actions = &m.Table, &m.ProfileTable.Table, m.Actions
+	default:
+		return nil, nil, nil
+	}
+	names := make([]string, 0)
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return main, columns, names
+}
+
+// openapiType maps the Go type used in pickup to an OpenAPI schema
+func openapiType(goType string) map[string]interface{} {
+	switch goType {
+	case "int", "int8", "int16", "int32", "uint", "uint8", "uint16", "uint32":
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case "int64":
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case "float32":
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case "float64":
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case "bool":
+		return map[string]interface{}{"type": "boolean"}
+	case "string":
+		return map[string]interface{}{"type": "string"}
+	default:
+	}
+	return map[string]interface{}{}
+}
+
+// openapiProperties returns the output labels and their schemas.
+// In case of hash, the labels are the values in the hash.
+func openapiProperties(hash map[string]interface{}, pars []interface{}) (map[string]interface{}, error) {
+	properties := make(map[string]interface{})
+	items := pars
+	if hasValue(hash) {
+		items = make([]interface{}, 0, len(hash))
+		for _, v := range hash {
+			items = append(items, v)
+		}
+	}
+	for _, vs := range items {
+		switch v := vs.(type) {
+		case string:
+			properties[v] = openapiType("")
+		case []interface{}:
+			if len(v) != 2 {
+				return nil, errors.New("column pair should be [label, type]")
+			}
+			label, ok := v[0].(string)
+			if !ok {
+				return nil, errors.New("column label should be string")
+			}
+			goType, ok := v[1].(string)
+			if !ok {
+				return nil, errors.New("column type should be string")
+			}
+			properties[label] = openapiType(goType)
+		default:
+			return nil, errors.New("column should be string or [label, type]")
+		}
+	}
+	return properties, nil
+}
+
+func openapiRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// openapiRow adds the component of model_action's row, and returns its reference.
+func (self *Schema) openapiRow(components map[string]interface{}, model, action string) (map[string]interface{}, error) {
+	key := model + "_" + action
+	if _, ok := components[key]; ok {
+		return openapiRef(key), nil
+	}
+	nav, ok := self.Models[model]
+	if !ok {
+		return nil, nil
+	}
+	main, columns, _ := openapiTables(nav)
+	if main == nil {
+		return nil, nil
+	}
+
+	var properties map[string]interface{}
+	var err error
+	switch action {
+	case "topics", "lasttopics", "releasetopics":
+		properties, err = openapiProperties(columns.TopicsHash, columns.TopicsPars)
+	case "edit", "editfk", "lastedit":
+		properties, err = openapiProperties(columns.EditHash, columns.EditPars)
+	default:
+		properties = make(map[string]interface{})
+		for _, v := range columns.InsertPars {
+			properties[v] = openapiType("")
+		}
+		properties[main.CurrentKey] = openapiType("")
+	}
+	if err != nil {
+		return nil, err
+	}
+	row := map[string]interface{}{"type": "object", "properties": properties}
+	// reserve the key before nextpages, which may refer back
+	components[key] = row
+
+	allOf := []interface{}{}
+	for _, page := range main.Nextpages[action] {
+		ref, err := self.openapiRow(components, page.Model, page.Action)
+		if err != nil {
+			return nil, err
+		}
+		if ref == nil {
+			continue
+		}
+		if page.Mode == "merge" {
+			allOf = append(allOf, ref)
+		} else {
+			properties[page.outputKey()] = map[string]interface{}{"type": "array", "items": ref}
+		}
+	}
+	if len(allOf) > 0 {
+		components[key] = map[string]interface{}{"allOf": append([]interface{}{row}, allOf...)}
+	}
+	return openapiRef(key), nil
+}
+
+// upperFirst upper-cases the first rune of 's'
+func upperFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+func openapiQuery(name string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"name": name, "in": "query", "required": false, "schema": schema}
+}
+
+// openapiOperation returns the path, the method and the operation of an action
+func openapiOperation(model, action string, main, columns *Table, ref map[string]interface{}) (string, string, map[string]interface{}) {
+	path := "/" + model
+	method := "get"
+	parameters := make([]interface{}, 0)
+	fields := openapiQuery(main.Fields, map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}})
+	idPath := func() {
+		path += "/{" + main.CurrentKey + "}"
+		parameters = append(parameters, map[string]interface{}{"name": main.CurrentKey, "in": "path", "required": true, "schema": map[string]interface{}{}})
+	}
+
+	var body map[string]interface{}
+	insert := func() {
+		properties := make(map[string]interface{})
+		for _, v := range columns.InsertPars {
+			properties[v] = openapiType("")
+		}
+		body = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{"type": "object", "properties": properties}}},
+		}
+	}
+
+	switch action {
+	case "topics":
+		integer := openapiType("int")
+		parameters = append(parameters,
+			openapiQuery(main.Rowcount, integer),
+			openapiQuery(main.Pageno, integer),
+			openapiQuery(main.Totalno, integer),
+			openapiQuery(main.Sortby, openapiType("string")),
+			openapiQuery(main.Sortreverse, openapiType("bool")),
+			fields)
+		if main != columns {
+			// Rmodel pages by the last id
+			parameters = append(parameters, openapiQuery(main.Passid, openapiType("int64")))
+		}
+	case "edit":
+		idPath()
+		parameters = append(parameters, fields)
+	case "insert":
+		method = "post"
+		insert()
+	case "insupd":
+		method = "patch"
+		insert()
+	case "update":
+		method = "put"
+		idPath()
+		parameters = append(parameters, openapiQuery(main.Empties, map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}))
+		insert()
+	case "delete":
+		method = "delete"
+		idPath()
+	default:
+		path += "/" + action
+		parameters = append(parameters, fields)
+	}
+
+	op := map[string]interface{}{
+		"operationId": model + upperFirst(action),
+		"tags":        []string{model},
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": model + " " + action,
+				"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{"type": "array", "items": ref}}},
+			},
+			"default": map[string]interface{}{"description": "error"},
+		},
+	}
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+	if body != nil {
+		op["requestBody"] = body
+	}
+	return path, method, op
+}
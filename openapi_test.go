@@ -0,0 +1,116 @@
+package taodbi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSchemaOpenAPI(t *testing.T) {
+	model, err := NewModel("m22.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.TopicsHash = map[string]interface{}{"x": []interface{}{"X", "string"}, "id": "ID"}
+	model.fulfill()
+	model.Nextpages["topics"] = append(model.Nextpages["topics"], &Page{Model: "testing", Action: "edit", Mode: "merge"})
+	model.Actions = map[string]func(...map[string]interface{}) error{"topics": model.Topics, "edit": model.Edit, "insert": model.Insert}
+
+	rest, err := NewRmodel("m3.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest.Actions = map[string]func(...map[string]interface{}) error{"topics": rest.Topics, "edit": rest.Edit, "update": rest.Update, "delete": rest.Delete}
+
+	schema := NewSchema(map[string]Navigate{"s": model, "testing": rest})
+	content, err := schema.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	paths := doc["paths"].(map[string]interface{})
+	for path, methods := range map[string][]string{"/s": {"get", "post"}, "/s/{id}": {"get"}, "/testing": {"get"}, "/testing/{tid}": {"get", "put", "delete"}} {
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s not found in %s", path, content)
+		}
+		for _, method := range methods {
+			if _, ok := item[method]; !ok {
+				t.Errorf("%s %s not found", method, path)
+			}
+		}
+	}
+
+	topics := paths["/s"].(map[string]interface{})["get"].(map[string]interface{})
+	names := make([]string, 0)
+	for _, p := range topics["parameters"].([]interface{}) {
+		names = append(names, p.(map[string]interface{})["name"].(string))
+	}
+	for _, name := range []string{"rowcount", "pageno", "sortby", "sortreverse", "totalno", "fields"} {
+		if !grep(names, name) {
+			t.Errorf("%s not in %v", name, names)
+		}
+	}
+	if grep(names, "passid") {
+		t.Errorf("passid is for Rmodel only: %v", names)
+	}
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	row := schemas["s_topics"].(map[string]interface{})["allOf"].([]interface{})
+	if len(row) != 2 || row[1].(map[string]interface{})["$ref"] != "#/components/schemas/testing_edit" {
+		t.Fatalf("%#v", row)
+	}
+	properties := row[0].(map[string]interface{})["properties"].(map[string]interface{})
+	if properties["X"].(map[string]interface{})["type"] != "string" {
+		t.Errorf("%#v", properties)
+	}
+	if _, ok := properties["ID"]; !ok {
+		t.Errorf("%#v", properties)
+	}
+	embedded := properties["testing_topics"].(map[string]interface{})
+	if embedded["type"] != "array" || embedded["items"].(map[string]interface{})["$ref"] != "#/components/schemas/testing_topics" {
+		t.Errorf("%#v", embedded)
+	}
+	child := schemas["testing_topics"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := child["child"]; !ok {
+		t.Errorf("%#v", child)
+	}
+}
+
+func TestOpenAPIMalformed(t *testing.T) {
+	model, err := NewModel("m22.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.Actions = map[string]func(...map[string]interface{}) error{"topics": model.Topics}
+	schema := NewSchema(map[string]Navigate{"s": model})
+
+	for _, hash := range []map[string]interface{}{
+		{"x": []interface{}{"X"}},
+		{"x": []interface{}{1, "string"}},
+		{"x": []interface{}{"X", 2}},
+		{"x": 3},
+	} {
+		model.TopicsHash = hash
+		if _, err := schema.OpenAPI(); err == nil {
+			t.Errorf("%v: malformed column not checked", hash)
+		}
+	}
+
+	model.TopicsHash = nil
+	content, err := schema.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	op := doc["paths"].(map[string]interface{})["/s"].(map[string]interface{})["get"].(map[string]interface{})
+	if op["operationId"] != "sTopics" {
+		t.Errorf("%v", op["operationId"])
+	}
+}
@@ -0,0 +1,338 @@
+package taodbi
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DataPoint is a data point of OpenTSDB, in the telnet line
+// put metric timestamp value tagk=tagv [tagk=tagv...]
+// or in the JSON of /api/put. The timestamp is in seconds,
+// or in milliseconds if it is greater than 9999999999.
+//
+type DataPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     float64           `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// UnmarshalJSON accepts the value as a number or a string
+func (self *DataPoint) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		Metric    string            `json:"metric"`
+		Timestamp json.Number       `json:"timestamp"`
+		Value     json.Number       `json:"value"`
+		Tags      map[string]string `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	ts, err := aux.Timestamp.Int64()
+	if err != nil {
+		return errors.New("invalid timestamp " + string(aux.Timestamp))
+	}
+	value, err := aux.Value.Float64()
+	if err != nil {
+		return errors.New("invalid value " + string(aux.Value))
+	}
+	*self = DataPoint{Metric: aux.Metric, Timestamp: ts, Value: value, Tags: aux.Tags}
+	return nil
+}
+
+// time returns the timestamp as time
+func (self *DataPoint) time() time.Time {
+	if self.Timestamp > 9999999999 {
+		return time.Unix(0, self.Timestamp*int64(time.Millisecond))
+	}
+	return time.Unix(self.Timestamp, 0)
+}
+
+// ParsePut parses a telnet put line, with or without the leading 'put'
+func ParsePut(line string) (*DataPoint, error) {
+	words := strings.Fields(line)
+	if len(words) > 0 && words[0] == "put" {
+		words = words[1:]
+	}
+	if len(words) < 4 {
+		return nil, newError(ErrValidation, "", "illegal argument: not enough arguments (need least 4, got "+strconv.Itoa(len(words))+")")
+	}
+	point := &DataPoint{Metric: words[0], Tags: make(map[string]string)}
+	var err error
+	if point.Timestamp, err = strconv.ParseInt(words[1], 10, 64); err != nil || point.Timestamp <= 0 {
+		return nil, newError(ErrValidation, point.Metric, "illegal argument: invalid timestamp "+words[1])
+	}
+	if point.Value, err = strconv.ParseFloat(words[2], 64); err != nil {
+		return nil, newError(ErrValidation, point.Metric, "illegal argument: invalid value "+words[2])
+	}
+	for _, word := range words[3:] {
+		i := strings.IndexByte(word, '=')
+		if i <= 0 || i == len(word)-1 {
+			return nil, newError(ErrValidation, point.Metric, "illegal argument: invalid tag "+word)
+		}
+		point.Tags[word[:i]] = word[i+1:]
+	}
+	return point, nil
+}
+
+// OpenTSDB writes data points of OpenTSDB into super tables, one per
+// metric, with timestamp 'ts', column 'value' and the tags as TDengine
+// tags. A super table is created on the first sight of its metric, with
+// Tags, or the tags of the data point. A data point may carry any subset
+// of the tags of its super table, the missing ones being NULL. The names
+// of metrics and tags have the characters not allowed in TDengine, like
+// '.', replaced by '_' and a hash of the name appended.
+// It serves the telnet protocol by Serve, and /api/put by ServeHTTP.
+//
+type OpenTSDB struct {
+	DBI
+	// Models are the super tables keyed by the metric
+	Models map[string]*Smodel
+	// Tags: optional, the tags of the super tables to create, default
+	// the tags of the first data point of each metric
+	Tags []string
+	// TagLength is the length of the string tags, default 64
+	TagLength int
+	// BatchSize is the maximal number of rows in a statement, default 1000
+	BatchSize int
+	sync.Mutex
+}
+
+// NewOpenTSDB creates an OpenTSDB writing into database handle 'db'
+func NewOpenTSDB(db *sql.DB) *OpenTSDB {
+	return &OpenTSDB{DBI: DBI{DB: db}, Models: make(map[string]*Smodel)}
+}
+
+// model returns the super table model of 'point', creating the super
+// table if it does not exist
+func (self *OpenTSDB) model(point *DataPoint) (*Smodel, error) {
+	if model, ok := self.Models[point.Metric]; ok {
+		return model, nil
+	}
+	length := self.TagLength
+	if length <= 0 {
+		length = 64
+	}
+	table := safeName(point.Metric, maxTableName)
+	names := self.Tags
+	if len(names) == 0 {
+		for k := range point.Tags {
+			names = append(names, k)
+		}
+	}
+	tags := make([]string, 0)
+	for _, k := range names {
+		tags = append(tags, safeName(k, maxColumnName)+" "+self.dialect().Text(length))
+	}
+	sort.Strings(tags)
+	if err := self.DoSQL("CREATE TABLE IF NOT EXISTS " + table + " (ts TIMESTAMP, value DOUBLE) TAGS (" + strings.Join(tags, ", ") + ")"); err != nil {
+		return nil, err
+	}
+
+	// the super table may exist with other columns
+	columns, err := self.Describe(table)
+	if err != nil {
+		return nil, err
+	}
+	model := &Smodel{}
+	model.CurrentTable = table
+	model.Tags = make([]string, 0)
+	for _, column := range columns {
+		if column.Tag {
+			model.Tags = append(model.Tags, column.Field)
+		} else if model.CurrentKey == "" {
+			model.CurrentKey = column.Field
+		}
+		model.EditPars = append(model.EditPars, column.Field)
+	}
+	model.InsertPars = append([]string{"value"}, model.Tags...)
+	model.TopicsPars = model.EditPars
+	model.fulfill()
+	model.acrud = model
+	model.DB = self.DB
+	model.Dialect = self.Dialect
+	model.Hooks = self.Hooks
+	self.Models[point.Metric] = model
+	return model, nil
+}
+
+// Write inserts the data points, creating the super tables and the
+// child tables when missing
+func (self *OpenTSDB) Write(points []*DataPoint) error {
+	size := self.BatchSize
+	if size <= 0 {
+		size = 1000
+	}
+	self.Lock()
+	defer self.Unlock()
+
+	order := make([]string, 0)
+	rows := make(map[string][]map[string]interface{})
+	for _, point := range points {
+		if point.Metric == "" || point.Timestamp <= 0 {
+			return newError(ErrValidation, point.Metric, "metric and timestamp are required")
+		}
+		if len(point.Tags) == 0 {
+			return newError(ErrValidation, point.Metric, "at least one tag is required")
+		}
+		model, err := self.model(point)
+		if err != nil {
+			return err
+		}
+		row := map[string]interface{}{model.CurrentKey: point.time(), "value": point.Value}
+		for _, tag := range model.Tags {
+			row[tag] = nil
+		}
+		for k, v := range point.Tags {
+			name := safeName(k, maxColumnName)
+			if _, ok := row[name]; !ok || name == model.CurrentKey || name == "value" {
+				return newError(ErrValidation, point.Metric, "tag "+k+" not in super table "+model.CurrentTable)
+			}
+			row[name] = v
+		}
+		if _, ok := rows[point.Metric]; !ok {
+			order = append(order, point.Metric)
+		}
+		rows[point.Metric] = append(rows[point.Metric], row)
+	}
+
+	for _, metric := range order {
+		model := self.Models[metric]
+		all := rows[metric]
+		for len(all) > 0 {
+			n := size
+			if n > len(all) {
+				n = len(all)
+			}
+			if err := model.InsertRows(all[:n]); err != nil {
+				return err
+			}
+			all = all[n:]
+		}
+	}
+	return nil
+}
+
+// ListenAndServe listens on TCP address 'addr' and serves the telnet protocol
+func (self *OpenTSDB) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return self.Serve(l)
+}
+
+// Serve accepts connections of the telnet protocol on listener 'l'
+// until it is closed. The commands are put, version and exit.
+//
+func (self *OpenTSDB) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go self.serveConn(conn)
+	}
+}
+
+// serveConn writes the put lines of a connection in batches of those
+// already received. Like OpenTSDB, only errors are answered.
+func (self *OpenTSDB) serveConn(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	points := make([]*DataPoint, 0)
+	flush := func() {
+		if len(points) == 0 {
+			return
+		}
+		if err := self.Write(points); err != nil {
+			fmt.Fprintf(conn, "put: %s\n", err.Error())
+		}
+		points = points[:0]
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if words := strings.Fields(line); len(words) > 0 {
+			switch words[0] {
+			case "put":
+				point, err := ParsePut(line)
+				if err != nil {
+					fmt.Fprintf(conn, "put: %s\n", err.Error())
+				} else {
+					points = append(points, point)
+				}
+			case "version":
+				flush()
+				fmt.Fprintf(conn, "taodbi OpenTSDB adapter\n")
+			case "exit":
+				flush()
+				return
+			default:
+				fmt.Fprintf(conn, "unknown command: %s.  Try `help'.\n", words[0])
+			}
+		}
+		if err != nil || reader.Buffered() == 0 || len(points) >= 1000 {
+			flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ServeHTTP serves /api/put with one data point or an array of them
+// in JSON. It returns 204 on success, and the error of OpenTSDB otherwise.
+//
+func (self *OpenTSDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		openTSDBError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		openTSDBError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	points := make([]*DataPoint, 0)
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(data, &points)
+	} else {
+		point := new(DataPoint)
+		err = json.Unmarshal(data, point)
+		points = append(points, point)
+	}
+	if err != nil {
+		openTSDBError(w, http.StatusBadRequest, "unable to parse the given JSON: "+err.Error())
+		return
+	}
+	err = self.Write(points)
+	var modelErr *Error
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.As(err, &modelErr):
+		openTSDBError(w, http.StatusBadRequest, err.Error())
+	default:
+		openTSDBError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func openTSDBError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": code, "message": msg}})
+}
@@ -0,0 +1,148 @@
+package taodbi
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePut(t *testing.T) {
+	point, err := ParsePut("put sys.cpu.user 1600000000123 42.5 host=web01 cpu=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if point.Metric != "sys.cpu.user" || point.Value != 42.5 || point.Tags["host"] != "web01" || point.Tags["cpu"] != "0" {
+		t.Errorf("%#v", point)
+	}
+	if !point.time().Equal(time.Unix(1600000000, 123000000)) {
+		t.Errorf("%v", point.time())
+	}
+	if point, err = ParsePut("sys.cpu.user 1600000000 1 host=web01"); err != nil || !point.time().Equal(time.Unix(1600000000, 0)) {
+		t.Errorf("%#v %v", point, err)
+	}
+	for _, line := range []string{
+		"put sys.cpu.user 1600000000 1",
+		"put sys.cpu.user x 1 host=a",
+		"put sys.cpu.user 1600000000 x host=a",
+		"put sys.cpu.user 1600000000 1 host",
+	} {
+		if _, err := ParsePut(line); err == nil {
+			t.Errorf("%s: error expected", line)
+		}
+	}
+}
+
+func TestOpenTSDB(t *testing.T) {
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tsdb := NewOpenTSDB(db)
+	stable := safeName("sys.cpu.user", maxTableName)
+	if err := tsdb.DoSQL("DROP TABLE IF EXISTS " + stable); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(tsdb)
+	defer server.Close()
+	for _, c := range []struct {
+		body string
+		code int
+	}{
+		{`{"metric":"sys.cpu.user","timestamp":1600000000,"value":1.5,"tags":{"host":"web-01","cpu":"0"}}`, http.StatusNoContent},
+		{`[{"metric":"sys.cpu.user","timestamp":1600000001000,"value":"2","tags":{"host":"web-01","cpu":"0"}},
+		   {"metric":"sys.cpu.user","timestamp":1600000000,"value":3,"tags":{"host":"web-02","cpu":"0"}}]`, http.StatusNoContent},
+		{`{"metric":"sys.cpu.user","timestamp":1600000000,"value":1,"tags":{"host":"web-01"}}`, http.StatusNoContent},
+		{`{"metric":"sys.cpu.user","timestamp":1600000000,"value":1,"tags":{"host":"web-01","dc":"east"}}`, http.StatusBadRequest},
+		{`{"metric":"sys.cpu.user","timestamp":1600000000,"value":1,"tags":{}}`, http.StatusBadRequest},
+		{`{"metric":"sys.cpu.user","timestamp":1600000000,"value":"x","tags":{"host":"web-01"}}`, http.StatusBadRequest},
+	} {
+		res, err := http.Post(server.URL+"/api/put", "application/json", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.code {
+			t.Errorf("%s: %d", c.body, res.StatusCode)
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- tsdb.Serve(l) }()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "put sys.cpu.user 1600000002 4 host=web-01 cpu=0\nput sys.cpu.user 1600000002 bad host=web-01 cpu=0\nhello\nput sys.cpu.user 1600000002 5 cpu=1 host=web-01\nexit\n")
+	reply, err := io.ReadAll(conn)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(reply)), "\n"); len(lines) != 2 ||
+		!strings.HasPrefix(lines[0], "put: illegal argument") || !strings.HasPrefix(lines[1], "unknown command: hello") {
+		t.Errorf("%q", reply)
+	}
+	l.Close()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	got := make([]map[string]interface{}, 0)
+	if err := tsdb.SelectSQLLabel(&got, []string{"n", "total"}, "SELECT COUNT(*), SUM(value) FROM "+stable); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0]["n"] != int64(6) || got[0]["total"] != 16.5 {
+		t.Errorf("%#v", got)
+	}
+	n := int64(0)
+	if err := tsdb.scanRow("SELECT COUNT(*) FROM "+stable+childSuffix(stable, []interface{}{"0", "web-01"}), []interface{}{&n}); err != nil || n != 3 {
+		t.Errorf("%d %v", n, err)
+	}
+	if err := tsdb.scanRow("SELECT COUNT(*) FROM "+stable+" WHERE cpu IS NULL", []interface{}{&n}); err != nil || n != 1 {
+		t.Errorf("%d %v", n, err)
+	}
+}
+
+func TestOpenTSDBTags(t *testing.T) {
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tsdb := NewOpenTSDB(db)
+	tsdb.Tags = []string{"host", "cpu", "dc"}
+	stable := safeName("mem.free", maxTableName)
+	if err := tsdb.DoSQL("DROP TABLE IF EXISTS " + stable); err != nil {
+		t.Fatal(err)
+	}
+
+	points := []*DataPoint{
+		{Metric: "mem.free", Timestamp: 1600000000, Value: 1, Tags: map[string]string{"host": "a"}},
+		{Metric: "mem.free", Timestamp: 1600000000, Value: 2, Tags: map[string]string{"host": "a", "dc": "east"}},
+		{Metric: "mem.free", Timestamp: 1600000000, Value: 3, Tags: map[string]string{"cpu": "1", "dc": "east"}},
+	}
+	if err := tsdb.Write(points); err != nil {
+		t.Fatal(err)
+	}
+	if tags := tsdb.Models["mem.free"].Tags; len(tags) != 3 {
+		t.Errorf("%v", tags)
+	}
+	n := int64(0)
+	if err := tsdb.scanRow("SELECT COUNT(*) FROM "+stable+" WHERE dc='east'", []interface{}{&n}); err != nil || n != 2 {
+		t.Errorf("%d %v", n, err)
+	}
+	if err := tsdb.Write([]*DataPoint{{Metric: "mem.free", Timestamp: 1600000000, Value: 1, Tags: map[string]string{"rack": "r1"}}}); !errors.Is(err, ErrValidation) {
+		t.Errorf("%v", err)
+	}
+}
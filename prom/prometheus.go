@@ -0,0 +1,349 @@
+// Package prom is a remote storage of Prometheus in a super table of
+// taodbi, kept apart for its dependencies on protobuf and snappy.
+package prom
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/genelet/taodbi"
+	"github.com/golang/snappy"
+)
+
+// Prometheus is a remote storage of Prometheus in the super table of
+// Model. The labels of a series are the Tags of the model, so each series
+// is a child table, and the samples are written to column Value. Missing
+// labels are written as empty strings. A series with labels not in Tags
+// is rejected, unless SeriesTag is set to keep it apart from the others.
+//
+type Prometheus struct {
+	Model *taodbi.Smodel
+	// Value is the column of sample values, default "value"
+	Value string
+	// SeriesTag: optional, a tag in Tags receiving the hash of all labels,
+	// so that series differing only by labels not in Tags are written to
+	// different child tables. Those labels are not stored.
+	SeriesTag string
+	// Precision is the precision of the database, "ms" (default), "us" or "ns"
+	Precision string
+	// BatchSize is the maximal number of rows in a statement, default 1000
+	BatchSize int
+	sync.Mutex
+}
+
+// NewPrometheus creates a Prometheus storage in super table 'model'
+func NewPrometheus(model *taodbi.Smodel) *Prometheus {
+	return &Prometheus{Model: model}
+}
+
+func (self *Prometheus) value() string {
+	if self.Value == "" {
+		return "value"
+	}
+	return self.Value
+}
+
+// unit returns the duration of timestamps in the database
+func (self *Prometheus) unit() time.Duration {
+	switch self.Precision {
+	case "us":
+		return time.Microsecond
+	case "ns":
+		return time.Nanosecond
+	default:
+	}
+	return time.Millisecond
+}
+
+// Write inserts the samples of 'all'. Samples of NaN, which are
+// the staleness markers of Prometheus, are skipped.
+//
+func (self *Prometheus) Write(all []*TimeSeries) error {
+	size := self.BatchSize
+	if size <= 0 {
+		size = 1000
+	}
+	if self.SeriesTag != "" && !grep(self.Model.Tags, self.SeriesTag) {
+		return newError( self.Model.ModelName, "series tag "+self.SeriesTag+" not in tags")
+	}
+	rows := make([]map[string]interface{}, 0)
+	for _, series := range all {
+		labels := make(map[string]string)
+		for _, label := range series.Labels {
+			labels[label.Name] = label.Value
+			if self.SeriesTag == "" && !grep(self.Model.Tags, label.Name) || self.SeriesTag != "" && label.Name == self.SeriesTag {
+				return newError( self.Model.ModelName, "label "+label.Name+" not in tags")
+			}
+		}
+		if self.SeriesTag != "" {
+			labels[self.SeriesTag] = seriesHash(series.Labels)
+		}
+		for _, sample := range series.Samples {
+			if math.IsNaN(sample.Value) {
+				continue
+			}
+			row := map[string]interface{}{
+				self.Model.CurrentKey: time.Unix(0, sample.Timestamp*int64(time.Millisecond)),
+				self.value():          sample.Value,
+			}
+			for _, tag := range self.Model.Tags {
+				row[tag] = labels[tag]
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	self.Lock()
+	defer self.Unlock()
+	for len(rows) > 0 {
+		n := size
+		if n > len(rows) {
+			n = len(rows)
+		}
+		if err := self.Model.InsertRows(rows[:n]); err != nil {
+			return err
+		}
+		rows = rows[n:]
+	}
+	return nil
+}
+
+// newError returns a validation error of 'model', which is answered by 400
+func newError(model, msg string) *taodbi.Error {
+	return &taodbi.Error{Kind: taodbi.ErrValidation, Model: model, Msg: msg}
+}
+
+func grep(vs []string, t string) bool {
+	for _, v := range vs {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// seriesHash returns the FNV-1a hash of the sorted labels in 16 hex digits
+func seriesHash(labels []Label) string {
+	pairs := make([]string, len(labels))
+	for i, label := range labels {
+		pairs[i] = label.Name + "=" + label.Value
+	}
+	sort.Strings(pairs)
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(pairs, "\xff")))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// matcher is a label matcher with the compiled regular expression
+type matcher struct {
+	LabelMatcher
+	re *regexp.Regexp
+}
+
+func (self *matcher) matches(value string) bool {
+	switch self.Type {
+	case MatchEqual:
+		return value == self.Value
+	case MatchNotEqual:
+		return value != self.Value
+	case MatchRegexp:
+		return self.re.MatchString(value)
+	case MatchNotRegexp:
+		return !self.re.MatchString(value)
+	default:
+	}
+	return false
+}
+
+// Read returns the series matched by 'query', with samples in order of
+// time. The equal matchers on tags are in the WHERE condition, and the
+// others are applied to the rows selected.
+//
+func (self *Prometheus) Read(query *ReadQuery) ([]*TimeSeries, error) {
+	model := self.Model
+	matchers := make([]*matcher, 0)
+	for _, m := range query.Matchers {
+		item := &matcher{LabelMatcher: m}
+		if m.Type == MatchRegexp || m.Type == MatchNotRegexp {
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return nil, newError( model.ModelName, "invalid regexp "+m.Value)
+			}
+			item.re = re
+		} else if m.Type != MatchEqual && m.Type != MatchNotEqual {
+			return nil, newError( model.ModelName, "invalid matcher type")
+		}
+		matchers = append(matchers, item)
+	}
+
+	unit := int64(self.unit())
+	labels := append([]string{model.CurrentKey, self.value()}, model.Tags...)
+	types := []string{"int64", "float64"}
+	for range model.Tags {
+		types = append(types, "string")
+	}
+	sql := "SELECT " + strings.Join(labels, ", ") + " FROM " + model.CurrentTable + " WHERE " + model.CurrentKey + ">=? AND " + model.CurrentKey + "<=?"
+	values := []interface{}{
+		time.Unix(0, query.Start*int64(time.Millisecond)),
+		time.Unix(0, query.End*int64(time.Millisecond)),
+	}
+	for _, m := range matchers {
+		if m.Type == MatchEqual && grep(model.Tags, m.Name) {
+			sql += " AND " + m.Name + "=?"
+			values = append(values, m.Value)
+		}
+	}
+
+	self.Lock()
+	lists := make([]map[string]interface{}, 0)
+	err := model.SelectSQLTypeLabel(&lists, types, labels, sql, values...)
+	self.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]*TimeSeries, 0)
+	index := make(map[string]*TimeSeries)
+	for _, item := range lists {
+		key := ""
+		for _, tag := range model.Tags {
+			v, _ := item[tag].(string)
+			key += v + "\xff"
+		}
+		series, ok := index[key]
+		if !ok {
+			series = &TimeSeries{}
+			for _, tag := range model.Tags {
+				if v, _ := item[tag].(string); v != "" && tag != self.SeriesTag {
+					series.Labels = append(series.Labels, Label{Name: tag, Value: v})
+				}
+			}
+			index[key] = series
+			if !seriesMatches(series, matchers) {
+				continue
+			}
+			all = append(all, series)
+		}
+		ts, _ := item[model.CurrentKey].(int64)
+		v, _ := item[self.value()].(float64)
+		series.Samples = append(series.Samples, Sample{Value: v, Timestamp: ts * unit / int64(time.Millisecond)})
+	}
+	for _, series := range all {
+		sort.SliceStable(series.Samples, func(i, j int) bool {
+			return series.Samples[i].Timestamp < series.Samples[j].Timestamp
+		})
+	}
+	return all, nil
+}
+
+// seriesMatches tests the labels of 'series' against 'matchers',
+// a missing label being an empty string
+func seriesMatches(series *TimeSeries, matchers []*matcher) bool {
+	for _, m := range matchers {
+		value := ""
+		for _, label := range series.Labels {
+			if label.Name == m.Name {
+				value = label.Value
+			}
+		}
+		if !m.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// readBody returns the snappy-decoded body of request 'r'
+func readBody(r *http.Request) ([]byte, error) {
+	compressed, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return snappy.Decode(nil, compressed)
+}
+
+// ServeHTTP serves the remote read if the path ends in /read,
+// otherwise the remote write
+func (self *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/read") {
+		self.ServeRead(w, r)
+	} else {
+		self.ServeWrite(w, r)
+	}
+}
+
+// ServeWrite serves the remote write of snappy-compressed protobuf
+// WriteRequest. It returns 204 on success, 400 for a bad request, which
+// Prometheus does not retry, and 500 for a database error, which it does.
+//
+func (self *Prometheus) ServeWrite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	all, err := unmarshalWriteRequest(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = self.Write(all)
+	var modelErr *taodbi.Error
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.As(err, &modelErr):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ServeRead serves the remote read of snappy-compressed protobuf
+// ReadRequest, answering ReadResponse of samples.
+//
+func (self *Prometheus) ServeRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	queries, err := unmarshalReadRequest(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	results := make([][]*TimeSeries, 0)
+	for _, query := range queries {
+		all, err := self.Read(query)
+		var modelErr *taodbi.Error
+		if errors.As(err, &modelErr) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		results = append(results, all)
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	w.Write(snappy.Encode(nil, marshalReadResponse(results)))
+}
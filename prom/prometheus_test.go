@@ -0,0 +1,209 @@
+package prom
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/genelet/taodbi"
+	_ "github.com/genelet/taodbi/taodbitest"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// open opens the test database of config.json in the taodbitest driver
+func open() (*sql.DB, error) {
+	c, err := taodbi.NewConfig("../config.json")
+	if err != nil {
+		return nil, err
+	}
+	return sql.Open("taodbitest", c.DSN(c.Database))
+}
+
+func marshalWriteRequest(all []*TimeSeries) []byte {
+	var b []byte
+	for _, series := range all {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = appendTimeSeries(b, series)
+	}
+	return b
+}
+
+func marshalReadRequest(query *ReadQuery) []byte {
+	var q []byte
+	q = protowire.AppendTag(q, 1, protowire.VarintType)
+	q = protowire.AppendVarint(q, uint64(query.Start))
+	q = protowire.AppendTag(q, 2, protowire.VarintType)
+	q = protowire.AppendVarint(q, uint64(query.End))
+	for _, m := range query.Matchers {
+		var item []byte
+		item = protowire.AppendTag(item, 1, protowire.VarintType)
+		item = protowire.AppendVarint(item, uint64(m.Type))
+		item = protowire.AppendTag(item, 2, protowire.BytesType)
+		item = protowire.AppendString(item, m.Name)
+		item = protowire.AppendTag(item, 3, protowire.BytesType)
+		item = protowire.AppendString(item, m.Value)
+		q = protowire.AppendTag(q, 3, protowire.BytesType)
+		q = protowire.AppendBytes(q, item)
+	}
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, q)
+}
+
+func unmarshalReadResponse(b []byte) ([][]*TimeSeries, error) {
+	results := make([][]*TimeSeries, 0)
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, bytes []byte, v uint64) error {
+		all, err := unmarshalWriteRequest(bytes)
+		results = append(results, all)
+		return err
+	})
+	return results, err
+}
+
+func TestPrometheus(t *testing.T) {
+	db, err := open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	smodel, err := taodbi.NewSmodel("testdata/prom.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smodel.SetDB(db)
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS samples",
+		"CREATE TABLE samples (ts timestamp, value double) TAGS (__name__ binary(64), job binary(32), instance binary(32))",
+	} {
+		if err := smodel.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prom := NewPrometheus(smodel)
+	prom.Precision = "us"
+	server := httptest.NewServer(prom)
+	defer server.Close()
+
+	post := func(path string, body []byte) ([]byte, int) {
+		res, err := http.Post(server.URL+path, "application/x-protobuf", bytes.NewReader(snappy.Encode(nil, body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		return data, res.StatusCode
+	}
+
+	up := []Label{{"__name__", "up"}, {"job", "node"}, {"instance", "a:9100"}}
+	upB := []Label{{"__name__", "up"}, {"job", "node"}, {"instance", "b:9100"}}
+	load := []Label{{"__name__", "load1"}, {"job", "node"}}
+	if _, code := post("/api/v1/write", marshalWriteRequest([]*TimeSeries{
+		{Labels: up, Samples: []Sample{{1, 1600000001000}, {0, 1600000000000}}},
+		{Labels: upB, Samples: []Sample{{1, 1600000000000}}},
+		{Labels: load, Samples: []Sample{{0.5, 1600000000500}}},
+	})); code != http.StatusNoContent {
+		t.Fatalf("%d", code)
+	}
+	if _, code := post("/api/v1/write", []byte{0xff}); code != http.StatusBadRequest {
+		t.Errorf("%d", code)
+	}
+	// env is not a tag
+	if _, code := post("/api/v1/write", marshalWriteRequest([]*TimeSeries{
+		{Labels: append(upB, Label{"env", "prod"}), Samples: []Sample{{1, 1600000000000}}},
+	})); code != http.StatusBadRequest {
+		t.Errorf("%d", code)
+	}
+
+	data, code := post("/api/v1/read", marshalReadRequest(&ReadQuery{
+		Start: 1600000000000,
+		End:   1600000001000,
+		Matchers: []LabelMatcher{
+			{MatchEqual, "__name__", "up"},
+			{MatchRegexp, "instance", "a:.*"},
+		},
+	}))
+	if code != http.StatusOK {
+		t.Fatalf("%d %s", code, data)
+	}
+	data, err = snappy.Decode(nil, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := unmarshalReadResponse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]*TimeSeries{{{Labels: up, Samples: []Sample{{0, 1600000000000}, {1, 1600000001000}}}}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("%#v", results[0])
+	}
+
+	all, err := prom.Read(&ReadQuery{Start: 1600000000000, End: 1600000000600, Matchers: []LabelMatcher{{MatchNotEqual, "instance", ""}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || len(all[0].Samples) != 1 || len(all[1].Samples) != 1 {
+		t.Errorf("%#v", all)
+	}
+	if _, err := prom.Read(&ReadQuery{Matchers: []LabelMatcher{{MatchRegexp, "job", "("}}}); err == nil {
+		t.Errorf("regexp error expected")
+	}
+}
+
+func TestPrometheusSeriesTag(t *testing.T) {
+	db, err := open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	smodel, err := taodbi.NewSmodel("testdata/prom.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smodel.SetDB(db)
+	smodel.CurrentTable = "series"
+	smodel.Tags = append(smodel.Tags, "series_id")
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS series",
+		"CREATE TABLE series (ts timestamp, value double) TAGS (__name__ binary(64), job binary(32), instance binary(32), series_id binary(16))",
+	} {
+		if err := smodel.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prom := NewPrometheus(smodel)
+	prom.SeriesTag = "series_id"
+
+	prod := []Label{{"__name__", "up"}, {"job", "node"}, {"instance", "a:9100"}, {"env", "prod"}}
+	test := []Label{{"__name__", "up"}, {"job", "node"}, {"instance", "a:9100"}, {"env", "test"}}
+	if err := prom.Write([]*TimeSeries{
+		{Labels: prod, Samples: []Sample{{1, 1600000000000}}},
+		{Labels: test, Samples: []Sample{{0, 1600000000000}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	all, err := prom.Read(&ReadQuery{Start: 1600000000000, End: 1600000000000, Matchers: []LabelMatcher{{MatchEqual, "__name__", "up"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || len(all[0].Samples) != 1 || len(all[1].Samples) != 1 || all[0].Samples[0].Value == all[1].Samples[0].Value {
+		t.Errorf("%#v", all)
+	}
+	for _, series := range all {
+		for _, label := range series.Labels {
+			if label.Name == "series_id" {
+				t.Errorf("%v", series.Labels)
+			}
+		}
+	}
+
+	if err := prom.Write([]*TimeSeries{{Labels: []Label{{"series_id", "x"}}, Samples: []Sample{{1, 1600000000000}}}}); !errors.Is(err, taodbi.ErrValidation) {
+		t.Errorf("%v", err)
+	}
+}
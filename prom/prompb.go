@@ -0,0 +1,211 @@
+package prom
+
+import (
+	"errors"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of the remote storage protocol of Prometheus, in prompb
+
+// Label is a name and value pair of a series
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a value at a timestamp in milliseconds
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// TimeSeries is a series of samples identified by labels
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// MatchType is the type of a label matcher
+type MatchType int
+
+// Types of label matcher
+const (
+	MatchEqual MatchType = iota
+	MatchNotEqual
+	MatchRegexp
+	MatchNotRegexp
+)
+
+// LabelMatcher selects series by the value of a label
+type LabelMatcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+}
+
+// ReadQuery selects the samples of the matched series in a time range,
+// inclusive, in milliseconds
+type ReadQuery struct {
+	Start    int64
+	End      int64
+	Matchers []LabelMatcher
+}
+
+var errProtobuf = errors.New("invalid protobuf message")
+
+// consumeFields calls 'field' with the number, type and value of each field
+// in 'b', the value being bytes, or an integer for varint and fixed64 types
+func consumeFields(b []byte, field func(protowire.Number, protowire.Type, []byte, uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errProtobuf
+		}
+		b = b[n:]
+		var bytes []byte
+		var v uint64
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errProtobuf
+		}
+		b = b[n:]
+		if err := field(num, typ, bytes, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unmarshalTimeSeries(b []byte) (*TimeSeries, error) {
+	series := new(TimeSeries)
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, bytes []byte, v uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			var label Label
+			err := consumeFields(bytes, func(num protowire.Number, typ protowire.Type, bytes []byte, v uint64) error {
+				if num == 1 && typ == protowire.BytesType {
+					label.Name = string(bytes)
+				} else if num == 2 && typ == protowire.BytesType {
+					label.Value = string(bytes)
+				}
+				return nil
+			})
+			series.Labels = append(series.Labels, label)
+			return err
+		case num == 2 && typ == protowire.BytesType:
+			var sample Sample
+			err := consumeFields(bytes, func(num protowire.Number, typ protowire.Type, bytes []byte, v uint64) error {
+				if num == 1 && typ == protowire.Fixed64Type {
+					sample.Value = math.Float64frombits(v)
+				} else if num == 2 && typ == protowire.VarintType {
+					sample.Timestamp = int64(v)
+				}
+				return nil
+			})
+			series.Samples = append(series.Samples, sample)
+			return err
+		}
+		return nil
+	})
+	return series, err
+}
+
+// unmarshalWriteRequest returns the series of a WriteRequest
+func unmarshalWriteRequest(b []byte) ([]*TimeSeries, error) {
+	all := make([]*TimeSeries, 0)
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, bytes []byte, v uint64) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		series, err := unmarshalTimeSeries(bytes)
+		all = append(all, series)
+		return err
+	})
+	return all, err
+}
+
+// unmarshalReadRequest returns the queries of a ReadRequest
+func unmarshalReadRequest(b []byte) ([]*ReadQuery, error) {
+	queries := make([]*ReadQuery, 0)
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, bytes []byte, v uint64) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		query := new(ReadQuery)
+		queries = append(queries, query)
+		return consumeFields(bytes, func(num protowire.Number, typ protowire.Type, bytes []byte, v uint64) error {
+			switch {
+			case num == 1 && typ == protowire.VarintType:
+				query.Start = int64(v)
+			case num == 2 && typ == protowire.VarintType:
+				query.End = int64(v)
+			case num == 3 && typ == protowire.BytesType:
+				var matcher LabelMatcher
+				err := consumeFields(bytes, func(num protowire.Number, typ protowire.Type, bytes []byte, v uint64) error {
+					switch {
+					case num == 1 && typ == protowire.VarintType:
+						matcher.Type = MatchType(v)
+					case num == 2 && typ == protowire.BytesType:
+						matcher.Name = string(bytes)
+					case num == 3 && typ == protowire.BytesType:
+						matcher.Value = string(bytes)
+					}
+					return nil
+				})
+				query.Matchers = append(query.Matchers, matcher)
+				return err
+			}
+			return nil
+		})
+	})
+	return queries, err
+}
+
+func appendTimeSeries(b []byte, series *TimeSeries) []byte {
+	var body []byte
+	for _, label := range series.Labels {
+		var item []byte
+		item = protowire.AppendTag(item, 1, protowire.BytesType)
+		item = protowire.AppendString(item, label.Name)
+		item = protowire.AppendTag(item, 2, protowire.BytesType)
+		item = protowire.AppendString(item, label.Value)
+		body = protowire.AppendTag(body, 1, protowire.BytesType)
+		body = protowire.AppendBytes(body, item)
+	}
+	for _, sample := range series.Samples {
+		var item []byte
+		item = protowire.AppendTag(item, 1, protowire.Fixed64Type)
+		item = protowire.AppendFixed64(item, math.Float64bits(sample.Value))
+		item = protowire.AppendTag(item, 2, protowire.VarintType)
+		item = protowire.AppendVarint(item, uint64(sample.Timestamp))
+		body = protowire.AppendTag(body, 2, protowire.BytesType)
+		body = protowire.AppendBytes(body, item)
+	}
+	return protowire.AppendBytes(b, body)
+}
+
+// marshalReadResponse returns a ReadResponse of the series of each query
+func marshalReadResponse(results [][]*TimeSeries) []byte {
+	var b []byte
+	for _, all := range results {
+		var result []byte
+		for _, series := range all {
+			result = protowire.AppendTag(result, 1, protowire.BytesType)
+			result = appendTimeSeries(result, series)
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, result)
+	}
+	return b
+}
@@ -0,0 +1,59 @@
+package taodbi
+
+import (
+	"sync"
+)
+
+// Statement is a SQL statement with its arguments, as passed to DBI.
+type Statement struct {
+	Query string        `json:"query"`
+	Args  []interface{} `json:"args,omitempty"`
+}
+
+// Recorder logs the statements run through DBI.
+// If DryRun is true, the statements are logged but not sent to the database:
+// executions affect no row, and queries return no row.
+//
+type Recorder struct {
+	DryRun bool
+
+	sync.Mutex
+	statements []Statement
+}
+
+// NewRecorder creates a recorder, in dry-run mode if 'dryRun' is true.
+func NewRecorder(dryRun bool) *Recorder {
+	return &Recorder{DryRun: dryRun}
+}
+
+// Log returns the recorded statements in order.
+func (self *Recorder) Log() []Statement {
+	self.Lock()
+	defer self.Unlock()
+	log := make([]Statement, len(self.statements))
+	copy(log, self.statements)
+	return log
+}
+
+// Reset clears the log.
+func (self *Recorder) Reset() {
+	self.Lock()
+	self.statements = nil
+	self.Unlock()
+}
+
+func (self *Recorder) add(query string, args []interface{}) {
+	self.Lock()
+	self.statements = append(self.statements, Statement{Query: query, Args: args})
+	self.Unlock()
+}
+
+// record logs the statement if there is a recorder,
+// and reports if the statement should be skipped.
+func (self *DBI) record(query string, args ...interface{}) bool {
+	if self.Recorder == nil {
+		return false
+	}
+	self.Recorder.add(query, args)
+	return self.Recorder.DryRun
+}
@@ -0,0 +1,65 @@
+package taodbi
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	c := newconf("config.json")
+	db, err := sql.Open(c.DbType, c.DSN(c.Database))
+	if err != nil { t.Fatal(err) }
+	defer db.Close()
+
+	model, err := NewModel("m1.json")
+	if err != nil { t.Fatal(err) }
+	model.SetDB(db)
+	if err = model.DoSQL(`drop table if exists atesting`); err != nil { t.Fatal(err) }
+	if err = model.DoSQL(`CREATE TABLE atesting (id timestamp, x binary(8), y binary(8), z binary(8))`); err != nil { t.Fatal(err) }
+
+	r := NewRecorder(false)
+	model.SetRecorder(r)
+	model.SetArgs(map[string]interface{}{"x":"a1234567"})
+	if err = model.Insert(); err != nil { t.Fatal(err) }
+	log := r.Log()
+	if len(log) != 2 ||
+		log[0].Query != "INSERT INTO atesting (id, x) VALUES (now,?)" || log[0].Args[0] != "a1234567" ||
+		log[1].Query != "SELECT LAST(id) FROM atesting" || log[1].Args != nil {
+		t.Errorf("%#v", log)
+	}
+	if model.LastID == 0 {
+		t.Errorf("insert should be executed")
+	}
+
+	model.Actions = map[string]func(...map[string]interface{}) error{
+		"topics": func(args ...map[string]interface{}) error { return model.Topics(args...) },
+		"insert": func(args ...map[string]interface{}) error { return model.Insert(args...) },
+	}
+	r = NewRecorder(true)
+	schema := NewSchema(map[string]Navigate{"m1": model})
+	schema.SetDB(db)
+	schema.SetRecorder(r)
+	lists, err := schema.Run("m1", "topics", map[string]interface{}{}, map[string]interface{}{"x":"a1234567"})
+	if err != nil { t.Fatal(err) }
+	log = r.Log()
+	if len(lists) != 0 || len(log) != 1 ||
+		log[0].Query != "SELECT id, x, y, z\nFROM atesting\nWHERE (x=?)\nORDER BY id" || log[0].Args[0] != "a1234567" {
+		t.Errorf("%#v", log)
+	}
+	if model.Recorder != nil {
+		t.Errorf("recorder should be unset after Run")
+	}
+
+	r.Reset()
+	schema.SetRecorder(r)
+	if _, err = schema.Run("m1", "insert", map[string]interface{}{"x":"b1234567"}); err != nil { t.Fatal(err) }
+	if len(r.Log()) != 2 {
+		t.Errorf("%#v", r.Log())
+	}
+	model.SetDB(db)
+	model.SetArgs(map[string]interface{}{})
+	if err = model.Topics(); err != nil { t.Fatal(err) }
+	if lists = model.GetLists(); len(lists) != 1 {
+		t.Errorf("dry run should not insert: %#v", lists)
+	}
+}
@@ -0,0 +1,76 @@
+package taodbi
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/genelet/taodbi/taodbitest"
+	_ "github.com/genelet/taodbi/taosrest"
+)
+
+// TestREST runs the same model over the REST driver and the native one,
+// expecting the same values from pickup.
+func TestREST(t *testing.T) {
+	fakeOnly(t)
+	server := httptest.NewServer(&taodbitest.RESTHandler{User: "root", Password: "taosdata"})
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	c := newconf("config.json")
+	native, err := open(c.DSN(c.Database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer native.Close()
+	rest, err := sql.Open("taosRest", "root:taosdata@/http("+address+")/demodb?parseTime=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rest.Close()
+
+	results := make([][]map[string]interface{}, 0)
+	for i, db := range []*sql.DB{native, rest} {
+		model, err := NewModel("m1.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		model.SetDB(db)
+		for _, query := range []string{
+			"DROP TABLE IF EXISTS atesting",
+			"CREATE TABLE atesting (id timestamp, x binary(8), y binary(8), z binary(8))",
+		} {
+			if err := model.DoSQL(query); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, x := range []string{"a1234567", "b12"} {
+			model.SetArgs(map[string]interface{}{"x": x, "y": "y"})
+			if err := model.Insert(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		model.SetArgs(map[string]interface{}{})
+		if err := model.Topics(); err != nil {
+			t.Fatal(err)
+		}
+		lists := model.GetLists()
+		if len(lists) != 2 || lists[1]["id"] != model.LastID {
+			t.Errorf("%d: %#v %d", i, lists, model.LastID)
+		}
+		// ids are the insert time
+		for _, item := range lists {
+			delete(item, "id")
+		}
+		results = append(results, lists)
+	}
+
+	if len(results[1]) != 2 || results[1][0]["x"] != "a1234567" || results[1][1]["x"] != "b12" {
+		t.Errorf("%#v", results[1])
+	}
+	if !reflect.DeepEqual(results[0], results[1]) {
+		t.Errorf("%#v\n%#v", results[0], results[1])
+	}
+}
@@ -0,0 +1,86 @@
+package taodbi
+
+import (
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Retry is the policy to retry transient failures of reads, and of
+// writes whose key is explicit.
+//
+type Retry struct {
+	// MaxAttempts: the number of attempts including the first, default 3
+	MaxAttempts int
+	// Backoff: the wait before the first retry, doubled afterwards, default 100ms
+	Backoff time.Duration
+	// MaxBackoff: optional, the limit of the wait
+	MaxBackoff time.Duration
+	// Jitter: the fraction of the wait to be randomized, from 0 to 1
+	Jitter float64
+	// Retryable: optional, classifies errors, default IsRetryable
+	Retryable func(error) bool
+}
+
+// NewRetry creates a Retry of 'attempts' starting with 'backoff',
+// with half jitter.
+func NewRetry(attempts int, backoff time.Duration) *Retry {
+	return &Retry{MaxAttempts: attempts, Backoff: backoff, Jitter: 0.5}
+}
+
+// IsRetryable reports if an error is transient: connection failures,
+// and a table not existing yet while being created, by the codes of
+// 2.x and 3.x.
+func IsRetryable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	switch ErrorCode(err) {
+	case CodeNetworkUnavailable, CodeTableNotExist, CodeStorageTableNotExist, CodeParserNoTable, CodeParserNoTable3:
+		return true
+	default:
+	}
+	return false
+}
+
+// wait returns the backoff before retry 'n', starting at 1
+func (self *Retry) wait(n int) time.Duration {
+	d := self.Backoff
+	if d <= 0 {
+		d = 100 * time.Millisecond
+	}
+	for i := 1; i < n; i++ {
+		d *= 2
+		if self.MaxBackoff > 0 && d >= self.MaxBackoff {
+			d = self.MaxBackoff
+			break
+		}
+	}
+	if self.Jitter > 0 {
+		j := time.Duration(float64(d) * self.Jitter)
+		d = d - j + time.Duration(rand.Int63n(int64(j)+1))
+	}
+	return d
+}
+
+// attempt runs 'run' observed by the hooks, and retries it if 'idempotent'
+func (self *DBI) attempt(idempotent bool, query string, args []interface{}, run func() (int64, error)) error {
+	err := self.observe(query, args, run)
+	if self.Retry == nil || !idempotent {
+		return err
+	}
+	attempts := self.Retry.MaxAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	retryable := self.Retry.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	for n := 1; err != nil && n < attempts && retryable(err); n++ {
+		time.Sleep(self.Retry.wait(n))
+		err = self.observe(query, args, run)
+	}
+	return err
+}
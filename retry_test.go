@@ -0,0 +1,110 @@
+package taodbi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genelet/taodbi/taodbitest"
+)
+
+type countHook struct {
+	n int
+}
+
+func (self *countHook) Before(event *Event) {
+	self.n++
+}
+
+func (self *countHook) After(event *Event) {
+}
+
+func TestRetry(t *testing.T) {
+	fakeOnly(t)
+	c := newconf("config.json")
+	db, err := open(c.DSN(c.Database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer taodbitest.SetFault(nil)
+
+	model, err := NewModel("m22.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.SetDB(db)
+	for _, query := range []string{
+		`drop table if exists atesting`,
+		`create table atesting (id timestamp, x binary(8), y binary(8), z binary(8))`,
+	} {
+		if err := model.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hook := new(countHook)
+	model.SetHooks(hook)
+	model.Retry = NewRetry(3, time.Millisecond)
+
+	lists := make([]map[string]interface{}, 0)
+	taodbitest.SetFault(taodbitest.FailTimes(2, "FROM atesting", taodbitest.ErrNetwork))
+	if err := model.SelectSQL(&lists, `SELECT x FROM atesting`); err != nil || hook.n != 3 {
+		t.Errorf("%d %v", hook.n, err)
+	}
+
+	hook.n = 0
+	taodbitest.SetFault(taodbitest.FailTimes(3, "FROM atesting", taodbitest.ErrNetwork))
+	err = model.SelectSQL(&lists, `SELECT x FROM atesting`)
+	if ErrorCode(err) != CodeNetworkUnavailable || hook.n != 3 {
+		t.Errorf("%d %v", hook.n, err)
+	}
+
+	hook.n = 0
+	taodbitest.SetFault(taodbitest.FailTimes(1, "INSERT", taodbitest.ErrNetwork))
+	if err := model.insertHash(map[string]interface{}{"x": "a"}); err == nil || hook.n != 1 {
+		t.Errorf("insert of implicit key retried: %d %v", hook.n, err)
+	}
+
+	hook.n = 0
+	taodbitest.SetFault(taodbitest.FailTimes(1, "INSERT", errors.New("Table does not exist")))
+	// the insert is retried once, then LAST(id) is selected
+	if err := model.insertHash(map[string]interface{}{"id": 1600000000000000, "x": "a"}); err != nil || hook.n != 3 {
+		t.Errorf("%d %v", hook.n, err)
+	}
+
+	for _, code := range []string{"0x0362", "0x0604", "0x2603", "0x2662"} {
+		if !IsRetryable(errors.New("[" + code + "] Table does not exist")) {
+			t.Errorf("%s not retryable", code)
+		}
+	}
+	if IsRetryable(nil) || IsRetryable(errors.New("[0x0388] Database not exist")) {
+		t.Errorf("not retryable")
+	}
+
+	hook.n = 0
+	taodbitest.SetFault(nil)
+	if err := model.SelectSQL(&lists, `SELECT q FROM atesting`); err == nil || hook.n != 1 {
+		t.Errorf("syntax error retried: %d %v", hook.n, err)
+	}
+
+	lists = make([]map[string]interface{}, 0)
+	taodbitest.SetFault(taodbitest.FailTimes(1, "FROM atesting", taodbitest.ErrNetwork))
+	if err := model.SelectSQL(&lists, `SELECT x FROM atesting`); err != nil || len(lists) != 1 {
+		t.Errorf("%v %v", lists, err)
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	r := &Retry{Backoff: 10 * time.Millisecond, MaxBackoff: 30 * time.Millisecond}
+	for n, d := range []time.Duration{10, 20, 30, 30} {
+		if w := r.wait(n + 1); w != d*time.Millisecond {
+			t.Errorf("%d: %s", n+1, w)
+		}
+	}
+	r.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if w := r.wait(2); w < 10*time.Millisecond || w > 20*time.Millisecond {
+			t.Errorf("%s", w)
+		}
+	}
+}
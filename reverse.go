@@ -0,0 +1,228 @@
+package taodbi
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Column describes a column reported by DESCRIBE
+type Column struct {
+	Field  string `json:"field"`
+	Type   string `json:"type"`
+	Length int    `json:"length"`
+	// Tag: if the column is a tag of super table
+	Tag bool `json:"tag,omitempty"`
+}
+
+// Definition is a model definition in the same JSON format as
+// those used in NewModel, NewSmodel and NewRmodel.
+//
+type Definition struct {
+	Table
+	Tags         []string `json:"tags,omitempty"`
+	ProfileTable *Table   `json:"profile_table,omitempty"`
+	StatusTable  *Table   `json:"status_table,omitempty"`
+}
+
+// Describe returns the columns of table, including tags of super table.
+//
+func (self *DBI) Describe(table string) ([]*Column, error) {
+	lists := make([]map[string]interface{}, 0)
+	if err := self.SelectSQLLabel(&lists, []string{"field", "type", "length", "note"}, "DESCRIBE "+table); err != nil {
+		return nil, err
+	}
+	columns := make([]*Column, 0)
+	for _, item := range lists {
+		field, ok1 := item["field"].(string)
+		typ, ok2 := item["type"].(string)
+		if !ok1 || !ok2 {
+			return nil, errors.New("unexpected output of DESCRIBE " + table)
+		}
+		column := &Column{Field: field, Type: strings.ToUpper(typ)}
+		switch v := item["length"].(type) {
+		case int:
+			column.Length = v
+		case int16:
+			column.Length = int(v)
+		case int32:
+			column.Length = int(v)
+		case int64:
+			column.Length = int(v)
+		default:
+		}
+		if note, ok := item["note"].(string); ok && strings.ToUpper(note) == "TAG" {
+			column.Tag = true
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// Definitions reads all tables and super tables in the current database
+// and returns their model definitions keyed by model names. Child tables of
+// super tables are skipped. Tables named PREFIXprofile and PREFIXstatus, with or
+// without underscore before the suffix, are combined with the main table, whose
+// name starts with PREFIX and whose timestamp is the foreign key, into Rmodel.
+//
+func (self *DBI) Definitions() (map[string]*Definition, error) {
+	lists := make([]map[string]interface{}, 0)
+	if err := self.SelectSQL(&lists, "SHOW STABLES"); err != nil {
+		return nil, err
+	}
+	label := self.dialect().StableName()
+	stables := make(map[string][]*Column)
+	for _, item := range lists {
+		name, ok := item[label].(string)
+		if !ok {
+			return nil, errors.New("no " + label + " in SHOW STABLES")
+		}
+		columns, err := self.Describe(name)
+		if err != nil {
+			return nil, err
+		}
+		stables[name] = columns
+	}
+
+	lists = make([]map[string]interface{}, 0)
+	if err := self.SelectSQL(&lists, "SHOW TABLES"); err != nil {
+		return nil, err
+	}
+	tables := make(map[string][]*Column)
+	for _, item := range lists {
+		if stable, ok := item["stable_name"].(string); ok && stable != "" {
+			continue
+		}
+		name, ok := item["table_name"].(string)
+		if !ok {
+			return nil, errors.New("no table_name in SHOW TABLES")
+		}
+		columns, err := self.Describe(name)
+		if err != nil {
+			return nil, err
+		}
+		tables[name] = columns
+	}
+
+	return newDefinitions(tables, stables), nil
+}
+
+// newTableDefinition uses the timestamp column as the current key,
+// and the rest of columns for insert_pars.
+func newTableDefinition(name string, columns []*Column) *Table {
+	table := &Table{CurrentTable: name}
+	all := make([]interface{}, 0)
+	for _, column := range columns {
+		if table.CurrentKey == "" && column.Type == "TIMESTAMP" && !column.Tag {
+			table.CurrentKey = column.Field
+		} else {
+			table.InsertPars = append(table.InsertPars, column.Field)
+		}
+		all = append(all, column.Field)
+	}
+	table.EditPars = all
+	table.TopicsPars = all
+	return table
+}
+
+// relatedTables splits name into prefix and suffix,
+// in case of suffix "profile", "_profile", "status" or "_status".
+func relatedTables(name string) (string, string) {
+	for _, suffix := range []string{"profile", "status"} {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			prefix := strings.TrimSuffix(strings.TrimSuffix(name, suffix), "_")
+			if prefix != "" {
+				return prefix, suffix
+			}
+		}
+	}
+	return "", ""
+}
+
+func newDefinitions(tables, stables map[string][]*Column) map[string]*Definition {
+	definitions := make(map[string]*Definition)
+	for name, columns := range stables {
+		table := newTableDefinition(name, columns)
+		def := &Definition{Table: *table}
+		for _, column := range columns {
+			if column.Tag {
+				def.Tags = append(def.Tags, column.Field)
+			}
+		}
+		definitions[name] = def
+	}
+
+	names := make([]string, 0)
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// find pairs of profile and status tables
+	profiles := make(map[string]string)
+	statuses := make(map[string]string)
+	for _, name := range names {
+		switch prefix, suffix := relatedTables(name); suffix {
+		case "profile":
+			profiles[prefix] = name
+		case "status":
+			statuses[prefix] = name
+		default:
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, prefix := range sortedKeys(profiles) {
+		profileName := profiles[prefix]
+		statusName, ok := statuses[prefix]
+		if !ok {
+			continue
+		}
+		status := newTableDefinition(statusName, tables[statusName])
+		if len(status.InsertPars) != 2 {
+			continue
+		}
+		fk := status.InsertPars[0]
+		for _, name := range names {
+			if used[name] || name == profileName || name == statusName || !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			main := newTableDefinition(name, tables[name])
+			if main.CurrentKey != fk {
+				continue
+			}
+			profile := newTableDefinition(profileName, tables[profileName])
+			profile.ForeignKey = fk
+			status.ForeignKey = fk
+			status.EditPars = nil
+			status.TopicsPars = nil
+			main.EditPars = nil
+			main.TopicsPars = nil
+			if len(main.InsertPars) == 1 && main.InsertPars[0] == "useless" {
+				// the placeholder column of insertRest, no unique key
+				main.InsertPars = nil
+			}
+			definitions[name] = &Definition{Table: *main, ProfileTable: profile, StatusTable: status}
+			used[name] = true
+			used[profileName] = true
+			used[statusName] = true
+			break
+		}
+	}
+
+	for _, name := range names {
+		if !used[name] {
+			definitions[name] = &Definition{Table: *newTableDefinition(name, tables[name])}
+		}
+	}
+	return definitions
+}
+
+func sortedKeys(hash map[string]string) []string {
+	keys := make([]string, 0)
+	for k := range hash {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
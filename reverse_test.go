@@ -0,0 +1,111 @@
+package taodbi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/genelet/taodbi/taodbitest"
+)
+
+func columnsOf(pairs ...string) []*Column {
+	columns := make([]*Column, 0)
+	for i := 0; i < len(pairs); i += 2 {
+		column := &Column{Field: pairs[i], Type: pairs[i+1]}
+		if column.Type == "TAG" {
+			column.Type = "BINARY"
+			column.Tag = true
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+func TestReverseDefinitions(t *testing.T) {
+	tables := map[string][]*Column{
+		"atesting":   columnsOf("id", "TIMESTAMP", "x", "BINARY", "y", "BINARY"),
+		"at_profile": columnsOf("ts", "TIMESTAMP", "id", "BIGINT", "x", "BINARY", "y", "BINARY", "z", "BINARY"),
+		"at_status":  columnsOf("ts", "TIMESTAMP", "id", "BIGINT", "status", "BOOL"),
+		"testing":    columnsOf("tid", "TIMESTAMP", "useless", "BOOL"),
+		"t_profile":  columnsOf("ts", "TIMESTAMP", "tid", "BIGINT", "id", "BIGINT", "child", "BINARY"),
+		"t_status":   columnsOf("ts", "TIMESTAMP", "tid", "BIGINT", "status", "BOOL"),
+		"demot":      columnsOf("ts", "TIMESTAMP", "id", "INT", "name", "BINARY"),
+	}
+	stables := map[string][]*Column{
+		"stesting": columnsOf("id", "TIMESTAMP", "x", "BINARY", "pubid", "TAG", "location", "TAG"),
+	}
+
+	defs := newDefinitions(tables, stables)
+	if len(defs) != 4 {
+		t.Fatalf("%#v", defs)
+	}
+
+	a := defs["atesting"]
+	if a.ProfileTable == nil || a.ProfileTable.CurrentTable != "at_profile" || a.ProfileTable.ForeignKey != "id" ||
+		a.StatusTable == nil || a.StatusTable.CurrentTable != "at_status" ||
+		len(a.InsertPars) != 2 || a.CurrentKey != "id" {
+		t.Errorf("%#v", a)
+	}
+	b := defs["testing"]
+	if b.ProfileTable == nil || b.ProfileTable.ForeignKey != "tid" || b.InsertPars != nil {
+		t.Errorf("%#v", b)
+	}
+	d := defs["demot"]
+	if d.CurrentKey != "ts" || len(d.InsertPars) != 2 || len(d.TopicsPars) != 3 || d.ProfileTable != nil {
+		t.Errorf("%#v", d)
+	}
+	s := defs["stesting"]
+	if len(s.Tags) != 2 || s.Tags[0] != "pubid" || len(s.InsertPars) != 3 {
+		t.Errorf("%#v", s)
+	}
+
+	content, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := new(Smodel)
+	if err := json.Unmarshal(content, parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.CurrentTable != "stesting" || len(parsed.Tags) != 2 {
+		t.Errorf("%s", content)
+	}
+}
+
+func TestDefinitions3(t *testing.T) {
+	fakeOnly(t)
+	defer func(v string) { taodbitest.Version = v }(taodbitest.Version)
+	taodbitest.Version = "3.0.0.0"
+
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	dbi := &DBI{DB: db, Dialect: Dialect3}
+	for _, query := range []string{
+		`DROP TABLE IF EXISTS stesting`,
+		`CREATE STABLE stesting (id timestamp, x varchar(8)) TAGS (pubid int, location varchar(8))`,
+		`INSERT INTO stesting_1 USING stesting TAGS (1, 'a') VALUES (1600000000000000, 'x')`,
+	} {
+		if err := dbi.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defs, err := dbi.Definitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := defs["stesting"]
+	if !ok || len(s.Tags) != 2 || s.Tags[1] != "location" {
+		t.Errorf("%#v", s)
+	}
+	if _, ok := defs["stesting_1"]; ok {
+		t.Errorf("child table defined")
+	}
+
+	// the column of 2.x is not in the output of 3.x
+	dbi.Dialect = Dialect2
+	if _, err := dbi.Definitions(); err == nil {
+		t.Errorf("error wanted")
+	}
+}
@@ -3,9 +3,9 @@ package taodbi
 import (
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
+	"strconv"
 	"time"
 )
 
@@ -47,10 +47,51 @@ func (self *Rmodel) SetDB(db *sql.DB) {
 	self.StatusTable.DB = db
 }
 
+// SetRecorder sets the statement recorder
+func (self *Rmodel) SetRecorder(r *Recorder) {
+	self.Model.SetRecorder(r)
+	self.ProfileTable.Recorder = r
+	self.StatusTable.Recorder = r
+}
+
+// SetHooks sets the statement hooks
+func (self *Rmodel) SetHooks(hooks ...Hook) {
+	self.Model.SetHooks(hooks...)
+	self.ProfileTable.Hooks = hooks
+	self.StatusTable.Hooks = hooks
+}
+
+// GetAction returns action's function. The action name is passed
+// to hooks while the function runs.
+func (self *Rmodel) GetAction(action string) func(...map[string]interface{}) error {
+	act, ok := self.Actions[action]
+	if !ok {
+		return nil
+	}
+	return func(extra ...map[string]interface{}) error {
+		defer self.setNames(self.ModelName, self.ActionName)
+		self.setNames(self.ModelName, action)
+		return act(extra...)
+	}
+}
+
+func (self *Rmodel) setNames(model, action string) {
+	self.Model.setNames(model, action)
+	self.ProfileTable.setNames(model, action)
+	self.StatusTable.setNames(model, action)
+}
+
+func (self *Rmodel) setDatabase(database string) {
+	self.Model.setDatabase(database)
+	self.ProfileTable.setDatabase(database)
+	self.StatusTable.setDatabase(database)
+}
+
 func (self *Rmodel) getStatus(id interface{}) (bool, error) {
 	s := self.StatusTable
 	status := false
-	err := self.DB.QueryRow("SELECT LAST("+s.statusColumn()+") FROM "+s.CurrentTable+" WHERE "+s.ForeignKey+"=?", id).Scan(&status)
+	query := "SELECT LAST(" + s.statusColumn() + ") FROM " + s.CurrentTable + " WHERE " + s.ForeignKey + "=?"
+	err := self.scanRow(query, []interface{}{&status}, id)
 	return status, err
 }
 
@@ -66,7 +107,7 @@ func (self *Rmodel) insertRest(args map[string]interface{}) error {
 		for _, k := range self.InsertPars {
 			v, ok := args[k]
 			if !ok {
-				return errors.New("missing unique key: " + k)
+				return newError(ErrMissingKey, self.ModelName, "missing unique key: " + k)
 			}
 			extra[k] = v
 		}
@@ -80,7 +121,7 @@ func (self *Rmodel) insertRest(args map[string]interface{}) error {
 			if status, err := self.getStatus(id); err != nil {
 				return err
 			} else if status {
-				return errors.New("current unique key already taken")
+				return newError(ErrDuplicate, self.ModelName, "current unique key already taken")
 			}
 			self.LastID = id.(int64)
 		} else if err := self.insertHash(extra); err != nil {
@@ -108,7 +149,7 @@ func (self *Rmodel) insertRest(args map[string]interface{}) error {
 		return err
 	}
 
-	return self.DoSQL("INSERT INTO "+self.StatusTable.CurrentTable+" VALUES (now, ?, true)", id)
+	return self.DoSQL("INSERT INTO "+self.StatusTable.CurrentTable+" VALUES ("+self.dialect().Now()+", ?, true)", id)
 }
 
 // updateRest updates multiple rows using data expressed in type Values.
@@ -151,7 +192,20 @@ func (self *Rmodel) deleteRest(ids []interface{}, extra ...map[string]interface{
 	}
 	s := self.StatusTable
 	for _, item := range lists {
-		if err := self.DoSQL("INSERT INTO "+s.CurrentTable+" VALUES (now, ?, false)", item[p.ForeignKey]); err != nil {
+		id := item[p.ForeignKey]
+		if self.dialect().Delete(self.CurrentTable, self.CurrentKey) != "" {
+			// real delete of the row, its profiles and statuses
+			for _, m := range []*Model{p, s} {
+				if err := m.purge(m.ForeignKey, id); err != nil {
+					return err
+				}
+			}
+			if err := self.Model.purge(self.CurrentKey, id); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := self.DoSQL("INSERT INTO "+s.CurrentTable+" VALUES ("+self.dialect().Now()+", ?, false)", id); err != nil {
 			return err
 		}
 	}
@@ -166,7 +220,7 @@ func (self *Rmodel) insupdRest(args map[string]interface{}) error {
 	for _, k := range self.InsertPars {
 		v, ok := args[k]
 		if !ok {
-			return errors.New("missing unique key: " + k)
+			return newError(ErrMissingKey, self.ModelName, "missing unique key: " + k)
 		}
 		extra[k] = v
 	}
@@ -177,13 +231,13 @@ func (self *Rmodel) insupdRest(args map[string]interface{}) error {
 
 	p := self.ProfileTable
 	if len(lists) > 1 {
-		return errors.New("multiple returns for unique key")
+		return newError(ErrDuplicate, self.ModelName, "multiple returns for unique key")
 	} else if len(lists) == 1 {
 		self.Updated = true
 		id := lists[0][self.CurrentKey]
 		status, err := self.getStatus(id)
 		if err == nil && !status {
-			err = self.DoSQL("INSERT INTO "+self.StatusTable.CurrentTable+" VALUES (now, ?, true)", id)
+			err = self.DoSQL("INSERT INTO "+self.StatusTable.CurrentTable+" VALUES ("+self.dialect().Now()+", ?, true)", id)
 		}
 		if err != nil {
 			return err
@@ -238,7 +292,7 @@ func (self *Rmodel) getMainExtra(passid interface{}, rowcount int, reverse bool,
 //
 func (self *Rmodel) simpleRest(rowcount int, reverse bool, passid interface{}, lists *[]map[string]interface{}, selectPars interface{}, extra ...map[string]interface{}) error {
 	if rowcount < 1 {
-		return errors.New("no row counts")
+		return newError(ErrValidation, self.ModelName, "no row counts")
 	}
 	countTable := 0
 	if err := self.totalHash(&countTable, extra...); err != nil {
@@ -303,8 +357,6 @@ func (self *Rmodel) simpleRest(rowcount int, reverse bool, passid interface{}, l
 			return nil
 		}
 	}
-
-	return nil
 }
 
 // topicsRest selects rows by pages
@@ -318,7 +370,7 @@ func (self *Rmodel) simpleRest(rowcount int, reverse bool, passid interface{}, l
 //
 func (self *Rmodel) topicsRest(rowcount int, reverse bool, passid interface{}, lists *[]map[string]interface{}, selectPars interface{}, extra ...map[string]interface{}) error {
 	if rowcount < 1 {
-		return errors.New("no row counts")
+		return newError(ErrValidation, self.ModelName, "no row counts")
 	}
 	countTable := 0
 	if err := self.totalHash(&countTable); err != nil {
@@ -368,64 +420,90 @@ func (self *Rmodel) topicsRest(rowcount int, reverse bool, passid interface{}, l
 			return nil
 		}
 	}
-
-	return nil
 }
 
-// totalRest returns the start, end and total number of rows available
+// totalRest returns the first active id, the last id, and the numbers of
+// active ids and of all ids in the main table.
 // This function is used for pagination.
-// extra: optional, extra constraints on WHERE statement.
+// It counts by one aggregate query on each of the main and status tables.
 //
 func (self *Rmodel) totalRest(start, end, v, n *int64) error {
-	query := "SELECT " + self.CurrentKey + " FROM " + self.CurrentTable
-	sth, err := self.DB.Prepare(query)
-	if err != nil {
+	*start, *end, *v, *n = 0, 0, 0, 0
+	lists := make([]map[string]interface{}, 0)
+	query := "SELECT COUNT(*), LAST(" + self.CurrentKey + ") FROM " + self.CurrentTable
+	if err := self.SelectSQLLabel(&lists, []string{"n", "id"}, query); err != nil {
 		return err
 	}
-	defer sth.Close()
-
-	s := self.StatusTable
-	sta, err := self.DB.Prepare("SELECT LAST(" + s.statusColumn() + ") FROM " + s.CurrentTable + " WHERE " + s.ForeignKey + "=?")
-	if err != nil {
-		return err
+	if len(lists) == 0 || lists[0]["n"] == nil {
+		return nil
+	}
+	var ok bool
+	if *n, ok = idOf(lists[0]["n"]); !ok {
+		return newError(ErrValidation, self.ModelName, fmt.Sprintf("count of unknown type %T", lists[0]["n"]))
+	}
+	if *end, ok = idOf(lists[0]["id"]); !ok {
+		return newError(ErrValidation, self.ModelName, fmt.Sprintf("id of unknown type %T", lists[0]["id"]))
 	}
-	defer sth.Close()
 
-	rows, err := sth.Query()
-	if err != nil {
+	s := self.StatusTable
+	lists = make([]map[string]interface{}, 0)
+	query = self.dialect().SelectGroup("LAST("+s.statusColumn()+")", s.CurrentTable, []string{s.ForeignKey}) + " GROUP BY " + s.ForeignKey
+	if err := self.SelectSQLLabel(&lists, []string{"status", "id"}, query); err != nil {
 		return err
 	}
-	defer rows.Close()
-
-	status := false
-	id := int64(0)
-	i := int64(0)
-	raw := int64(0)
-	for rows.Next() {
-		raw++
-		if err = rows.Scan(&id); err != nil {
-			return err
+	for _, item := range lists {
+		id, ok := idOf(item["id"])
+		if !ok {
+			return newError(ErrValidation, self.ModelName, fmt.Sprintf("id of unknown type %T", item["id"]))
 		}
-		if err := sta.QueryRow(id).Scan(&status); err != nil {
-			return err
+		if !isActive(item["status"]) {
+			continue
 		}
-		if status {
-			if i == 0 {
-				*start = id
-			}
-			i++
+		if *v == 0 || id < *start {
+			*start = id
 		}
+		*v++
 	}
-	if err := rows.Err(); err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	*end = id
-	*v = i
-	*n = raw
 	return nil
 }
 
+// idOf converts 'v', an integer of any driver type, to int64
+func idOf(v interface{}) (int64, bool) {
+	if i, ok := asInt64(v); ok {
+		return i, true
+	}
+	switch u := v.(type) {
+	case uint:
+		return int64(u), true
+	case uint64:
+		return int64(u), true
+	case float32:
+		return int64(u), float32(int64(u)) == u
+	case float64:
+		return int64(u), float64(int64(u)) == u
+	case json.Number:
+		i, err := u.Int64()
+		return i, err == nil
+	case string:
+		i, err := strconv.ParseInt(u, 10, 64)
+		return i, err == nil
+	case []byte:
+		i, err := strconv.ParseInt(string(u), 10, 64)
+		return i, err == nil
+	default:
+	}
+	return 0, false
+}
+
+// isActive tells if status 'v', a bool or a number, is true
+func isActive(v interface{}) bool {
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	i, ok := idOf(v)
+	return ok && i != 0
+}
+
 func (self *Rmodel) conditionMainPars(hashPars interface{}) bool {
 	_, asks, _ := selectType(hashPars)
 	_, topics, _ := selectType(self.topicsHashPars)
@@ -488,7 +566,7 @@ func (self *Rmodel) Topics(extra ...map[string]interface{}) error {
 func (self *Rmodel) Edit(extra ...map[string]interface{}) error {
 	val := self.editIdVal(extra...)
 	if !hasValue(val) {
-		return errors.New("pk value not provided")
+		return newError(ErrMissingKey, self.ModelName, "pk value not provided")
 	}
 
 	p := self.ProfileTable
@@ -514,7 +592,7 @@ func (self *Rmodel) Insert(extra ...map[string]interface{}) error {
 		}
 	}
 	if !hasValue(fieldValues) {
-		return errors.New("no data to insert")
+		return newError(ErrValidation, self.ModelName, "no data to insert")
 	}
 
 	self.aLISTS = make([]map[string]interface{}, 0)
@@ -542,7 +620,7 @@ func (self *Rmodel) Insupd(extra ...map[string]interface{}) error {
 		}
 	}
 	if !hasValue(fieldValues) {
-		return errors.New("pk value not found")
+		return newError(ErrMissingKey, self.ModelName, "pk value not found")
 	}
 
 	if err := self.insupdRest(fieldValues); err != nil {
@@ -561,13 +639,13 @@ func (self *Rmodel) Insupd(extra ...map[string]interface{}) error {
 func (self *Rmodel) Update(extra ...map[string]interface{}) error {
 	val := self.editIdVal(extra...)
 	if !hasValue(val) {
-		return errors.New("pk value not found")
+		return newError(ErrMissingKey, self.ModelName, "pk value not found")
 	}
 
 	p := self.ProfileTable
 	fieldValues := self.getFv(p.InsertPars)
 	if !hasValue(fieldValues) {
-		return errors.New("no data to update")
+		return newError(ErrValidation, self.ModelName, "no data to update")
 	} else if len(fieldValues) == 1 && fieldValues[self.CurrentKey] != nil {
 		self.aLISTS = append(self.aLISTS, fieldValues)
 		return nil
@@ -590,7 +668,7 @@ func (self *Rmodel) Update(extra ...map[string]interface{}) error {
 func (self *Rmodel) Delete(extra ...map[string]interface{}) error {
 	val := self.editIdVal(extra...)
 	if !hasValue(val) {
-		return errors.New("pk value not provided")
+		return newError(ErrMissingKey, self.ModelName, "pk value not provided")
 	}
 	if err := self.deleteRest(val, extra...); err != nil {
 		return err
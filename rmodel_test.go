@@ -3,7 +3,7 @@ package taodbi
 import (
 	"testing"
 	"database/sql"
-	_ "github.com/taosdata/driver-go/taosSql"
+	"encoding/json"
 )
 
 func initRest(db *sql.DB) {
@@ -19,7 +19,7 @@ func initRest(db *sql.DB) {
 
 func TestRestfulNew(t *testing.T) {
 	c := newconf("config.json")
-	db, err := sql.Open(c.DbType, c.Dsn2)
+	db, err := sql.Open(c.DbType, c.DSN(c.Database))
 	if err != nil { t.Fatal(err) }
 	defer db.Close()
 
@@ -122,7 +122,7 @@ func TestRestfulNew(t *testing.T) {
 
 func TestRmodel(t *testing.T) {
 	c := newconf("config.json")
-    db, err := sql.Open(c.DbType, c.Dsn2)
+    db, err := sql.Open(c.DbType, c.DSN(c.Database))
     if err != nil { t.Fatal(err) }
     defer db.Close()
 
@@ -224,3 +224,19 @@ func TestRmodel(t *testing.T) {
         t.Errorf("%v", lists)
     }
 }
+
+func TestIdOf(t *testing.T) {
+	for _, v := range []interface{}{int64(7), int32(7), uint64(7), float64(7), json.Number("7"), "7", []byte("7")} {
+		if id, ok := idOf(v); !ok || id != 7 {
+			t.Errorf("%T: %d %v", v, id, ok)
+		}
+	}
+	for _, v := range []interface{}{nil, 7.5, json.Number("x"), true} {
+		if _, ok := idOf(v); ok {
+			t.Errorf("%T %v converted", v, v)
+		}
+	}
+	if !isActive(true) || !isActive(float64(1)) || isActive(int64(0)) || isActive(nil) {
+		t.Errorf("status not converted")
+	}
+}
@@ -2,27 +2,67 @@ package taodbi
 
 import (
 	"database/sql"
-	"errors"
+	"time"
 )
 
 // Schema describes all models and actions in a database schema
 //
 type Schema struct {
-	db     *sql.DB
-	Models map[string]Navigate
+	db       *sql.DB
+	database string
+	recorder *Recorder
+	hooks    []Hook
+	metrics  *Metrics
+	Models   map[string]Navigate
 }
 
 func NewSchema(s map[string]Navigate) *Schema {
-	return &Schema{nil, s}
+	return &Schema{Models: s}
 }
 
 func (self *Schema) SetDB(db *sql.DB) {
 	self.db = db
 }
 
+// SetDatabase binds all models to 'database', by qualifying their tables
+// as database.table, so schemas of several databases can share one handle.
+func (self *Schema) SetDatabase(database string) error {
+	if database != "" {
+		if err := validName(database); err != nil {
+			return err
+		}
+	}
+	self.database = database
+	return nil
+}
+
+// SetRecorder logs statements of all models in Run into 'r'.
+// Use a dry-run recorder to preview a Run without touching the database.
+func (self *Schema) SetRecorder(r *Recorder) {
+	self.recorder = r
+}
+
+// SetHooks passes 'hooks' to all models in Run, with the model
+// and action names in their events.
+func (self *Schema) SetHooks(hooks ...Hook) {
+	self.hooks = hooks
+}
+
+// SetMetrics collects metrics of Run and of the statements in it.
+func (self *Schema) SetMetrics(m *Metrics) {
+	self.metrics = m
+}
+
 func (self *Schema) GetNavigate(model string, args map[string]interface{}) Navigate {
 	if model := self.Models[model]; model != nil {
 		model.SetDB(self.db)
+		model.setDatabase(self.database)
+		model.SetRecorder(self.recorder)
+		hooks := self.hooks
+		if self.metrics != nil {
+			hooks = append(hooks[:len(hooks):len(hooks)], self.metrics)
+		}
+		model.SetHooks(hooks...)
 		model.SetArgs(args)
 		return model
 	}
@@ -36,16 +76,29 @@ func (self *Schema) GetNavigate(model string, args map[string]interface{}) Navig
 // The output are data and optional error code
 //
 func (self *Schema) Run(model, action string, args map[string]interface{}, extra ...map[string]interface{}) ([]map[string]interface{}, error) {
+	if self.metrics == nil {
+		return self.run(model, action, args, extra...)
+	}
+	start := time.Now()
+	lists, err := self.run(model, action, args, extra...)
+	self.metrics.observeRun(model, action, time.Since(start), err)
+	return lists, err
+}
+
+func (self *Schema) run(model, action string, args map[string]interface{}, extra ...map[string]interface{}) ([]map[string]interface{}, error) {
 	modelObj := self.GetNavigate(model, args)
 	if modelObj == nil {
-		return nil, errors.New("model not found in schema models")
+		return nil, ErrModelNotFound
 	}
 	act := modelObj.GetAction(action)
 	if act == nil {
-		return nil, errors.New("action not found in schema model")
+		return nil, ErrActionNotFound
 	}
 
-	if err := act(extra...); err != nil {
+	modelObj.setNames(model, action)
+	err := act(extra...)
+	modelObj.setNames("", "")
+	if err != nil {
 		return nil, err
 	}
 	lists := modelObj.GetLists()
@@ -54,6 +107,8 @@ func (self *Schema) Run(model, action string, args map[string]interface{}, extra
 
 	modelObj.SetArgs(map[string]interface{}{})
 	modelObj.SetDB(nil)
+	modelObj.SetRecorder(nil)
+	modelObj.SetHooks()
 
 	if !hasValue(lists) || nextpages == nil {
 		return lists, nil
@@ -85,7 +140,7 @@ func (self *Schema) Run(model, action string, args map[string]interface{}, extra
 			if err != nil {
 				return nil, err
 			}
-			item[page.Model+"_"+page.Action] = newLists
+			page.embed(item, newLists)
 		}
 	}
 
@@ -2,9 +2,10 @@ package taodbi
 
 import (
 	"fmt"
-	"errors"
 	"encoding/json"
+	"hash/fnv"
 	"strings"
+	"unicode"
 	"io/ioutil"
 )
 
@@ -31,7 +32,7 @@ func NewSmodel(filename string) (*Smodel, error) {
 }
 
 func (self *Smodel) insertExtra(args map[string]interface{}) string {
-	table := ""
+	values := make([]interface{}, 0)
 	using := ""
 	for _, t := range self.Tags {
 		v, ok := args[t]
@@ -39,24 +40,85 @@ func (self *Smodel) insertExtra(args map[string]interface{}) string {
 			return ""
 		}
 		switch u := v.(type) {
+		case nil:
+			using += "NULL,"
 		case int:
-			table += fmt.Sprintf("_%d", u)
 			using += Quote(fmt.Sprintf("%d", u)).(string) + ","
 		default:
-			table += "_" + v.(string)
-			using += Quote(v).(string) + ","
+			using += fmt.Sprintf("%v,", Quote(v))
 		}
+		values = append(values, v)
 		delete(args, t)
 	}
 
-    return table + " USING " + self.CurrentTable + " TAGS (" + using[:len(using)-1] + ") "
+    return childSuffix(self.CurrentTable, values) + " USING " + self.CurrentTable + " TAGS (" + using[:len(using)-1] + ") "
+}
+
+// maximal lengths of names in TDengine
+const (
+	maxTableName  = 192
+	maxColumnName = 64
+)
+
+// childSuffix is the part of a child table name of 'stable' from tag
+// values. If the name is longer than maxTableName, it is cut and the
+// hash of the values appended. NULL is hashed as nullMarker.
+func childSuffix(stable string, values []interface{}) string {
+	suffix := ""
+	raw := make([]string, len(values))
+	for i, v := range values {
+		if v == nil {
+			raw[i] = nullMarker
+		} else {
+			raw[i] = fmt.Sprintf("%v", v)
+		}
+		suffix += "_" + safeName(raw[i], maxTableName)
+	}
+	if len(stable)+len(suffix) <= maxTableName {
+		return suffix
+	}
+	keep := maxTableName - len(stable) - 9
+	if keep < 0 {
+		keep = 0
+	}
+	return suffix[:keep] + "_" + nameHash(strings.Join(raw, "\x00"))
+}
+
+// nullMarker stands for a NULL tag in child table names. It is not valid
+// UTF-8, so no tag string is the same.
+const nullMarker = "\xff"
+
+// safeName replaces characters not allowed in names by '_'. If any is
+// replaced, or the name is longer than 'max', it is cut and the hash of
+// the original appended, so different names stay different.
+func safeName(name string, max int) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '_' || r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return '_'
+	}, name)
+	if safe == name && len(name) <= max {
+		return name
+	}
+	if len(safe) > max-9 {
+		safe = safe[:max-9]
+	}
+	return safe + "_" + nameHash(name)
+}
+
+// nameHash returns the FNV-1a hash of 'name' in 8 hex digits
+func nameHash(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("%08x", h.Sum32())
 }
 
 // LastTopics reports items of a given foreign key in all tables under a super table.
 func (self *Smodel) LastTopics(extra ...map[string]interface{}) error {
     val := self.editFKVal(extra...)
     if !hasValue(val) {
-        return errors.New("fk value not provided")
+        return newError(ErrMissingKey, self.ModelName, "fk value not provided")
     }
 
 	hashPars := self.topicsHashPars
@@ -64,7 +126,7 @@ func (self *Smodel) LastTopics(extra ...map[string]interface{}) error {
         hashPars = generalHashPars(self.TopicsHash, self.TopicsPars, fields.([]string))
     }
 	sql, labels, types := selectType(hashPars)
-	sql = `SELECT LAST(*) FROM ` + self.CurrentTable
+	sql = self.dialect().SelectGroup(`LAST(*)`, self.CurrentTable, self.Tags)
 	where, values := singleCondition(self.ForeignKey, val, extra...)
 	sql += ` WHERE ` + where + " GROUP BY " + strings.Join(self.Tags, ",")
 
@@ -88,7 +150,7 @@ func (self *Smodel)LastEdit(extra ...map[string]interface{}) error {
 
     val := self.editFKVal(extra...)
     if !hasValue(val) {
-        return errors.New("fk value not provided")
+        return newError(ErrMissingKey, self.ModelName, "fk value not provided")
     }
 
     hashPars := self.editHashPars
@@ -106,12 +168,10 @@ func (self *Smodel) ReleaseTopics(extra ...map[string]interface{}) error {
 	rtag := self.Tags[0]
 	ts := 0
 	release := 0
-	err := self.DB.QueryRow(
-`SELECT LAST(` + self.CurrentKey + `)
-FROM ` + self.CurrentTable + `
+	query := self.dialect().SelectGroup(`LAST(` + self.CurrentKey + `)`, self.CurrentTable, []string{rtag}) + `
 GROUP BY ` + rtag + `
-ORDER BY ` + rtag + ` DESC LIMIT 1`).Scan(&ts, &release)
-	if err != nil { return err }
+ORDER BY ` + rtag + ` DESC LIMIT 1`
+	if err := self.scanRow(query, []interface{}{&ts, &release}); err != nil { return err }
 
 	if hasValue(extra) {
 		extra[0][rtag] = release
@@ -132,14 +192,29 @@ func (self *Smodel) CreateTable(extra ...map[string]interface{}) error {
 	table :=  self.CurrentTable
 	using := "USING "+self.CurrentTable+" TAGS ("
 	for i, v := range values {
-		if v==nil { return errors.New("Missing " + self.Tags[i]) }
-		table += fmt.Sprintf("_%v", v)
+		if v==nil { return newError(ErrMissingKey, self.ModelName, "Missing " + self.Tags[i]) }
 		using += fmt.Sprintf("%v,", Quote(v))
 	}
+	table += childSuffix(self.CurrentTable, values)
 	using = using[:len(using)-1] + ")"
 	return self.DoSQL("CREATE TABLE IF NOT EXISTS " + table + " " + using)
 }
 
+// CreateTagIndexes indexes tags of the super table, except the first
+// which is indexed by the server. It does nothing if not supported.
+func (self *Smodel) CreateTagIndexes() error {
+	for i, tag := range self.Tags {
+		query := self.dialect().TagIndex(self.CurrentTable, tag)
+		if i == 0 || query == "" {
+			continue
+		}
+		if err := self.DoSQL(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // DropTable drops a table using tags and current super table
 func (self *Smodel) DropTable(extra ...map[string]interface{}) error {
 	var one map[string]interface{}
@@ -149,8 +224,8 @@ func (self *Smodel) DropTable(extra ...map[string]interface{}) error {
 	values := self.properValues(self.Tags, one)
 	table :=  self.CurrentTable
 	for i, v := range values {
-		if v==nil { return errors.New("Missing " + self.Tags[i]) }
-		table += fmt.Sprintf("_%v", v)
+		if v==nil { return newError(ErrMissingKey, self.ModelName, "Missing " + self.Tags[i]) }
 	}
+	table += childSuffix(self.CurrentTable, values)
 	return self.DoSQL("DROP TABLE IF EXISTS " + table)
 }
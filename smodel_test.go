@@ -3,13 +3,12 @@ package taodbi
 import (
     "testing"
     "database/sql"
-    _ "github.com/taosdata/driver-go/taosSql"
 )
 
 /*
 func TestNextPages(t *testing.T) {
     c := newconf("config.json")
-    db, err := sql.Open(c.DbType, c.Dsn2)
+    db, err := sql.Open(c.DbType, c.DSN(c.Database))
     if err != nil { panic(err) }
     model, err := NewSmodel(getString("m2.json"))
     if err != nil { panic(err) }
@@ -115,7 +114,7 @@ if diff > 30.0 {
 
 func TestNextPagesMore(t *testing.T) {
     c := newconf("config.json")
-    db, err := sql.Open(c.DbType, c.Dsn2)
+    db, err := sql.Open(c.DbType, c.DSN(c.Database))
     if err != nil { panic(err) }
     model, err := NewSmodel(getString("m22.json")) // no relate_item, to OTHER
     if err != nil { panic(err) }
@@ -220,7 +219,7 @@ func TestNextPagesMore(t *testing.T) {
 
 func TestSmodel(t *testing.T) {
     c := newconf("config.json")
-    db, err := sql.Open(c.DbType, c.Dsn2)
+    db, err := sql.Open(c.DbType, c.DSN(c.Database))
     if err != nil { panic(err) }
 
 	smodel, err := NewSmodel("ms.json")
@@ -277,3 +276,43 @@ func TestSmodel(t *testing.T) {
 
 	db.Close()
 }
+
+func TestChildSuffix(t *testing.T) {
+	if got := childSuffix("s", []interface{}{333, "yyz"}); got != "_333_yyz" {
+		t.Errorf("%s", got)
+	}
+	names := make(map[string]string)
+	for _, v := range []string{"a.b", "a-b", "a_b", "a b"} {
+		name := "s" + childSuffix("s", []interface{}{v})
+		if other, ok := names[name]; ok {
+			t.Errorf("%s and %s in %s", v, other, name)
+		}
+		names[name] = v
+		if name != safeName(name, maxTableName) {
+			t.Errorf("%s not safe", name)
+		}
+	}
+
+	long := make([]byte, 300)
+	for i := range long {
+		long[i] = 'x'
+	}
+	a := "s" + childSuffix("s", []interface{}{string(long), 1})
+	b := "s" + childSuffix("s", []interface{}{string(long), 2})
+	if len(a) != maxTableName || len(b) != maxTableName || a == b {
+		t.Errorf("%d %d %v", len(a), len(b), a == b)
+	}
+	if name := safeName(string(long), maxColumnName); len(name) != maxColumnName {
+		t.Errorf("%s", name)
+	}
+
+	null := "s" + childSuffix("s", []interface{}{nil})
+	if str := "s" + childSuffix("s", []interface{}{"<nil>"}); null == str || null != safeName(null, maxTableName) {
+		t.Errorf("%s %s", null, str)
+	}
+	a = "s" + childSuffix("s", []interface{}{string(long), nil})
+	b = "s" + childSuffix("s", []interface{}{string(long), "<nil>"})
+	if len(a) != maxTableName || a == b {
+		t.Errorf("%s %s", a, b)
+	}
+}
@@ -0,0 +1,376 @@
+package taodbi
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spool keeps the rows failed to be inserted in append-only files in Dir,
+// while the database is unreachable, and replays them in order once it
+// is back. It wraps the RowInserter of the direct write path, and its
+// OnError captures the batches failed in BufferedWriter.
+//
+type Spool struct {
+	Dir      string
+	Inserter RowInserter
+	// Keys identify a row: a later row of the same keys in a file
+	// replaces an earlier one in replay. The default is the key of
+	// Model, and the tags of Smodel.
+	Keys []string
+	// Retryable classifies the errors to be spooled, and to be retried
+	// in replay, default the network errors only
+	Retryable func(error) bool
+	// OnDrop is called with the rows not spooled and the error, if the
+	// error is not retryable or the rows can not be written to disk,
+	// and with the rows failed in replay by an error not retryable
+	OnDrop func(rows []map[string]interface{}, err error)
+	// OnReplayError is called with the errors of replay in Start, and
+	// with the lines of the spool skipped as not readable
+	OnReplayError func(error)
+	// BatchSize is the maximal number of rows in a replay statement,
+	// default 1000
+	BatchSize int
+
+	// stamp is the timestamp key set to the time of Write if missing
+	stamp  string
+	file   *os.File
+	seq    int
+	replay sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+	sync.Mutex
+}
+
+// spoolRecord is a line in the spool: a row, with the columns of
+// time.Time which are written in RFC3339
+type spoolRecord struct {
+	Row   map[string]interface{} `json:"row"`
+	Times []string               `json:"times,omitempty"`
+}
+
+// NewSpool creates a Spool of 'inserter' in directory 'dir', creating it
+// if it does not exist. The rows spooled before are kept for replay.
+//
+func NewSpool(dir string, inserter RowInserter) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	self := &Spool{Dir: dir, Inserter: inserter}
+	switch v := inserter.(type) {
+	case *Model:
+		self.Keys = []string{v.CurrentKey}
+		self.stamp = v.CurrentKey
+	case *Smodel:
+		self.Keys = append([]string{v.CurrentKey}, v.Tags...)
+		self.stamp = v.CurrentKey
+	default:
+	}
+	return self, nil
+}
+
+func (self *Spool) retryable(err error) bool {
+	if self.Retryable != nil {
+		return self.Retryable(err)
+	}
+	return isTransient(err)
+}
+
+// isTransient is true for the errors of losing the server. Unlike
+// IsRetryable, a missing table is not, which replay would not fix.
+func isTransient(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || ErrorCode(err) == CodeNetworkUnavailable
+}
+
+func (self *Spool) drop(rows []map[string]interface{}, err error) {
+	if self.OnDrop != nil {
+		self.OnDrop(rows, err)
+	}
+}
+
+func (self *Spool) report(err error) {
+	if self.OnReplayError != nil {
+		self.OnReplayError(err)
+	}
+}
+
+// InsertRows inserts 'rows' by Inserter, spooling them if the error
+// is retryable. Other errors are returned.
+//
+func (self *Spool) InsertRows(rows []map[string]interface{}) error {
+	err := self.Inserter.InsertRows(rows)
+	if err == nil || !self.retryable(err) {
+		return err
+	}
+	return self.Write(rows)
+}
+
+// OnError spools the batch failed in BufferedWriter, as WriterOptions.OnError
+func (self *Spool) OnError(rows []map[string]interface{}, err error) {
+	if self.retryable(err) {
+		err = self.Write(rows)
+		if err == nil {
+			return
+		}
+	}
+	self.drop(rows, err)
+}
+
+// Write appends 'rows' to the current file of the spool, synced to disk.
+// A row without the timestamp key of Model or Smodel is written with
+// the current time, which the database would have given. If it fails, the file is closed, leaving a line cut at its end to be
+// skipped in replay, and the next rows go to a new file.
+//
+func (self *Spool) Write(rows []map[string]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	for _, row := range rows {
+		record := spoolRecord{Row: make(map[string]interface{})}
+		if self.stamp != "" && row[self.stamp] == nil {
+			record.Times = append(record.Times, self.stamp)
+			record.Row[self.stamp] = time.Now().Format(time.RFC3339Nano)
+		}
+		for k, v := range row {
+			if v == nil && k == self.stamp {
+				continue
+			}
+			if t, ok := v.(time.Time); ok {
+				record.Times = append(record.Times, k)
+				v = t.Format(time.RFC3339Nano)
+			}
+			record.Row[k] = v
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	self.Lock()
+	defer self.Unlock()
+	if self.file == nil {
+		self.seq++
+		name := filepath.Join(self.Dir, fmt.Sprintf("%020d-%06d.spool", time.Now().UnixNano(), self.seq))
+		file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		self.file = file
+	}
+	_, err := self.file.WriteString(b.String())
+	if err == nil {
+		err = self.file.Sync()
+	}
+	if err != nil {
+		self.file.Close()
+		self.file = nil
+	}
+	return err
+}
+
+// files returns the files of the spool in order, closing the current
+// one so the rows spooled afterwards go to a new file
+func (self *Spool) files() ([]string, error) {
+	self.Lock()
+	defer self.Unlock()
+	if self.file != nil {
+		self.file.Close()
+		self.file = nil
+	}
+	names, err := filepath.Glob(filepath.Join(self.Dir, "*.spool"))
+	sort.Strings(names)
+	return names, err
+}
+
+// readSpool returns the rows of file 'name', and the errors of the lines
+// skipped as not readable. The last line not complete, as after a crash
+// or a failed write, is skipped silently.
+//
+func readSpool(name string) ([]map[string]interface{}, []error, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	rows := make([]map[string]interface{}, 0)
+	var skipped []error
+	reader := bufio.NewReader(file)
+	for lineno := 1; ; lineno++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return rows, skipped, nil
+		} else if err != nil {
+			return rows, skipped, err
+		}
+		record := new(spoolRecord)
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(record); err != nil || record.Row == nil {
+			if err == nil {
+				err = errors.New("no row")
+			}
+			skipped = append(skipped, fmt.Errorf("spool %s line %d skipped: %w", name, lineno, err))
+			continue
+		}
+		row := record.Row
+		for k, v := range row {
+			if n, ok := v.(json.Number); ok {
+				if i, err := n.Int64(); err == nil {
+					row[k] = i
+				} else if f, err := n.Float64(); err == nil {
+					row[k] = f
+				}
+			}
+		}
+		for _, k := range record.Times {
+			if s, ok := row[k].(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					row[k] = t
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// dedup keeps the last row of the same keys, in order. Rows missing
+// any of the keys are all kept.
+func (self *Spool) dedup(rows []map[string]interface{}) []map[string]interface{} {
+	if len(self.Keys) == 0 {
+		return rows
+	}
+	last := make(map[string]int)
+	keys := make([]string, len(rows))
+	keyless := make([]bool, len(rows))
+	for i, row := range rows {
+		parts := make([]string, len(self.Keys))
+		for j, k := range self.Keys {
+			if row[k] == nil {
+				keyless[i] = true
+			}
+			parts[j] = fmt.Sprintf("%v", row[k])
+		}
+		if keyless[i] {
+			continue
+		}
+		keys[i] = strings.Join(parts, "\xff")
+		last[keys[i]] = i
+	}
+	kept := make([]map[string]interface{}, 0, len(rows))
+	for i, row := range rows {
+		if keyless[i] || last[keys[i]] == i {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+// Replay inserts the rows spooled, file by file in order, removing each
+// file once inserted. A batch failed by an error not retryable is passed
+// to OnDrop, and replay goes on. At a retryable error, it stops keeping
+// the file for the next replay; the batches inserted already are inserted
+// again then, which is harmless as rows of the same keys overwrite.
+//
+func (self *Spool) Replay() (int, error) {
+	self.replay.Lock()
+	defer self.replay.Unlock()
+	names, err := self.files()
+	if err != nil {
+		return 0, err
+	}
+	size := self.BatchSize
+	if size <= 0 {
+		size = 1000
+	}
+	n := 0
+	for _, name := range names {
+		rows, skipped, err := readSpool(name)
+		for _, err := range skipped {
+			self.report(err)
+		}
+		if err != nil {
+			return n, err
+		}
+		rows = self.dedup(rows)
+		for start := 0; start < len(rows); start += size {
+			end := start + size
+			if end > len(rows) {
+				end = len(rows)
+			}
+			if err := self.Inserter.InsertRows(rows[start:end]); err != nil {
+				if self.retryable(err) {
+					return n, err
+				}
+				self.drop(rows[start:end], err)
+				continue
+			}
+			n += end - start
+		}
+		if err := os.Remove(name); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Start replays the spool every 'interval' in the background, until Close.
+// The errors of replay are passed to OnReplayError.
+//
+func (self *Spool) Start(interval time.Duration) {
+	self.Lock()
+	defer self.Unlock()
+	if self.stop != nil {
+		return
+	}
+	self.stop = make(chan struct{})
+	self.done = make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := self.Replay(); err != nil {
+					self.report(err)
+				}
+			}
+		}
+	}(self.stop, self.done)
+}
+
+// Close stops replaying, and closes the current file. The rows not
+// replayed stay in Dir for the next Spool.
+//
+func (self *Spool) Close() error {
+	self.Lock()
+	stop, done := self.stop, self.done
+	self.stop, self.done = nil, nil
+	self.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	self.Lock()
+	defer self.Unlock()
+	if self.file != nil {
+		err := self.file.Close()
+		self.file = nil
+		return err
+	}
+	return nil
+}
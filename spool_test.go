@@ -0,0 +1,244 @@
+package taodbi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genelet/taodbi/taodbitest"
+)
+
+func TestSpool(t *testing.T) {
+	fakeOnly(t)
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer taodbitest.SetFault(nil)
+	smodel, err := NewSmodel("ms.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smodel.SetDB(db)
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS stesting",
+		"CREATE TABLE stesting (id timestamp, x binary(8), y binary(8), z binary(8)) TAGS (pubid int, location binary(8))",
+	} {
+		if err := smodel.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := t.TempDir()
+	spool, err := NewSpool(dir, smodel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	start := time.Unix(1600000000, 0)
+	row := func(i int, x string) map[string]interface{} {
+		return map[string]interface{}{"id": start.Add(time.Duration(i) * time.Second), "x": x, "pubid": 1, "location": "here"}
+	}
+
+	// the server is down for the direct and buffered writes
+	taodbitest.SetFault(taodbitest.FailTimes(1000, "INSERT", taodbitest.ErrNetwork))
+	if err := spool.InsertRows([]map[string]interface{}{row(0, "a"), row(1, "b")}); err != nil {
+		t.Fatal(err)
+	}
+	writer := NewBufferedWriter(smodel, &WriterOptions{BatchSize: 2, OnError: spool.OnError})
+	writer.Write(row(2, "c"))
+	writer.Write(row(1, "d"))
+	writer.Close()
+
+	// a syntax error is not spooled
+	taodbitest.SetFault(taodbitest.FailTimes(1, "INSERT", errors.New("syntax error near")))
+	if err := spool.InsertRows([]map[string]interface{}{row(3, "e")}); err == nil {
+		t.Errorf("error not returned")
+	}
+
+	// the first replay fails, and the next one, with the server back, succeeds
+	taodbitest.SetFault(taodbitest.FailTimes(1, "INSERT", taodbitest.ErrNetwork))
+	if n, err := spool.Replay(); n != 0 || err == nil {
+		t.Errorf("%d %v", n, err)
+	}
+	taodbitest.SetFault(nil)
+	if err := spool.InsertRows([]map[string]interface{}{row(4, "f")}); err != nil {
+		t.Fatal(err)
+	}
+	// a batch failed by an error not retryable is dropped, not blocking
+	var dropped []map[string]interface{}
+	spool.OnDrop = func(rows []map[string]interface{}, err error) { dropped = append(dropped, rows...) }
+	spool.BatchSize = 1
+	taodbitest.SetFault(taodbitest.FailTimes(1, "INSERT", errors.New("Table does not exist")))
+	n, err := spool.Replay()
+	if err != nil || n != 2 || len(dropped) != 1 || dropped[0]["x"] != "a" {
+		t.Errorf("%d %v %v", n, err, dropped)
+	}
+	lists := make([]map[string]interface{}, 0)
+	if err := smodel.SelectSQL(&lists, "SELECT x FROM stesting ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0)
+	for _, item := range lists {
+		got = append(got, item["x"].(string))
+	}
+	// row 1 is written twice in the spool, and replayed once
+	if strings.Join(got, "") != "dcf" {
+		t.Errorf("%v", got)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, "*.spool")); len(names) != 0 {
+		t.Errorf("%v", names)
+	}
+}
+
+func TestSpoolRecovery(t *testing.T) {
+	fakeOnly(t)
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer taodbitest.SetFault(nil)
+	model, err := NewModel("m1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.SetDB(db)
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS atesting",
+		"CREATE TABLE atesting (id timestamp, x binary(8), y binary(8), z binary(8))",
+	} {
+		if err := model.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := t.TempDir()
+	spool, err := NewSpool(dir, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taodbitest.SetFault(taodbitest.FailTimes(1, "INSERT", taodbitest.ErrNetwork))
+	if err := spool.InsertRows([]map[string]interface{}{{"id": 1600000000000000, "x": "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	spool.Close()
+
+	// a line not readable is reported, and a line cut by a crash is
+	// skipped silently by the next process
+	names, _ := filepath.Glob(filepath.Join(dir, "*.spool"))
+	if len(names) != 1 {
+		t.Fatalf("%v", names)
+	}
+	file, err := os.OpenFile(names[0], os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("not json\n" + `{"row":{"id":16000000010`)
+	file.Close()
+
+	spool, err = NewSpool(dir, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reported := make(chan error, 10)
+	spool.OnReplayError = func(err error) { reported <- err }
+	spool.Start(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	spool.Close()
+	close(reported)
+	errs := make([]error, 0)
+	for err := range reported {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "line 2 skipped") {
+		t.Errorf("%v", errs)
+	}
+	lists := make([]map[string]interface{}, 0)
+	if err := model.SelectSQL(&lists, "SELECT x FROM atesting"); err != nil || len(lists) != 1 || lists[0]["x"] != "a" {
+		t.Errorf("%v %v", lists, err)
+	}
+
+	// a failed write closes the file, and the next rows go to a new one
+	spool, err = NewSpool(dir, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	if err := spool.Write([]map[string]interface{}{{"x": "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	spool.file.Close()
+	if err := spool.Write([]map[string]interface{}{{"x": "c"}}); err == nil || spool.file != nil {
+		t.Errorf("%v", err)
+	}
+	if err := spool.Write([]map[string]interface{}{{"x": "d"}}); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, "*.spool")); len(names) != 2 {
+		t.Errorf("%v", names)
+	}
+}
+
+func TestSpoolKeyless(t *testing.T) {
+	fakeOnly(t)
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer taodbitest.SetFault(nil)
+	model, err := NewModel("m1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.SetDB(db)
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS atesting",
+		"CREATE TABLE atesting (id timestamp, x binary(8), y binary(8), z binary(8))",
+	} {
+		if err := model.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spool, err := NewSpool(t.TempDir(), model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+
+	// rows without the key are not the same row
+	rows := []map[string]interface{}{{"x": "a"}, {"id": nil, "x": "b"}, {"id": 1, "x": "c"}, {"id": 1, "x": "d"}}
+	if kept := spool.dedup(rows); len(kept) != 3 || kept[2]["x"] != "d" {
+		t.Errorf("%v", kept)
+	}
+
+	// and are stamped with the time spooled, not of replay
+	taodbitest.SetFault(taodbitest.FailTimes(1000, "INSERT", taodbitest.ErrNetwork))
+	before := time.Now()
+	for _, x := range []string{"a", "b"} {
+		if err := spool.InsertRows([]map[string]interface{}{{"x": x}}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	taodbitest.SetFault(nil)
+	time.Sleep(10 * time.Millisecond)
+	if n, err := spool.Replay(); n != 2 || err != nil {
+		t.Fatalf("%d %v", n, err)
+	}
+	lists := make([]map[string]interface{}, 0)
+	if err := model.SelectSQLType(&lists, []string{"int64", "string"}, "SELECT id, x FROM atesting ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 2 || lists[0]["x"] != "a" || lists[1]["x"] != "b" {
+		t.Fatalf("%v", lists)
+	}
+	for _, item := range lists {
+		if ts := time.UnixMicro(item["id"].(int64)); ts.Before(before) || ts.After(before.Add(10*time.Millisecond)) {
+			t.Errorf("%v not in the time spooled %v", ts, before)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package taodbi
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+)
+
+// DefaultStmtCacheSize is the size of StmtCache if not given
+var DefaultStmtCacheSize = 256
+
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+// StmtCache keeps prepared statements of a database handle by query text,
+// and closes the least recently used ones beyond Size. It is safe for
+// concurrent use: a statement evicted in use is closed after the use.
+//
+type StmtCache struct {
+	db   *sql.DB
+	size int
+
+	sync.Mutex
+	order  *list.List
+	items  map[string]*list.Element
+	hits   int64
+	misses int64
+}
+
+// NewStmtCache creates a cache for 'db' of 'size' statements;
+// DefaultStmtCacheSize is used if 'size' is not positive.
+func NewStmtCache(db *sql.DB, size int) *StmtCache {
+	if size <= 0 {
+		size = DefaultStmtCacheSize
+	}
+	return &StmtCache{db: db, size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Len returns the number of statements in cache
+func (self *StmtCache) Len() int {
+	self.Lock()
+	defer self.Unlock()
+	return self.order.Len()
+}
+
+// Stats returns the numbers of hits and misses
+func (self *StmtCache) Stats() (int64, int64) {
+	self.Lock()
+	defer self.Unlock()
+	return self.hits, self.misses
+}
+
+// Purge closes and removes all statements, e.g. after tables are changed.
+func (self *StmtCache) Purge() {
+	self.Lock()
+	closing := make([]*sql.Stmt, 0)
+	for e := self.order.Front(); e != nil; e = e.Next() {
+		if c := self.evict(e); c != nil {
+			closing = append(closing, c)
+		}
+	}
+	self.order.Init()
+	self.items = make(map[string]*list.Element)
+	self.Unlock()
+
+	for _, stmt := range closing {
+		stmt.Close()
+	}
+}
+
+// evict marks the statement evicted, and returns it if to be closed now
+func (self *StmtCache) evict(e *list.Element) *sql.Stmt {
+	c := e.Value.(*cachedStmt)
+	c.evicted = true
+	if c.refs == 0 {
+		return c.stmt
+	}
+	return nil
+}
+
+// get returns the prepared statement of 'query', and the function
+// to call after the statement is used.
+func (self *StmtCache) get(query string) (*sql.Stmt, func(), error) {
+	self.Lock()
+	if e, ok := self.items[query]; ok {
+		self.hits++
+		c := self.use(e)
+		self.Unlock()
+		return c.stmt, func() { self.release(c) }, nil
+	}
+	self.misses++
+	self.Unlock()
+
+	stmt, err := self.db.Prepare(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	self.Lock()
+	if e, ok := self.items[query]; ok { // prepared by another goroutine
+		c := self.use(e)
+		self.Unlock()
+		stmt.Close()
+		return c.stmt, func() { self.release(c) }, nil
+	}
+	c := &cachedStmt{query: query, stmt: stmt, refs: 1}
+	self.items[query] = self.order.PushFront(c)
+	closing := make([]*sql.Stmt, 0)
+	for self.order.Len() > self.size {
+		e := self.order.Back()
+		self.order.Remove(e)
+		delete(self.items, e.Value.(*cachedStmt).query)
+		if old := self.evict(e); old != nil {
+			closing = append(closing, old)
+		}
+	}
+	self.Unlock()
+
+	for _, old := range closing {
+		old.Close()
+	}
+	return stmt, func() { self.release(c) }, nil
+}
+
+func (self *StmtCache) use(e *list.Element) *cachedStmt {
+	self.order.MoveToFront(e)
+	c := e.Value.(*cachedStmt)
+	c.refs++
+	return c
+}
+
+func (self *StmtCache) release(c *cachedStmt) {
+	self.Lock()
+	c.refs--
+	closing := c.evicted && c.refs == 0
+	self.Unlock()
+	if closing {
+		c.stmt.Close()
+	}
+}
+
+// prepare returns a prepared statement from the cache if it is for the
+// database handle, or a new one; and the function to call after use.
+func (self *DBI) prepare(query string) (*sql.Stmt, func(), error) {
+	if self.Stmts != nil && self.Stmts.db == self.DB {
+		return self.Stmts.get(query)
+	}
+	sth, err := self.DB.Prepare(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sth, func() { sth.Close() }, nil
+}
@@ -0,0 +1,102 @@
+package taodbi
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func newCacheDBI(t testing.TB) *DBI {
+	c := newconf("config.json")
+	db, err := open(c.DSN(c.Database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbi := &DBI{DB: db}
+	for _, query := range []string{
+		`drop table if exists cachet`,
+		`create table cachet (ts timestamp, x int, y binary(8))`,
+	} {
+		if err := dbi.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dbi
+}
+
+func TestStmtCache(t *testing.T) {
+	dbi := newCacheDBI(t)
+	defer dbi.DB.Close()
+	dbi.Stmts = NewStmtCache(dbi.DB, 2)
+
+	insert := `insert into cachet (ts, x, y) values (?, ?, ?)`
+	for i := 1; i <= 3; i++ {
+		if err := dbi.DoSQL(insert, 1600000000000000+i, i, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hits, misses := dbi.Stmts.Stats(); hits != 2 || misses != 1 {
+		t.Errorf("hits %d, misses %d", hits, misses)
+	}
+
+	lists := make([]map[string]interface{}, 0)
+	for _, query := range []string{
+		`select x from cachet where x=?`,
+		`select y from cachet where x=?`,
+		`select x, y from cachet where x=?`,
+	} {
+		if err := dbi.SelectSQL(&lists, query, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dbi.Stmts.Len() != 2 {
+		t.Errorf("%d statements in cache", dbi.Stmts.Len())
+	}
+
+	if err := dbi.DoSQL(`create table if not exists cachez (ts timestamp, x int)`); err != nil {
+		t.Fatal(err)
+	}
+	if dbi.Stmts.Len() != 0 {
+		t.Errorf("%d statements in cache after create", dbi.Stmts.Len())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			query := `select x from cachet where x=` + strconv.Itoa(i%4)
+			for j := 0; j < 20; j++ {
+				rows := make([]map[string]interface{}, 0)
+				if err := dbi.SelectSQL(&rows, query); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if dbi.Stmts.Len() != 2 {
+		t.Errorf("%d statements in cache", dbi.Stmts.Len())
+	}
+}
+
+func benchmarkDoSQL(b *testing.B, cached bool) {
+	dbi := newCacheDBI(b)
+	defer dbi.DB.Close()
+	if cached {
+		dbi.Stmts = NewStmtCache(dbi.DB, 0)
+	}
+	insert := `insert into cachet (ts, x, y) values (?, ?, ?)`
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dbi.DoSQL(insert, 1600000000000000+i, i, "a"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDoSQL(b *testing.B) {
+	b.Run("prepare", func(b *testing.B) { benchmarkDoSQL(b, false) })
+	b.Run("cached", func(b *testing.B) { benchmarkDoSQL(b, true) })
+}
@@ -9,25 +9,63 @@ import (
 // Model: the name of the model
 // Action: the method name on the model
 // Manual: constraint conditions manually assigned
-// RelateItem: current page's column versus next page's column. The value is forced as constraint.
+// RelateItem: current page's columns versus next page's columns. The values are forced as constraints.
+// Key: the output key in the current row, default to model_action
+// Mode: how the next page is put into the current row:
+// "embed"	(default) as slice of rows under Key
+// "merge"	the first row is flattened into the current row, for one-to-one relations
 type Page struct {
 	Model      string                 `json:"model"`
 	Action     string                 `json:"action"`
 	Manual     map[string]interface{} `json:"manual,omitempty"`
 	RelateItem map[string]string      `json:"relate_item,omitempty"`
+	Key        string                 `json:"key,omitempty"`
+	Mode       string                 `json:"mode,omitempty"`
 }
 
+// refresh returns a new copy of extra with all the related columns
+// from item. It fails if any of the related columns is missing in item.
 func (self *Page) refresh(item map[string]interface{}, extra map[string]interface{}) (map[string]interface{}, bool) {
-	newExtra := extra
-	found := false
+	if !hasValue(self.RelateItem) {
+		return extra, false
+	}
+	newExtra := make(map[string]interface{})
+	for k, v := range extra {
+		newExtra[k] = v
+	}
 	for k, v := range self.RelateItem {
-		if t, ok := item[k]; ok {
-			found = true
-			newExtra[v] = t
-			break
+		t, ok := item[k]
+		if !ok {
+			return nil, false
+		}
+		newExtra[v] = t
+	}
+	return newExtra, true
+}
+
+// outputKey returns the key under which the next page is embedded
+func (self *Page) outputKey() string {
+	if self.Key != "" {
+		return self.Key
+	}
+	return self.Model + "_" + self.Action
+}
+
+// embed puts the next page's rows into item according to Mode.
+// In the merge mode, existing columns in item are not overridden.
+func (self *Page) embed(item map[string]interface{}, lists []map[string]interface{}) {
+	if self.Mode != "merge" {
+		item[self.outputKey()] = lists
+		return
+	}
+	if !hasValue(lists) {
+		return
+	}
+	for k, v := range lists[0] {
+		if _, ok := item[k]; !ok {
+			item[k] = v
 		}
 	}
-	return newExtra, found
 }
 
 // Table gives the RESTful table structure, usually parsed by JSON file on disk
@@ -45,7 +83,7 @@ type Table struct {
 	// InsertPars: the columns used for Create
 	InsertPars []string `json:"insert_pars,omitempty"`
 	// InsupdPars: unique columns
-	InsupdPars []string `json:"insupd_pars"`
+	InsupdPars []string `json:"insupd_pars,omitempty"`
 	// EditPar: the columns used for Read One
 	EditPars []interface{} `json:"edit_pars,omitempty"`
 	// EditHash: the columns used for Read One
@@ -76,6 +114,22 @@ type Table struct {
 	Sortreverse string `json:"sortreverse,omitempty"`
 	Sortby      string `json:"sortby,omitempty"`
 	Passid      string `json:"passid,omitempty"`
+
+	// baseTable: CurrentTable without database
+	baseTable string
+}
+
+// qualify prefixes CurrentTable with 'database', or removes the prefix
+// if 'database' is empty.
+func (self *Table) qualify(database string) {
+	if self.baseTable == "" {
+		self.baseTable = self.CurrentTable
+	}
+	if database == "" {
+		self.CurrentTable = self.baseTable
+	} else {
+		self.CurrentTable = database + "." + self.baseTable
+	}
 }
 
 func newTable(content []byte) (*Table, error) {
@@ -128,7 +182,6 @@ func generalHashPars(TopicsHash map[string]interface{}, TopicsPars []interface{}
 		}
 		return s1
 	}
-	return nil
 }
 
 func (parsed *Table) fulfill() {
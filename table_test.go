@@ -98,3 +98,38 @@ func TestTableStr(t *testing.T) {
 	}
 */
 }
+
+func TestPageRefresh(t *testing.T) {
+	page := &Page{Model: "child", Action: "topics", RelateItem: map[string]string{"id": "pid", "loc": "location"}}
+	extra := map[string]interface{}{"z": "e1234"}
+
+	newExtra, ok := page.refresh(map[string]interface{}{"id": 1, "loc": "beijing"}, extra)
+	if !ok || newExtra["pid"] != 1 || newExtra["location"] != "beijing" || newExtra["z"] != "e1234" {
+		t.Errorf("%#v", newExtra)
+	}
+	if _, ok := extra["pid"]; ok {
+		t.Errorf("extra should not be changed: %#v", extra)
+	}
+	if _, ok := page.refresh(map[string]interface{}{"id": 2}, extra); ok {
+		t.Errorf("missing related column should not be found")
+	}
+
+	item := map[string]interface{}{"id": 1}
+	page.embed(item, []map[string]interface{}{{"pid": 1, "child": "john"}})
+	if _, ok := item["child_topics"]; !ok {
+		t.Errorf("%#v", item)
+	}
+
+	page.Key = "kids"
+	page.embed(item, nil)
+	if _, ok := item["kids"]; !ok {
+		t.Errorf("%#v", item)
+	}
+
+	page.Mode = "merge"
+	item = map[string]interface{}{"id": 1, "child": "sam"}
+	page.embed(item, []map[string]interface{}{{"id": 5, "child": "john", "age": 3}})
+	if item["id"] != 1 || item["child"] != "sam" || item["age"] != 3 {
+		t.Errorf("%#v", item)
+	}
+}
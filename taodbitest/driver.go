@@ -0,0 +1,248 @@
+package taodbitest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/genelet/taodbi/internal/taosql"
+)
+
+func init() {
+	sql.Register("taodbitest", &Driver{})
+}
+
+// Driver is a database/sql driver keeping TDengine tables in memory.
+// It understands the subset of TDengine SQL used by taodbi, and returns
+// values in the same types as the native driver taosSql does.
+//
+// The DSN is the same as taosSql's, e.g. root:taosdata@/tcp(127.0.0.1:0)/demodb?parseTime=false.
+// The database in DSN is created with precision "us" if it does not exist.
+type Driver struct{}
+
+// Open returns a new connection with its own session.
+func (self *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := self.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+// OpenConnector returns a connector whose connections share the session,
+// so USE is effective for a *sql.DB like the one connection of taosSql.
+func (self *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	sess, err := newSession(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{driver: self, sess: sess}, nil
+}
+
+type session struct {
+	sync.Mutex
+	db        string
+	parseTime bool
+}
+
+func newSession(dsn string) (*session, error) {
+	sess := &session{parseTime: true}
+	if i := strings.LastIndex(dsn, "/"); i >= 0 {
+		dsn = dsn[i+1:]
+	}
+	params := ""
+	if i := strings.Index(dsn, "?"); i >= 0 {
+		dsn, params = dsn[:i], dsn[i+1:]
+	}
+	for _, pair := range strings.Split(params, "&") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 && kv[0] == "parseTime" {
+			b, err := strconv.ParseBool(kv[1])
+			if err != nil {
+				return nil, errors.New("invalid bool value: " + kv[1])
+			}
+			sess.parseTime = b
+		}
+	}
+	if dsn != "" {
+		sess.db = strings.ToLower(dsn)
+		global.Lock()
+		if _, ok := global.databases[sess.db]; !ok {
+			global.create(sess.db, map[string]string{"precision": "us"})
+		}
+		global.Unlock()
+	}
+	return sess, nil
+}
+
+func (self *session) currentDB() string {
+	self.Lock()
+	defer self.Unlock()
+	return self.db
+}
+
+func (self *session) setDB(db string) {
+	self.Lock()
+	self.db = db
+	self.Unlock()
+}
+
+type connector struct {
+	driver *Driver
+	sess   *session
+}
+
+func (self *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &conn{sess: self.sess}, nil
+}
+
+func (self *connector) Driver() driver.Driver {
+	return self.driver
+}
+
+type conn struct {
+	sess *session
+}
+
+func (self *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: self, query: query}, nil
+}
+
+func (self *conn) Close() error {
+	return nil
+}
+
+func (self *conn) Begin() (driver.Tx, error) {
+	return nil, errors.New("taodbitest does not support transaction")
+}
+
+func (self *conn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	query, err := taosql.Interpolate(query, args)
+	if err != nil {
+		return nil, err
+	}
+	_, n, err := execute(self.sess, query)
+	if err != nil {
+		return nil, err
+	}
+	return result(n), nil
+}
+
+func (self *conn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	query, err := taosql.Interpolate(query, args)
+	if err != nil {
+		return nil, err
+	}
+	rs, _, err := execute(self.sess, query)
+	if err != nil {
+		return nil, err
+	}
+	if rs == nil {
+		rs = &resultSet{}
+	}
+	return &rows{rs: rs, parseTime: self.sess.parseTime}, nil
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (self *stmt) Close() error {
+	return nil
+}
+
+// NumInput is -1 since placeholders are interpolated as taosSql does
+func (self *stmt) NumInput() int {
+	return -1
+}
+
+func (self *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return self.conn.Exec(self.query, args)
+}
+
+func (self *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return self.conn.Query(self.query, args)
+}
+
+type result int64
+
+func (self result) LastInsertId() (int64, error) {
+	return 0, errors.New("taodbitest does not support LastInsertId")
+}
+
+func (self result) RowsAffected() (int64, error) {
+	return int64(self), nil
+}
+
+type rows struct {
+	rs        *resultSet
+	parseTime bool
+	pos       int
+}
+
+func (self *rows) Columns() []string {
+	names := make([]string, len(self.rs.columns))
+	for i, c := range self.rs.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+func (self *rows) ColumnTypeDatabaseTypeName(i int) string {
+	return self.rs.columns[i].typeName()
+}
+
+func (self *rows) Close() error {
+	return nil
+}
+
+// Next outputs values in types of taosSql: int for TINYINT and INT,
+// int16 for SMALLINT, float32 for FLOAT, and NUL-padded strings
+// unless the Version is 3.x.
+func (self *rows) Next(dest []driver.Value) error {
+	if self.pos >= len(self.rs.rows) {
+		return io.EOF
+	}
+	row := self.rs.rows[self.pos]
+	self.pos++
+	for i, c := range self.rs.columns {
+		v := row[i]
+		if v == nil {
+			dest[i] = nil
+			continue
+		}
+		switch c.typ {
+		case "TINYINT", "INT":
+			dest[i] = int(v.(int64))
+		case "SMALLINT":
+			dest[i] = int16(v.(int64))
+		case "BIGINT":
+			dest[i] = v.(int64)
+		case "FLOAT":
+			dest[i] = float32(v.(float64))
+		case "DOUBLE":
+			dest[i] = v.(float64)
+		case "BOOL":
+			dest[i] = v.(bool)
+		case "TIMESTAMP":
+			if self.parseTime {
+				dest[i] = taosql.FormatTime(v.(int64), self.rs.precision)
+			} else {
+				dest[i] = v.(int64)
+			}
+		default:
+			s := v.(string)
+			if n := c.length + 2 - len(s); n > 0 && !v3() {
+				s += strings.Repeat("\x00", n)
+			}
+			dest[i] = s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package taodbitest
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func openTest(t *testing.T, dsn string) *sql.DB {
+	db, err := sql.Open("taodbitest", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`drop database if exists fakedb`,
+		`create database fakedb precision "us"`,
+		`use fakedb`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestDriverTypes(t *testing.T) {
+	db := openTest(t, "root:taosdata@/tcp(127.0.0.1:0)/?parseTime=false")
+	defer db.Close()
+
+	if _, err := db.Exec(`create table t1 (ts timestamp, a tinyint, b smallint, c int, d bigint, e float, f double, g bool, h binary(8), i nchar(4))`); err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.Exec(`insert into t1 values (1600000000000000, 1, 2, 3, 4, 5.5, 6.5, true, ?, 'ab') (1600000000000001, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL)`, "'xy'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("%d", n)
+	}
+	if _, err := db.Exec(`insert into t1 (ts, h) values (now, 'toolong123')`); err == nil {
+		t.Errorf("string overflow expected")
+	}
+
+	rows, err := db.Query(`select * from t1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	values := make([]interface{}, 10)
+	pointers := make([]interface{}, 10)
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if !rows.Next() {
+		t.Fatal("no row")
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		t.Fatal(err)
+	}
+	if values[0] != int64(1600000000000000) || values[1] != 1 || values[2] != int16(2) ||
+		values[3] != 3 || values[4] != int64(4) || values[5] != float32(5.5) ||
+		values[6] != 6.5 || values[7] != true || values[8] != "xy\x00\x00\x00\x00\x00\x00\x00\x00" ||
+		values[9] != "ab\x00\x00\x00\x00" {
+		t.Errorf("%#v", values)
+	}
+	if !rows.Next() {
+		t.Fatal("no second row")
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range values[1:] {
+		if v != nil {
+			t.Errorf("%#v", values)
+		}
+	}
+}
+
+func TestDriverParseTime(t *testing.T) {
+	db := openTest(t, "root:taosdata@/tcp(127.0.0.1:0)/")
+	defer db.Close()
+
+	db.Exec(`create table t2 (ts timestamp, x int)`)
+	if _, err := db.Exec(`insert into t2 values ('2020-08-11 11:27:13.375020', 1)`); err != nil {
+		t.Fatal(err)
+	}
+	var ts string
+	var x int
+	if err := db.QueryRow(`select ts, x from t2 where ts = '2020-08-11 11:27:13.375020'`).Scan(&ts, &x); err != nil {
+		t.Fatal(err)
+	}
+	if ts != "2020-08-11 11:27:13.375020" || x != 1 {
+		t.Errorf("%s %d", ts, x)
+	}
+	if _, err := db.Begin(); err == nil {
+		t.Errorf("transaction is not supported")
+	}
+}
+
+func TestDriverSuperTable(t *testing.T) {
+	db := openTest(t, "root:taosdata@/tcp(127.0.0.1:0)/fakedb?parseTime=false")
+	defer db.Close()
+
+	for _, s := range []string{
+		`create stable st (ts timestamp, x binary(8), y int) tags (pubid int, location binary(8))`,
+		`insert into st_1 using st tags (1, 'yyz') values (1000, 'a', 1) (2000, 'b', NULL)`,
+		`insert into st_2 using st tags ('2', 'yul') values (1500, 'a', 3) st_1 values (3000, 'c', 4)`,
+		`create table st_3 using st tags (3, 'yvr')`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(s, err)
+		}
+	}
+
+	var n int64
+	if err := db.QueryRow(`select count(*) from st where pubid in (1, 2)`).Scan(&n); err != nil || n != 4 {
+		t.Errorf("%d %v", n, err)
+	}
+	if err := db.QueryRow(`select count(*) from st_3`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("%d %v", n, err)
+	}
+	if err := db.QueryRow(`select last(ts) from st_3`).Scan(&n); err != sql.ErrNoRows {
+		t.Errorf("no rows expected: %v", err)
+	}
+
+	rows, err := db.Query(`select last(*) from st where x = 'a' or y is null group by pubid, location order by pubid desc`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, _ := rows.Columns()
+	if strings.Join(columns, ",") != "last(ts),last(x),last(y),pubid,location" {
+		t.Errorf("%v", columns)
+	}
+	lists := make([]string, 0)
+	for rows.Next() {
+		var ts, y, pubid int64
+		var x, location string
+		if err := rows.Scan(&ts, &x, &y, &pubid, &location); err != nil {
+			t.Fatal(err)
+		}
+		lists = append(lists, strings.TrimRight(x, "\x00")+strings.TrimRight(location, "\x00"))
+	}
+	rows.Close()
+	if strings.Join(lists, ",") != "ayul,byyz" {
+		t.Errorf("%v", lists)
+	}
+
+	var x string
+	if err := db.QueryRow(`select x from st where location like 'y_z' order by ts desc limit 1 offset 1`).Scan(&x); err != nil || x != "b"+strings.Repeat("\x00", 9) {
+		t.Errorf("%q %v", x, err)
+	}
+
+	var name, stable string
+	var created, ncolumns int64
+	if err := db.QueryRow(`show tables`).Scan(&name, &created, &ncolumns, &stable); err != nil || strings.TrimRight(name, "\x00") != "st_1" || strings.TrimRight(stable, "\x00") != "st" {
+		t.Errorf("%s %s %v", name, stable, err)
+	}
+	rows, err = db.Query(`describe st`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes := make([]string, 0)
+	for rows.Next() {
+		var field, typ, note string
+		var length int
+		rows.Scan(&field, &typ, &length, &note)
+		notes = append(notes, strings.TrimRight(field, "\x00")+":"+strings.TrimRight(note, "\x00"))
+	}
+	rows.Close()
+	if strings.Join(notes, ",") != "ts:,x:,y:,pubid:TAG,location:TAG" {
+		t.Errorf("%v", notes)
+	}
+
+	if _, err := db.Exec(`drop table st_1`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`select * from st_1`); err == nil {
+		t.Errorf("table should be dropped")
+	}
+	if _, err := db.Exec(`select * from`); err == nil || !strings.HasPrefix(err.Error(), "invalid SQL") {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestDriverFault(t *testing.T) {
+	db := openTest(t, "root:taosdata@/tcp(127.0.0.1:0)/")
+	defer db.Close()
+	defer SetFault(nil)
+
+	SetFault(FailTimes(1, "show", ErrNetwork))
+	if _, err := db.Exec(`show tables`); err != ErrNetwork {
+		t.Errorf("%v", err)
+	}
+	if _, err := db.Exec(`show tables`); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestDriverVersion3(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	Version = "3.0.2.0"
+	db := openTest(t, "root:taosdata@/tcp(127.0.0.1:0)/?parseTime=false")
+	defer db.Close()
+
+	for _, s := range []string{
+		`create stable st (ts timestamp, x int, y varchar(8)) tags (loc varchar(8), gid int)`,
+		`create index st_gid on st (gid)`,
+		`insert into c1 using st tags ('a', 1) values (1000, 1, 'one') (2000, 2, 'two') c2 using st tags ('b', 2) values (1000, 3, 'three')`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var y string
+	if err := db.QueryRow(`select y from c1 where x=1`).Scan(&y); err != nil || y != "one" {
+		t.Errorf("%q %v", y, err)
+	}
+	rows, err := db.Query(`select last(x) from st group by loc`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, _ := rows.Columns()
+	rows.Close()
+	if len(columns) != 1 {
+		t.Errorf("%v", columns)
+	}
+
+	res, err := db.Exec(`delete from st where loc='a' and x>1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("%d", n)
+	}
+	var n int64
+	if err := db.QueryRow(`select count(*) from st`).Scan(&n); err != nil || n != 2 {
+		t.Errorf("%d %v", n, err)
+	}
+	if _, err := db.Exec(`create index st_x on st (x)`); err == nil {
+		t.Errorf("index on column expected to fail")
+	}
+}
+
+func TestDriverInterval(t *testing.T) {
+	db := openTest(t, "root:taosdata@/tcp(127.0.0.1:0)/?parseTime=false")
+	defer db.Close()
+	for _, s := range []string{
+		`create table st (ts timestamp, x int) tags (loc binary(8))`,
+		`insert into c1 using st tags ('a') values (1000000, 1) (1500000, 3) (2000000, 5) c2 using st tags ('b') values (1000000, 7)`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(query string) []string {
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatal(query, err)
+		}
+		defer rows.Close()
+		got := make([]string, 0)
+		for rows.Next() {
+			var ts int64
+			var avg float64
+			var loc string
+			if err := rows.Scan(&ts, &avg, &loc); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, fmt.Sprintf("%s:%d:%g", strings.TrimRight(loc, "\x00"), ts, avg))
+		}
+		return got
+	}
+	expected := "a:0:2,a:2000000:5,b:0:7"
+	if got := scan(`select avg(x) from st where ts>=0 interval(2s) group by loc`); strings.Join(got, ",") != expected {
+		t.Errorf("%v", got)
+	}
+
+	defer func(v string) { Version = v }(Version)
+	Version = "3.0.2.0"
+	if got := scan(`select _wstart, avg(x), loc from st partition by loc interval(2s)`); strings.Join(got, ",") != expected {
+		t.Errorf("%v", got)
+	}
+}
@@ -0,0 +1,649 @@
+package taodbitest
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Version is reported by SELECT SERVER_VERSION(). With a version 3.x,
+// the driver behaves as TDengine 3: strings are not padded, group columns
+// are not appended to aggregates, and DELETE and CREATE INDEX are supported.
+var Version = "2.0.0.0"
+
+func v3() bool {
+	return strings.HasPrefix(Version, "3")
+}
+
+// record is one row in evaluating expressions. Names map lower-cased
+// column names to positions in values.
+type record struct {
+	names     map[string]int
+	columns   []*column
+	values    []interface{}
+	precision string
+}
+
+func (self *record) lookup(name string) (*column, interface{}, bool) {
+	if self == nil {
+		return nil, nil, false
+	}
+	i, ok := self.names[strings.ToLower(name)]
+	if !ok {
+		return nil, nil, false
+	}
+	if i >= len(self.values) {
+		return self.columns[i], nil, true
+	}
+	return self.columns[i], self.values[i], true
+}
+
+type expr interface {
+	eval(r *record) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (self *literal) eval(r *record) (interface{}, error) {
+	return self.value, nil
+}
+
+type columnRef struct {
+	name string
+}
+
+func (self *columnRef) eval(r *record) (interface{}, error) {
+	_, v, ok := r.lookup(self.name)
+	if !ok {
+		return nil, errSyntax("invalid column name " + self.name)
+	}
+	return v, nil
+}
+
+// column returns the definition if the expression is a column
+func columnOf(e expr, r *record) *column {
+	if c, ok := e.(*columnRef); ok {
+		col, _, _ := r.lookup(c.name)
+		return col
+	}
+	return nil
+}
+
+type unary struct {
+	op    string
+	inner expr
+}
+
+func (self *unary) eval(r *record) (interface{}, error) {
+	v, err := self.inner.eval(r)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	if self.op == "NOT" {
+		b, ok := v.(bool)
+		if !ok {
+			return nil, errSyntax("NOT on non-boolean")
+		}
+		return !b, nil
+	}
+	switch u := v.(type) {
+	case int64:
+		return -u, nil
+	case float64:
+		return -u, nil
+	default:
+	}
+	return nil, errSyntax("minus on non-number")
+}
+
+type binary struct {
+	op          string
+	left, right expr
+}
+
+func (self *binary) eval(r *record) (interface{}, error) {
+	a, err := self.left.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	if self.op == "AND" || self.op == "OR" {
+		x, _ := a.(bool)
+		if self.op == "AND" && a != nil && !x {
+			return false, nil
+		}
+		if self.op == "OR" && x {
+			return true, nil
+		}
+		b, err := self.right.eval(r)
+		if err != nil {
+			return nil, err
+		}
+		y, _ := b.(bool)
+		return y, nil
+	}
+	b, err := self.right.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil || b == nil {
+		return nil, nil
+	}
+	switch self.op {
+	case "+", "-", "*", "/", "%":
+		return arithmetic(self.op, a, b)
+	default:
+	}
+	if c := columnOf(self.left, r); c != nil {
+		b = asColumn(c, b, r.precision)
+	}
+	if c := columnOf(self.right, r); c != nil {
+		a = asColumn(c, a, r.precision)
+	}
+	cmp, ok := compare(a, b)
+	if !ok {
+		return false, nil
+	}
+	switch self.op {
+	case "=":
+		return cmp == 0, nil
+	case "!=", "<>":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	default:
+	}
+	return nil, errSyntax("unknown operator " + self.op)
+}
+
+// asColumn converts a literal to the type of the column it is compared with,
+// e.g. a time string to timestamp, or '333' to a number.
+func asColumn(c *column, v interface{}, precision string) interface{} {
+	if c.typ == "BOOL" {
+		if n, ok := v.(int64); ok {
+			return n != 0
+		}
+	}
+	if s, ok := v.(string); ok && !c.isString() && c.typ != "BOOL" {
+		if cv, err := coerce(c, s, precision); err == nil {
+			return cv
+		}
+	}
+	return v
+}
+
+type inList struct {
+	not   bool
+	left  expr
+	items []expr
+}
+
+func (self *inList) eval(r *record) (interface{}, error) {
+	a, err := self.left.eval(r)
+	if err != nil || a == nil {
+		return nil, err
+	}
+	c := columnOf(self.left, r)
+	for _, item := range self.items {
+		b, err := item.eval(r)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			b = asColumn(c, b, r.precision)
+		}
+		if cmp, ok := compare(a, b); ok && cmp == 0 {
+			return !self.not, nil
+		}
+	}
+	return self.not, nil
+}
+
+type like struct {
+	not     bool
+	left    expr
+	pattern expr
+}
+
+func (self *like) eval(r *record) (interface{}, error) {
+	a, err := self.left.eval(r)
+	if err != nil || a == nil {
+		return nil, err
+	}
+	p, err := self.pattern.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	s, ok1 := a.(string)
+	pattern, ok2 := p.(string)
+	if !ok1 || !ok2 {
+		return nil, errSyntax("LIKE on non-string")
+	}
+	return matchLike(s, pattern) != self.not, nil
+}
+
+// matchLike matches % for any characters and _ for one character
+func matchLike(s, pattern string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	switch pattern[0] {
+	case '%':
+		for i := 0; i <= len(s); i++ {
+			if matchLike(s[i:], pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		return s != "" && matchLike(s[1:], pattern[1:])
+	default:
+	}
+	return s != "" && s[0] == pattern[0] && matchLike(s[1:], pattern[1:])
+}
+
+type isNull struct {
+	not  bool
+	left expr
+}
+
+func (self *isNull) eval(r *record) (interface{}, error) {
+	a, err := self.left.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	return (a == nil) != self.not, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch u := v.(type) {
+	case int64:
+		return float64(u), true
+	case float64:
+		return u, true
+	case bool:
+		if u {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(u, 64)
+		return f, err == nil
+	default:
+	}
+	return 0, false
+}
+
+// compare returns -1, 0 or 1. It fails if the two are not comparable.
+func compare(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	}
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			default:
+			}
+			return 0, true
+		}
+	}
+	x, ok1 := toFloat(a)
+	y, ok2 := toFloat(b)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	default:
+	}
+	return 0, true
+}
+
+func arithmetic(op string, a, b interface{}) (interface{}, error) {
+	x, ok1 := a.(int64)
+	y, ok2 := b.(int64)
+	if ok1 && ok2 && op != "/" {
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		default:
+		}
+		if y == 0 {
+			return nil, nil
+		}
+		return x % y, nil
+	}
+	f, ok1 := toFloat(a)
+	g, ok2 := toFloat(b)
+	if !ok1 || !ok2 {
+		return nil, errSyntax("arithmetic on non-number")
+	}
+	switch op {
+	case "+":
+		return f + g, nil
+	case "-":
+		return f - g, nil
+	case "*":
+		return f * g, nil
+	default:
+	}
+	if g == 0 {
+		return nil, nil
+	}
+	if op == "%" {
+		return float64(int64(f) % int64(g)), nil
+	}
+	return f / g, nil
+}
+
+// duration converts a literal like 10s to an integer in the precision
+func duration(text, precision string) (int64, error) {
+	i := len(text)
+	for i > 0 && (text[i-1] < '0' || text[i-1] > '9') {
+		i--
+	}
+	n, err := strconv.ParseInt(text[:i], 10, 64)
+	if err != nil {
+		return 0, errSyntax("invalid number " + text)
+	}
+	var ns int64
+	switch strings.ToLower(text[i:]) {
+	case "b":
+		ns = 1
+	case "u":
+		ns = 1000
+	case "a":
+		ns = 1000000
+	case "s":
+		ns = 1000000000
+	case "m":
+		ns = 60 * 1000000000
+	case "h":
+		ns = 3600 * 1000000000
+	case "d":
+		ns = 86400 * 1000000000
+	case "w":
+		ns = 7 * 86400 * 1000000000
+	default:
+		return 0, errSyntax("invalid duration " + text)
+	}
+	switch precision {
+	case "ms":
+		return n * ns / 1000000, nil
+	case "us":
+		return n * ns / 1000, nil
+	default:
+	}
+	return n * ns, nil
+}
+
+// parseExpr parses an expression in the order of OR, AND, NOT,
+// comparison, addition, multiplication and the unary.
+func (self *parser) parseExpr() (expr, error) {
+	left, err := self.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for self.accept("OR") {
+		right, err := self.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (self *parser) parseAnd() (expr, error) {
+	left, err := self.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for self.accept("AND") {
+		right, err := self.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (self *parser) parseNot() (expr, error) {
+	if self.accept("NOT") {
+		inner, err := self.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{op: "NOT", inner: inner}, nil
+	}
+	return self.parseComparison()
+}
+
+func (self *parser) parseComparison() (expr, error) {
+	left, err := self.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if self.accept("IS") {
+		not := self.accept("NOT")
+		if err := self.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNull{not: not, left: left}, nil
+	}
+	not := self.accept("NOT")
+	switch {
+	case self.accept("IN"):
+		if err := self.expect("("); err != nil {
+			return nil, err
+		}
+		items := make([]expr, 0)
+		for {
+			item, err := self.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if self.accept(")") {
+				break
+			}
+			if err := self.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		return &inList{not: not, left: left, items: items}, nil
+	case self.accept("LIKE"):
+		pattern, err := self.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &like{not: not, left: left, pattern: pattern}, nil
+	case not:
+		return nil, errSyntax("expecting IN or LIKE after NOT")
+	default:
+	}
+	for _, op := range []string{"=", "!=", "<>", "<=", ">=", "<", ">"} {
+		if self.accept(op) {
+			right, err := self.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return &binary{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (self *parser) parseAdditive() (expr, error) {
+	left, err := self.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := self.peek().Text
+		if !self.peek().Is("+") && !self.peek().Is("-") {
+			return left, nil
+		}
+		self.next()
+		right, err := self.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+}
+
+func (self *parser) parseMultiplicative() (expr, error) {
+	left, err := self.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := self.peek().Text
+		if !self.peek().Is("*") && !self.peek().Is("/") && !self.peek().Is("%") {
+			return left, nil
+		}
+		self.next()
+		right, err := self.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+}
+
+func (self *parser) parseUnary() (expr, error) {
+	if self.accept("-") {
+		inner, err := self.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{op: "-", inner: inner}, nil
+	}
+	self.accept("+")
+	return self.parsePrimary()
+}
+
+func (self *parser) precision() string {
+	if self.db != nil {
+		return self.db.precision
+	}
+	return "ms"
+}
+
+func (self *parser) parsePrimary() (expr, error) {
+	t := self.next()
+	switch t.Kind {
+	case tNumber:
+		if n, err := strconv.ParseInt(t.Text, 10, 64); err == nil {
+			return &literal{n}, nil
+		}
+		if f, err := strconv.ParseFloat(t.Text, 64); err == nil {
+			return &literal{f}, nil
+		}
+		d, err := duration(t.Text, self.precision())
+		if err != nil {
+			return nil, err
+		}
+		return &literal{d}, nil
+	case tString:
+		return &literal{t.Text}, nil
+	case tIdent:
+		switch {
+		case t.Is("NULL"):
+			return &literal{nil}, nil
+		case t.Is("TRUE"):
+			return &literal{true}, nil
+		case t.Is("FALSE"):
+			return &literal{false}, nil
+		default:
+		}
+		if self.accept("(") {
+			return self.function(t)
+		}
+		if t.Is("NOW") {
+			return &literal{self.timeNow()}, nil
+		}
+		name := t.Text
+		if self.accept(".") {
+			next, err := self.ident()
+			if err != nil {
+				return nil, err
+			}
+			name = next
+		}
+		return &columnRef{name: strings.ToLower(name)}, nil
+	case tPunct:
+		if t.Is("(") {
+			e, err := self.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return e, self.expect(")")
+		}
+	default:
+	}
+	return nil, errSyntax("unexpected " + t.Text)
+}
+
+// timeNow is the same now for all places in a statement
+func (self *parser) timeNow() int64 {
+	if self.now == 0 {
+		if self.db == nil {
+			if db, ok := global.databases[self.sess.currentDB()]; ok {
+				self.db = db
+			}
+		}
+		if self.db != nil {
+			self.now = self.db.now()
+		} else {
+			self.now = (&database{precision: "ms"}).now()
+		}
+	}
+	return self.now
+}
+
+// function evaluates scalar functions without arguments
+func (self *parser) function(t token) (expr, error) {
+	if err := self.expect(")"); err != nil {
+		return nil, err
+	}
+	switch {
+	case t.Is("NOW"):
+		return &literal{self.timeNow()}, nil
+	case t.Is("SERVER_VERSION"), t.Is("CLIENT_VERSION"):
+		return &literal{Version}, nil
+	case t.Is("DATABASE"):
+		if db := self.sess.currentDB(); db != "" {
+			return &literal{db}, nil
+		}
+		return &literal{nil}, nil
+	case t.Is("SERVER_STATUS"):
+		return &literal{int64(1)}, nil
+	default:
+	}
+	return nil, errSyntax("unsupported function " + t.Text)
+}
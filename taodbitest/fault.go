@@ -0,0 +1,49 @@
+package taodbitest
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrNetwork is the message of the TDengine client losing the server.
+var ErrNetwork = errors.New("Unable to establish connection")
+
+var faults struct {
+	sync.Mutex
+	inject func(query string) error
+}
+
+// SetFault makes a statement fail with the error returned by 'inject',
+// which is called with the statement before it runs. A nil 'inject', or
+// Reset, removes the fault.
+func SetFault(inject func(query string) error) {
+	faults.Lock()
+	faults.inject = inject
+	faults.Unlock()
+}
+
+// FailTimes returns a fault failing the first 'n' statements containing
+// 'match' with 'err'.
+func FailTimes(n int, match string, err error) func(string) error {
+	var mu sync.Mutex
+	return func(query string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if n > 0 && strings.Contains(query, match) {
+			n--
+			return err
+		}
+		return nil
+	}
+}
+
+func fault(query string) error {
+	faults.Lock()
+	inject := faults.inject
+	faults.Unlock()
+	if inject == nil {
+		return nil
+	}
+	return inject(query)
+}
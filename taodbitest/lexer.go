@@ -0,0 +1,24 @@
+package taodbitest
+
+import (
+	"github.com/genelet/taodbi/internal/lexer"
+)
+
+type token = lexer.Token
+
+const (
+	tEOF    = lexer.EOF
+	tIdent  = lexer.Ident
+	tNumber = lexer.Number
+	tString = lexer.String
+	tPunct  = lexer.Punct
+)
+
+// tokenize splits a statement into tokens by the shared lexer
+func tokenize(query string) ([]token, error) {
+	tokens, err := lexer.Tokenize(query)
+	if err != nil {
+		return nil, errSyntax(err.Error())
+	}
+	return tokens, nil
+}
@@ -0,0 +1,710 @@
+package taodbitest
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/genelet/taodbi/internal/taosql"
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+	sess   *session
+	db     *database
+	now    int64
+}
+
+func (self *parser) peek() token {
+	return self.tokens[self.pos]
+}
+
+func (self *parser) next() token {
+	t := self.tokens[self.pos]
+	if t.Kind != tEOF {
+		self.pos++
+	}
+	return t
+}
+
+// accept consumes the keywords or punctuations in sequence if all matched
+func (self *parser) accept(words ...string) bool {
+	for i, w := range words {
+		if self.pos+i >= len(self.tokens) || !self.tokens[self.pos+i].Is(w) {
+			return false
+		}
+	}
+	self.pos += len(words)
+	return true
+}
+
+func (self *parser) expect(words ...string) error {
+	if !self.accept(words...) {
+		return errSyntax("expecting " + strings.Join(words, " ") + " near " + self.peek().Text)
+	}
+	return nil
+}
+
+func (self *parser) ident() (string, error) {
+	t := self.next()
+	if t.Kind != tIdent {
+		return "", errSyntax("expecting name near " + t.Text)
+	}
+	return t.Text, nil
+}
+
+// tableName reads name or db.name, and returns the database and table name
+func (self *parser) tableName() (*database, string, error) {
+	name, err := self.ident()
+	if err != nil {
+		return nil, "", err
+	}
+	if !self.accept(".") {
+		return self.resolve(taosql.Name{Table: strings.ToLower(name)})
+	}
+	table, err := self.ident()
+	if err != nil {
+		return nil, "", err
+	}
+	return self.resolve(taosql.Name{Database: strings.ToLower(name), Table: strings.ToLower(table)})
+}
+
+// resolve returns the database and table name of 'name'
+func (self *parser) resolve(name taosql.Name) (*database, string, error) {
+	dbname := name.Database
+	if dbname == "" {
+		dbname = self.sess.db
+	}
+	if dbname == "" {
+		return nil, "", errNoDatabase
+	}
+	db, ok := global.databases[strings.ToLower(dbname)]
+	if !ok {
+		return nil, "", errInvalidDB
+	}
+	self.db = db
+	if self.now == 0 {
+		self.now = db.now()
+	}
+	return db, name.Table, nil
+}
+
+func (self *parser) done() error {
+	if t := self.peek(); t.Kind != tEOF {
+		return errSyntax("unexpected " + t.Text)
+	}
+	return nil
+}
+
+// execute runs one statement. It returns the result set of a query,
+// or the number of affected rows.
+func execute(sess *session, query string) (*resultSet, int64, error) {
+	if err := fault(query); err != nil {
+		return nil, 0, err
+	}
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	global.Lock()
+	defer global.Unlock()
+
+	p := &parser{tokens: tokens, sess: sess}
+	t := p.next()
+	switch {
+	case t.Is("CREATE"):
+		if p.accept("DATABASE") {
+			return nil, 0, p.createDatabase()
+		}
+		if v3() && p.accept("INDEX") {
+			return nil, 0, p.createIndex()
+		}
+		super := p.accept("STABLE")
+		if !super {
+			if err := p.expect("TABLE"); err != nil {
+				return nil, 0, err
+			}
+		}
+		return nil, 0, p.createTable(super)
+	case t.Is("DROP"):
+		if p.accept("DATABASE") {
+			return nil, 0, p.dropDatabase()
+		}
+		if !p.accept("STABLE") {
+			if err := p.expect("TABLE"); err != nil {
+				return nil, 0, err
+			}
+		}
+		return nil, 0, p.dropTable()
+	case t.Is("ALTER"):
+		if err := p.expect("DATABASE"); err != nil {
+			return nil, 0, err
+		}
+		return nil, 0, p.alterDatabase()
+	case t.Is("USE"):
+		name, err := p.ident()
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, ok := global.databases[strings.ToLower(name)]; !ok {
+			return nil, 0, errInvalidDB
+		}
+		sess.setDB(strings.ToLower(name))
+		return nil, 0, p.done()
+	case t.Is("INSERT"):
+		n, err := p.insert()
+		return nil, n, err
+	case t.Is("DELETE") && v3():
+		n, err := p.deleteRows()
+		return nil, n, err
+	case t.Is("SELECT"):
+		rs, err := p.selectStatement()
+		return rs, 0, err
+	case t.Is("DESCRIBE") || t.Is("DESC"):
+		rs, err := p.describe()
+		return rs, 0, err
+	case t.Is("SHOW"):
+		rs, err := p.show()
+		return rs, 0, err
+	default:
+	}
+	return nil, 0, errSyntax("unsupported statement " + t.Text)
+}
+
+// dbOptions reads options like PRECISION "us" KEEP 365 UPDATE 1
+func (self *parser) dbOptions() (map[string]string, error) {
+	options := make(map[string]string)
+	for self.peek().Kind == tIdent {
+		key := strings.ToLower(self.next().Text)
+		t := self.next()
+		if t.Kind != tNumber && t.Kind != tString && t.Kind != tIdent {
+			return nil, errSyntax("invalid option " + key)
+		}
+		options[key] = strings.ToLower(t.Text)
+	}
+	if p, ok := options["precision"]; ok && p != "ms" && p != "us" && p != "ns" {
+		return nil, errSyntax("invalid precision " + p)
+	}
+	// 3.x has DURATION for DAYS, and no BLOCKS and UPDATE
+	for _, key := range []string{"days", "blocks", "update", "duration"} {
+		if _, ok := options[key]; ok && (key == "duration") != v3() {
+			return nil, errSyntax("invalid option " + key)
+		}
+	}
+	return options, self.done()
+}
+
+func (self *parser) createDatabase() error {
+	ifNot := self.accept("IF", "NOT", "EXISTS")
+	name, err := self.ident()
+	if err != nil {
+		return err
+	}
+	name = strings.ToLower(name)
+	options, err := self.dbOptions()
+	if err != nil {
+		return err
+	}
+	if _, ok := global.databases[name]; ok {
+		if ifNot {
+			return nil
+		}
+		return errDBExists
+	}
+	global.create(name, options)
+	return nil
+}
+
+func (self *parser) alterDatabase() error {
+	name, err := self.ident()
+	if err != nil {
+		return err
+	}
+	db, ok := global.databases[strings.ToLower(name)]
+	if !ok {
+		return errInvalidDB
+	}
+	options, err := self.dbOptions()
+	if err != nil {
+		return err
+	}
+	if _, ok := options["precision"]; ok {
+		return errSyntax("precision can not be altered")
+	}
+	for k, v := range options {
+		db.options[k] = v
+		if k == "update" {
+			db.update = v == "1"
+		}
+	}
+	return nil
+}
+
+func (self *parser) dropDatabase() error {
+	ifExists := self.accept("IF", "EXISTS")
+	name, err := self.ident()
+	if err != nil {
+		return err
+	}
+	name = strings.ToLower(name)
+	if err := self.done(); err != nil {
+		return err
+	}
+	if _, ok := global.databases[name]; !ok {
+		if ifExists {
+			return nil
+		}
+		return errInvalidDB
+	}
+	delete(global.databases, name)
+	if self.sess.currentDB() == name {
+		self.sess.setDB("")
+	}
+	return nil
+}
+
+// value evaluates the tokens of a value in the statement
+func (self *parser) value(tokens []token) (interface{}, error) {
+	saved, pos := self.tokens, self.pos
+	defer func() { self.tokens, self.pos = saved, pos }()
+	self.tokens, self.pos = append(append([]token{}, tokens...), token{Kind: tEOF}), 0
+	e, err := self.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := self.done(); err != nil {
+		return nil, err
+	}
+	return e.eval(nil)
+}
+
+// child returns the child table of 'using' in 'db', creating it with
+// tag values if it does not exist.
+func (self *parser) child(db *database, using *taosql.Using) (*table, error) {
+	st, ok := db.tables[using.Stable.Table]
+	if !ok {
+		return nil, errNoTable
+	}
+	if !st.isSuper() {
+		return nil, errNotSuper
+	}
+	name := using.Table.Table
+	if t := db.table(name); t != nil {
+		if t.stable != st {
+			return nil, errTableExists
+		}
+		return t, nil
+	}
+	positions := make([]int, 0)
+	for i := range st.tags {
+		positions = append(positions, i)
+	}
+	if len(using.Tags) > 0 {
+		positions = positions[:0]
+		for _, tag := range using.Tags {
+			found := -1
+			for i, c := range st.tags {
+				if c.name == tag {
+					found = i
+				}
+			}
+			if found < 0 {
+				return nil, errSyntax("invalid tag name " + tag)
+			}
+			positions = append(positions, found)
+		}
+	}
+	if len(using.Values) != len(positions) {
+		return nil, errSyntax("tags number not matched")
+	}
+	tagValues := make([]interface{}, len(st.tags))
+	for i, tokens := range using.Values {
+		v, err := self.value(tokens)
+		if err != nil {
+			return nil, err
+		}
+		cv, err := coerce(st.tags[positions[i]], v, db.precision)
+		if err != nil {
+			return nil, err
+		}
+		tagValues[positions[i]] = cv
+	}
+	t := &table{name: name, stable: st, tagValues: tagValues, created: self.now}
+	st.children[name] = t
+	return t, nil
+}
+
+func (self *parser) createTable(super bool) error {
+	create, err := taosql.ParseCreateTable(self.tokens[self.pos:], super)
+	if err != nil {
+		return err
+	}
+	self.pos = len(self.tokens) - 1
+	for _, using := range create.Children {
+		db, name, err := self.resolve(using.Table)
+		if err != nil {
+			return err
+		}
+		if !create.IfNotExists && db.table(name) != nil {
+			return errTableExists
+		}
+		if _, err := self.child(db, using); err != nil {
+			return err
+		}
+	}
+	if len(create.Children) > 0 {
+		return nil
+	}
+
+	db, name, err := self.resolve(create.Table)
+	if err != nil {
+		return err
+	}
+	columns, err := definitions(create.Columns)
+	if err != nil {
+		return err
+	}
+	tags, err := definitions(create.Tags)
+	if err != nil {
+		return err
+	}
+	if db.table(name) != nil {
+		if create.IfNotExists {
+			return nil
+		}
+		return errTableExists
+	}
+	t := &table{name: name, columns: columns, created: self.now}
+	if len(tags) > 0 {
+		t.tags = tags
+		t.children = make(map[string]*table)
+	}
+	db.tables[name] = t
+	return nil
+}
+
+func (self *parser) dropTable() error {
+	ifExists := self.accept("IF", "EXISTS")
+	db, name, err := self.tableName()
+	if err != nil {
+		return err
+	}
+	if err := self.done(); err != nil {
+		return err
+	}
+	t := db.table(name)
+	if t == nil {
+		if ifExists {
+			return nil
+		}
+		return errNoTable
+	}
+	if t.stable != nil {
+		delete(t.stable.children, name)
+	} else {
+		delete(db.tables, name)
+	}
+	return nil
+}
+
+// createIndex runs CREATE INDEX name ON st (tag), which changes nothing
+func (self *parser) createIndex() error {
+	if _, err := self.ident(); err != nil {
+		return err
+	}
+	if err := self.expect("ON"); err != nil {
+		return err
+	}
+	db, name, err := self.tableName()
+	if err != nil {
+		return err
+	}
+	if err := self.expect("("); err != nil {
+		return err
+	}
+	tag, err := self.ident()
+	if err != nil {
+		return err
+	}
+	if err := self.expect(")"); err != nil {
+		return err
+	}
+	if err := self.done(); err != nil {
+		return err
+	}
+	t := db.table(name)
+	if t == nil {
+		return errNoTable
+	}
+	if !t.isSuper() {
+		return errNotSuper
+	}
+	for _, c := range t.tags {
+		if c.name == strings.ToLower(tag) {
+			return nil
+		}
+	}
+	return errSyntax("invalid tag name " + tag)
+}
+
+// deleteRows runs DELETE FROM t [WHERE ...], on child tables of super table t
+func (self *parser) deleteRows() (int64, error) {
+	if err := self.expect("FROM"); err != nil {
+		return 0, err
+	}
+	db, name, err := self.tableName()
+	if err != nil {
+		return 0, err
+	}
+	var where expr
+	if self.accept("WHERE") {
+		if where, err = self.parseExpr(); err != nil {
+			return 0, err
+		}
+	}
+	if err := self.done(); err != nil {
+		return 0, err
+	}
+	t := db.table(name)
+	if t == nil {
+		return 0, errNoTable
+	}
+	tables := []*table{t}
+	if t.isSuper() {
+		tables = make([]*table, 0)
+		for _, child := range t.children {
+			tables = append(tables, child)
+		}
+	}
+
+	all, names, _ := source(db, t)
+	r := &record{names: names, columns: all, precision: db.precision}
+	affected := int64(0)
+	for _, child := range tables {
+		kept := make([][]interface{}, 0, len(child.rows))
+		for _, row := range child.rows {
+			ok := true
+			if where != nil {
+				r.values = append(append(append([]interface{}{}, row...), child.tagValues...), child.name)
+				v, err := where.eval(r)
+				if err != nil {
+					return affected, err
+				}
+				ok, _ = v.(bool)
+			}
+			if ok {
+				affected++
+			} else {
+				kept = append(kept, row)
+			}
+		}
+		child.rows = kept
+	}
+	return affected, nil
+}
+
+// insert runs INSERT INTO t1 [USING st TAGS (...)] [(cols)] VALUES (...) (...) [t2 ...]
+func (self *parser) insert() (int64, error) {
+	inserts, err := taosql.ParseInsert(self.tokens[self.pos:])
+	if err != nil {
+		return 0, err
+	}
+	self.pos = len(self.tokens) - 1
+	affected := int64(0)
+	for _, insert := range inserts {
+		db, name, err := self.resolve(insert.Table)
+		if err != nil {
+			return affected, err
+		}
+		var t *table
+		if insert.Using != nil {
+			if t, err = self.child(db, insert.Using); err != nil {
+				return affected, err
+			}
+		} else if t = db.table(name); t == nil {
+			return affected, errNoTable
+		}
+		if t.isSuper() {
+			return affected, errSyntax("insert data into super table is not supported")
+		}
+		columns, _ := t.schema()
+
+		positions := make([]int, 0)
+		for i := range columns {
+			positions = append(positions, i)
+		}
+		if len(insert.Columns) > 0 {
+			positions = positions[:0]
+			for _, cname := range insert.Columns {
+				found := -1
+				for i, c := range columns {
+					if c.name == cname {
+						found = i
+					}
+				}
+				if found < 0 {
+					return affected, errSyntax("invalid column name " + cname)
+				}
+				positions = append(positions, found)
+			}
+		}
+
+		for _, values := range insert.Rows {
+			if len(values) != len(positions) {
+				return affected, errSyntax("illegal number of columns")
+			}
+			row := make([]interface{}, len(columns))
+			for i, tokens := range values {
+				v, err := self.value(tokens)
+				if err != nil {
+					return affected, err
+				}
+				cv, err := coerce(columns[positions[i]], v, db.precision)
+				if err != nil {
+					return affected, err
+				}
+				row[positions[i]] = cv
+			}
+			if row[0] == nil {
+				return affected, errSyntax("primary timestamp column can not be null")
+			}
+			if t.insert(row, db.update) {
+				affected++
+			}
+		}
+	}
+	return affected, nil
+}
+
+// describe returns Field, Type, Length and Note of columns
+func (self *parser) describe() (*resultSet, error) {
+	db, name, err := self.tableName()
+	if err != nil {
+		return nil, err
+	}
+	if err := self.done(); err != nil {
+		return nil, err
+	}
+	t := db.table(name)
+	if t == nil {
+		return nil, errNoTable
+	}
+	rs := &resultSet{columns: []*column{
+		{name: "Field", typ: "BINARY", length: 64},
+		{name: "Type", typ: "BINARY", length: 16},
+		{name: "Length", typ: "INT", length: 4},
+		{name: "Note", typ: "BINARY", length: 16},
+	}}
+	columns, tags := t.schema()
+	for _, c := range columns {
+		rs.rows = append(rs.rows, []interface{}{c.name, c.typeName(), int64(c.length), ""})
+	}
+	for _, c := range tags {
+		rs.rows = append(rs.rows, []interface{}{c.name, c.typeName(), int64(c.length), "TAG"})
+	}
+	return rs, nil
+}
+
+// show supports SHOW DATABASES, SHOW TABLES and SHOW STABLES
+func (self *parser) show() (*resultSet, error) {
+	what, err := taosql.ParseShow(self.tokens[self.pos:])
+	if err != nil {
+		return nil, err
+	}
+	if what == "DATABASES" {
+		names := make([]string, 0)
+		for name := range global.databases {
+			names = append(names, name)
+		}
+		sortStrings(names)
+		dbs := make([]*taosql.Database, 0)
+		for _, name := range names {
+			db := global.databases[name]
+			n := int64(0)
+			for _, t := range db.tables {
+				if t.isSuper() {
+					n += int64(len(t.children))
+				} else {
+					n++
+				}
+			}
+			days := optionInt(db.options, "days", 10)
+			if v3() {
+				days = optionInt(db.options, "duration", 10)
+			}
+			update := int64(0)
+			if db.update {
+				update = 1
+			}
+			dbs = append(dbs, &taosql.Database{Name: name, Created: db.created, Tables: n,
+				Replica: optionInt(db.options, "replica", 1), Days: days, Keep: optionInt(db.options, "keep", 3650),
+				Blocks: optionInt(db.options, "blocks", 6), Precision: db.precision, Update: update})
+		}
+		columns, rows := taosql.ShowDatabases(dbs, v3())
+		return &resultSet{columns: columnsOf(columns), rows: rows, precision: "ms"}, nil
+	}
+
+	super := what == "STABLES"
+	db, ok := global.databases[self.sess.currentDB()]
+	if !ok {
+		return nil, errNoDatabase
+	}
+	names := make([]string, 0)
+	for name := range db.tables {
+		names = append(names, name)
+	}
+	sortStrings(names)
+	tables := make([]*taosql.Table, 0)
+	for _, name := range names {
+		t := db.tables[name]
+		if super {
+			if t.isSuper() {
+				tables = append(tables, &taosql.Table{Name: name, Created: t.created, Columns: int64(len(t.columns)),
+					Tags: int64(len(t.tags)), Children: int64(len(t.children))})
+			}
+			continue
+		}
+		if !t.isSuper() {
+			tables = append(tables, &taosql.Table{Name: name, Created: t.created, Columns: int64(len(t.columns))})
+			continue
+		}
+		children := make([]string, 0)
+		for c := range t.children {
+			children = append(children, c)
+		}
+		sortStrings(children)
+		for _, c := range children {
+			tables = append(tables, &taosql.Table{Name: c, Created: t.children[c].created, Columns: int64(len(t.columns)), Stable: name})
+		}
+	}
+	// 3.x names the column of super tables stable_name
+	label := "name"
+	if v3() {
+		label = "stable_name"
+	}
+	columns, rows := taosql.ShowTables(tables, super, label)
+	return &resultSet{columns: columnsOf(columns), rows: rows, precision: db.precision}, nil
+}
+
+// columnsOf returns the columns of a result set
+func columnsOf(columns []*taosql.Column) []*column {
+	cs := make([]*column, len(columns))
+	for i, c := range columns {
+		cs[i] = &column{name: c.Name, typ: c.Type, length: c.Length}
+	}
+	return cs
+}
+
+func option(options map[string]string, key, dft string) string {
+	if v, ok := options[key]; ok {
+		return v
+	}
+	return dft
+}
+
+func optionInt(options map[string]string, key string, dft int64) int64 {
+	if v, err := strconv.ParseInt(option(options, key, ""), 10, 64); err == nil {
+		return v
+	}
+	return dft
+}
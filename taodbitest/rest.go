@@ -0,0 +1,152 @@
+package taodbitest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RESTHandler serves the REST interface of TDengine, POST /rest/sql or
+// /rest/sql/database with the statement in body, on the databases in
+// memory. Responses are in the format of Version, 2.x or 3.x. If User
+// is not empty, requests must authenticate with User and Password.
+type RESTHandler struct {
+	User     string
+	Password string
+}
+
+// restCodes are the TDengine codes of errors
+var restCodes = map[error]int{
+	errNoTable:      0x0362,
+	errTableExists:  0x0360,
+	errNotSuper:     0x0363,
+	errNoDatabase:   0x0380,
+	errInvalidDB:    0x0381,
+	errDBExists:     0x0383,
+	errStringLength: 0x0200,
+}
+
+// restTypes are the type codes of column_meta in 2.x
+var restTypes = map[string]int{
+	"BOOL":      1,
+	"TINYINT":   2,
+	"SMALLINT":  3,
+	"INT":       4,
+	"BIGINT":    5,
+	"FLOAT":     6,
+	"DOUBLE":    7,
+	"BINARY":    8,
+	"TIMESTAMP": 9,
+	"NCHAR":     10,
+}
+
+func (self *RESTHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, "/rest/sql") {
+		http.NotFound(w, r)
+		return
+	}
+	if self.User != "" {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != self.User || password != self.Password {
+			self.fail(w, http.StatusUnauthorized, 0x0357, "Authentication failure")
+			return
+		}
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		self.fail(w, http.StatusBadRequest, 0x0200, err.Error())
+		return
+	}
+
+	sess := &session{}
+	if db := strings.Trim(strings.TrimPrefix(r.URL.Path, "/rest/sql"), "/"); db != "" {
+		global.Lock()
+		_, ok := global.databases[strings.ToLower(db)]
+		global.Unlock()
+		if !ok {
+			self.fail(w, http.StatusOK, 0x0381, errInvalidDB.Error())
+			return
+		}
+		sess.db = strings.ToLower(db)
+	}
+
+	rs, n, err := execute(sess, string(body))
+	if err != nil {
+		code, ok := restCodes[err]
+		if !ok {
+			code = 0x0200
+		}
+		self.fail(w, http.StatusOK, code, err.Error())
+		return
+	}
+	if rs == nil {
+		rs = &resultSet{columns: []*column{{name: "affected_rows", typ: "INT", length: 4}}, rows: [][]interface{}{{n}}}
+	}
+
+	head := make([]string, len(rs.columns))
+	meta := make([][]interface{}, len(rs.columns))
+	for i, c := range rs.columns {
+		head[i] = c.name
+		if v3() {
+			meta[i] = []interface{}{c.name, c.typeName(), c.length}
+		} else {
+			meta[i] = []interface{}{c.name, restTypes[c.typ], c.length}
+		}
+	}
+	data := make([][]interface{}, len(rs.rows))
+	for i, row := range rs.rows {
+		values := make([]interface{}, len(row))
+		for j, v := range row {
+			if v != nil && rs.columns[j].typ == "TIMESTAMP" {
+				v = restTime(v.(int64), rs.precision)
+			}
+			values[j] = v
+		}
+		data[i] = values
+	}
+	res := map[string]interface{}{"column_meta": meta, "data": data, "rows": len(data)}
+	if v3() {
+		res["code"] = 0
+	} else {
+		res["status"] = "succ"
+		res["head"] = head
+	}
+	self.write(w, http.StatusOK, res)
+}
+
+func (self *RESTHandler) fail(w http.ResponseWriter, status, code int, desc string) {
+	res := map[string]interface{}{"code": code, "desc": desc}
+	if !v3() {
+		res["status"] = "error"
+	}
+	self.write(w, status, res)
+}
+
+func (self *RESTHandler) write(w http.ResponseWriter, status int, res map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// restTime formats a timestamp as 2.x, like 2018-10-03 14:38:05.000 in
+// local time, or as 3.x in RFC3339, with digits of the precision.
+func restTime(ts int64, precision string) string {
+	var t time.Time
+	digits := "000"
+	switch precision {
+	case "ms":
+		t = time.Unix(ts/1000, ts%1000*int64(time.Millisecond))
+	case "us":
+		t = time.Unix(ts/1000000, ts%1000000*int64(time.Microsecond))
+		digits = "000000"
+	default:
+		t = time.Unix(0, ts)
+		digits = "000000000"
+	}
+	if v3() {
+		return t.Format("2006-01-02T15:04:05." + digits + "Z07:00")
+	}
+	return t.Format("2006-01-02 15:04:05." + digits)
+}
@@ -0,0 +1,719 @@
+package taodbitest
+
+import (
+	"sort"
+	"strings"
+)
+
+// resultSet is the output of a query. Values are stored as in tables,
+// and converted to the native driver's types in rows.
+type resultSet struct {
+	columns   []*column
+	rows      [][]interface{}
+	precision string
+}
+
+// selectItem is *, an aggregate function, or an expression
+type selectItem struct {
+	fn    string
+	star  bool
+	arg   expr
+	name  string
+	alias string
+}
+
+type orderItem struct {
+	key  expr
+	name string
+	desc bool
+}
+
+var aggregates = map[string]bool{"count": true, "last": true, "first": true, "last_row": true,
+	"max": true, "min": true, "sum": true, "avg": true}
+
+// text joins the original tokens from position start
+func (self *parser) text(start int) string {
+	parts := make([]string, 0)
+	for _, t := range self.tokens[start:self.pos] {
+		if t.Kind == tString {
+			parts = append(parts, "'"+t.Text+"'")
+		} else {
+			parts = append(parts, strings.ToLower(t.Text))
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func (self *parser) selectItem() (*selectItem, error) {
+	if self.accept("*") {
+		return &selectItem{star: true}, nil
+	}
+	item := &selectItem{}
+	t := self.peek()
+	if t.Kind == tIdent && aggregates[strings.ToLower(t.Text)] && self.tokens[self.pos+1].Is("(") {
+		self.pos += 2
+		item.fn = strings.ToLower(t.Text)
+		start := self.pos
+		if self.accept("*") {
+			item.star = true
+		} else {
+			arg, err := self.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item.arg = arg
+		}
+		item.name = item.fn + "(" + self.text(start) + ")"
+		if err := self.expect(")"); err != nil {
+			return nil, err
+		}
+	} else {
+		start := self.pos
+		arg, err := self.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		item.arg = arg
+		item.name = self.text(start)
+	}
+	if self.accept("AS") {
+		alias, err := self.ident()
+		if err != nil {
+			return nil, err
+		}
+		item.alias = alias
+	} else if t := self.peek(); t.Kind == tIdent && !t.Is("FROM") {
+		item.alias = self.next().Text
+	}
+	return item, nil
+}
+
+// source returns columns and records of a table. Tags of a super
+// or child table follow the data columns, and then tbname.
+// Records of a normal table are the rows themselves, not to be changed.
+func source(db *database, t *table) ([]*column, map[string]int, [][]interface{}) {
+	columns, tags := t.schema()
+	all := append(append(append([]*column{}, columns...), tags...), &column{name: "tbname", typ: "BINARY", length: 192})
+	names := make(map[string]int)
+	for i, c := range all {
+		names[c.name] = i
+	}
+	if tags == nil {
+		// tbname is out of row, and evaluated to NULL
+		return all, names, t.rows
+	}
+	rows := make([][]interface{}, 0)
+	add := func(child *table) {
+		for _, row := range child.rows {
+			values := make([]interface{}, 0, len(all))
+			values = append(append(append(values, row...), child.tagValues...), child.name)
+			rows = append(rows, values)
+		}
+	}
+	if t.isSuper() {
+		children := make([]string, 0)
+		for name := range t.children {
+			children = append(children, name)
+		}
+		sortStrings(children)
+		for _, name := range children {
+			add(t.children[name])
+		}
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i][0].(int64) < rows[j][0].(int64) })
+	} else {
+		add(t)
+	}
+	return all, names, rows
+}
+
+func (self *parser) selectStatement() (*resultSet, error) {
+	items := make([]*selectItem, 0)
+	for {
+		item, err := self.selectItem()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if !self.accept(",") {
+			break
+		}
+	}
+	if self.peek().Kind == tEOF {
+		return constants(items)
+	}
+	if err := self.expect("FROM"); err != nil {
+		return nil, err
+	}
+	db, name, err := self.tableName()
+	if err != nil {
+		return nil, err
+	}
+	t := db.table(name)
+	if t == nil {
+		return nil, errNoTable
+	}
+
+	var where expr
+	if self.accept("WHERE") {
+		if where, err = self.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	groups := make([]string, 0)
+	groupBy := func() error {
+		for {
+			g, err := self.ident()
+			if err != nil {
+				return err
+			}
+			groups = append(groups, strings.ToLower(g))
+			if !self.accept(",") {
+				return nil
+			}
+		}
+	}
+	// PARTITION BY of 3.x, before INTERVAL
+	if self.accept("PARTITION", "BY") {
+		if err := groupBy(); err != nil {
+			return nil, err
+		}
+	}
+	interval := int64(0)
+	if self.accept("INTERVAL", "(") {
+		t := self.next()
+		if t.Kind != tNumber {
+			return nil, errSyntax("invalid interval " + t.Text)
+		}
+		if interval, err = duration(t.Text, db.precision); err != nil {
+			return nil, err
+		}
+		if interval <= 0 {
+			return nil, errSyntax("invalid interval " + t.Text)
+		}
+		if err := self.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if self.accept("GROUP", "BY") {
+		if err := groupBy(); err != nil {
+			return nil, err
+		}
+	}
+	orders := make([]*orderItem, 0)
+	if self.accept("ORDER", "BY") {
+		for {
+			start := self.pos
+			key, err := self.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			o := &orderItem{key: key, name: self.text(start)}
+			if self.accept("DESC") {
+				o.desc = true
+			} else {
+				self.accept("ASC")
+			}
+			orders = append(orders, o)
+			if !self.accept(",") {
+				break
+			}
+		}
+	}
+	limit, offset := int64(-1), int64(0)
+	if self.accept("LIMIT") {
+		if limit, err = self.integer(); err != nil {
+			return nil, err
+		}
+		if self.accept(",") {
+			offset = limit
+			if limit, err = self.integer(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if self.accept("OFFSET") {
+		if offset, err = self.integer(); err != nil {
+			return nil, err
+		}
+	}
+	if err := self.done(); err != nil {
+		return nil, err
+	}
+
+	all, names, rows := source(db, t)
+	r := &record{names: names, columns: all, precision: db.precision}
+	filtered := rows
+	if where != nil {
+		filtered = make([][]interface{}, 0)
+		for _, row := range rows {
+			r.values = row
+			ok, err := where.eval(r)
+			if err != nil {
+				return nil, err
+			}
+			if b, _ := ok.(bool); b {
+				filtered = append(filtered, row)
+			}
+		}
+	}
+
+	aggregated := len(groups) > 0 || interval > 0
+	for _, item := range items {
+		if item.fn != "" {
+			aggregated = true
+		}
+	}
+
+	var rs *resultSet
+	if aggregated {
+		if rs, err = aggregate(r, items, groups, interval, filtered, t); err != nil {
+			return nil, err
+		}
+		if err := sortOutput(rs, orders); err != nil {
+			return nil, err
+		}
+	} else {
+		if filtered, err = sortRecords(r, filtered, orders); err != nil {
+			return nil, err
+		}
+		if rs, err = project(r, items, paginate(filtered, limit, offset), t); err != nil {
+			return nil, err
+		}
+	}
+	rs.precision = db.precision
+	if aggregated {
+		rs.rows = paginate(rs.rows, limit, offset)
+	}
+	return rs, nil
+}
+
+func paginate(rows [][]interface{}, limit, offset int64) [][]interface{} {
+	if offset > int64(len(rows)) {
+		offset = int64(len(rows))
+	}
+	rows = rows[offset:]
+	if limit >= 0 && limit < int64(len(rows)) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func (self *parser) integer() (int64, error) {
+	e, err := self.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	v, err := e.eval(nil)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return 0, errSyntax("invalid number in LIMIT or OFFSET")
+	}
+	return n, nil
+}
+
+// constants evaluates a SELECT without FROM
+func constants(items []*selectItem) (*resultSet, error) {
+	rs := &resultSet{precision: "ms"}
+	row := make([]interface{}, 0)
+	for _, item := range items {
+		if item.star || item.fn != "" {
+			return nil, errSyntax("no table specified")
+		}
+		v, err := item.arg.eval(nil)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, v)
+		rs.columns = append(rs.columns, inferred(item, v))
+	}
+	rs.rows = append(rs.rows, row)
+	return rs, nil
+}
+
+// inferred returns the output column of an expression from its value
+func inferred(item *selectItem, v interface{}) *column {
+	name := item.name
+	if item.alias != "" {
+		name = item.alias
+	}
+	c := &column{name: name, typ: "BIGINT", length: 8}
+	switch u := v.(type) {
+	case float64:
+		c.typ = "DOUBLE"
+	case bool:
+		c.typ, c.length = "BOOL", 1
+	case string:
+		c.typ, c.length = "BINARY", len(u)
+	default:
+	}
+	return c
+}
+
+func output(c *column, alias, name string) *column {
+	if alias != "" {
+		name = alias
+	}
+	return &column{name: name, typ: c.typ, length: c.length}
+}
+
+// sortRecords returns sorted rows in a new slice
+func sortRecords(r *record, rows [][]interface{}, orders []*orderItem) ([][]interface{}, error) {
+	if len(orders) == 0 {
+		return rows, nil
+	}
+	keys := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		r.values = row
+		for _, o := range orders {
+			v, err := o.key.eval(r)
+			if err != nil {
+				return nil, err
+			}
+			keys[i] = append(keys[i], v)
+		}
+	}
+	index := make([]int, len(rows))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		return less(keys[index[i]], keys[index[j]], orders)
+	})
+	sorted := make([][]interface{}, len(rows))
+	for i, k := range index {
+		sorted[i] = rows[k]
+	}
+	return sorted, nil
+}
+
+// less compares keys in order, where NULL is the smallest
+func less(a, b []interface{}, orders []*orderItem) bool {
+	for i, o := range orders {
+		var cmp int
+		switch {
+		case a[i] == nil && b[i] == nil:
+		case a[i] == nil:
+			cmp = -1
+		case b[i] == nil:
+			cmp = 1
+		default:
+			cmp, _ = compare(a[i], b[i])
+		}
+		if cmp == 0 {
+			continue
+		}
+		if o.desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	return false
+}
+
+func ascending(n int) []*orderItem {
+	orders := make([]*orderItem, n)
+	for i := range orders {
+		orders[i] = &orderItem{}
+	}
+	return orders
+}
+
+// project outputs rows of a query without aggregates
+func project(r *record, items []*selectItem, rows [][]interface{}, t *table) (*resultSet, error) {
+	columns, tags := t.schema()
+	width := len(columns)
+	if t.isSuper() {
+		width += len(tags)
+	}
+	rs := &resultSet{}
+	for _, item := range items {
+		if item.star {
+			for _, c := range r.columns[:width] {
+				rs.columns = append(rs.columns, output(c, "", c.name))
+			}
+		} else if c := columnOf(item.arg, r); c != nil {
+			rs.columns = append(rs.columns, output(c, item.alias, c.name))
+		} else {
+			rs.columns = append(rs.columns, nil)
+		}
+	}
+	for _, row := range rows {
+		r.values = row
+		values := make([]interface{}, 0, len(rs.columns))
+		for _, item := range items {
+			if item.star {
+				values = append(values, row[:width]...)
+				continue
+			}
+			v, err := item.arg.eval(r)
+			if err != nil {
+				return nil, err
+			}
+			if c := rs.columns[len(values)]; c == nil && v != nil {
+				rs.columns[len(values)] = inferred(item, v)
+			}
+			values = append(values, v)
+		}
+		rs.rows = append(rs.rows, values)
+	}
+	if len(rows) == 0 {
+		for _, item := range items {
+			if !item.star && item.arg != nil {
+				if _, err := item.arg.eval(r); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for i, c := range rs.columns {
+		if c == nil {
+			rs.columns[i] = inferred(items[i], nil)
+		}
+	}
+	return rs, nil
+}
+
+// aggregate outputs one row for each group, and for each window of
+// 'interval' in the group if it is not 0. Values of the group columns
+// follow those of the select items, and in 2.x the window start comes
+// first, as _wstart in 3.x.
+func aggregate(r *record, items []*selectItem, groups []string, interval int64, rows [][]interface{}, t *table) (*resultSet, error) {
+	columns, _ := t.schema()
+	gpos := make([]int, len(groups))
+	for i, g := range groups {
+		k, ok := r.names[g]
+		if !ok {
+			return nil, errSyntax("invalid group column " + g)
+		}
+		gpos[i] = k
+	}
+
+	type group struct {
+		key  []interface{}
+		rows [][]interface{}
+	}
+	list := make([]*group, 0)
+	if len(groups) == 0 && interval == 0 {
+		list = append(list, &group{rows: rows})
+	} else {
+		for _, row := range rows {
+			key := make([]interface{}, len(gpos))
+			for i, k := range gpos {
+				key[i] = row[k]
+			}
+			if interval > 0 {
+				ts := row[0].(int64)
+				key = append(key, ts-(ts%interval+interval)%interval)
+			}
+			var found *group
+			for _, g := range list {
+				if !less(g.key, key, ascending(len(key))) && !less(key, g.key, ascending(len(key))) {
+					found = g
+					break
+				}
+			}
+			if found == nil {
+				found = &group{key: key}
+				list = append(list, found)
+			}
+			found.rows = append(found.rows, row)
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			return less(list[i].key, list[j].key, ascending(len(list[i].key)))
+		})
+	}
+
+	// expand LAST(*) into data columns
+	expanded := make([]*selectItem, 0)
+	for _, item := range items {
+		if item.star && item.fn != "" && item.fn != "count" {
+			for _, c := range columns {
+				expanded = append(expanded, &selectItem{fn: item.fn, arg: &columnRef{name: c.name}, name: item.fn + "(" + c.name + ")"})
+			}
+			continue
+		}
+		if item.star && item.fn == "" {
+			return nil, errSyntax("* is not allowed with aggregate functions")
+		}
+		expanded = append(expanded, item)
+	}
+
+	rs := &resultSet{}
+	if interval > 0 && !v3() {
+		rs.columns = append(rs.columns, output(columns[0], "", columns[0].name))
+	}
+	for _, item := range expanded {
+		var c *column
+		switch {
+		case isWindow(item):
+			c = columns[0]
+		case item.fn == "count":
+			c = &column{typ: "BIGINT", length: 8}
+		case item.fn == "avg":
+			c = &column{typ: "DOUBLE", length: 8}
+		default:
+			if c = columnOf(item.arg, r); c == nil {
+				c = &column{typ: "DOUBLE", length: 8}
+			} else if item.fn == "sum" && c.typ != "FLOAT" && c.typ != "DOUBLE" {
+				c = &column{typ: "BIGINT", length: 8}
+			} else if item.fn == "sum" {
+				c = &column{typ: "DOUBLE", length: 8}
+			}
+		}
+		rs.columns = append(rs.columns, output(c, item.alias, item.name))
+	}
+	if v3() {
+		gpos = nil
+	}
+	for _, k := range gpos {
+		rs.columns = append(rs.columns, output(r.columns[k], "", r.columns[k].name))
+	}
+
+	onlyCount := true
+	for _, item := range expanded {
+		if item.fn != "count" {
+			onlyCount = false
+		}
+	}
+	for _, g := range list {
+		if len(g.rows) == 0 && !onlyCount {
+			continue
+		}
+		values := make([]interface{}, 0, len(rs.columns))
+		var window interface{}
+		if interval > 0 {
+			window = g.key[len(g.key)-1]
+			if !v3() {
+				values = append(values, window)
+			}
+		}
+		for _, item := range expanded {
+			if isWindow(item) {
+				values = append(values, window)
+				continue
+			}
+			v, err := reduce(r, item, g.rows)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		if gpos != nil {
+			values = append(values, g.key[:len(gpos)]...)
+		}
+		rs.rows = append(rs.rows, values)
+	}
+	return rs, nil
+}
+
+// isWindow tells if the item is _wstart, the window start of INTERVAL
+func isWindow(item *selectItem) bool {
+	c, ok := item.arg.(*columnRef)
+	return ok && item.fn == "" && strings.ToLower(c.name) == "_wstart"
+}
+
+// reduce computes an aggregate function over rows. NULLs are skipped.
+func reduce(r *record, item *selectItem, rows [][]interface{}) (interface{}, error) {
+	if item.fn == "" {
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		r.values = rows[len(rows)-1]
+		return item.arg.eval(r)
+	}
+	if item.fn == "count" && item.star {
+		return int64(len(rows)), nil
+	}
+	var result interface{}
+	count := int64(0)
+	sum := float64(0)
+	isum := int64(0)
+	for _, row := range rows {
+		r.values = row
+		v, err := item.arg.eval(r)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		count++
+		switch item.fn {
+		case "first":
+			if result == nil {
+				result = v
+			}
+		case "last", "last_row":
+			result = v
+		case "max":
+			if cmp, _ := compare(v, result); result == nil || cmp > 0 {
+				result = v
+			}
+		case "min":
+			if cmp, _ := compare(v, result); result == nil || cmp < 0 {
+				result = v
+			}
+		case "sum", "avg":
+			f, _ := toFloat(v)
+			sum += f
+			if n, ok := v.(int64); ok {
+				isum += n
+			}
+		default:
+		}
+	}
+	switch item.fn {
+	case "count":
+		return count, nil
+	case "sum":
+		if count == 0 {
+			return nil, nil
+		}
+		if c := columnOf(item.arg, r); c != nil && c.isInteger() {
+			return isum, nil
+		}
+		return sum, nil
+	case "avg":
+		if count == 0 {
+			return nil, nil
+		}
+		return sum / float64(count), nil
+	default:
+	}
+	return result, nil
+}
+
+// sortOutput sorts aggregated rows by output column names
+func sortOutput(rs *resultSet, orders []*orderItem) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	names := make(map[string]int)
+	for i, c := range rs.columns {
+		names[strings.ToLower(c.name)] = i
+	}
+	positions := make([]int, len(orders))
+	for i, o := range orders {
+		k, ok := names[o.name]
+		if !ok {
+			return errSyntax("invalid column in ORDER BY " + o.name)
+		}
+		positions[i] = k
+	}
+	sort.SliceStable(rs.rows, func(i, j int) bool {
+		a := make([]interface{}, len(positions))
+		b := make([]interface{}, len(positions))
+		for k, p := range positions {
+			a[k], b[k] = rs.rows[i][p], rs.rows[j][p]
+		}
+		return less(a, b, orders)
+	})
+	return nil
+}
+
+func sortStrings(names []string) {
+	sort.Strings(names)
+}
@@ -0,0 +1,310 @@
+package taodbitest
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/genelet/taodbi/internal/taosql"
+)
+
+// The error messages are those of TDengine 2.x
+var errSyntax = taosql.ErrSyntax
+
+var (
+	errNoTable      = errors.New("Table does not exist")
+	errTableExists  = errors.New("Table already exists")
+	errNoDatabase   = errors.New("Database not specified or available")
+	errDBExists     = errors.New("Database already exists")
+	errInvalidDB    = errors.New("Invalid database name")
+	errNotSuper     = errors.New("Invalid table type")
+	errStringLength = errors.New("invalid SQL: string data overflow")
+)
+
+type column struct {
+	name   string
+	typ    string
+	length int
+}
+
+// typeName is the type reported, VARCHAR for BINARY in 3.x
+func (self *column) typeName() string {
+	if self.typ == "BINARY" && v3() {
+		return "VARCHAR"
+	}
+	return self.typ
+}
+
+func (self *column) isString() bool {
+	return self.typ == "BINARY" || self.typ == "NCHAR"
+}
+
+func (self *column) isInteger() bool {
+	switch self.typ {
+	case "TINYINT", "SMALLINT", "INT", "BIGINT", "TIMESTAMP":
+		return true
+	default:
+	}
+	return false
+}
+
+// table is a normal table, a super table with tags,
+// or a child table with its super table and tag values.
+type table struct {
+	name      string
+	columns   []*column
+	tags      []*column
+	stable    *table
+	tagValues []interface{}
+	children  map[string]*table
+	rows      [][]interface{}
+	created   int64
+}
+
+func (self *table) isSuper() bool {
+	return self.tags != nil && self.stable == nil
+}
+
+// schema returns the data columns and the tags
+func (self *table) schema() ([]*column, []*column) {
+	if self.stable != nil {
+		return self.stable.columns, self.stable.tags
+	}
+	return self.columns, self.tags
+}
+
+// insert puts one row in order of the timestamp in the first column.
+// A row of existing timestamp is discarded, or replaces the old one if update.
+func (self *table) insert(row []interface{}, update bool) bool {
+	ts := row[0].(int64)
+	i := sort.Search(len(self.rows), func(i int) bool { return self.rows[i][0].(int64) >= ts })
+	if i < len(self.rows) && self.rows[i][0].(int64) == ts {
+		if !update {
+			return false
+		}
+		for j, v := range row {
+			if v != nil {
+				self.rows[i][j] = v
+			}
+		}
+		return true
+	}
+	self.rows = append(self.rows, nil)
+	copy(self.rows[i+1:], self.rows[i:])
+	self.rows[i] = row
+	return true
+}
+
+type database struct {
+	name      string
+	precision string
+	update    bool
+	options   map[string]string
+	tables    map[string]*table
+	lastNow   int64
+	created   int64
+}
+
+func (self *database) now() int64 {
+	t := time.Now().UnixNano()
+	switch self.precision {
+	case "ms":
+		t /= int64(time.Millisecond)
+	case "us":
+		t /= int64(time.Microsecond)
+	default:
+	}
+	if t <= self.lastNow {
+		t = self.lastNow + 1
+	}
+	self.lastNow = t
+	return t
+}
+
+// table finds a normal, super or child table
+func (self *database) table(name string) *table {
+	name = strings.ToLower(name)
+	if t, ok := self.tables[name]; ok {
+		return t
+	}
+	for _, t := range self.tables {
+		if c, ok := t.children[name]; ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// server holds all databases in memory
+type server struct {
+	sync.Mutex
+	databases map[string]*database
+}
+
+var global = &server{databases: make(map[string]*database)}
+
+// Reset drops all databases in memory, and removes the fault.
+func Reset() {
+	global.Lock()
+	global.databases = make(map[string]*database)
+	global.Unlock()
+	SetFault(nil)
+}
+
+func (self *server) create(name string, options map[string]string) *database {
+	db := &database{name: name, precision: "ms", options: options, tables: make(map[string]*table), created: time.Now().UnixNano() / int64(time.Millisecond)}
+	if p, ok := options["precision"]; ok {
+		db.precision = p
+	}
+	if u, ok := options["update"]; ok {
+		db.update = u == "1"
+	}
+	if v3() { // rows of existing timestamps are always updated
+		db.update = true
+	}
+	self.databases[name] = db
+	return db
+}
+
+// coerce converts a value to the type of column.
+// Timestamps are int64 in the precision, and integers int64.
+func coerce(c *column, v interface{}, precision string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch c.typ {
+	case "TIMESTAMP":
+		switch u := v.(type) {
+		case int64:
+			return u, nil
+		case float64:
+			return int64(u), nil
+		case string:
+			return parseTime(u, precision)
+		default:
+		}
+	case "BOOL":
+		switch u := v.(type) {
+		case bool:
+			return u, nil
+		case int64:
+			return u != 0, nil
+		case float64:
+			return u != 0, nil
+		case string:
+			return strconv.ParseBool(u)
+		default:
+		}
+	case "TINYINT", "SMALLINT", "INT", "BIGINT":
+		switch u := v.(type) {
+		case int64:
+			return u, nil
+		case float64:
+			return int64(u), nil
+		case bool:
+			if u {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case string:
+			return strconv.ParseInt(u, 10, 64)
+		default:
+		}
+	case "FLOAT", "DOUBLE":
+		switch u := v.(type) {
+		case int64:
+			return float64(u), nil
+		case float64:
+			return u, nil
+		case string:
+			return strconv.ParseFloat(u, 64)
+		default:
+		}
+	case "BINARY", "NCHAR":
+		s := ""
+		switch u := v.(type) {
+		case string:
+			s = u
+		case int64:
+			s = strconv.FormatInt(u, 10)
+		case float64:
+			s = strconv.FormatFloat(u, 'g', -1, 64)
+		case bool:
+			s = strconv.FormatBool(u)
+		default:
+		}
+		n := len(s)
+		if c.typ == "NCHAR" {
+			n = len([]rune(s))
+		}
+		if n > c.length {
+			return nil, errStringLength
+		}
+		return s, nil
+	default:
+	}
+	return nil, errSyntax("invalid value for " + c.name)
+}
+
+var timeFormats = []string{"2006-01-02 15:04:05.999999999", "2006-01-02 15:04:05", "2006-01-02T15:04:05.999999999Z07:00", "2006-01-02"}
+
+func parseTime(s, precision string) (int64, error) {
+	for _, f := range timeFormats {
+		if t, err := time.ParseInLocation(f, s, time.Local); err == nil {
+			switch precision {
+			case "ms":
+				return t.UnixNano() / int64(time.Millisecond), nil
+			case "us":
+				return t.UnixNano() / int64(time.Microsecond), nil
+			default:
+			}
+			return t.UnixNano(), nil
+		}
+	}
+	return 0, errSyntax("invalid timestamp " + s)
+}
+
+// definitions checks the columns of CREATE TABLE
+func definitions(defs []*taosql.Column) ([]*column, error) {
+	columns := make([]*column, len(defs))
+	for i, def := range defs {
+		c := &column{name: def.Name, typ: def.Type}
+		switch c.typ {
+		case "INTEGER":
+			c.typ = "INT"
+		case "VARCHAR":
+			c.typ = "BINARY"
+		case "TIMESTAMP", "BOOL", "TINYINT", "SMALLINT", "INT", "BIGINT", "FLOAT", "DOUBLE", "BINARY", "NCHAR":
+		default:
+			return nil, errSyntax("invalid data type " + def.Type)
+		}
+		switch {
+		case c.isString() && def.Length > 0:
+			c.length = def.Length
+		case c.isString():
+			return nil, errSyntax("invalid length of " + def.Name)
+		case def.Length > 0:
+			return nil, errSyntax("invalid data type " + def.Type)
+		default:
+			c.length = typeLength(c.typ)
+		}
+		columns[i] = c
+	}
+	return columns, nil
+}
+
+func typeLength(typ string) int {
+	switch typ {
+	case "BOOL", "TINYINT":
+		return 1
+	case "SMALLINT":
+		return 2
+	case "INT", "FLOAT":
+		return 4
+	default:
+	}
+	return 8
+}
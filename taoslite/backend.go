@@ -0,0 +1,431 @@
+package taoslite
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/genelet/taodbi/internal/taosql"
+	_ "modernc.org/sqlite"
+)
+
+var errSyntax = taosql.ErrSyntax
+
+// errors as the messages of TDengine
+var (
+	errNoTable      = errors.New("Table does not exist")
+	errTableExists  = errors.New("Table already exists")
+	errNoDatabase   = errors.New("Database not specified or available")
+	errDBExists     = errors.New("Database already exists")
+	errInvalidDB    = errors.New("Invalid database name")
+	errNotSuper     = errors.New("Invalid table type")
+	errStringLength = errors.New("invalid SQL: string data overflow")
+)
+
+// catalog is the SQL of the tables describing databases and tables
+var catalog = []string{
+	`CREATE TABLE IF NOT EXISTS _taos_databases (name TEXT PRIMARY KEY, precision TEXT NOT NULL, created INTEGER NOT NULL,
+keep INTEGER NOT NULL, days INTEGER NOT NULL, replica INTEGER NOT NULL, blocks INTEGER NOT NULL, update_mode INTEGER NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS _taos_tables (db TEXT NOT NULL, name TEXT NOT NULL, kind TEXT NOT NULL,
+stable TEXT NOT NULL, tags TEXT NOT NULL, created INTEGER NOT NULL, PRIMARY KEY (db, name))`,
+}
+
+// backend is a SQLite database holding all TDengine databases. It has
+// one connection, locked by each statement.
+type backend struct {
+	sync.Mutex
+	db      *sql.DB
+	lastNow map[string]int64
+}
+
+var backends = struct {
+	sync.Mutex
+	m map[string]*backend
+}{m: make(map[string]*backend)}
+
+// openBackend opens the data in directory 'dir', or in memory if empty
+func openBackend(dir string) (*backend, error) {
+	if dir != "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		dir = abs
+	}
+	backends.Lock()
+	defer backends.Unlock()
+	if b, ok := backends.m[dir]; ok {
+		return b, nil
+	}
+
+	name := ":memory:"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		name = filepath.Join(dir, "taoslite.db")
+	}
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	for _, s := range catalog {
+		if _, err := db.Exec(s); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	b := &backend{db: db, lastNow: make(map[string]int64)}
+	backends.m[dir] = b
+	return b, nil
+}
+
+// now returns the current time in 'precision', increasing
+func (self *backend) now(precision string) int64 {
+	t := toPrecision(time.Now(), precision)
+	if t <= self.lastNow[precision] {
+		t = self.lastNow[precision] + 1
+	}
+	self.lastNow[precision] = t
+	return t
+}
+
+type database struct {
+	name      string
+	precision string
+	created   int64
+	keep      int64
+	days      int64
+	replica   int64
+	blocks    int64
+	update    int64
+}
+
+// database reads database 'name', or nil if not found
+func (self *backend) database(name string) (*database, error) {
+	d := &database{name: name}
+	err := self.db.QueryRow(`SELECT precision, created, keep, days, replica, blocks, update_mode FROM _taos_databases WHERE name=?`, name).
+		Scan(&d.precision, &d.created, &d.keep, &d.days, &d.replica, &d.blocks, &d.update)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+func optionInt(options map[string]string, key string, value int64) (int64, error) {
+	s, ok := options[key]
+	if !ok {
+		return value, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errSyntax("invalid " + key + " " + s)
+	}
+	return n, nil
+}
+
+// create creates database 'name' with the options in lower case
+func (self *backend) create(name string, options map[string]string, ifNotExists bool) error {
+	d, err := self.database(name)
+	if err != nil {
+		return err
+	}
+	if d != nil {
+		if ifNotExists {
+			return nil
+		}
+		return errDBExists
+	}
+	d = &database{name: name, precision: "ms", created: toPrecision(time.Now(), "ms")}
+	if p, ok := options["precision"]; ok {
+		if p != "ms" && p != "us" && p != "ns" {
+			return errSyntax("invalid precision " + p)
+		}
+		d.precision = p
+	}
+	for _, item := range []struct {
+		key   string
+		field *int64
+		value int64
+	}{{"keep", &d.keep, 3650}, {"days", &d.days, 10}, {"replica", &d.replica, 1}, {"blocks", &d.blocks, 6}, {"update", &d.update, 0}} {
+		if *item.field, err = optionInt(options, item.key, item.value); err != nil {
+			return err
+		}
+	}
+	_, err = self.db.Exec(`INSERT INTO _taos_databases VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.name, d.precision, d.created, d.keep, d.days, d.replica, d.blocks, d.update)
+	return err
+}
+
+// alter changes options of database 'name'
+func (self *backend) alter(name string, options map[string]string) error {
+	d, err := self.database(name)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return errInvalidDB
+	}
+	for key := range options {
+		switch key {
+		case "keep", "replica", "blocks", "update":
+			n, err := optionInt(options, key, 0)
+			if err != nil {
+				return err
+			}
+			column := key
+			if key == "update" {
+				column = "update_mode"
+			}
+			if _, err := self.db.Exec(`UPDATE _taos_databases SET `+column+`=? WHERE name=?`, n, name); err != nil {
+				return err
+			}
+		default:
+			return errSyntax(key + " can not be altered")
+		}
+	}
+	return nil
+}
+
+// drop drops database 'name' and its tables
+func (self *backend) drop(name string, ifExists bool) error {
+	d, err := self.database(name)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		if ifExists {
+			return nil
+		}
+		return errInvalidDB
+	}
+	tables, err := self.tables(name)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if err := self.dropTable(t); err != nil {
+			return err
+		}
+	}
+	_, err = self.db.Exec(`DELETE FROM _taos_databases WHERE name=?`, name)
+	return err
+}
+
+// column is a column of TDengine, with the type name in upper case
+type column struct {
+	name   string
+	typ    string
+	length int
+}
+
+// fixed are the lengths of types in bytes
+var fixed = map[string]int{
+	"BOOL":      1,
+	"TINYINT":   1,
+	"SMALLINT":  2,
+	"INT":       4,
+	"BIGINT":    8,
+	"FLOAT":     4,
+	"DOUBLE":    8,
+	"TIMESTAMP": 8,
+}
+
+// declared returns the SQLite type of the column. BINARY is declared
+// with TEXT for the affinity of text.
+func (self *column) declared() string {
+	switch self.typ {
+	case "BINARY":
+		return "BINARY TEXT(" + strconv.Itoa(self.length) + ")"
+	case "NCHAR", "VARCHAR":
+		return self.typ + "(" + strconv.Itoa(self.length) + ")"
+	default:
+	}
+	return self.typ
+}
+
+// columnOf reads the column of SQLite type 'declared'
+func columnOf(name, declared string) *column {
+	c := &column{name: name, typ: strings.ToUpper(strings.TrimSpace(declared))}
+	if i := strings.IndexByte(c.typ, '('); i > 0 {
+		c.length, _ = strconv.Atoi(strings.TrimSuffix(c.typ[i+1:], ")"))
+		c.typ = strings.TrimSpace(c.typ[:i])
+	}
+	c.typ = strings.TrimSuffix(c.typ, " TEXT")
+	if n, ok := fixed[strings.TrimSuffix(c.typ, " UNSIGNED")]; ok {
+		c.length = n
+	}
+	return c
+}
+
+func (self *column) isString() bool {
+	return self.typ == "BINARY" || self.typ == "NCHAR" || self.typ == "VARCHAR"
+}
+
+// table is a table of TDengine
+type table struct {
+	db      string
+	name    string
+	kind    string
+	stable  string
+	tags    string
+	created int64
+	// columns and tagColumns, of the super table for a child
+	columns    []*column
+	tagColumns []*column
+}
+
+const (
+	kindTable  = "table"
+	kindStable = "stable"
+	kindChild  = "child"
+)
+
+// quoted returns the name of 'name' in database 'db' in SQLite
+func quoted(db, name string) string {
+	return `"` + db + "." + name + `"`
+}
+
+// sqlName is the SQLite table of data, the super table for a child
+func (self *table) sqlName() string {
+	if self.kind == kindChild {
+		return quoted(self.db, self.stable)
+	}
+	return quoted(self.db, self.name)
+}
+
+func (self *table) column(name string) *column {
+	for _, c := range self.columns {
+		if strings.EqualFold(c.name, name) {
+			return c
+		}
+	}
+	for _, c := range self.tagColumns {
+		if strings.EqualFold(c.name, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// table reads table 'name' of database 'db', or nil if not found
+func (self *backend) table(db, name string) (*table, error) {
+	t := &table{db: db, name: name}
+	err := self.db.QueryRow(`SELECT kind, stable, tags, created FROM _taos_tables WHERE db=? AND name=?`, db, name).
+		Scan(&t.kind, &t.stable, &t.tags, &t.created)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, self.describe(t)
+}
+
+// tables reads all tables of database 'db', in order of names
+func (self *backend) tables(db string) ([]*table, error) {
+	rows, err := self.db.Query(`SELECT name, kind, stable, tags, created FROM _taos_tables WHERE db=? ORDER BY name`, db)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]*table, 0)
+	for rows.Next() {
+		t := &table{db: db}
+		if err := rows.Scan(&t.name, &t.kind, &t.stable, &t.tags, &t.created); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, t := range tables {
+		if err := self.describe(t); err != nil {
+			return nil, err
+		}
+	}
+	return tables, nil
+}
+
+// describe reads the columns and tag columns of the table
+func (self *backend) describe(t *table) error {
+	tags := make(map[string]bool)
+	if t.kind == kindChild {
+		stable, err := self.table(t.db, t.stable)
+		if err != nil {
+			return err
+		}
+		if stable == nil {
+			return errNoTable
+		}
+		t.columns, t.tagColumns = stable.columns, stable.tagColumns
+		return nil
+	}
+	if t.kind == kindStable {
+		for _, name := range strings.Split(t.tags, ",") {
+			tags[name] = true
+		}
+	}
+	rows, err := self.db.Query(`SELECT name, type FROM pragma_table_info(?)`, t.db+"."+t.name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, declared string
+		if err := rows.Scan(&name, &declared); err != nil {
+			return err
+		}
+		switch {
+		case name == "tbname" && t.kind == kindStable:
+		case tags[name]:
+			t.tagColumns = append(t.tagColumns, columnOf(name, declared))
+		default:
+			t.columns = append(t.columns, columnOf(name, declared))
+		}
+	}
+	return rows.Err()
+}
+
+// dropTable drops the table, and the children of a super table
+func (self *backend) dropTable(t *table) error {
+	statements := make([]string, 0)
+	switch t.kind {
+	case kindChild:
+		statements = append(statements, `DELETE FROM `+t.sqlName()+` WHERE tbname='`+t.name+`'`, `DROP VIEW `+quoted(t.db, t.name))
+	case kindStable:
+		rows, err := self.db.Query(`SELECT name FROM _taos_tables WHERE db=? AND stable=?`, t.db, t.name)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			statements = append(statements, `DROP VIEW `+quoted(t.db, name))
+		}
+		rows.Close()
+		statements = append(statements, `DROP TABLE `+t.sqlName())
+	default:
+		statements = append(statements, `DROP TABLE `+t.sqlName())
+	}
+	for _, s := range statements {
+		if _, err := self.db.Exec(s); err != nil {
+			return err
+		}
+	}
+	_, err := self.db.Exec(`DELETE FROM _taos_tables WHERE db=? AND (name=? OR stable=? AND kind=?)`, t.db, t.name, t.name, kindChild)
+	return err
+}
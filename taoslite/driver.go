@@ -0,0 +1,331 @@
+// Package taoslite is a database/sql driver, registered as "taosLite",
+// that runs the SQL of TDengine on SQLite (pure Go), so models can be
+// developed and tested without a TDengine server.
+//
+// The DSN is in the same form as taosSql. With protocol file, the address
+// is the directory of the data; otherwise data are kept in memory, shared
+// by all handles of the process:
+//
+//	root:taosdata@/file(/var/lib/taoslite)/demodb?parseTime=false
+//	root:taosdata@/tcp(127.0.0.1:0)/demodb
+//
+// The database in DSN is created if missing, in precision "us".
+//
+// Databases are prefixes of table names. A super table is a table with
+// its tags and tbname as columns, and each child table is a view of it.
+// LAST and FIRST select the rows of the latest and earliest timestamps,
+// now is the current time in the precision of the database, and the
+// group columns are appended to the results of GROUP BY, as TDengine 2.x.
+// Values are returned in the types of taosSql, strings padded with two
+// NULs unless pad=false.
+package taoslite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genelet/taodbi/internal/taosql"
+)
+
+// Version is reported by SELECT SERVER_VERSION(). Since DELETE and
+// CREATE INDEX are supported, it selects the dialect of 3.x.
+var Version = "3.0.0.0-sqlite"
+
+func init() {
+	sql.Register("taosLite", &Driver{})
+}
+
+// Driver is the SQLite driver of TDengine SQL
+type Driver struct{}
+
+// Open opens a connection by DSN
+func (self *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := self.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+// OpenConnector parses DSN and opens the data. Connections of the same
+// connector share the database set by USE.
+func (self *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	dir, sess, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if sess.backend, err = openBackend(dir); err != nil {
+		return nil, err
+	}
+	if sess.db != "" {
+		sess.backend.Lock()
+		err = sess.backend.create(sess.db, map[string]string{"precision": "us"}, true)
+		sess.backend.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &connector{driver: self, sess: sess}, nil
+}
+
+// parseDSN parses [user[:password]@][/protocol(address)]/[database][?params]
+// into the data directory and the session.
+func parseDSN(dsn string) (string, *session, error) {
+	sess := &session{parseTime: true, pad: true}
+	if i := strings.LastIndex(dsn, "@"); i >= 0 {
+		dsn = dsn[i+1:]
+	}
+	dir := ""
+	rest := strings.TrimPrefix(dsn, "/")
+	if i := strings.IndexByte(rest, '('); i >= 0 && !strings.Contains(rest[:i], "/") {
+		j := strings.LastIndex(rest, ")")
+		if j < i {
+			return "", nil, errors.New("invalid DSN: network address not terminated")
+		}
+		if rest[:i] == "file" {
+			if dir = rest[i+1 : j]; dir == "" {
+				return "", nil, errors.New("invalid DSN: directory missing")
+			}
+		}
+		dsn = rest[j+1:]
+	}
+	if !strings.HasPrefix(dsn, "/") {
+		return "", nil, errors.New("invalid DSN: missing the slash separating the database name")
+	}
+	dsn = dsn[1:]
+	params := ""
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		dsn, params = dsn[:i], dsn[i+1:]
+	}
+	sess.db = strings.ToLower(dsn)
+	for _, pair := range strings.Split(params, "&") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] != "parseTime" && kv[0] != "pad" {
+			continue
+		}
+		b, err := strconv.ParseBool(kv[1])
+		if err != nil {
+			return "", nil, errors.New("invalid bool value: " + kv[1])
+		}
+		if kv[0] == "parseTime" {
+			sess.parseTime = b
+		} else {
+			sess.pad = b
+		}
+	}
+	return dir, sess, nil
+}
+
+type connector struct {
+	driver *Driver
+	sess   *session
+}
+
+func (self *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &conn{sess: self.sess}, nil
+}
+
+func (self *connector) Driver() driver.Driver {
+	return self.driver
+}
+
+type conn struct {
+	sess *session
+}
+
+func (self *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: self, query: query}, nil
+}
+
+func (self *conn) Close() error {
+	return nil
+}
+
+func (self *conn) Begin() (driver.Tx, error) {
+	return nil, errors.New("taosLite does not support transaction")
+}
+
+func (self *conn) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (self *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query, err := taosql.Interpolate(query, taosql.Named(args))
+	if err != nil {
+		return nil, err
+	}
+	_, n, err := self.sess.execute(query)
+	if err != nil {
+		return nil, err
+	}
+	return result(n), nil
+}
+
+func (self *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query, err := taosql.Interpolate(query, taosql.Named(args))
+	if err != nil {
+		return nil, err
+	}
+	rs, n, err := self.sess.execute(query)
+	if err != nil {
+		return nil, err
+	}
+	if rs == nil {
+		rs = &resultSet{columns: []*column{{name: "affected_rows", typ: "INT", length: 4}}, rows: [][]interface{}{{n}}}
+	}
+	return &rows{rs: rs, parseTime: self.sess.parseTime, pad: self.sess.pad}, nil
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (self *stmt) Close() error {
+	return nil
+}
+
+func (self *stmt) NumInput() int {
+	return -1
+}
+
+func (self *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return self.conn.ExecContext(context.Background(), self.query, named(args))
+}
+
+func (self *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return self.conn.QueryContext(context.Background(), self.query, named(args))
+}
+
+func (self *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return self.conn.ExecContext(ctx, self.query, args)
+}
+
+func (self *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return self.conn.QueryContext(ctx, self.query, args)
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return values
+}
+
+type result int64
+
+func (self result) LastInsertId() (int64, error) {
+	return 0, errors.New("taosLite does not support LastInsertId")
+}
+
+func (self result) RowsAffected() (int64, error) {
+	return int64(self), nil
+}
+
+type rows struct {
+	rs        *resultSet
+	parseTime bool
+	pad       bool
+	pos       int
+}
+
+func (self *rows) Columns() []string {
+	names := make([]string, len(self.rs.columns))
+	for i, c := range self.rs.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+func (self *rows) ColumnTypeDatabaseTypeName(i int) string {
+	return self.rs.columns[i].typ
+}
+
+func (self *rows) Close() error {
+	return nil
+}
+
+// Next outputs values in types of taosSql: int for TINYINT and INT,
+// int16 for SMALLINT, float32 for FLOAT, and NUL-padded strings.
+func (self *rows) Next(dest []driver.Value) error {
+	if self.pos >= len(self.rs.rows) {
+		return io.EOF
+	}
+	row := self.rs.rows[self.pos]
+	self.pos++
+	for i, c := range self.rs.columns {
+		v := row[i]
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		if v == nil {
+			dest[i] = nil
+			continue
+		}
+		switch u := v.(type) {
+		case int64:
+			dest[i] = self.integer(c, u)
+		case float64:
+			switch c.typ {
+			case "FLOAT":
+				dest[i] = float32(u)
+			case "DOUBLE", "":
+				dest[i] = u
+			default:
+				dest[i] = self.integer(c, int64(u))
+			}
+		case bool:
+			dest[i] = u
+		case time.Time:
+			dest[i] = self.integer(c, toPrecision(u, self.rs.precision))
+		case string:
+			if self.pad {
+				u += "\x00\x00"
+			}
+			dest[i] = u
+		default:
+			dest[i] = v
+		}
+	}
+	return nil
+}
+
+func (self *rows) integer(c *column, v int64) driver.Value {
+	switch c.typ {
+	case "TINYINT", "INT":
+		return int(v)
+	case "SMALLINT":
+		return int16(v)
+	case "BOOL":
+		return v != 0
+	case "FLOAT":
+		return float32(v)
+	case "DOUBLE":
+		return float64(v)
+	case "TIMESTAMP":
+		if self.parseTime {
+			return taosql.FormatTime(v, self.rs.precision)
+		}
+	default:
+	}
+	return v
+}
+
+// toPrecision converts a time to an integer of the precision
+func toPrecision(t time.Time, precision string) int64 {
+	switch precision {
+	case "ms":
+		return t.UnixNano() / int64(time.Millisecond)
+	case "us":
+		return t.UnixNano() / int64(time.Microsecond)
+	default:
+	}
+	return t.UnixNano()
+}
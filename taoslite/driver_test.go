@@ -0,0 +1,210 @@
+package taoslite
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func openTest(t *testing.T, dsn string) *sql.DB {
+	db, err := sql.Open("taosLite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`drop database if exists litedb`,
+		`create database litedb precision "us"`,
+		`use litedb`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestParseDSN(t *testing.T) {
+	dir, sess, err := parseDSN("root:taosdata@/file(/tmp/lite)/demodb?parseTime=false&pad=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != "/tmp/lite" || sess.db != "demodb" || sess.parseTime || sess.pad {
+		t.Errorf("%s %#v", dir, sess)
+	}
+	if dir, sess, err = parseDSN("root:taosdata@/tcp(127.0.0.1:0)/"); err != nil || dir != "" || sess.db != "" || !sess.parseTime {
+		t.Errorf("%s %#v %v", dir, sess, err)
+	}
+	if _, _, err := parseDSN("root@/tcp(h:6030)db"); err == nil {
+		t.Errorf("error expected")
+	}
+}
+
+func TestLiteTypes(t *testing.T) {
+	db := openTest(t, "root:taosdata@/tcp(127.0.0.1:0)/?parseTime=false")
+	defer db.Close()
+
+	if _, err := db.Exec(`create table t1 (ts timestamp, a tinyint, b smallint, c int, d bigint, e float, f double, g bool, h binary(8), i nchar(4))`); err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.Exec(`insert into t1 values (1600000000000000, 1, 2, 3, 4, 5.5, 6.5, true, ?, '0012') (1600000000000001, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL)`, "'x\"y'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("%d", n)
+	}
+	if _, err := db.Exec(`insert into t1 (ts, h) values (now, 'toolong123')`); err == nil || err.Error() != errStringLength.Error() {
+		t.Errorf("string overflow expected: %v", err)
+	}
+
+	rows, err := db.Query(`select * from t1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, _ := rows.ColumnTypes()
+	if types[0].DatabaseTypeName() != "TIMESTAMP" || types[8].DatabaseTypeName() != "BINARY" {
+		t.Errorf("%s %s", types[0].DatabaseTypeName(), types[8].DatabaseTypeName())
+	}
+	values := make([]interface{}, 10)
+	pointers := make([]interface{}, 10)
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if !rows.Next() {
+		t.Fatal("no row")
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		t.Fatal(err)
+	}
+	if values[0] != int64(1600000000000000) || values[1] != 1 || values[2] != int16(2) ||
+		values[3] != 3 || values[4] != int64(4) || values[5] != float32(5.5) ||
+		values[6] != 6.5 || values[7] != true || values[8] != "x\"y\x00\x00" || values[9] != "0012\x00\x00" {
+		t.Errorf("%#v", values)
+	}
+	if !rows.Next() {
+		t.Fatal("no second row")
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range values[1:] {
+		if v != nil {
+			t.Errorf("%#v", values)
+		}
+	}
+}
+
+func TestLiteSuper(t *testing.T) {
+	db := openTest(t, "root:taosdata@/tcp(127.0.0.1:0)/?parseTime=false&pad=false")
+	defer db.Close()
+
+	for _, s := range []string{
+		`create table st (ts timestamp, x int, y binary(8)) tags (loc binary(8), gid int)`,
+		`create table c1 using st tags ('a', 1)`,
+		`insert into c1 values (1000, 1, 'one') (2000, 2, 'two') c2 using st tags ('b', 2) values (1000, 3, 'three') (3000, NULL, 'four')`,
+		`insert into c1 values (1000, 9, 'dup')`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(s, err)
+		}
+	}
+
+	var x int
+	var y, loc string
+	if err := db.QueryRow(`select x, y, loc from c1 where ts='1970-01-01 00:00:00.001' or ts=?`, 1000).Scan(&x, &y, &loc); err != nil || x != 1 || y != "one" || loc != "a" {
+		t.Errorf("%d %s %s %v", x, y, loc, err)
+	}
+
+	rows, err := db.Query(`select last(*) from st where gid>0 group by loc`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, _ := rows.Columns()
+	if strings.Join(columns, ",") != "last(ts),last(x),last(y),loc" {
+		t.Errorf("%v", columns)
+	}
+	got := make([]string, 0)
+	for rows.Next() {
+		var ts int64
+		var x sql.NullInt64
+		if err := rows.Scan(&ts, &x, &y, &loc); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, loc+":"+y)
+	}
+	rows.Close()
+	if strings.Join(got, ",") != "a:two,b:four" {
+		t.Errorf("%v", got)
+	}
+
+	var n int64
+	if err := db.QueryRow(`select count(*) from st`).Scan(&n); err != nil || n != 4 {
+		t.Errorf("%d %v", n, err)
+	}
+	if err := db.QueryRow(`select last(x) from c2`).Scan(&x); err == nil {
+		t.Errorf("NULL expected of the last row")
+	}
+	res, err := db.Exec(`delete from c1 where ts=?`, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("%d", n)
+	}
+
+	rows, err = db.Query(`show tables`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = got[:0]
+	for rows.Next() {
+		var name, stable string
+		var created int64
+		var columns int16
+		if err := rows.Scan(&name, &created, &columns, &stable); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name+":"+stable)
+	}
+	rows.Close()
+	if strings.Join(got, ",") != "c1:st,c2:st" {
+		t.Errorf("%v", got)
+	}
+
+	if _, err := db.Exec(`drop table st`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`select * from c1`); err == nil || err.Error() != errNoTable.Error() {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestLiteFile(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("taosLite", "root:taosdata@/file("+dir+")/filedb?parseTime=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, s := range []string{
+		`create table if not exists t1 (ts timestamp, x int)`,
+		`insert into t1 values (now, 1)`,
+		`insert into filedb.t1 values (now, 2)`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(s, err)
+		}
+	}
+	var x int
+	var version string
+	if err := db.QueryRow(`select last(x) from t1`).Scan(&x); err != nil || x != 2 {
+		t.Errorf("%d %v", x, err)
+	}
+	if err := db.QueryRow(`select server_version()`).Scan(&version); err != nil || !strings.HasPrefix(version, "3.") {
+		t.Errorf("%q %v", version, err)
+	}
+	if _, err := db.Exec(`use nosuchdb`); err == nil || err.Error() != errInvalidDB.Error() {
+		t.Errorf("%v", err)
+	}
+}
@@ -0,0 +1,1273 @@
+package taoslite
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/genelet/taodbi/internal/taosql"
+)
+
+// session is the state shared by connections of a connector
+type session struct {
+	backend *backend
+	sync.Mutex
+	db        string
+	parseTime bool
+	pad       bool
+}
+
+func (self *session) currentDB() string {
+	self.Lock()
+	defer self.Unlock()
+	return self.db
+}
+
+func (self *session) setDB(db string) {
+	self.Lock()
+	self.db = db
+	self.Unlock()
+}
+
+// resultSet is the result of a query, read in full
+type resultSet struct {
+	columns   []*column
+	rows      [][]interface{}
+	precision string
+}
+
+// execute translates and runs a statement on the backend, returning
+// the result of a query or the number of affected rows.
+func (self *session) execute(query string) (*resultSet, int64, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	self.backend.Lock()
+	defer self.backend.Unlock()
+	p := &parser{sess: self, b: self.backend, tokens: tokens, now: make(map[string]int64)}
+	return p.statement()
+}
+
+type parser struct {
+	sess   *session
+	b      *backend
+	tokens []token
+	pos    int
+	// now: the current time of the statement by precision
+	now map[string]int64
+}
+
+func (self *parser) peek() token {
+	return self.tokens[self.pos]
+}
+
+func (self *parser) next() token {
+	t := self.tokens[self.pos]
+	if t.Kind != tEOF {
+		self.pos++
+	}
+	return t
+}
+
+func (self *parser) accept(s string) bool {
+	if self.peek().Is(s) {
+		self.pos++
+		return true
+	}
+	return false
+}
+
+func (self *parser) expect(s string) error {
+	if !self.accept(s) {
+		return errSyntax("expect " + s + " near " + self.peek().Text)
+	}
+	return nil
+}
+
+func (self *parser) done() error {
+	if self.peek().Kind != tEOF {
+		return errSyntax("unexpected " + self.peek().Text)
+	}
+	return nil
+}
+
+func (self *parser) ident() (string, error) {
+	t := self.next()
+	if t.Kind != tIdent {
+		return "", errSyntax("expect name near " + t.Text)
+	}
+	return strings.ToLower(t.Text), nil
+}
+
+func (self *parser) ifExists() bool {
+	if self.peek().Is("IF") && self.tokens[self.pos+1].Is("EXISTS") {
+		self.pos += 2
+		return true
+	}
+	return false
+}
+
+func (self *parser) ifNotExists() bool {
+	if self.peek().Is("IF") && self.tokens[self.pos+1].Is("NOT") {
+		self.pos += 2
+		return self.accept("EXISTS")
+	}
+	return false
+}
+
+// database reads the database of 'name', or the current one if empty
+func (self *parser) database(name string) (*database, error) {
+	if name == "" {
+		if name = self.sess.currentDB(); name == "" {
+			return nil, errNoDatabase
+		}
+	}
+	d, err := self.b.database(name)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, errInvalidDB
+	}
+	return d, nil
+}
+
+// tableName reads [database.]table, returning the database in use
+func (self *parser) tableName() (*database, string, error) {
+	name, err := self.ident()
+	if err != nil {
+		return nil, "", err
+	}
+	db := ""
+	if self.accept(".") {
+		db = name
+		if name, err = self.ident(); err != nil {
+			return nil, "", err
+		}
+	}
+	d, err := self.database(db)
+	return d, name, err
+}
+
+// nowOf returns the current time of the statement in 'precision'
+func (self *parser) nowOf(precision string) int64 {
+	if _, ok := self.now[precision]; !ok {
+		self.now[precision] = self.b.now(precision)
+	}
+	return self.now[precision]
+}
+
+func (self *parser) statement() (*resultSet, int64, error) {
+	var err error
+	switch {
+	case self.accept("USE"):
+		err = self.use()
+	case self.accept("CREATE"):
+		switch {
+		case self.accept("DATABASE"):
+			err = self.createDatabase()
+		case self.accept("TABLE"):
+			err = self.createTable(false)
+		case self.accept("STABLE"):
+			err = self.createTable(true)
+		case self.accept("INDEX"):
+			err = self.createIndex()
+		default:
+			err = errSyntax("unsupported CREATE")
+		}
+	case self.accept("DROP"):
+		switch {
+		case self.accept("DATABASE"):
+			err = self.dropDatabase()
+		case self.accept("TABLE"), self.accept("STABLE"):
+			err = self.dropTable()
+		default:
+			err = errSyntax("unsupported DROP")
+		}
+	case self.accept("ALTER"):
+		if err = self.expect("DATABASE"); err == nil {
+			err = self.alterDatabase()
+		}
+	case self.accept("SHOW"):
+		rs, err := self.show()
+		return rs, 0, err
+	case self.accept("DESCRIBE"), self.accept("DESC"):
+		rs, err := self.describe()
+		return rs, 0, err
+	case self.accept("INSERT"):
+		n, err := self.insert()
+		return nil, n, err
+	case self.accept("DELETE"):
+		n, err := self.delete()
+		return nil, n, err
+	case self.accept("SELECT"):
+		rs, err := self.query()
+		return rs, 0, err
+	default:
+		err = errSyntax("unsupported statement " + self.peek().Text)
+	}
+	return nil, 0, err
+}
+
+func (self *parser) use() error {
+	name, err := self.ident()
+	if err != nil {
+		return err
+	}
+	if err := self.done(); err != nil {
+		return err
+	}
+	if _, err := self.database(name); err != nil {
+		return err
+	}
+	self.sess.setDB(name)
+	return nil
+}
+
+// options reads the options of database like KEEP 365 PRECISION 'us'
+func (self *parser) options() (map[string]string, error) {
+	options := make(map[string]string)
+	for self.peek().Kind != tEOF {
+		key, err := self.ident()
+		if err != nil {
+			return nil, err
+		}
+		value := self.next()
+		if value.Kind == tEOF {
+			return nil, errSyntax("value of " + key + " missing")
+		}
+		options[key] = strings.ToLower(value.Text)
+	}
+	return options, nil
+}
+
+func (self *parser) createDatabase() error {
+	ifNotExists := self.ifNotExists()
+	name, err := self.ident()
+	if err != nil {
+		return err
+	}
+	options, err := self.options()
+	if err != nil {
+		return err
+	}
+	return self.b.create(name, options, ifNotExists)
+}
+
+func (self *parser) alterDatabase() error {
+	name, err := self.ident()
+	if err != nil {
+		return err
+	}
+	options, err := self.options()
+	if err != nil {
+		return err
+	}
+	return self.b.alter(name, options)
+}
+
+func (self *parser) dropDatabase() error {
+	ifExists := self.ifExists()
+	name, err := self.ident()
+	if err != nil {
+		return err
+	}
+	if err := self.done(); err != nil {
+		return err
+	}
+	return self.b.drop(name, ifExists)
+}
+
+func (self *parser) dropTable() error {
+	ifExists := self.ifExists()
+	d, name, err := self.tableName()
+	if err != nil {
+		return err
+	}
+	if err := self.done(); err != nil {
+		return err
+	}
+	t, err := self.b.table(d.name, name)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		if ifExists {
+			return nil
+		}
+		return errNoTable
+	}
+	return self.b.dropTable(t)
+}
+
+// definitions checks the columns of CREATE TABLE
+func definitions(defs []*taosql.Column) ([]*column, error) {
+	columns := make([]*column, len(defs))
+	for i, def := range defs {
+		c := &column{name: def.Name, typ: def.Type, length: def.Length}
+		switch c.typ {
+		case "BINARY", "NCHAR", "VARCHAR":
+			if c.length <= 0 {
+				return nil, errSyntax("invalid length of " + def.Name)
+			}
+		default:
+			length, ok := fixed[strings.TrimSuffix(c.typ, " UNSIGNED")]
+			if !ok || def.Length > 0 {
+				return nil, errSyntax("invalid type " + def.Type)
+			}
+			c.length = length
+		}
+		columns[i] = c
+	}
+	return columns, nil
+}
+
+func (self *parser) createTable(super bool) error {
+	create, err := taosql.ParseCreateTable(self.tokens[self.pos:], super)
+	if err != nil {
+		return err
+	}
+	self.pos = len(self.tokens) - 1
+	for _, u := range create.Children {
+		if _, err := self.using(u, create.IfNotExists); err != nil {
+			return err
+		}
+	}
+	if len(create.Children) > 0 {
+		return nil
+	}
+
+	d, err := self.database(create.Table.Database)
+	if err != nil {
+		return err
+	}
+	name := create.Table.Table
+	columns, err := definitions(create.Columns)
+	if err != nil {
+		return err
+	}
+	tags, err := definitions(create.Tags)
+	if err != nil {
+		return err
+	}
+	t, err := self.b.table(d.name, name)
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		if create.IfNotExists {
+			return nil
+		}
+		return errTableExists
+	}
+
+	defs := make([]string, 0)
+	for _, c := range columns {
+		defs = append(defs, c.name+" "+c.declared())
+	}
+	kind, names := kindTable, make([]string, 0)
+	if len(tags) > 0 {
+		kind = kindStable
+		for _, c := range tags {
+			defs = append(defs, c.name+" "+c.declared())
+			names = append(names, c.name)
+		}
+		defs = append(defs, "tbname TEXT NOT NULL", "PRIMARY KEY (tbname, "+columns[0].name+")")
+	} else {
+		defs = append(defs, "PRIMARY KEY ("+columns[0].name+")")
+	}
+	if _, err := self.b.db.Exec("CREATE TABLE " + quoted(d.name, name) + " (" + strings.Join(defs, ", ") + ")"); err != nil {
+		return err
+	}
+	_, err = self.b.db.Exec(`INSERT INTO _taos_tables VALUES (?, ?, ?, '', ?, ?)`, d.name, name, kind, strings.Join(names, ","), self.b.now(d.precision))
+	return err
+}
+
+// using creates the child table of 'u' unless it exists
+func (self *parser) using(u *taosql.Using, ifNotExists bool) (*table, error) {
+	d, err := self.database(u.Table.Database)
+	if err != nil {
+		return nil, err
+	}
+	sd, err := self.database(u.Stable.Database)
+	if err != nil {
+		return nil, err
+	}
+	if sd.name != d.name {
+		return nil, errSyntax("super table in another database")
+	}
+	name, sname := u.Table.Table, u.Stable.Table
+	stable, err := self.b.table(d.name, sname)
+	if err != nil {
+		return nil, err
+	}
+	if stable == nil {
+		return nil, errNoTable
+	}
+	if stable.kind != kindStable {
+		return nil, errNotSuper
+	}
+	tags := stable.tagColumns
+	if len(u.Tags) > 0 {
+		tags = make([]*column, len(u.Tags))
+		for i, n := range u.Tags {
+			if tags[i] = stable.column(n); tags[i] == nil {
+				return nil, errSyntax("invalid tag " + n)
+			}
+		}
+	}
+	if len(u.Values) != len(tags) {
+		return nil, errSyntax("invalid number of tags")
+	}
+	literals := make(map[string]string)
+	for i, c := range tags {
+		if literals[c.name], err = self.literal(u.Values[i], c, d.precision); err != nil {
+			return nil, err
+		}
+	}
+
+	t, err := self.b.table(d.name, name)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		if ifNotExists && t.kind == kindChild && t.stable == sname {
+			return t, nil
+		}
+		return nil, errTableExists
+	}
+	ordered := make([]string, len(stable.tagColumns))
+	for i, c := range stable.tagColumns {
+		if ordered[i] = literals[c.name]; ordered[i] == "" {
+			ordered[i] = "NULL"
+		}
+	}
+	if _, err := self.b.db.Exec("CREATE VIEW " + quoted(d.name, name) + " AS SELECT * FROM " + quoted(d.name, sname) + " WHERE tbname=" + quote(name)); err != nil {
+		return nil, err
+	}
+	if _, err := self.b.db.Exec(`INSERT INTO _taos_tables VALUES (?, ?, ?, ?, ?, ?)`, d.name, name, kindChild, sname, strings.Join(ordered, ", "), self.b.now(d.precision)); err != nil {
+		return nil, err
+	}
+	return self.b.table(d.name, name)
+}
+
+func (self *parser) createIndex() error {
+	index, err := self.ident()
+	if err != nil {
+		return err
+	}
+	if err := self.expect("ON"); err != nil {
+		return err
+	}
+	d, name, err := self.tableName()
+	if err != nil {
+		return err
+	}
+	names, err := self.names()
+	if err != nil {
+		return err
+	}
+	if err := self.done(); err != nil {
+		return err
+	}
+	t, err := self.b.table(d.name, name)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return errNoTable
+	}
+	if t.kind != kindStable {
+		return errNotSuper
+	}
+	_, err = self.b.db.Exec("CREATE INDEX IF NOT EXISTS " + quoted(d.name, index) + " ON " + t.sqlName() + " (" + strings.Join(names, ", ") + ")")
+	return err
+}
+
+// names reads (name, ...)
+func (self *parser) names() ([]string, error) {
+	if err := self.expect("("); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for {
+		name, err := self.ident()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if self.accept(")") {
+			return names, nil
+		}
+		if err := self.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (self *parser) insert() (int64, error) {
+	inserts, err := taosql.ParseInsert(self.tokens[self.pos:])
+	if err != nil {
+		return 0, err
+	}
+	self.pos = len(self.tokens) - 1
+	total := int64(0)
+	for _, insert := range inserts {
+		d, err := self.database(insert.Table.Database)
+		if err != nil {
+			return 0, err
+		}
+		name := insert.Table.Table
+		var t *table
+		if insert.Using != nil {
+			t, err = self.using(insert.Using, true)
+		} else {
+			t, err = self.b.table(d.name, name)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if t == nil {
+			return 0, errNoTable
+		}
+		if t.kind == kindStable {
+			return 0, errSyntax("can not insert into super table " + name)
+		}
+
+		columns := t.columns
+		if len(insert.Columns) > 0 {
+			columns = make([]*column, len(insert.Columns))
+			for i, n := range insert.Columns {
+				if columns[i] = t.column(n); columns[i] == nil || i == 0 && columns[i].typ != "TIMESTAMP" {
+					return 0, errSyntax("invalid column " + n)
+				}
+			}
+		}
+		rows := make([]string, 0)
+		for _, values := range insert.Rows {
+			if len(values) != len(columns) {
+				return 0, errSyntax("invalid number of values")
+			}
+			literals := make([]string, len(values))
+			for i, value := range values {
+				if literals[i], err = self.literal(value, columns[i], d.precision); err != nil {
+					return 0, err
+				}
+			}
+			if t.kind == kindChild {
+				literals = append([]string{quote(t.name), t.tags}, literals...)
+			}
+			rows = append(rows, "("+strings.Join(literals, ", ")+")")
+		}
+
+		names, keys, updates := make([]string, 0), columns[0].name, make([]string, 0)
+		if t.kind == kindChild {
+			names = append(names, "tbname")
+			for _, c := range t.tagColumns {
+				names = append(names, c.name)
+			}
+			keys = "tbname, " + keys
+		}
+		for i, c := range columns {
+			names = append(names, c.name)
+			if i > 0 {
+				updates = append(updates, c.name+"=excluded."+c.name)
+			}
+		}
+		query := " INTO " + t.sqlName() + " (" + strings.Join(names, ", ") + ") VALUES " + strings.Join(rows, ", ")
+		switch {
+		case d.update == 1:
+			query = "INSERT OR REPLACE" + query
+		case d.update == 2 && len(updates) > 0:
+			query = "INSERT" + query + " ON CONFLICT (" + keys + ") DO UPDATE SET " + strings.Join(updates, ", ")
+		default:
+			query = "INSERT OR IGNORE" + query
+		}
+		res, err := self.b.db.Exec(query)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
+
+func (self *parser) delete() (int64, error) {
+	if err := self.expect("FROM"); err != nil {
+		return 0, err
+	}
+	d, name, err := self.tableName()
+	if err != nil {
+		return 0, err
+	}
+	t, err := self.b.table(d.name, name)
+	if err != nil {
+		return 0, err
+	}
+	if t == nil {
+		return 0, errNoTable
+	}
+	conditions := make([]string, 0)
+	if t.kind == kindChild {
+		conditions = append(conditions, "tbname="+quote(t.name))
+	}
+	if self.accept("WHERE") {
+		where, err := self.render(self.tokens[self.pos:len(self.tokens)-1], t, d.precision)
+		if err != nil {
+			return 0, err
+		}
+		conditions = append(conditions, "("+where+")")
+	} else if err := self.done(); err != nil {
+		return 0, err
+	}
+	query := "DELETE FROM " + t.sqlName()
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	res, err := self.b.db.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (self *parser) describe() (*resultSet, error) {
+	d, name, err := self.tableName()
+	if err != nil {
+		return nil, err
+	}
+	if err := self.done(); err != nil {
+		return nil, err
+	}
+	t, err := self.b.table(d.name, name)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, errNoTable
+	}
+	rs := &resultSet{columns: []*column{
+		{name: "Field", typ: "BINARY", length: 64},
+		{name: "Type", typ: "BINARY", length: 16},
+		{name: "Length", typ: "INT", length: 4},
+		{name: "Note", typ: "BINARY", length: 16},
+	}}
+	for _, c := range t.columns {
+		rs.rows = append(rs.rows, []interface{}{c.name, c.typ, int64(c.length), ""})
+	}
+	for _, c := range t.tagColumns {
+		rs.rows = append(rs.rows, []interface{}{c.name, c.typ, int64(c.length), "TAG"})
+	}
+	return rs, nil
+}
+
+// show supports SHOW DATABASES, SHOW TABLES and SHOW STABLES
+func (self *parser) show() (*resultSet, error) {
+	what, err := taosql.ParseShow(self.tokens[self.pos:])
+	if err != nil {
+		return nil, err
+	}
+	if what == "DATABASES" {
+		return self.showDatabases()
+	}
+	super := what == "STABLES"
+	d, err := self.database("")
+	if err != nil {
+		return nil, err
+	}
+	tables, err := self.b.tables(d.name)
+	if err != nil {
+		return nil, err
+	}
+	shown := make([]*taosql.Table, 0)
+	for _, t := range tables {
+		switch {
+		case super && t.kind == kindStable:
+			children := int64(0)
+			for _, c := range tables {
+				if c.kind == kindChild && c.stable == t.name {
+					children++
+				}
+			}
+			shown = append(shown, &taosql.Table{Name: t.name, Created: t.created, Columns: int64(len(t.columns)),
+				Tags: int64(len(t.tagColumns)), Children: children})
+		case !super && t.kind != kindStable:
+			shown = append(shown, &taosql.Table{Name: t.name, Created: t.created, Columns: int64(len(t.columns)), Stable: t.stable})
+		default:
+		}
+	}
+	columns, rows := taosql.ShowTables(shown, super, "stable_name")
+	return &resultSet{columns: columnsOf(columns), rows: rows, precision: d.precision}, nil
+}
+
+func (self *parser) showDatabases() (*resultSet, error) {
+	rows, err := self.b.db.Query(`SELECT d.name, d.created, (SELECT COUNT(*) FROM _taos_tables t WHERE t.db=d.name AND t.kind<>?),
+d.replica, d.days, d.keep, d.blocks, d.precision, d.update_mode FROM _taos_databases d ORDER BY d.name`, kindStable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	dbs := make([]*taosql.Database, 0)
+	for rows.Next() {
+		db := new(taosql.Database)
+		if err := rows.Scan(&db.Name, &db.Created, &db.Tables, &db.Replica, &db.Days, &db.Keep, &db.Blocks, &db.Precision, &db.Update); err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	columns, shown := taosql.ShowDatabases(dbs, false)
+	return &resultSet{columns: columnsOf(columns), rows: shown, precision: "ms"}, nil
+}
+
+// columnsOf returns the columns of a result set
+func columnsOf(columns []*taosql.Column) []*column {
+	cs := make([]*column, len(columns))
+	for i, c := range columns {
+		cs[i] = &column{name: c.Name, typ: c.Type, length: c.Length}
+	}
+	return cs
+}
+
+// item is an expression in the select list
+type item struct {
+	sql  string
+	name string
+	typ  string
+	// column: the column name if the item is a column
+	column string
+}
+
+// query translates SELECT. LAST and FIRST select the row of the latest
+// or earliest timestamp by MAX or MIN, and group columns are appended.
+func (self *parser) query() (*resultSet, error) {
+	end, depth := self.pos, 0
+	for ; self.tokens[end].Kind != tEOF; end++ {
+		t := self.tokens[end]
+		if t.Is("(") {
+			depth++
+		} else if t.Is(")") {
+			depth--
+		} else if depth == 0 && t.Is("FROM") {
+			break
+		}
+	}
+	list := self.tokens[self.pos:end]
+	self.pos = end
+
+	var t *table
+	precision := "ms"
+	if self.accept("FROM") {
+		if self.peek().Is("(") {
+			return nil, errSyntax("subquery is not supported")
+		}
+		d, name, err := self.tableName()
+		if err != nil {
+			return nil, err
+		}
+		if t, err = self.b.table(d.name, name); err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return nil, errNoTable
+		}
+		precision = d.precision
+	}
+	clauses, err := self.clauses()
+	if err != nil {
+		return nil, err
+	}
+
+	items, mode, err := self.items(split(list), t, precision)
+	if err != nil {
+		return nil, err
+	}
+	group := make([]string, 0)
+	for _, g := range split(clauses["GROUP BY"]) {
+		if len(g) != 1 || g[0].Kind != tIdent {
+			return nil, errSyntax("invalid GROUP BY")
+		}
+		group = append(group, strings.ToLower(g[0].Text))
+	}
+	// as TDengine 2.x, the group columns are returned with the aggregates
+	for _, g := range group {
+		found := false
+		for _, it := range items {
+			found = found || strings.EqualFold(it.column, g)
+		}
+		if !found {
+			items = append(items, self.columnItem(g, t))
+		}
+	}
+
+	selected := make([]string, len(items))
+	for i, it := range items {
+		selected[i] = it.sql + ` AS "` + strings.Replace(it.name, `"`, `""`, -1) + `"`
+	}
+	query := "SELECT " + strings.Join(selected, ", ")
+	if mode != "" {
+		function := "MAX"
+		if mode == "first" {
+			function = "MIN"
+		}
+		query += ", " + function + "(" + t.columns[0].name + ") AS _taos_ts"
+	}
+	if t != nil {
+		query += " FROM " + quoted(t.db, t.name)
+	}
+	for _, clause := range []string{"WHERE", "GROUP BY", "HAVING"} {
+		if tokens, ok := clauses[clause]; ok {
+			s, err := self.render(tokens, t, precision)
+			if err != nil {
+				return nil, err
+			}
+			query += " " + clause + " " + s
+		}
+	}
+	order, ok := clauses["ORDER BY"]
+	if mode != "" {
+		names := make([]string, len(items))
+		for i, it := range items {
+			names[i] = `"` + strings.Replace(it.name, `"`, `""`, -1) + `"`
+		}
+		query = "SELECT " + strings.Join(names, ", ") + " FROM (" + query + ") WHERE _taos_ts IS NOT NULL"
+		// order by the columns of LAST(column)
+		for i, tk := range order {
+			for _, it := range items {
+				if tk.Kind == tIdent && strings.EqualFold(tk.Text, it.column) {
+					order[i] = token{Kind: tIdent, Text: `"` + it.name + `"`}
+				}
+			}
+		}
+	}
+	if ok {
+		s, err := self.render(order, t, precision)
+		if err != nil {
+			return nil, err
+		}
+		query += " ORDER BY " + s
+	} else if t != nil && mode == "" && len(group) == 0 && !aggregated(list) {
+		if t.kind == kindStable {
+			query += " ORDER BY tbname, " + t.columns[0].name
+		} else {
+			query += " ORDER BY " + t.columns[0].name
+		}
+	}
+	if limit, ok := clauses["LIMIT"]; ok {
+		s, err := self.render(limit, t, precision)
+		if err != nil {
+			return nil, err
+		}
+		query += " LIMIT " + s
+	}
+	return self.run(query, items, precision)
+}
+
+// clauses splits the rest of SELECT by clause
+func (self *parser) clauses() (map[string][]token, error) {
+	clauses := make(map[string][]token)
+	current, depth := "", 0
+	for {
+		t := self.next()
+		if t.Kind == tEOF {
+			return clauses, nil
+		}
+		if depth == 0 && t.Kind == tIdent {
+			clause := ""
+			switch {
+			case t.Is("WHERE"), t.Is("HAVING"), t.Is("LIMIT"):
+				clause = strings.ToUpper(t.Text)
+			case t.Is("GROUP"), t.Is("ORDER"):
+				if err := self.expect("BY"); err != nil {
+					return nil, err
+				}
+				clause = strings.ToUpper(t.Text) + " BY"
+			case t.Is("INTERVAL"), t.Is("FILL"), t.Is("SLIDING"), t.Is("SLIMIT"), t.Is("SOFFSET"), t.Is("PARTITION"):
+				return nil, errSyntax(strings.ToUpper(t.Text) + " is not supported")
+			default:
+			}
+			if clause != "" {
+				if _, ok := clauses[clause]; ok {
+					return nil, errSyntax("duplicated " + clause)
+				}
+				current = clause
+				clauses[current] = make([]token, 0)
+				continue
+			}
+		}
+		if current == "" {
+			return nil, errSyntax("unexpected " + t.Text)
+		}
+		if t.Is("(") {
+			depth++
+		} else if t.Is(")") {
+			depth--
+		}
+		clauses[current] = append(clauses[current], t)
+	}
+}
+
+// items translates the select list, returning also "last" or "first"
+func (self *parser) items(list [][]token, t *table, precision string) ([]*item, string, error) {
+	items := make([]*item, 0)
+	mode := ""
+	for _, tokens := range list {
+		alias := ""
+		if n := len(tokens); n > 2 && tokens[n-2].Is("AS") {
+			alias, tokens = tokens[n-1].Text, tokens[:n-2]
+		}
+		if len(tokens) == 0 {
+			return nil, "", errSyntax("select list missing")
+		}
+		added := make([]*item, 0)
+		first := tokens[0]
+		switch {
+		case len(tokens) == 1 && first.Is("*"):
+			if t == nil {
+				return nil, "", errSyntax("FROM missing")
+			}
+			columns := t.columns
+			if t.kind == kindStable {
+				columns = append(append([]*column{}, t.columns...), t.tagColumns...)
+			}
+			for _, c := range columns {
+				added = append(added, &item{sql: c.name, name: c.name, typ: c.typ, column: c.name})
+			}
+		case (first.Is("LAST") || first.Is("LAST_ROW") || first.Is("FIRST")) && len(tokens) > 3 && tokens[1].Is("(") && tokens[len(tokens)-1].Is(")"):
+			if t == nil {
+				return nil, "", errSyntax("FROM missing")
+			}
+			function, m := strings.ToLower(first.Text), "last"
+			if function == "first" {
+				m = "first"
+			}
+			if mode != "" && mode != m {
+				return nil, "", errSyntax("LAST and FIRST can not be mixed")
+			}
+			mode = m
+			args := tokens[2 : len(tokens)-1]
+			columns := make([]*column, 0)
+			if len(args) == 1 && args[0].Is("*") {
+				columns = t.columns
+			} else {
+				for _, arg := range split(args) {
+					if len(arg) != 1 || arg[0].Kind != tIdent {
+						return nil, "", errSyntax("invalid argument of " + function)
+					}
+					c := t.column(arg[0].Text)
+					if c == nil {
+						return nil, "", errSyntax("invalid column " + arg[0].Text)
+					}
+					columns = append(columns, c)
+				}
+			}
+			for _, c := range columns {
+				added = append(added, &item{sql: c.name, name: function + "(" + c.name + ")", typ: c.typ, column: c.name})
+			}
+		case len(tokens) == 1 && first.Kind == tIdent:
+			added = append(added, self.columnItem(strings.ToLower(first.Text), t))
+		default:
+			s, err := self.render(tokens, t, precision)
+			if err != nil {
+				return nil, "", err
+			}
+			added = append(added, &item{sql: s, name: compact(tokens), typ: typeOf(tokens, t)})
+		}
+		if alias != "" {
+			if len(added) != 1 {
+				return nil, "", errSyntax("alias of multiple columns")
+			}
+			added[0].name = alias
+		}
+		items = append(items, added...)
+	}
+	return items, mode, nil
+}
+
+func (self *parser) columnItem(name string, t *table) *item {
+	it := &item{sql: name, name: name, column: name}
+	if t != nil {
+		if c := t.column(name); c != nil {
+			it.typ = c.typ
+		} else if name == "tbname" {
+			it.typ = "BINARY"
+		}
+	}
+	return it
+}
+
+// typeOf returns the type of functions of a column, or empty
+func typeOf(tokens []token, t *table) string {
+	if len(tokens) < 3 || tokens[0].Kind != tIdent || !tokens[1].Is("(") || !tokens[len(tokens)-1].Is(")") {
+		return ""
+	}
+	var c *column
+	if len(tokens) == 4 && t != nil {
+		c = t.column(tokens[2].Text)
+	}
+	switch strings.ToUpper(tokens[0].Text) {
+	case "COUNT":
+		return "BIGINT"
+	case "AVG", "SPREAD", "STDDEV":
+		return "DOUBLE"
+	case "SUM":
+		if c != nil && (c.typ == "FLOAT" || c.typ == "DOUBLE") {
+			return "DOUBLE"
+		}
+		return "BIGINT"
+	case "MAX", "MIN":
+		if c != nil {
+			return c.typ
+		}
+	case "SERVER_VERSION", "CLIENT_VERSION", "DATABASE":
+		return "BINARY"
+	case "SERVER_STATUS":
+		return "INT"
+	case "NOW":
+		return "TIMESTAMP"
+	default:
+	}
+	return ""
+}
+
+// run runs the query of SQLite and reads the result
+func (self *parser) run(query string, items []*item, precision string) (*resultSet, error) {
+	rows, err := self.b.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rs := &resultSet{precision: precision}
+	for _, it := range items {
+		rs.columns = append(rs.columns, &column{name: it.name, typ: it.typ})
+	}
+	for rows.Next() {
+		row := make([]interface{}, len(items))
+		pointers := make([]interface{}, len(items))
+		for i := range row {
+			pointers[i] = &row[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		rs.rows = append(rs.rows, row)
+	}
+	return rs, rows.Err()
+}
+
+// render translates an expression: strings are quoted for SQLite, now is
+// the current time, and time strings compared to timestamps are integers.
+func (self *parser) render(tokens []token, t *table, precision string) (string, error) {
+	parts := make([]string, 0)
+	timestamp, between := false, false
+	for i := 0; i < len(tokens); i++ {
+		tk := tokens[i]
+		switch tk.Kind {
+		case tString:
+			if timestamp {
+				if ts, ok := parseTime(tk.Text, precision); ok {
+					parts = append(parts, strconv.FormatInt(ts, 10))
+					continue
+				}
+			}
+			parts = append(parts, quote(tk.Text))
+		case tNumber:
+			if _, err := strconv.ParseFloat(tk.Text, 64); err != nil {
+				return "", errSyntax("invalid number " + tk.Text)
+			}
+			parts = append(parts, tk.Text)
+		case tIdent:
+			switch {
+			case tk.Is("NOW"):
+				if i+2 < len(tokens) && tokens[i+1].Is("(") && tokens[i+2].Is(")") {
+					i += 2
+				}
+				ts := self.nowOf(precision)
+				if i+2 < len(tokens) && (tokens[i+1].Is("+") || tokens[i+1].Is("-")) && tokens[i+2].Kind == tNumber {
+					if d, ok := duration(tokens[i+2].Text, precision); ok {
+						if tokens[i+1].Is("-") {
+							d = -d
+						}
+						ts += d
+						i += 2
+					}
+				}
+				parts = append(parts, strconv.FormatInt(ts, 10))
+				continue
+			case i+2 < len(tokens) && tokens[i+1].Is("(") && tokens[i+2].Is(")") && constant(tk) != "":
+				parts = append(parts, self.constant(tk))
+				i += 2
+				continue
+			case tk.Is("BETWEEN"):
+				between = timestamp
+			case tk.Is("AND") && between:
+				between = false
+			case tk.Is("AND"), tk.Is("OR"):
+				timestamp = false
+			default:
+				if t != nil {
+					if c := t.column(tk.Text); c != nil {
+						timestamp = c.typ == "TIMESTAMP"
+					}
+				}
+			}
+			parts = append(parts, tk.Text)
+		default:
+			if tk.Is(",") {
+				timestamp = false
+			}
+			parts = append(parts, tk.Text)
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// constant returns the name of a function without arguments, or empty
+func constant(tk token) string {
+	for _, name := range []string{"SERVER_VERSION", "CLIENT_VERSION", "SERVER_STATUS", "DATABASE"} {
+		if tk.Is(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+func (self *parser) constant(tk token) string {
+	switch constant(tk) {
+	case "SERVER_VERSION", "CLIENT_VERSION":
+		return quote(Version)
+	case "SERVER_STATUS":
+		return "1"
+	default:
+	}
+	if db := self.sess.currentDB(); db != "" {
+		return quote(db)
+	}
+	return "NULL"
+}
+
+// literal translates the value of column 'c' in INSERT or TAGS
+func (self *parser) literal(tokens []token, c *column, precision string) (string, error) {
+	if len(tokens) == 1 {
+		tk := tokens[0]
+		switch {
+		case tk.Kind == tString && c.typ == "TIMESTAMP":
+			ts, ok := parseTime(tk.Text, precision)
+			if !ok {
+				return "", errSyntax("invalid timestamp " + tk.Text)
+			}
+			return strconv.FormatInt(ts, 10), nil
+		case tk.Kind == tString && c.isString():
+			n := len(tk.Text)
+			if c.typ == "NCHAR" {
+				n = utf8.RuneCountInString(tk.Text)
+			}
+			if n > c.length {
+				return "", errStringLength
+			}
+		case tk.Is("NULL"):
+			return "NULL", nil
+		case tk.Is("TRUE"):
+			return "1", nil
+		case tk.Is("FALSE"):
+			return "0", nil
+		default:
+		}
+	}
+	return self.render(tokens, nil, precision)
+}
+
+// parseTime parses a time string in local time into 'precision'
+func parseTime(s, precision string) (int64, bool) {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999Z07:00", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return toPrecision(t, precision), true
+		}
+	}
+	return 0, false
+}
+
+// duration parses a duration like 10s into 'precision'
+func duration(s, precision string) (int64, bool) {
+	units := map[byte]time.Duration{'b': time.Nanosecond, 'u': time.Microsecond, 'a': time.Millisecond,
+		's': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if len(s) < 2 {
+		return 0, false
+	}
+	unit, ok := units[s[len(s)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	d := time.Duration(n) * unit
+	switch precision {
+	case "ms":
+		return int64(d / time.Millisecond), true
+	case "us":
+		return int64(d / time.Microsecond), true
+	default:
+	}
+	return int64(d), true
+}
+
+// split splits tokens by commas out of parentheses
+func split(tokens []token) [][]token {
+	lists := make([][]token, 0)
+	if len(tokens) == 0 {
+		return lists
+	}
+	start, depth := 0, 0
+	for i, t := range tokens {
+		switch {
+		case t.Is("("):
+			depth++
+		case t.Is(")"):
+			depth--
+		case t.Is(",") && depth == 0:
+			lists = append(lists, tokens[start:i])
+			start = i + 1
+		default:
+		}
+	}
+	return append(lists, tokens[start:])
+}
+
+// aggregated reports if the select list calls functions
+func aggregated(tokens []token) bool {
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].Kind == tIdent && tokens[i+1].Is("(") {
+			return true
+		}
+	}
+	return false
+}
+
+// compact returns the name of an expression, like count(*)
+func compact(tokens []token) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		switch t.Kind {
+		case tString:
+			b.WriteString("'" + t.Text + "'")
+		case tIdent:
+			b.WriteString(strings.ToLower(t.Text))
+		default:
+			b.WriteString(t.Text)
+		}
+	}
+	return b.String()
+}
+
+// quote quotes a string for SQLite
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,520 @@
+// Package taosrest is a pure-Go database/sql driver of TDengine over
+// its REST interface, registered as "taosRest". It needs no C client.
+//
+// The DSN is in the same form as taosSql, with protocol http or https:
+//
+//	root:taosdata@/http(127.0.0.1:6041)/demodb?parseTime=false
+//
+// Values are returned in the types of taosSql: int for TINYINT and INT,
+// int16 for SMALLINT, float32 for FLOAT, strings padded with two NULs
+// (unless pad=false), and timestamps as strings (or as integers in the
+// database precision, if parseTime=false). Arguments are interpolated
+// into statements, and USE changes the database of later statements.
+package taosrest
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/genelet/taodbi/internal/taosql"
+)
+
+func init() {
+	sql.Register("taosRest", &Driver{})
+}
+
+// Driver is the REST driver. Client is used for requests, or
+// http.DefaultClient if nil.
+type Driver struct {
+	Client *http.Client
+}
+
+// Open opens a connection by DSN
+func (self *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := self.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+// OpenConnector parses DSN. Connections of the same connector share
+// the database set by USE.
+func (self *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{driver: self, cfg: cfg}, nil
+}
+
+type config struct {
+	user      string
+	password  string
+	url       string
+	parseTime bool
+	pad       bool
+
+	sync.Mutex
+	db string
+}
+
+// parseDSN parses [user[:password]@][/protocol(address)]/[database][?params]
+func parseDSN(dsn string) (*config, error) {
+	cfg := &config{parseTime: true, pad: true}
+	if i := strings.LastIndex(dsn, "@"); i >= 0 {
+		cfg.user, cfg.password = dsn[:i], ""
+		if j := strings.IndexByte(cfg.user, ':'); j >= 0 {
+			cfg.user, cfg.password = cfg.user[:j], cfg.user[j+1:]
+		}
+		dsn = dsn[i+1:]
+	}
+	protocol, address := "http", "localhost:6041"
+	rest := strings.TrimPrefix(dsn, "/")
+	if i := strings.IndexByte(rest, '('); i >= 0 && !strings.Contains(rest[:i], "/") {
+		j := strings.IndexByte(rest, ')')
+		if j < i {
+			return nil, errors.New("invalid DSN: network address not terminated")
+		}
+		protocol, address = rest[:i], rest[i+1:j]
+		dsn = rest[j+1:]
+	}
+	if protocol != "http" && protocol != "https" {
+		return nil, errors.New("invalid DSN: protocol must be http or https")
+	}
+	cfg.url = protocol + "://" + address + "/rest/sql"
+	if !strings.HasPrefix(dsn, "/") {
+		return nil, errors.New("invalid DSN: missing the slash separating the database name")
+	}
+	dsn = dsn[1:]
+	params := ""
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		dsn, params = dsn[:i], dsn[i+1:]
+	}
+	cfg.db = dsn
+	for _, pair := range strings.Split(params, "&") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "parseTime", "pad":
+			b, err := strconv.ParseBool(kv[1])
+			if err != nil {
+				return nil, errors.New("invalid bool value: " + kv[1])
+			}
+			if kv[0] == "parseTime" {
+				cfg.parseTime = b
+			} else {
+				cfg.pad = b
+			}
+		default:
+		}
+	}
+	return cfg, nil
+}
+
+func (self *config) database() string {
+	self.Lock()
+	defer self.Unlock()
+	return self.db
+}
+
+func (self *config) use(db string) {
+	self.Lock()
+	self.db = db
+	self.Unlock()
+}
+
+type connector struct {
+	driver *Driver
+	cfg    *config
+}
+
+func (self *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	client := self.driver.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &conn{cfg: self.cfg, client: client}, nil
+}
+
+func (self *connector) Driver() driver.Driver {
+	return self.driver
+}
+
+type conn struct {
+	cfg    *config
+	client *http.Client
+}
+
+func (self *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: self, query: query}, nil
+}
+
+func (self *conn) Close() error {
+	return nil
+}
+
+func (self *conn) Begin() (driver.Tx, error) {
+	return nil, errors.New("taosRest does not support transaction")
+}
+
+func (self *conn) Ping(ctx context.Context) error {
+	_, err := self.do(ctx, "SELECT SERVER_VERSION()")
+	return err
+}
+
+func (self *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query, err := taosql.Interpolate(query, taosql.Named(args))
+	if err != nil {
+		return nil, err
+	}
+	res, err := self.do(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(0)
+	if len(res.data) == 1 && len(res.data[0]) == 1 && len(res.meta) == 1 && res.meta[0].name == "affected_rows" {
+		if num, ok := res.data[0][0].(json.Number); ok {
+			n, _ = num.Int64()
+		}
+	}
+	return result(n), nil
+}
+
+func (self *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query, err := taosql.Interpolate(query, taosql.Named(args))
+	if err != nil {
+		return nil, err
+	}
+	res, err := self.do(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{res: res, cfg: self.cfg}, nil
+}
+
+// do posts the statement, and handles USE by the client
+func (self *conn) do(ctx context.Context, query string) (*response, error) {
+	use := ""
+	if fields := strings.Fields(strings.TrimRight(query, "; \t\n")); len(fields) == 2 && strings.EqualFold(fields[0], "USE") {
+		use = strings.Trim(fields[1], "`")
+	}
+
+	url := self.cfg.url
+	if db := self.cfg.database(); db != "" {
+		url += "/" + db
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	if self.cfg.user != "" {
+		req.SetBasicAuth(self.cfg.user, self.cfg.password)
+	}
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return nil, connError(ctx, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	res, err := decode(body)
+	if err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.New(resp.Status)
+		}
+		return nil, err
+	}
+	if use != "" {
+		self.cfg.use(use)
+	}
+	return res, nil
+}
+
+// connError returns the error of the context if it is done, or
+// driver.ErrBadConn if the connection could not be dialed, so that
+// database/sql retries only statements not sent to the server.
+func connError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var op *net.OpError
+	if errors.As(err, &op) && op.Op == "dial" {
+		return driver.ErrBadConn
+	}
+	return err
+}
+
+type column struct {
+	name   string
+	typ    string
+	length int
+}
+
+type response struct {
+	meta []*column
+	data [][]interface{}
+}
+
+// typeNames are the type names of codes in column_meta of 2.x
+var typeNames = map[int64]string{
+	1:  "BOOL",
+	2:  "TINYINT",
+	3:  "SMALLINT",
+	4:  "INT",
+	5:  "BIGINT",
+	6:  "FLOAT",
+	7:  "DOUBLE",
+	8:  "BINARY",
+	9:  "TIMESTAMP",
+	10: "NCHAR",
+	11: "TINYINT UNSIGNED",
+	12: "SMALLINT UNSIGNED",
+	13: "INT UNSIGNED",
+	14: "BIGINT UNSIGNED",
+	15: "JSON",
+}
+
+// decode reads the response of 2.x, with status, or of 3.x, with code
+func decode(body []byte) (*response, error) {
+	var raw struct {
+		Status     string          `json:"status"`
+		Code       int             `json:"code"`
+		Desc       string          `json:"desc"`
+		ColumnMeta [][]interface{} `json:"column_meta"`
+		Data       [][]interface{} `json:"data"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	if raw.Status == "error" || raw.Code != 0 {
+		return nil, fmt.Errorf("[0x%04X] %s", raw.Code, raw.Desc)
+	}
+
+	res := &response{data: raw.Data}
+	for _, item := range raw.ColumnMeta {
+		if len(item) < 3 {
+			return nil, errors.New("invalid column_meta")
+		}
+		c := &column{name: fmt.Sprint(item[0])}
+		switch v := item[1].(type) {
+		case json.Number:
+			code, _ := v.Int64()
+			c.typ = typeNames[code]
+		case string:
+			c.typ = strings.ToUpper(v)
+		default:
+		}
+		if n, ok := item[2].(json.Number); ok {
+			length, _ := n.Int64()
+			c.length = int(length)
+		}
+		res.meta = append(res.meta, c)
+	}
+	return res, nil
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (self *stmt) Close() error {
+	return nil
+}
+
+func (self *stmt) NumInput() int {
+	return -1
+}
+
+func (self *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return self.conn.ExecContext(context.Background(), self.query, named(args))
+}
+
+func (self *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return self.conn.QueryContext(context.Background(), self.query, named(args))
+}
+
+func (self *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return self.conn.ExecContext(ctx, self.query, args)
+}
+
+func (self *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return self.conn.QueryContext(ctx, self.query, args)
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return values
+}
+
+type result int64
+
+func (self result) LastInsertId() (int64, error) {
+	return 0, errors.New("taosRest does not support LastInsertId")
+}
+
+func (self result) RowsAffected() (int64, error) {
+	return int64(self), nil
+}
+
+type rows struct {
+	res *response
+	cfg *config
+	pos int
+}
+
+func (self *rows) Columns() []string {
+	names := make([]string, len(self.res.meta))
+	for i, c := range self.res.meta {
+		names[i] = c.name
+	}
+	return names
+}
+
+func (self *rows) ColumnTypeDatabaseTypeName(i int) string {
+	return self.res.meta[i].typ
+}
+
+func (self *rows) Close() error {
+	return nil
+}
+
+func (self *rows) Next(dest []driver.Value) error {
+	if self.pos >= len(self.res.data) {
+		return io.EOF
+	}
+	row := self.res.data[self.pos]
+	self.pos++
+	for i, c := range self.res.meta {
+		if i >= len(row) || row[i] == nil {
+			dest[i] = nil
+			continue
+		}
+		v, err := self.convert(c, row[i])
+		if err != nil {
+			return err
+		}
+		dest[i] = v
+	}
+	return nil
+}
+
+// convert converts a JSON value to the type of taosSql
+func (self *rows) convert(c *column, v interface{}) (driver.Value, error) {
+	switch c.typ {
+	case "BOOL":
+		switch u := v.(type) {
+		case bool:
+			return u, nil
+		case json.Number:
+			return u.String() != "0", nil
+		default:
+		}
+	case "TINYINT", "INT", "SMALLINT", "BIGINT", "TINYINT UNSIGNED", "SMALLINT UNSIGNED", "INT UNSIGNED", "BIGINT UNSIGNED":
+		num, ok := v.(json.Number)
+		if !ok {
+			break
+		}
+		n, err := num.Int64()
+		if err != nil {
+			return nil, err
+		}
+		switch c.typ {
+		case "TINYINT", "INT":
+			return int(n), nil
+		case "SMALLINT":
+			return int16(n), nil
+		default:
+		}
+		return n, nil
+	case "FLOAT", "DOUBLE":
+		num, ok := v.(json.Number)
+		if !ok {
+			break
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return nil, err
+		}
+		if c.typ == "FLOAT" {
+			return float32(f), nil
+		}
+		return f, nil
+	case "TIMESTAMP":
+		return self.timestamp(v)
+	default:
+		if s, ok := v.(string); ok {
+			if self.cfg.pad {
+				s += "\x00\x00"
+			}
+			return s, nil
+		}
+	}
+	if num, ok := v.(json.Number); ok {
+		return num.String(), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+var timeFormats = []string{"2006-01-02 15:04:05", time.RFC3339Nano}
+
+// timestamp returns a time string as 2.x in local time, or an integer
+// in the precision given by the digits of fraction if parseTime=false.
+func (self *rows) timestamp(v interface{}) (driver.Value, error) {
+	if num, ok := v.(json.Number); ok {
+		return num.Int64()
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, errors.New("invalid timestamp")
+	}
+	var t time.Time
+	var err error
+	for _, f := range timeFormats {
+		if t, err = time.ParseInLocation(f, s, time.Local); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	digits := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		for j := i + 1; j < len(s) && s[j] >= '0' && s[j] <= '9'; j++ {
+			digits++
+		}
+	}
+	if self.cfg.parseTime {
+		return t.Local().Format("2006-01-02 15:04:05." + strings.Repeat("0", digits)), nil
+	}
+	switch {
+	case digits <= 3:
+		return t.UnixNano() / int64(time.Millisecond), nil
+	case digits <= 6:
+		return t.UnixNano() / int64(time.Microsecond), nil
+	default:
+	}
+	return t.UnixNano(), nil
+}
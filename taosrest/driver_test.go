@@ -0,0 +1,204 @@
+package taosrest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/genelet/taodbi/taodbitest"
+)
+
+func openREST(t *testing.T, params string) (*sql.DB, func()) {
+	server := httptest.NewServer(&taodbitest.RESTHandler{User: "root", Password: "taosdata"})
+	address := strings.TrimPrefix(server.URL, "http://")
+	db, err := sql.Open("taosRest", "root:taosdata@/http("+address+")/"+params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`drop database if exists restdb`,
+		`create database restdb precision "us"`,
+		`use restdb`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, func() { db.Close(); server.Close() }
+}
+
+func TestParseDSN(t *testing.T) {
+	cfg, err := parseDSN("root:tao@data@https(h:6041)/demodb?parseTime=false&pad=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.user != "root" || cfg.password != "tao@data" || cfg.url != "https://h:6041/rest/sql" ||
+		cfg.db != "demodb" || cfg.parseTime || cfg.pad {
+		t.Errorf("%#v", cfg)
+	}
+	if cfg, err = parseDSN("root@/http(h:6041)/"); err != nil || cfg.url != "http://h:6041/rest/sql" || cfg.db != "" {
+		t.Errorf("%#v %v", cfg, err)
+	}
+	if cfg, err = parseDSN("/"); err != nil || cfg.url != "http://localhost:6041/rest/sql" || !cfg.parseTime || !cfg.pad {
+		t.Errorf("%#v %v", cfg, err)
+	}
+	for _, dsn := range []string{"root@tcp(h:6030)/", "root@http(h:6041", "root@http(h:6041)db"} {
+		if _, err := parseDSN(dsn); err == nil {
+			t.Errorf("%s: error expected", dsn)
+		}
+	}
+}
+
+func TestRESTTypes(t *testing.T) {
+	db, done := openREST(t, "?parseTime=false")
+	defer done()
+
+	if _, err := db.Exec(`create table t1 (ts timestamp, a tinyint, b smallint, c int, d bigint, e float, f double, g bool, h binary(8), i nchar(4))`); err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.Exec(`insert into t1 values (1600000000000000, 1, 2, 3, 4, 5.5, 6.5, true, ?, 'ab') (1600000000000001, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL)`, "'x\"y'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("%d", n)
+	}
+
+	rows, err := db.Query(`select * from t1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, _ := rows.ColumnTypes()
+	if types[0].DatabaseTypeName() != "TIMESTAMP" || types[8].DatabaseTypeName() != "BINARY" {
+		t.Errorf("%s %s", types[0].DatabaseTypeName(), types[8].DatabaseTypeName())
+	}
+	values := make([]interface{}, 10)
+	pointers := make([]interface{}, 10)
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if !rows.Next() {
+		t.Fatal("no row")
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		t.Fatal(err)
+	}
+	if values[0] != int64(1600000000000000) || values[1] != 1 || values[2] != int16(2) ||
+		values[3] != 3 || values[4] != int64(4) || values[5] != float32(5.5) ||
+		values[6] != 6.5 || values[7] != true || values[8] != "x\"y\x00\x00" || values[9] != "ab\x00\x00" {
+		t.Errorf("%#v", values)
+	}
+	if !rows.Next() {
+		t.Fatal("no second row")
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range values[1:] {
+		if v != nil {
+			t.Errorf("%#v", values)
+		}
+	}
+}
+
+func TestRESTErrors(t *testing.T) {
+	db, done := openREST(t, "?parseTime=false")
+	defer done()
+
+	_, err := db.Exec(`insert into nosuch values (now, 1)`)
+	if err == nil || !strings.HasPrefix(err.Error(), "[0x0362] ") {
+		t.Errorf("%v", err)
+	}
+	if _, err := db.Exec(`use nosuchdb`); err == nil {
+		t.Errorf("invalid database expected")
+	}
+	// the failed USE keeps the database
+	if _, err := db.Exec(`create table t2 (ts timestamp, x int)`); err != nil {
+		t.Error(err)
+	}
+
+	bad, err := sql.Open("taosRest", "root:wrong@http(127.0.0.1:1)/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bad.Close()
+	if err := bad.Ping(); err == nil {
+		t.Errorf("connection error expected")
+	}
+}
+
+func TestRESTConnErrors(t *testing.T) {
+	// a closed port is never reached: safe to retry
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	c, err := (&Driver{}).Open("root:taosdata@/http(" + address + ")/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.(*conn).do(context.Background(), "show databases"); err != driver.ErrBadConn {
+		t.Errorf("%v", err)
+	}
+
+	// a statement sent but not answered may have run
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hijacked, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			hijacked.Close()
+		}
+	}))
+	defer server.Close()
+	c, err = (&Driver{}).Open("root:taosdata@/http(" + strings.TrimPrefix(server.URL, "http://") + ")/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.(*conn).do(context.Background(), "insert into t values (now, 1)"); err == nil || errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.(*conn).do(ctx, "show databases"); err != context.Canceled {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestRESTVersion3(t *testing.T) {
+	defer func(v string) { taodbitest.Version = v }(taodbitest.Version)
+	taodbitest.Version = "3.0.2.0"
+	db, done := openREST(t, "?pad=false")
+	defer done()
+
+	for _, s := range []string{
+		`create stable st (ts timestamp, x int, y varchar(8)) tags (loc varchar(8))`,
+		`insert into c1 using st tags ('a') values (1600000000000001, 1, 'one')`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ts, y, version string
+	if err := db.QueryRow(`select ts, y from c1 where x=?`, 1).Scan(&ts, &y); err != nil {
+		t.Fatal(err)
+	}
+	if ts != "2020-09-13 12:26:40.000001" && !strings.HasSuffix(ts, ":26:40.000001") || y != "one" {
+		t.Errorf("%q %q", ts, y)
+	}
+	if err := db.QueryRow(`select server_version()`).Scan(&version); err != nil || version != "3.0.2.0" {
+		t.Errorf("%q %v", version, err)
+	}
+	_, err := db.Exec(`insert into nosuch values (now, 1)`)
+	if err == nil || !strings.HasPrefix(err.Error(), "[0x0362] ") {
+		t.Errorf("%v", err)
+	}
+}
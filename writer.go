@@ -0,0 +1,169 @@
+package taodbi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RowInserter writes rows in batch, as InsertRows of Model and Smodel
+type RowInserter interface {
+	InsertRows(rows []map[string]interface{}) error
+}
+
+// WriterOptions configures BufferedWriter
+type WriterOptions struct {
+	// BatchSize is the number of rows flushed in a statement, default 1000
+	BatchSize int
+	// FlushInterval is the longest time a row waits, default 1s
+	FlushInterval time.Duration
+	// Capacity is the number of rows queued before Write blocks,
+	// default BatchSize
+	Capacity int
+	// OnError is called with the rows of a batch failed and the error.
+	// It is called in the writing goroutine, so it should not block long.
+	// Without OnError, the rows of a failed batch are lost.
+	OnError func(rows []map[string]interface{}, err error)
+}
+
+// BufferedWriter writes rows in the background. Rows are queued, and
+// flushed by the RowInserter when BatchSize rows are buffered or every
+// FlushInterval, in a multi-table INSERT grouped by child tables for
+// Smodel. Write blocks when the queue is full. The first error of the
+// batches is returned by the next Flush or Close.
+//
+type BufferedWriter struct {
+	inserter RowInserter
+	opts     WriterOptions
+	rows     chan map[string]interface{}
+	flushes  chan chan error
+	done     chan struct{}
+	// err is the first error since the last Flush, owned by run
+	err      error
+	closed   bool
+	sync.RWMutex
+}
+
+// NewBufferedWriter starts a BufferedWriter of 'inserter', e.g.
+// a model, with 'opts' which may be nil.
+//
+func NewBufferedWriter(inserter RowInserter, opts *WriterOptions) *BufferedWriter {
+	self := &BufferedWriter{inserter: inserter}
+	if opts != nil {
+		self.opts = *opts
+	}
+	if self.opts.BatchSize <= 0 {
+		self.opts.BatchSize = 1000
+	}
+	if self.opts.FlushInterval <= 0 {
+		self.opts.FlushInterval = time.Second
+	}
+	if self.opts.Capacity <= 0 {
+		self.opts.Capacity = self.opts.BatchSize
+	}
+	self.rows = make(chan map[string]interface{}, self.opts.Capacity)
+	self.flushes = make(chan chan error)
+	self.done = make(chan struct{})
+	go self.run()
+	return self
+}
+
+// Write queues 'row', waiting while the queue is full. The row should
+// not be changed afterwards.
+func (self *BufferedWriter) Write(row map[string]interface{}) error {
+	return self.WriteContext(context.Background(), row)
+}
+
+// WriteContext queues 'row' as Write, unless 'ctx' is done while waiting
+func (self *BufferedWriter) WriteContext(ctx context.Context, row map[string]interface{}) error {
+	self.RLock()
+	defer self.RUnlock()
+	if self.closed {
+		return ErrWriterClosed
+	}
+	select {
+	case self.rows <- row:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush writes the rows queued, waits for them to be written, and
+// returns the first error of the batches since the last Flush
+func (self *BufferedWriter) Flush() error {
+	self.RLock()
+	defer self.RUnlock()
+	if self.closed {
+		return ErrWriterClosed
+	}
+	ack := make(chan error)
+	self.flushes <- ack
+	return <-ack
+}
+
+// Close stops accepting rows, waits for those queued to be written, and
+// returns the first error of the batches since the last Flush
+func (self *BufferedWriter) Close() error {
+	self.Lock()
+	closing := !self.closed
+	if closing {
+		self.closed = true
+		close(self.rows)
+	}
+	self.Unlock()
+	<-self.done
+	if !closing {
+		return nil
+	}
+	return self.err
+}
+
+func (self *BufferedWriter) run() {
+	defer close(self.done)
+	ticker := time.NewTicker(self.opts.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]map[string]interface{}, 0, self.opts.BatchSize)
+	add := func(row map[string]interface{}) {
+		batch = append(batch, row)
+		if len(batch) >= self.opts.BatchSize {
+			batch = self.flush(batch)
+		}
+	}
+	for {
+		select {
+		case row, ok := <-self.rows:
+			if !ok {
+				self.flush(batch)
+				return
+			}
+			add(row)
+		case <-ticker.C:
+			batch = self.flush(batch)
+		case ack := <-self.flushes:
+			for n := len(self.rows); n > 0; n-- {
+				add(<-self.rows)
+			}
+			batch = self.flush(batch)
+			ack <- self.err
+			self.err = nil
+		}
+	}
+}
+
+// flush writes 'batch', reporting it to OnError if failed, and returns
+// a new batch
+func (self *BufferedWriter) flush(batch []map[string]interface{}) []map[string]interface{} {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := self.inserter.InsertRows(batch); err != nil {
+		if self.err == nil {
+			self.err = err
+		}
+		if self.opts.OnError != nil {
+			self.opts.OnError(batch, err)
+		}
+	}
+	return make([]map[string]interface{}, 0, self.opts.BatchSize)
+}
@@ -0,0 +1,192 @@
+package taodbi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genelet/taodbi/taodbitest"
+)
+
+// blockedInserter counts rows, waiting for 'release' before each batch
+type blockedInserter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	rows    int
+}
+
+func (self *blockedInserter) InsertRows(rows []map[string]interface{}) error {
+	<-self.release
+	self.mu.Lock()
+	self.rows += len(rows)
+	self.mu.Unlock()
+	return nil
+}
+
+func TestBufferedWriter(t *testing.T) {
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	smodel, err := NewSmodel("ms.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smodel.SetDB(db)
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS stesting",
+		"CREATE TABLE stesting (id timestamp, x binary(8), y binary(8), z binary(8)) TAGS (pubid int, location binary(8))",
+	} {
+		if err := smodel.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writer := NewBufferedWriter(smodel, &WriterOptions{BatchSize: 10, FlushInterval: time.Hour})
+	start := time.Unix(1600000000, 0)
+	for i := 0; i < 25; i++ {
+		row := map[string]interface{}{"id": start.Add(time.Duration(i) * time.Second), "x": "a", "pubid": i % 3, "location": "here"}
+		if err := writer.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	count := func() int64 {
+		lists := make([]map[string]interface{}, 0)
+		if err := smodel.SelectSQLType(&lists, []string{"int64"}, "SELECT COUNT(*) FROM stesting"); err != nil {
+			t.Fatal(err)
+		}
+		if len(lists) == 0 {
+			return 0
+		}
+		for _, v := range lists[0] {
+			return v.(int64)
+		}
+		return 0
+	}
+	if n := count(); n != 25 {
+		t.Errorf("%d rows flushed", n)
+	}
+
+	writer.Write(map[string]interface{}{"id": start.Add(time.Minute), "x": "b", "pubid": 1, "location": "here"})
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 26 {
+		t.Errorf("%d rows drained", n)
+	}
+	if err := writer.Write(map[string]interface{}{}); err != ErrWriterClosed {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestBufferedWriterError(t *testing.T) {
+	fakeOnly(t)
+	db, err := open(testDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer taodbitest.SetFault(nil)
+	model, err := NewModel("m1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.SetDB(db)
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS atesting",
+		"CREATE TABLE atesting (id timestamp, x binary(8), y binary(8), z binary(8))",
+	} {
+		if err := model.DoSQL(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var failed []map[string]interface{}
+	var failure error
+	writer := NewBufferedWriter(model, &WriterOptions{
+		BatchSize:     2,
+		FlushInterval: 10 * time.Millisecond,
+		OnError: func(rows []map[string]interface{}, err error) {
+			failed, failure = rows, err
+		},
+	})
+	taodbitest.SetFault(taodbitest.FailTimes(1, "INSERT", taodbitest.ErrNetwork))
+	writer.Write(map[string]interface{}{"id": 1600000000000000, "x": "a"})
+	writer.Write(map[string]interface{}{"id": 1600000001000000, "x": "b"})
+	writer.Write(map[string]interface{}{"id": 1600000002000000, "x": "c"})
+	// the last row is flushed by the interval
+	time.Sleep(50 * time.Millisecond)
+	if err := writer.Close(); ErrorCode(err) != CodeNetworkUnavailable {
+		t.Errorf("first error not returned: %v", err)
+	}
+	if len(failed) != 2 || failed[1]["x"] != "b" || ErrorCode(failure) != CodeNetworkUnavailable {
+		t.Errorf("%v %v", failed, failure)
+	}
+	lists := make([]map[string]interface{}, 0)
+	if err := model.SelectSQL(&lists, "SELECT x FROM atesting"); err != nil || len(lists) != 1 || lists[0]["x"] != "c" {
+		t.Errorf("%v %v", lists, err)
+	}
+}
+
+// failingInserter fails the first 'fails' batches
+type failingInserter struct {
+	fails int
+	rows  int
+}
+
+func (self *failingInserter) InsertRows(rows []map[string]interface{}) error {
+	if self.fails > 0 {
+		self.fails--
+		return errors.New("batch failed")
+	}
+	self.rows += len(rows)
+	return nil
+}
+
+func TestBufferedWriterFlushError(t *testing.T) {
+	inserter := &failingInserter{fails: 1}
+	writer := NewBufferedWriter(inserter, &WriterOptions{BatchSize: 10, FlushInterval: time.Hour})
+	writer.Write(map[string]interface{}{"i": 0})
+	if err := writer.Flush(); err == nil || err.Error() != "batch failed" {
+		t.Errorf("%v", err)
+	}
+	writer.Write(map[string]interface{}{"i": 1})
+	if err := writer.Flush(); err != nil {
+		t.Errorf("%v", err)
+	}
+	if err := writer.Close(); err != nil || inserter.rows != 1 {
+		t.Errorf("%d %v", inserter.rows, err)
+	}
+	if err := writer.Flush(); err != ErrWriterClosed {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestBufferedWriterBackpressure(t *testing.T) {
+	inserter := &blockedInserter{release: make(chan struct{})}
+	writer := NewBufferedWriter(inserter, &WriterOptions{BatchSize: 1, Capacity: 2, FlushInterval: time.Hour})
+
+	// one row is being inserted, and two are queued
+	for i := 0; i < 3; i++ {
+		if err := writer.Write(map[string]interface{}{"i": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := writer.WriteContext(ctx, map[string]interface{}{"i": 3}); err != context.DeadlineExceeded {
+		t.Errorf("full queue not blocking: %v", err)
+	}
+
+	close(inserter.release)
+	writer.Close()
+	if inserter.rows != 3 {
+		t.Errorf("%d", inserter.rows)
+	}
+}